@@ -0,0 +1,117 @@
+// Client RADIUS thử nghiệm (giả lập hotspot MikroTik gửi tới server trong backend):
+//
+//	go run ./cmd/radius-client -secret testing123 -nas IMO9562623 -user VOU-12345 -pass VOU-12345
+//	go run ./cmd/radius-client -secret testing123 -nas IMO9562623 -user crew01 -pass 123 -chap -acct -bytes 5000000
+//
+// -acct: sau khi được chấp nhận, gửi Acct-Start, Interim-Update (nửa lưu lượng) và Stop (đủ lưu lượng)
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"marine-backend/radius"
+)
+
+func main() {
+	server := flag.String("server", "127.0.0.1:1812", "Địa chỉ RADIUS xác thực")
+	acctServer := flag.String("acct-server", "127.0.0.1:1813", "Địa chỉ RADIUS accounting")
+	secret := flag.String("secret", "", "Shared secret")
+	nas := flag.String("nas", "", "NAS-Identifier (mã tàu)")
+	user := flag.String("user", "", "Tên đăng nhập / mã voucher")
+	pass := flag.String("pass", "", "Mật khẩu")
+	chap := flag.Bool("chap", false, "Dùng CHAP thay cho PAP")
+	acct := flag.Bool("acct", false, "Gửi accounting Start / Interim / Stop sau khi đăng nhập")
+	total := flag.Int64("bytes", 10<<20, "Tổng byte (tải về) báo trong accounting")
+	flag.Parse()
+	if *secret == "" || *user == "" {
+		log.Fatal("Cần -secret và -user")
+	}
+	key := []byte(*secret)
+
+	req := &radius.Packet{Code: radius.AccessRequest, Identifier: 1}
+	rand.Read(req.Authenticator[:])
+	req.AddString(radius.AttrUserName, *user)
+	req.AddString(radius.AttrNASIdentifier, *nas)
+	req.AddString(radius.AttrCallingStationID, "02:00:00:00:00:01")
+	if *chap {
+		challenge := make([]byte, 16)
+		rand.Read(challenge)
+		req.Add(radius.AttrCHAPPassword, radius.CHAPResponse(7, []byte(*pass), challenge))
+		req.Add(radius.AttrCHAPChallenge, challenge)
+	} else {
+		req.Add(radius.AttrUserPassword, radius.EncryptPassword([]byte(*pass), key, req.Authenticator))
+	}
+
+	reply := exchange(*server, req.EncodeRequest(key))
+	switch reply.Code {
+	case radius.AccessAccept:
+		fmt.Println("✅ Access-Accept")
+	case radius.AccessReject:
+		fmt.Println("🚫 Access-Reject:", reply.String(radius.AttrReplyMessage))
+		return
+	default:
+		log.Fatalf("Mã trả lời lạ: %d", reply.Code)
+	}
+	if v := reply.Vendor(radius.VendorMikrotik, radius.MikrotikRateLimit); v != nil {
+		fmt.Println("   Mikrotik-Rate-Limit:", string(v))
+	}
+	if v := reply.Vendor(radius.VendorMikrotik, radius.MikrotikGroup); v != nil {
+		fmt.Println("   Mikrotik-Group:", string(v))
+	}
+	if t := reply.Uint32(radius.AttrSessionTimeout); t > 0 {
+		fmt.Println("   Session-Timeout:", time.Duration(t)*time.Second)
+	}
+	if !*acct {
+		return
+	}
+
+	sessionID := fmt.Sprintf("%08x", time.Now().Unix())
+	steps := []struct {
+		status uint32
+		name   string
+		bytes  int64
+	}{{radius.AcctStart, "Start", 0}, {radius.AcctInterim, "Interim-Update", *total / 2}, {radius.AcctStop, "Stop", *total}}
+	for i, s := range steps {
+		p := &radius.Packet{Code: radius.AccountingRequest, Identifier: byte(10 + i)}
+		p.AddUint32(radius.AttrAcctStatusType, s.status)
+		p.AddString(radius.AttrUserName, *user)
+		p.AddString(radius.AttrNASIdentifier, *nas)
+		p.AddString(radius.AttrAcctSessionID, sessionID)
+		p.Add(radius.AttrFramedIPAddress, net.ParseIP("10.5.50.99").To4())
+		p.AddUint32(radius.AttrAcctSessionTime, uint32(i*60))
+		p.AddUint32(radius.AttrAcctInputOctets, uint32(s.bytes/5))
+		p.AddUint32(radius.AttrAcctOutputOctets, uint32(s.bytes))
+		resp := exchange(*acctServer, p.EncodeAccounting(key))
+		if resp.Code != radius.AccountingResponse {
+			log.Fatalf("Accounting %s: mã trả lời lạ %d", s.name, resp.Code)
+		}
+		fmt.Println("📊 Accounting", s.name, "OK")
+	}
+}
+
+func exchange(addr string, pkt []byte) *radius.Packet {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(pkt); err != nil {
+		log.Fatal(err)
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		log.Fatal("Không nhận được trả lời (sai secret hoặc NAS chưa khai báo?): ", err)
+	}
+	reply, err := radius.Parse(buf[:n])
+	if err != nil {
+		log.Fatal(err)
+	}
+	return reply
+}
@@ -0,0 +1,38 @@
+// Stub thiết bị vệ tinh để thử adapter mà không cần dish / modem thật:
+//
+//	go run ./cmd/terminal-stub
+//
+// Sau đó cấu hình tàu: starlink -> 127.0.0.1:9201, idirect -> 127.0.0.1:8081, snmp -> 127.0.0.1:1161 (community "public")
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"marine-backend/terminals"
+)
+
+func main() {
+	starlinkAddr := flag.String("starlink", ":9201", "Địa chỉ gRPC-Web giả lập dish Starlink (rỗng = tắt)")
+	idirectAddr := flag.String("idirect", ":8081", "Địa chỉ HTTP giả lập modem iDirect (rỗng = tắt)")
+	idirectToken := flag.String("idirect-token", "", "Bearer token modem yêu cầu (rỗng = không kiểm tra)")
+	snmpAddr := flag.String("snmp", ":1161", "Địa chỉ UDP giả lập modem SNMP (rỗng = tắt)")
+	community := flag.String("community", "public", "SNMP community")
+	flag.Parse()
+
+	errs := make(chan error, 3)
+	if *starlinkAddr != "" {
+		go func() { errs <- http.ListenAndServe(*starlinkAddr, terminals.StarlinkStubHandler()) }()
+		log.Println("🛰️ Starlink stub (gRPC-Web):", *starlinkAddr)
+	}
+	if *idirectAddr != "" {
+		go func() { errs <- http.ListenAndServe(*idirectAddr, terminals.IDirectStubHandler(*idirectToken)) }()
+		log.Println("📡 iDirect stub (HTTP):", *idirectAddr)
+	}
+	if *snmpAddr != "" {
+		go func() { errs <- terminals.ServeSNMPStub(*snmpAddr, *community) }()
+		log.Println("📟 SNMP stub (UDP):", *snmpAddr)
+	}
+	log.Fatal(<-errs)
+}
@@ -0,0 +1,411 @@
+package controllers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"marine-backend/database"
+	"marine-backend/models"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Nhận NMEA 0183 / AIS qua UDP, TCP hoặc file ghi sẵn (replay)
+// - !AIVDM / !AIVDO type 1/2/3/5: khớp tàu theo MMSI (hoặc IMO trong type 5)
+// - $--RMC / $--GGA: khớp tàu theo địa chỉ nguồn (Ship.NmeaSource)
+
+type aisFragmentKey struct {
+	source, seq, channel string
+}
+
+type aisFragments struct {
+	parts    []string
+	received int
+	fill     int
+	at       time.Time
+}
+
+type nmeaFeed struct {
+	mu        sync.Mutex
+	fragments map[aisFragmentKey]*aisFragments
+	lastFix   map[string]time.Time // Thời điểm vị trí AIS cuối đã lưu theo tàu
+
+	// Thống kê
+	Sentences     int64
+	Decoded       int64
+	Matched       int64
+	Errors        int64
+	LastMessageAt time.Time
+}
+
+var aisFeed = &nmeaFeed{
+	fragments: make(map[aisFragmentKey]*aisFragments),
+	lastFix:   make(map[string]time.Time),
+}
+
+// Khoảng cách tối thiểu giữa 2 điểm AIS được lưu (AIS phát 2-10 giây/lần)
+func aisMinInterval() time.Duration { return envSeconds("AIS_MIN_INTERVAL", 30*time.Second) }
+
+// Đọc thời gian từ tag block (\c:1700000000*hh\) nếu có, dùng khi replay file ghi sẵn
+func nmeaTagTime(line string) (time.Time, bool) {
+	if !strings.HasPrefix(line, "\\") {
+		return time.Time{}, false
+	}
+	end := strings.Index(line[1:], "\\")
+	if end < 0 {
+		return time.Time{}, false
+	}
+	tag := line[1 : end+1]
+	if star := strings.Index(tag, "*"); star >= 0 {
+		tag = tag[:star]
+	}
+	for _, kv := range strings.Split(tag, ",") {
+		if strings.HasPrefix(kv, "c:") {
+			if v, err := strconv.ParseInt(kv[2:], 10, 64); err == nil {
+				if v > 1e12 { // mili giây
+					return time.UnixMilli(v), true
+				}
+				return time.Unix(v, 0), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Xử lý 1 dòng NMEA từ nguồn (IP gửi hoặc "replay:<ship_id>")
+func (f *nmeaFeed) handleLine(source, line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	at, ok := nmeaTagTime(line)
+	if !ok {
+		at = time.Now()
+	}
+
+	f.mu.Lock()
+	f.Sentences++
+	f.LastMessageAt = time.Now()
+	f.mu.Unlock()
+
+	s, err := parseNMEA(line)
+	if err != nil {
+		f.countError()
+		return
+	}
+
+	switch s.Type {
+	case "VDM", "VDO":
+		bits, complete, err := f.assemble(source, s)
+		if err != nil {
+			f.countError()
+			return
+		}
+		if !complete {
+			return
+		}
+		msg, err := decodeAISMessage(bits)
+		if err != nil {
+			f.countError()
+			return
+		}
+		f.mu.Lock()
+		f.Decoded++
+		f.mu.Unlock()
+		f.applyAIS(source, s.Type == "VDO", msg, at)
+
+	case "RMC", "GGA":
+		ship, ok := shipByNmeaSource(source)
+		if !ok {
+			return
+		}
+		fix, err := nmeaToPosition(s, at)
+		if err != nil {
+			f.countError()
+			return
+		}
+		f.mu.Lock()
+		f.Decoded++
+		f.mu.Unlock()
+		if f.shouldRecord(ship.ID, fix.RecordedAt) {
+			recordShipPosition(ship.ID, fix)
+		}
+	}
+}
+
+func (f *nmeaFeed) countError() {
+	f.mu.Lock()
+	f.Errors++
+	f.mu.Unlock()
+}
+
+// Ghép các mảnh !AIVDM,count,num,seq,channel,payload,fill
+func (f *nmeaFeed) assemble(source string, s nmeaSentence) (aisBits, bool, error) {
+	if len(s.Fields) < 6 {
+		return nil, false, fmt.Errorf("AIVDM thiếu trường")
+	}
+	count, err1 := strconv.Atoi(s.Fields[0])
+	num, err2 := strconv.Atoi(s.Fields[1])
+	fill, _ := strconv.Atoi(s.Fields[5])
+	if err1 != nil || err2 != nil || count < 1 || num < 1 || num > count || count > 9 {
+		return nil, false, fmt.Errorf("số mảnh không hợp lệ")
+	}
+	if count == 1 {
+		bits, err := decodeAISPayload(s.Fields[4], fill)
+		return bits, err == nil, err
+	}
+
+	key := aisFragmentKey{source: source, seq: s.Fields[2], channel: s.Fields[3]}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Dọn các bản tin ghép dở quá 30 giây
+	for k, v := range f.fragments {
+		if time.Since(v.at) > 30*time.Second {
+			delete(f.fragments, k)
+		}
+	}
+
+	frag, ok := f.fragments[key]
+	if !ok || len(frag.parts) != count || num == 1 {
+		frag = &aisFragments{parts: make([]string, count), at: time.Now()}
+		f.fragments[key] = frag
+	}
+	if frag.parts[num-1] == "" {
+		frag.received++
+	}
+	frag.parts[num-1] = s.Fields[4]
+	if num == count {
+		frag.fill = fill
+	}
+	if frag.received < count {
+		return nil, false, nil
+	}
+	delete(f.fragments, key)
+	bits, err := decodeAISPayload(strings.Join(frag.parts, ""), frag.fill)
+	return bits, err == nil, err
+}
+
+// Giới hạn tần suất lưu vị trí cho mỗi tàu
+func (f *nmeaFeed) shouldRecord(shipID string, at time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	last, ok := f.lastFix[shipID]
+	if ok && at.After(last) && at.Sub(last) < aisMinInterval() {
+		return false
+	}
+	f.lastFix[shipID] = at
+	return true
+}
+
+// Nguồn phát lại của Admin: "replay:<ship_id>" gắn thẳng vào tàu đã chọn, không bao giờ khớp NmeaSource của tàu thật
+const nmeaReplayPrefix = "replay:"
+
+func shipByNmeaSource(source string) (models.Ship, bool) {
+	var ship models.Ship
+	if source == "" {
+		return ship, false
+	}
+	if shipID, ok := strings.CutPrefix(source, nmeaReplayPrefix); ok {
+		if shipID == "" {
+			return ship, false
+		}
+		err := database.DB.Where("id = ?", shipID).First(&ship).Error
+		return ship, err == nil
+	}
+	err := database.DB.Where("nmea_source = ?", source).First(&ship).Error
+	return ship, err == nil
+}
+
+// Cập nhật tàu từ bản tin AIS
+func (f *nmeaFeed) applyAIS(source string, own bool, msg aisMessage, at time.Time) {
+	var ship models.Ship
+	found := database.DB.Where("mmsi = ?", msg.MMSI).First(&ship).Error == nil
+	if !found && msg.Type == 5 && msg.IMO != "" {
+		// Lần đầu thấy MMSI: khớp theo số IMO rồi ghi nhớ MMSI
+		if database.DB.Where("id IN ?", []string{"IMO" + msg.IMO, msg.IMO}).First(&ship).Error == nil {
+			found = true
+			database.DB.Model(&models.Ship{}).Where("id = ?", ship.ID).Update("mmsi", msg.MMSI)
+		}
+	}
+	if !found && own {
+		ship, found = shipByNmeaSource(source)
+		if found && ship.MMSI == "" {
+			database.DB.Model(&models.Ship{}).Where("id = ?", ship.ID).Update("mmsi", msg.MMSI)
+		}
+	}
+	if !found {
+		return
+	}
+
+	f.mu.Lock()
+	f.Matched++
+	f.mu.Unlock()
+
+	switch msg.Type {
+	case 1, 2, 3:
+		updates := map[string]interface{}{"nav_status": msg.NavStatus}
+		if msg.Heading != nil {
+			updates["heading"] = *msg.Heading
+		}
+		database.DB.Model(&models.Ship{}).Where("id = ?", ship.ID).Updates(updates)
+		if msg.Lat != nil && f.shouldRecord(ship.ID, at) {
+			recordShipPosition(ship.ID, PositionFix{
+				Lat: *msg.Lat, Lon: *msg.Lon, SpeedKn: msg.SpeedKn, Course: msg.Course,
+				RecordedAt: at, Source: "ais",
+			})
+		}
+	case 5:
+		updates := map[string]interface{}{
+			"call_sign": msg.CallSign, "destination": msg.Destination, "draught": msg.Draught,
+		}
+		if eta := msg.eta(at); eta != nil {
+			updates["eta"] = *eta
+		}
+		if ship.Name == "" {
+			updates["name"] = msg.Name
+		}
+		database.DB.Model(&models.Ship{}).Where("id = ?", ship.ID).Updates(updates)
+	}
+}
+
+// --- LISTENER ---
+
+// Khởi động listener theo cấu hình: AIS_UDP_ADDR, AIS_TCP_ADDR, AIS_REPLAY_FILE
+func StartAISListener() {
+	if addr := os.Getenv("AIS_UDP_ADDR"); addr != "" {
+		go listenNMEAUDP(addr)
+	}
+	if addr := os.Getenv("AIS_TCP_ADDR"); addr != "" {
+		go listenNMEATCP(addr)
+	}
+	if path := os.Getenv("AIS_REPLAY_FILE"); path != "" {
+		go func() {
+			if _, err := ReplayNMEAFile(path, nmeaReplayPrefix); err != nil {
+				fmt.Println("⚠️ Lỗi replay NMEA:", err)
+			}
+		}()
+	}
+}
+
+func listenNMEAUDP(addr string) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		fmt.Println("❌ Không mở được cổng UDP NMEA:", err)
+		return
+	}
+	defer conn.Close()
+	fmt.Println("📡 NMEA/AIS UDP listening on", addr)
+
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			continue
+		}
+		host, _, _ := net.SplitHostPort(from.String())
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			aisFeed.handleLine(host, line)
+		}
+	}
+}
+
+func listenNMEATCP(addr string) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Println("❌ Không mở được cổng TCP NMEA:", err)
+		return
+	}
+	defer ln.Close()
+	fmt.Println("📡 NMEA/AIS TCP listening on", addr)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			continue
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+			readNMEAStream(conn, host)
+		}(conn)
+	}
+}
+
+func readNMEAStream(r io.Reader, source string) int {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	lines := 0
+	for scanner.Scan() {
+		aisFeed.handleLine(source, scanner.Text())
+		lines++
+	}
+	return lines
+}
+
+// Phát lại file NMEA ghi sẵn (mỗi dòng 1 câu, có thể kèm tag block c:)
+func ReplayNMEAFile(path, source string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return readNMEAStream(file, source), nil
+}
+
+// --- CÁC API ---
+
+// GET /api/ais/status
+func GetAISStatus(c *gin.Context) {
+	aisFeed.mu.Lock()
+	defer aisFeed.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{
+		"sentences": aisFeed.Sentences, "decoded": aisFeed.Decoded,
+		"matched": aisFeed.Matched, "errors": aisFeed.Errors,
+		"last_message_at": aisFeed.LastMessageAt, "pending_fragments": len(aisFeed.fragments),
+	})
+}
+
+// POST /api/ais/replay (multipart: file, ship_id) : phát lại file NMEA để kiểm thử (chỉ Admin)
+// ship_id = tàu nhận câu GPS $--RMC/$--GGA và !AIVDO; bỏ trống thì chỉ bản tin AIVDM khớp theo MMSI / IMO
+func ReplayNMEAUpload(c *gin.Context) {
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chưa chọn file"})
+		return
+	}
+	defer file.Close()
+
+	shipID := c.PostForm("ship_id")
+	if shipID != "" {
+		var count int64
+		database.DB.Model(&models.Ship{}).Where("id = ?", shipID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Không tìm thấy tàu"})
+			return
+		}
+	}
+	source := nmeaReplayPrefix + shipID
+
+	aisFeed.mu.Lock()
+	before := [3]int64{aisFeed.Decoded, aisFeed.Matched, aisFeed.Errors}
+	aisFeed.mu.Unlock()
+
+	lines := readNMEAStream(file, source)
+
+	aisFeed.mu.Lock()
+	after := [3]int64{aisFeed.Decoded, aisFeed.Matched, aisFeed.Errors}
+	aisFeed.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"lines": lines, "decoded": after[0] - before[0],
+		"matched": after[1] - before[1], "errors": after[2] - before[2],
+	})
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import "testing"
+
+func TestAISAssemble(t *testing.T) {
+	const (
+		single = "!AIVDM,1,1,,A,13u?etPv2;0n:dDPwUM1U1Cb069D,0*24"
+		part1  = "!AIVDM,2,1,1,A,55?MbV02;H;s<HtKR20EHE:0@T4@Dn2222222216L961O5Gf0NSQEp6ClRp8,0*1C"
+		part2  = "!AIVDM,2,2,1,A,88888888880,2*25"
+		other1 = "!AIVDM,2,1,2,B,55?MbV02;H;s<HtKR20EHE:0@T4@Dn2222222216L961O5Gf0NSQEp6ClRp8,0*1C"
+		other2 = "!AIVDM,2,2,2,B,88888888880,2*25"
+	)
+	type line struct{ source, text string }
+	tests := []struct {
+		name     string
+		lines    []line
+		complete []bool // Kết quả ghép sau từng dòng
+	}{
+		{"1 mảnh", []line{{"a", single}}, []bool{true}},
+		{"2 mảnh đúng thứ tự", []line{{"a", part1}, {"a", part2}}, []bool{false, true}},
+		{"mảnh 1 lặp lại bắt đầu bản tin mới", []line{{"a", part1}, {"a", part1}, {"a", part2}}, []bool{false, false, true}},
+		{"2 bản tin xen kẽ theo seq", []line{{"a", part1}, {"a", other1}, {"a", part2}, {"a", other2}}, []bool{false, false, true, true}},
+		{"khác nguồn không ghép chung", []line{{"a", part1}, {"b", part2}}, []bool{false, false}},
+		{"thiếu mảnh đầu", []line{{"a", part2}}, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &nmeaFeed{fragments: make(map[aisFragmentKey]*aisFragments)}
+			for i, l := range tt.lines {
+				s, err := parseNMEA(l.text)
+				if err != nil {
+					t.Fatalf("parseNMEA() error = %v", err)
+				}
+				bits, complete, err := f.assemble(l.source, s)
+				if err != nil {
+					t.Fatalf("dòng %d: assemble() error = %v", i+1, err)
+				}
+				if complete != tt.complete[i] {
+					t.Fatalf("dòng %d: complete = %v, want %v", i+1, complete, tt.complete[i])
+				}
+				if !complete {
+					continue
+				}
+				msg, err := decodeAISMessage(bits)
+				if err != nil || (msg.Type == 5 && msg.Name != "EVER DIADEM") {
+					t.Errorf("dòng %d: bản tin ghép = %+v, error = %v", i+1, msg, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAISAssembleInvalid(t *testing.T) {
+	tests := []struct {
+		name, line string
+	}{
+		{"số thứ tự lớn hơn số mảnh", "!AIVDM,2,3,1,A,88888888880,2"},
+		{"số mảnh bằng 0", "!AIVDM,0,1,1,A,88888888880,2"},
+		{"thiếu trường", "!AIVDM,1,1,,A"},
+		{"payload sai ký tự", "!AIVDM,1,1,,A,13u?etPvX,0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &nmeaFeed{fragments: make(map[aisFragmentKey]*aisFragments)}
+			s, err := parseNMEA(tt.line)
+			if err != nil {
+				t.Fatalf("parseNMEA() error = %v", err)
+			}
+			if _, complete, err := f.assemble("a", s); err == nil || complete {
+				t.Errorf("assemble() = complete %v, error %v; want lỗi", complete, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+func validateAllowancePolicy(p *models.AllowancePolicy) string {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return "Thiếu tên chính sách"
+	}
+	if p.AllowanceMB <= 0 {
+		return "Dung lượng phụ cấp phải lớn hơn 0"
+	}
+	for _, id := range splitList(p.ShipIDs) {
+		var count int64
+		database.DB.Model(&models.Ship{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			return "Tàu không tồn tại: " + id
+		}
+	}
+	p.ShipIDs = strings.Join(splitList(p.ShipIDs), ",")
+	p.Ranks = strings.Join(splitList(p.Ranks), ",")
+	return ""
+}
+
+func rankTargeted(ranks, rank string) bool {
+	if ranks == "" {
+		return true
+	}
+	for _, r := range splitList(ranks) {
+		if strings.EqualFold(r, strings.TrimSpace(rank)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Chính sách áp dụng cho thuyền viên: cụ thể nhất thắng (theo chức danh > chỉ định tàu > theo công ty), hòa thì ID nhỏ
+func allowancePolicyFor(crew models.Crew, ship models.Ship) *models.AllowancePolicy {
+	var policies []models.AllowancePolicy
+	database.DB.Where("enabled = ?", true).Order("id").Find(&policies)
+	return pickAllowancePolicy(policies, crew, ship)
+}
+
+// policies đã sắp theo ID tăng dần
+func pickAllowancePolicy(policies []models.AllowancePolicy, crew models.Crew, ship models.Ship) *models.AllowancePolicy {
+	var best *models.AllowancePolicy
+	bestScore := -1
+	for i, p := range policies {
+		if !shipTargeted(p.ShipIDs, p.Company, ship) || !rankTargeted(p.Ranks, crew.Rank) {
+			continue
+		}
+		score := 0
+		if p.Ranks != "" {
+			score += 4
+		}
+		if p.ShipIDs != "" {
+			score += 2
+		}
+		if p.Company != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = &policies[i], score
+		}
+	}
+	return best
+}
+
+// Tỉ lệ phụ cấp theo số ngày còn lại của chu kỳ kể từ ngày lên tàu
+func allowanceProRata(signOn, start, end time.Time) float64 {
+	if !signOn.After(start) {
+		return 1
+	}
+	if !signOn.Before(end) {
+		return 0
+	}
+	total := end.Sub(start).Hours() / 24
+	remaining := math.Ceil(end.Sub(signOn).Hours() / 24)
+	return math.Min(1, math.Round(remaining/total*1000)/1000)
+}
+
+// Cấp phụ cấp chu kỳ của st (1 lần / chu kỳ, ghi nhận vào AllowanceGrant) và cộng vào WelfareBytes.
+// Gọi khi mở chu kỳ mới (đang giữ quotaMu)
+func grantAllowance(crew models.Crew, st *models.QuotaState) {
+	var grant models.AllowanceGrant
+	if database.DB.Where("crew_id = ? AND period_start = ?", crew.ID, st.PeriodStart).Limit(1).Find(&grant).RowsAffected > 0 {
+		st.WelfareBytes = grant.GrantedBytes
+		return
+	}
+	var ship models.Ship
+	database.DB.Where("id = ?", crew.ShipID).Limit(1).Find(&ship)
+	policy := allowancePolicyFor(crew, ship)
+	if policy == nil {
+		return
+	}
+
+	signOn := crew.CreatedAt
+	if crew.SignOnAt != nil {
+		signOn = *crew.SignOnAt
+	}
+	ratio := allowanceProRata(signOn, st.PeriodStart, st.PeriodEnd)
+	full := policy.AllowanceMB << 20
+	grant = models.AllowanceGrant{
+		CrewID: crew.ID, PeriodStart: st.PeriodStart, PeriodEnd: st.PeriodEnd, ShipID: crew.ShipID, Rank: crew.Rank,
+		PolicyID: policy.ID, FullBytes: full, GrantedBytes: int64(float64(full)*ratio) >> 20 << 20, ProRata: ratio,
+		CreatedAt: time.Now(),
+	}
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&grant)
+	if result.Error != nil || result.RowsAffected == 0 || grant.GrantedBytes == 0 {
+		return
+	}
+	st.WelfareBytes = grant.GrantedBytes
+	msg := fmt.Sprintf("Phụ cấp công ty %s: +%d MB", policy.Name, grant.GrantedBytes>>20)
+	if ratio < 1 {
+		msg += fmt.Sprintf(" (%.0f%% do lên tàu giữa chu kỳ)", ratio*100)
+	}
+	addCrewUsageEvent(*st, "allowance", msg)
+}
+
+// Cấp phụ cấp chu kỳ hiện tại cho thuyền viên chưa được cấp (sau khi thêm / sửa chính sách)
+func grantCurrentAllowances() {
+	var crews []models.Crew
+	database.DB.Where("status = ? OR status = ''", "Active").Find(&crews)
+	now := time.Now()
+	for _, crew := range crews {
+		quotaMu.Lock()
+		cfg := currentQuotaConfig()
+		// So với trạng thái đã lưu: loadQuotaState có thể đã cấp phụ cấp khi mở chu kỳ mới
+		var saved models.QuotaState
+		database.DB.Where("crew_id = ?", crew.ID).Limit(1).Find(&saved)
+		st := loadQuotaState(crew, cfg, now)
+		grantAllowance(crew, &st)
+		if st.WelfareBytes != saved.WelfareBytes || !st.PeriodStart.Equal(saved.PeriodStart) {
+			evaluateQuota(&st, crew, cfg)
+			st.UpdatedAt = now
+		}
+		database.DB.Save(&st)
+		quotaMu.Unlock()
+	}
+}
+
+// --- CÁC API ---
+
+// 1. Danh sách chính sách phụ cấp
+func GetAllowancePolicies(c *gin.Context) {
+	var policies []models.AllowancePolicy
+	database.DB.Order("id").Find(&policies)
+	c.JSON(http.StatusOK, policies)
+}
+
+// 2. Tạo chính sách (cấp ngay cho chu kỳ hiện tại với thuyền viên chưa có phụ cấp)
+func CreateAllowancePolicy(c *gin.Context) {
+	input := models.AllowancePolicy{Enabled: true} // Không gửi enabled = bật
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateAllowancePolicy(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID = 0
+	if err := database.DB.Create(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	recordAudit(c, fmt.Sprintf("Created allowance policy %s (%d MB)", input.Name, input.AllowanceMB), "Success")
+	go grantCurrentAllowances()
+	c.JSON(http.StatusCreated, input)
+}
+
+// 3. Sửa chính sách (phụ cấp đã cấp trong chu kỳ giữ nguyên, áp dụng từ chu kỳ sau)
+func UpdateAllowancePolicy(c *gin.Context) {
+	var policy models.AllowancePolicy
+	if err := database.DB.First(&policy, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chính sách không tồn tại"})
+		return
+	}
+	input := models.AllowancePolicy{Enabled: policy.Enabled} // Không gửi enabled = giữ nguyên
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateAllowancePolicy(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID, input.CreatedAt = policy.ID, policy.CreatedAt
+	if err := database.DB.Save(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	recordAudit(c, fmt.Sprintf("Updated allowance policy %s (%d MB)", input.Name, input.AllowanceMB), "Success")
+	go grantCurrentAllowances()
+	c.JSON(http.StatusOK, input)
+}
+
+// 4. Xóa chính sách
+func DeleteAllowancePolicy(c *gin.Context) {
+	var policy models.AllowancePolicy
+	if err := database.DB.First(&policy, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chính sách không tồn tại"})
+		return
+	}
+	if err := database.DB.Delete(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
+		return
+	}
+	recordAudit(c, "Deleted allowance policy "+policy.Name, "Success")
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa thành công"})
+}
+
+// 5. GET /api/allowance-report?month=YYYY-MM&ship_id=&company=
+// Theo chu kỳ bắt đầu trong tháng: phụ cấp được cấp so với lưu lượng đã dùng (phụ cấp dùng trước, phần vượt là trả tiền)
+func GetAllowanceReport(c *gin.Context) {
+	monthStart, _, err := queryMonth(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cycleDay := currentQuotaConfig().CycleDay
+	start, end := billingPeriod(monthStart.AddDate(0, 0, cycleDay-1), cycleDay)
+
+	ships := []models.Ship{}
+	query := database.DB.Order("id")
+	if shipID := c.Query("ship_id"); shipID != "" {
+		query = query.Where("id = ?", shipID)
+	}
+	if company := c.Query("company"); company != "" {
+		query = query.Where("company = ?", company)
+	}
+	query.Find(&ships)
+
+	type reportRow struct {
+		ShipID           string  `json:"ship_id"`
+		CrewID           uint    `json:"crew_id"`
+		FullName         string  `json:"full_name"`
+		Rank             string  `json:"rank"`
+		PolicyID         uint    `json:"policy_id"`
+		ProRata          float64 `json:"pro_rata"`
+		AllowanceMB      int64   `json:"allowance_mb"`
+		UsedMB           int64   `json:"used_mb"`
+		AllowanceUsedMB  int64   `json:"allowance_used_mb"`
+		PaidUsedMB       int64   `json:"paid_used_mb"`
+		WalletSpentCents int64   `json:"wallet_spent_cents"`
+		AllowanceUsedPct float64 `json:"allowance_used_pct"`
+	}
+	rows := []reportRow{}
+	var totalAllowance, totalUsed, totalAllowanceUsed, totalPaid, totalSpent int64
+	for _, ship := range ships {
+		var crews []models.Crew
+		database.DB.Where("ship_id = ?", ship.ID).Order("full_name").Find(&crews)
+		for _, crew := range crews {
+			var grant models.AllowanceGrant
+			database.DB.Where("crew_id = ? AND period_start = ?", crew.ID, start).Limit(1).Find(&grant)
+			var used int64
+			database.DB.Model(&models.UsageDaily{}).Where("crew_id = ? AND day >= ? AND day < ?", crew.ID, start, end).
+				Select("COALESCE(SUM(bytes_in + bytes_out), 0)").Scan(&used)
+			var spent int64
+			database.DB.Model(&models.WalletTransaction{}).
+				Where("crew_id = ? AND source IN ? AND created_at >= ? AND created_at < ?", crew.ID, []string{"plan_purchase", "overage"}, start, end).
+				Select("COALESCE(-SUM(amount_cents), 0)").Scan(&spent)
+			if grant.ID == 0 && used == 0 && spent == 0 {
+				continue
+			}
+
+			allowanceUsed := min(used, grant.GrantedBytes)
+			row := reportRow{
+				ShipID: ship.ID, CrewID: crew.ID, FullName: crew.FullName, Rank: crew.Rank, PolicyID: grant.PolicyID,
+				ProRata: grant.ProRata, AllowanceMB: grant.GrantedBytes >> 20, UsedMB: used >> 20,
+				AllowanceUsedMB: allowanceUsed >> 20, PaidUsedMB: (used - allowanceUsed) >> 20, WalletSpentCents: spent,
+			}
+			if grant.GrantedBytes > 0 {
+				row.AllowanceUsedPct = math.Round(float64(allowanceUsed)*1000/float64(grant.GrantedBytes)) / 10
+			}
+			rows = append(rows, row)
+			totalAllowance += grant.GrantedBytes
+			totalUsed += used
+			totalAllowanceUsed += allowanceUsed
+			totalPaid += used - allowanceUsed
+			totalSpent += spent
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period_start": start, "period_end": end, "currency": walletCurrency,
+		"allowance_mb": totalAllowance >> 20, "used_mb": totalUsed >> 20,
+		"allowance_used_mb": totalAllowanceUsed >> 20, "paid_used_mb": totalPaid >> 20, "wallet_spent_cents": totalSpent,
+		"crew": rows,
+	})
+}
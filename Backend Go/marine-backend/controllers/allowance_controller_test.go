@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"marine-backend/models"
+	"testing"
+	"time"
+)
+
+func TestAllowanceProRata(t *testing.T) {
+	day := func(m time.Month, d, h int) time.Time { return time.Date(2026, m, d, h, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name       string
+		signOn     time.Time
+		start, end time.Time
+		want       float64
+	}{
+		{"lên tàu trước chu kỳ", day(3, 20, 0), day(4, 1, 0), day(5, 1, 0), 1},
+		{"lên tàu đúng đầu chu kỳ", day(4, 1, 0), day(4, 1, 0), day(5, 1, 0), 1},
+		{"giữa chu kỳ 30 ngày", day(4, 16, 0), day(4, 1, 0), day(5, 1, 0), 0.5},
+		{"ngày lẻ làm tròn lên cả ngày", day(4, 16, 12), day(4, 1, 0), day(5, 1, 0), 0.5},
+		{"tháng 2 có 28 ngày", day(2, 22, 0), day(2, 1, 0), day(3, 1, 0), 0.25},
+		{"chu kỳ lệch tháng (CycleDay 15)", day(5, 5, 0), day(4, 15, 0), day(5, 15, 0), 0.333},
+		{"lên tàu đúng cuối chu kỳ", day(5, 1, 0), day(4, 1, 0), day(5, 1, 0), 0},
+		{"lên tàu sau chu kỳ", day(5, 10, 0), day(4, 1, 0), day(5, 1, 0), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowanceProRata(tt.signOn, tt.start, tt.end); got != tt.want {
+				t.Errorf("allowanceProRata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickAllowancePolicy(t *testing.T) {
+	ship := models.Ship{ID: "IMO1", Company: "Acme"}
+	crew := models.Crew{Rank: "Master"}
+	tests := []struct {
+		name     string
+		policies []models.AllowancePolicy
+		want     uint // 0 = không có chính sách
+	}{
+		{"không có chính sách", nil, 0},
+		{"chính sách chung", []models.AllowancePolicy{{ID: 1}}, 1},
+		{"theo công ty thắng chính sách chung", []models.AllowancePolicy{{ID: 1}, {ID: 2, Company: "acme"}}, 2},
+		{"chỉ định tàu thắng theo công ty", []models.AllowancePolicy{{ID: 1, Company: "Acme"}, {ID: 2, ShipIDs: "IMO1"}}, 2},
+		{"theo chức danh thắng chỉ định tàu + công ty", []models.AllowancePolicy{{ID: 1, ShipIDs: "IMO1", Company: "Acme"}, {ID: 2, Ranks: "master"}}, 2},
+		{"hòa điểm thì ID nhỏ", []models.AllowancePolicy{{ID: 3, ShipIDs: "IMO1"}, {ID: 5, ShipIDs: "IMO2,IMO1"}}, 3},
+		{"bỏ qua chính sách không nhắm tới", []models.AllowancePolicy{{ID: 1}, {ID: 2, Ranks: "Cook"}, {ID: 3, ShipIDs: "IMO2"}, {ID: 4, Company: "Other"}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got uint
+			if p := pickAllowancePolicy(tt.policies, crew, ship); p != nil {
+				got = p.ID
+			}
+			if got != tt.want {
+				t.Errorf("pickAllowancePolicy() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
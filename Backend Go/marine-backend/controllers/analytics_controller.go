@@ -73,10 +73,11 @@ func GetAnalyticsOverview(c *gin.Context) {
 
 	totalTB := totalGB / 1024.0
 
-	// 2) Estimated cost: giả định 1GB = 4 USD (bạn có thể đổi theo gói)
-	estimatedCost := int(totalGB * 4.0)
-	// Projection: +20%
-	costProjection := int(float64(estimatedCost) * 1.2)
+	// 2) Estimated cost: theo lưu lượng từng link x bảng giá (phí tháng + vượt gói)
+	// Projection: chi phí cả tháng hiện tại theo tốc độ sử dụng tới nay
+	rangeCost, monthProjection := estimateLinkCost(start, time.Now())
+	estimatedCost := int(math.Round(rangeCost))
+	costProjection := int(math.Round(monthProjection))
 
 	// 3) Security threats: dùng AuditLogs có status Warning/Failed trong range
 	var threatCount int64
@@ -84,23 +85,20 @@ func GetAnalyticsOverview(c *gin.Context) {
 		Where("created_at >= ? AND (status = ? OR status = ?)", start, "Warning", "Failed").
 		Count(&threatCount).Error
 
-	// 4) Fleet uptime: tính theo ship.status (Online -> uptime)
-	var totalShips int64
-	var onlineShips int64
-	_ = database.DB.Model(&models.Ship{}).Count(&totalShips).Error
-	_ = database.DB.Model(&models.Ship{}).Where("status = ?", "Online").Count(&onlineShips).Error
-
+	// 4) Fleet uptime: tính từ các khoảng Offline thật (ship_status_events), so với kỳ trước
+	now := time.Now()
 	var uptime float64 = 99.0
-	if totalShips > 0 {
-		uptime = (float64(onlineShips) / float64(totalShips)) * 100.0
-		// nâng baseline để nhìn giống uptime thật
-		uptime = clampFloat(95.0+uptime*0.05, 80, 100)
+	var uptimeChangePct float64
+	if current, ok := fleetUptime(start, now); ok {
+		uptime = current
+		if previous, ok := fleetUptime(start.Add(-duration), start); ok {
+			uptimeChangePct = current - previous
+		}
 	}
 
 	// Change pct (tạm giả lập mượt để UI đẹp; khi có historical table thì tính thật)
 	totalChangePct := clampFloat(rand.NormFloat64()*5+10, -30, 30)
 	threatChangePct := clampFloat(rand.NormFloat64()*3-2, -30, 30)
-	uptimeChangePct := clampFloat(rand.NormFloat64()*0.2+0.1, -2, 2)
 
 	c.JSON(http.StatusOK, gin.H{
 		"range": rng,
@@ -191,10 +189,13 @@ func GetAnalyticsTopConsumers(c *gin.Context) {
 		return
 	}
 
+	// Giá / GB theo bảng giá bán crew_gb của tàu (chưa cấu hình: giá airtime thực tế tháng này)
+	rates := loadCrewRates(monthBounds(time.Now()))
+
 	resp := make([]gin.H, 0, len(crews))
 	for _, cr := range crews {
 		dataGB := cr.DataUsage
-		cost := int(dataGB * 4.0)
+		cost := round2(dataGB * rates.perGB(cr.ShipID))
 
 		// signal: nếu crew đang Active thì signal cao, không thì random
 		signal := randomBetween(40, 99)
@@ -224,13 +225,35 @@ func GetAnalyticsTopConsumers(c *gin.Context) {
 // ------------------------
 func GetAnalyticsAppUsage(c *gin.Context) {
 	rng := getRangeParam(c)
-	_ = rng
+	to := time.Now()
+	from := to.Add(-rangeToDuration(rng))
+
+	// Lưu lượng thật từ NetFlow/IPFIX; current = % tổng lưu lượng của từng nhóm
+	totals, users := appUsageTotals(from, to, c.Query("ship_id"), c.Query("username"))
+	var sum int64
+	for _, b := range totals {
+		sum += b
+	}
+
+	current := make([]int, len(appCategories))
+	limit := make([]int, len(appCategories))
+	bytesGB := make([]float64, len(appCategories))
+	for i, cat := range appCategories {
+		if sum > 0 {
+			current[i] = int(math.Round(float64(totals[cat]) * 100 / float64(sum)))
+		}
+		limit[i] = appCategoryLimits[cat]
+		bytesGB[i] = math.Round(bytesToGB(totals[cat])*1000) / 1000
+	}
 
-	// Bạn chưa có table app usage, nên trả mock ổn định để FE vẽ radar.
 	c.JSON(http.StatusOK, gin.H{
-		"range": rng,
-		"labels": []string{"VoIP", "Video", "ERP", "Email", "Social", "IoT"},
-		"current": []int{85, 90, 60, 40, 70, 30},
-		"limit":   []int{60, 70, 90, 90, 50, 100},
+		"range":    rng,
+		"labels":   appCategories,
+		"current":  current,
+		"limit":    limit,
+		"bytes_gb": bytesGB,
+		"other_gb": math.Round(bytesToGB(totals[otherCategory])*1000) / 1000,
+		"total_gb": math.Round(bytesToGB(sum)*1000) / 1000,
+		"users":    users,
 	})
 }
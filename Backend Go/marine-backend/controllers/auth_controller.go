@@ -34,6 +34,7 @@ func Login(c *gin.Context) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"username": user.Username,
 		"role":     user.Role,
+		"company":  user.Company,
 		"exp":      time.Now().Add(24 * time.Hour).Unix(),
 	})
 	tokenString, _ := token.SignedString([]byte(os.Getenv("JWT_KEY")))
@@ -42,6 +43,7 @@ func Login(c *gin.Context) {
 		"token":    tokenString,
 		"username": user.Username,
 		"role":     user.Role,
+		"company":  user.Company,
 	})
 }
 
@@ -5,12 +5,205 @@ import (
 	"marine-backend/database"
 	"marine-backend/models"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
 )
 
-// ... Giữ nguyên hàm GetBandwidthPlans ...
+// Tốc độ MikroTik: số + đơn vị k/M/G, có thể dạng "rx/tx"
+var (
+	rateValuePattern = regexp.MustCompile(`^\d+[kKMG]?(/\d+[kKMG]?)?$`)
+	burstTimePattern = regexp.MustCompile(`^\d+s?(/\d+s?)?$`)
+)
+
+// Chuỗi rate-limit kiểu MikroTik (rx = tốc độ tải lên của user), dùng cho profile và RADIUS:
+// rx/tx [burst-rate] [burst-threshold] [burst-time] [priority] [limit-at]
+func planRateLimit(p models.BandwidthPlan) string {
+	rate := fmt.Sprintf("%dk/%dk", p.UploadSpeed, p.DownloadSpeed)
+	if p.BurstLimit == "" && p.Priority == 0 && p.LimitAt == "" {
+		return rate
+	}
+	// Các trường phía sau theo vị trí: không có burst thì điền 0 (tắt burst)
+	burst, threshold, burstTime := p.BurstLimit, p.BurstThreshold, p.BurstTime
+	if burst == "" {
+		burst, threshold, burstTime = "0/0", "0/0", "0/0"
+	}
+	priority := p.Priority
+	if priority == 0 {
+		priority = 8
+	}
+	// burst-time tính bằng giây: "16s/16s" -> "16/16"
+	parts := []string{rate, burst, threshold, strings.TrimSuffix(strings.ReplaceAll(burstTime, "s/", "/"), "s"), strconv.Itoa(priority)}
+	if p.LimitAt != "" {
+		parts = append(parts, p.LimitAt)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Tàu (có router) thuộc phạm vi áp dụng của gói
+func planTargetShips(p models.BandwidthPlan) []models.Ship {
+	var ships []models.Ship
+	database.DB.Where("router_ip <> ''").Order("id").Find(&ships)
+	targets := []models.Ship{}
+	for _, ship := range ships {
+		if shipTargeted(p.ShipIDs, p.Company, ship) {
+			targets = append(targets, ship)
+		}
+	}
+	return targets
+}
+
+// Tạo / cập nhật (hoặc xóa) hotspot user profile của gói trên 1 router
+func syncPlanProfile(shipID string, p models.BandwidthPlan, remove bool) error {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	res, err := client.Run("/ip/hotspot/user/profile/print", "?name="+p.ProfileName)
+	if err != nil {
+		return err
+	}
+	if remove {
+		for _, re := range res.Re {
+			if _, err := client.Run("/ip/hotspot/user/profile/remove", "=.id="+re.Map[".id"]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(res.Re) > 0 {
+		_, err = client.Run("/ip/hotspot/user/profile/set", "=.id="+res.Re[0].Map[".id"], "=rate-limit="+planRateLimit(p))
+		return err
+	}
+	// /ip hotspot user profile add name="Plan-Name" rate-limit="5M/10M"
+	_, err = client.Run(
+		"/ip/hotspot/user/profile/add",
+		"=name="+p.ProfileName,
+		"=rate-limit="+planRateLimit(p),
+		"=shared-users=1", // Mỗi user chỉ đăng nhập 1 máy
+	)
+	return err
+}
+
+// Ghi trạng thái triển khai gói trên 1 tàu (mỗi cặp gói - tàu giữ 1 dòng, lần chạy mới ghi đè)
+func savePlanDeployment(d models.PlanDeployment) {
+	d.UpdatedAt = time.Now()
+	database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "plan_id"}, {Name: "ship_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"action", "status", "error", "updated_at"}),
+	}).Create(&d)
+}
+
+// Đẩy gói xuống các tàu (chạy nền), báo tiến độ từng tàu qua SSE "job"; trả về job_id
+// remove: các tàu cần gỡ profile (gói bị xóa hoặc tàu không còn trong phạm vi)
+func deployPlan(p models.BandwidthPlan, action string, apply, remove []models.Ship, owner string) string {
+	jobID := fmt.Sprintf("plan-%d-%d", p.ID, time.Now().UnixNano())
+	type step struct {
+		ship   models.Ship
+		remove bool
+	}
+	var steps []step
+	for _, ship := range apply {
+		steps = append(steps, step{ship, false})
+	}
+	for _, ship := range remove {
+		steps = append(steps, step{ship, true})
+	}
+	for _, st := range steps {
+		savePlanDeployment(models.PlanDeployment{PlanID: p.ID, ShipID: st.ship.ID, Action: action, Status: "pending"})
+	}
+
+	go func() {
+		failed := 0
+		for i, st := range steps {
+			d := models.PlanDeployment{PlanID: p.ID, ShipID: st.ship.ID, Action: action, Status: "ok"}
+			if st.remove {
+				d.Action = "delete"
+			}
+
+			var inUse int64
+			if st.remove {
+				database.DB.Model(&models.Crew{}).Where("ship_id = ? AND plan_id = ?", st.ship.ID, p.ID).Count(&inUse)
+			}
+			if inUse > 0 {
+				// Còn thuyền viên dùng gói trên tàu: giữ profile để không mất kết nối
+				d.Status, d.Error = "skipped", fmt.Sprintf("Còn %d thuyền viên đang dùng gói", inUse)
+			} else if err := syncPlanProfile(st.ship.ID, p, st.remove); err != nil {
+				d.Status, d.Error = "failed", err.Error()
+				failed++
+			}
+			savePlanDeployment(d)
+			PublishJobProgress(jobID, owner, i+1, len(steps), "running",
+				fmt.Sprintf("%s: %s %s", st.ship.Name, d.Status, d.Error))
+		}
+
+		status := "done"
+		if failed > 0 {
+			status = "failed"
+		}
+		PublishJobProgress(jobID, owner, len(steps), len(steps), status,
+			fmt.Sprintf("Gói %s: %d/%d tàu thành công", p.Name, len(steps)-failed, len(steps)))
+		if action == "delete" {
+			// Gói đã xóa khỏi DB: chỉ giữ lại dòng lỗi để tra cứu
+			database.DB.Where("plan_id = ? AND status = ?", p.ID, "ok").Delete(&models.PlanDeployment{})
+		}
+	}()
+	return jobID
+}
+
+// Gói kèm chuỗi rate-limit và trạng thái triển khai trên các tàu
+type planView struct {
+	models.BandwidthPlan
+	RateLimit   string                  `json:"rate_limit"`
+	Deployments []models.PlanDeployment `json:"deployments"`
+}
+
+func newPlanView(p models.BandwidthPlan, deployments []models.PlanDeployment) planView {
+	if deployments == nil {
+		deployments = []models.PlanDeployment{}
+	}
+	return planView{BandwidthPlan: p, RateLimit: planRateLimit(p), Deployments: deployments}
+}
+
+// 1. Danh sách gói (?status=Active)
+func GetBandwidthPlans(c *gin.Context) {
+	var plans []models.BandwidthPlan
+	query := database.DB.Order("id")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Find(&plans)
+
+	var deployments []models.PlanDeployment
+	database.DB.Order("ship_id").Find(&deployments)
+	byPlan := map[uint][]models.PlanDeployment{}
+	for _, d := range deployments {
+		byPlan[d.PlanID] = append(byPlan[d.PlanID], d)
+	}
+	views := make([]planView, 0, len(plans))
+	for _, p := range plans {
+		views = append(views, newPlanView(p, byPlan[p.ID]))
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+// 2. Chi tiết gói + trạng thái từng tàu
+func GetBandwidthPlan(c *gin.Context) {
+	var plan models.BandwidthPlan
+	if err := database.DB.First(&plan, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gói cước không tồn tại"})
+		return
+	}
+	var deployments []models.PlanDeployment
+	database.DB.Where("plan_id = ?", plan.ID).Order("ship_id").Find(&deployments)
+	c.JSON(http.StatusOK, newPlanView(plan, deployments))
+}
 
 // TẠO GÓI CƯỚC MỚI (ĐỒNG BỘ XUỐNG MIKROTIK)
 func CreateBandwidthPlan(c *gin.Context) {
@@ -20,8 +213,14 @@ func CreateBandwidthPlan(c *gin.Context) {
 		return
 	}
 
+	if msg := validatePlan(&input, 0); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
 	// 1. Lưu vào Database trước
 	if input.Status == "" { input.Status = "Active" }
+	input.ProfileName = planProfileName(input.Name) // Cố định từ lúc tạo
 	input.CreatedAt = time.Now()
 	
 	if err := database.DB.Create(&input).Error; err != nil {
@@ -29,42 +228,143 @@ func CreateBandwidthPlan(c *gin.Context) {
 		return
 	}
 
-	// 2. Đẩy cấu hình xuống MikroTik (Thực hiện trên tất cả tàu hoặc 1 tàu cụ thể)
-	// Ở đây mình ví dụ đẩy xuống con tàu bạn đang test (IMO9562623)
-	// Nếu muốn đẩy hết các tàu, bạn cần vòng lặp for qua danh sách tàu
-	shipID := "IMO9562623" 
-	
-	client, _, err := ConnectToRouter(shipID)
-	if err == nil {
-		defer client.Close()
-		
-		// Format tốc độ: RX/TX (Ví dụ: 5M/10M)
-		// Input đang là Kbps, cần đổi sang M hoặc k
-		rateLimit := fmt.Sprintf("%dk/%dk", input.UploadSpeed, input.DownloadSpeed)
-
-		// Lệnh tạo Profile trên MikroTik
-		// /ip hotspot user profile add name="Plan Name" rate-limit="5M/10M"
-		_, err := client.Run(
-			"/ip/hotspot/user/profile/add",
-			"=name=" + input.Name,
-			"=rate-limit=" + rateLimit,
-			"=shared-users=1", // Mỗi user chỉ đăng nhập 1 máy
-		)
-		
-		if err != nil {
-			fmt.Println("⚠️ Lỗi tạo Profile trên Router:", err)
-			// Không return lỗi để Web vẫn báo thành công (DB đã lưu)
-		} else {
-			fmt.Println("✅ Đã tạo Profile trên MikroTik:", input.Name)
+	// 2. Đẩy profile xuống router các tàu áp dụng (chạy nền, theo dõi qua job_id)
+	targets := planTargetShips(input)
+	jobID := deployPlan(input, "create", targets, nil, c.GetString("username"))
+
+	c.JSON(http.StatusCreated, gin.H{"plan": newPlanView(input, nil), "job_id": jobID, "targets": len(targets)})
+}
+
+// Kiểm tra dữ liệu gói; id = gói đang sửa (0 khi tạo mới)
+func validatePlan(p *models.BandwidthPlan, id uint) string {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return "Thiếu tên gói"
+	}
+	if p.UploadSpeed <= 0 || p.DownloadSpeed <= 0 {
+		return "Tốc độ tải lên / tải xuống phải lớn hơn 0"
+	}
+	if p.DataAllowanceMB < 0 || p.ValidityDays < 0 || p.Price < 0 {
+		return "Dung lượng, hạn dùng và giá không được âm"
+	}
+	if p.Priority < 0 || p.Priority > 8 {
+		return "Độ ưu tiên phải từ 1 đến 8"
+	}
+	// Burst cần đủ cả 3 trường
+	if (p.BurstLimit != "" || p.BurstThreshold != "" || p.BurstTime != "") &&
+		(p.BurstLimit == "" || p.BurstThreshold == "" || p.BurstTime == "") {
+		return "Burst cần đủ burst_limit, burst_threshold và burst_time"
+	}
+	for _, v := range []string{p.BurstLimit, p.BurstThreshold, p.LimitAt} {
+		if v != "" && !rateValuePattern.MatchString(v) {
+			return "Tốc độ không hợp lệ: " + v + " (ví dụ 2M/4M, 512k)"
 		}
 	}
+	if p.BurstTime != "" && !burstTimePattern.MatchString(p.BurstTime) {
+		return "Thời gian burst không hợp lệ: " + p.BurstTime + " (ví dụ 16/16 hoặc 16s)"
+	}
+	var ids []string
+	for _, id := range strings.Split(p.ShipIDs, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			var count int64
+			database.DB.Model(&models.Ship{}).Where("id = ?", id).Count(&count)
+			if count == 0 {
+				return "Tàu không tồn tại: " + id
+			}
+			ids = append(ids, id)
+		}
+	}
+	p.ShipIDs = strings.Join(ids, ",")
+	var count int64
+	database.DB.Model(&models.BandwidthPlan{}).Where("LOWER(name) = LOWER(?) AND id <> ?", p.Name, id).Count(&count)
+	if count > 0 {
+		return "Tên gói đã tồn tại"
+	}
+	return ""
+}
 
-	c.JSON(http.StatusCreated, input)
+// 3. Cập nhật gói: crew / voucher tham chiếu theo ID, profile trên router giữ nguyên tên
+// Đẩy thay đổi xuống các tàu áp dụng; tàu bị loại khỏi phạm vi sẽ được gỡ profile
+func UpdateBandwidthPlan(c *gin.Context) {
+	var plan models.BandwidthPlan
+	if err := database.DB.First(&plan, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gói cước không tồn tại"})
+		return
+	}
+	var input models.BandwidthPlan
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validatePlan(&input, plan.ID); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID, input.CreatedAt, input.ProfileName = plan.ID, plan.CreatedAt, plan.ProfileName
+	if input.Status == "" {
+		input.Status = plan.Status
+	}
+	if err := database.DB.Save(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	if input.Name != plan.Name {
+		renamePlanReferences(input)
+	}
+
+	targets := planTargetShips(input)
+	keep := map[string]bool{}
+	for _, ship := range targets {
+		keep[ship.ID] = true
+	}
+	var removed []models.Ship
+	for _, ship := range planTargetShips(plan) {
+		if !keep[ship.ID] {
+			removed = append(removed, ship)
+		}
+	}
+	jobID := deployPlan(input, "update", targets, removed, c.GetString("username"))
+	c.JSON(http.StatusOK, gin.H{"plan": newPlanView(input, nil), "job_id": jobID, "targets": len(targets), "removed": len(removed)})
+}
+
+// 4. Đẩy lại gói xuống mọi tàu áp dụng (thử lại khi có tàu lỗi / mất kết nối)
+func DeployBandwidthPlan(c *gin.Context) {
+	var plan models.BandwidthPlan
+	if err := database.DB.First(&plan, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gói cước không tồn tại"})
+		return
+	}
+	// Gói tạo tự động khi chuyển dữ liệu cũ chưa có tốc độ: phải sửa gói trước khi đẩy
+	check := plan
+	if msg := validatePlan(&check, plan.ID); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	targets := planTargetShips(plan)
+	jobID := deployPlan(plan, "update", targets, nil, c.GetString("username"))
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobID, "targets": len(targets)})
 }
 
-// 3. Xóa gói
+// 5. Xóa gói: chặn khi còn crew / voucher tham chiếu, gỡ profile trên router các tàu
 func DeleteBandwidthPlan(c *gin.Context) {
-	id := c.Param("id")
-	database.DB.Delete(&models.BandwidthPlan{}, id)
-	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
-}
\ No newline at end of file
+	var plan models.BandwidthPlan
+	if err := database.DB.First(&plan, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gói cước không tồn tại"})
+		return
+	}
+	var crews, vouchers int64
+	database.DB.Model(&models.Crew{}).Where("plan_id = ?", plan.ID).Count(&crews)
+	database.DB.Model(&models.Voucher{}).Where("plan_id = ? AND status IN ?", plan.ID, []string{"Unused", "Assigned", "Active"}).Count(&vouchers)
+	if crews > 0 || vouchers > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf(
+			"Gói đang được dùng bởi %d thuyền viên và %d voucher, hãy chuyển sang gói khác trước", crews, vouchers)})
+		return
+	}
+	if err := database.DB.Delete(&plan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
+		return
+	}
+	targets := planTargetShips(plan)
+	jobID := deployPlan(plan, "delete", nil, targets, c.GetString("username"))
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa thành công", "job_id": jobID, "targets": len(targets)})
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"marine-backend/models"
+	"testing"
+)
+
+func TestPlanRateLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		plan models.BandwidthPlan
+		want string
+	}{
+		{"chỉ rx/tx", models.BandwidthPlan{UploadSpeed: 512, DownloadSpeed: 2048}, "512k/2048k"},
+		{
+			"có burst 16s/16s",
+			models.BandwidthPlan{UploadSpeed: 512, DownloadSpeed: 2048, BurstLimit: "1M/4M", BurstThreshold: "384k/1536k", BurstTime: "16s/16s"},
+			"512k/2048k 1M/4M 384k/1536k 16/16 8",
+		},
+		{"chỉ priority -> điền 0/0 cho burst", models.BandwidthPlan{UploadSpeed: 256, DownloadSpeed: 1024, Priority: 3}, "256k/1024k 0/0 0/0 0/0 3"},
+		{
+			"limit-at",
+			models.BandwidthPlan{UploadSpeed: 256, DownloadSpeed: 1024, LimitAt: "64k/128k"},
+			"256k/1024k 0/0 0/0 0/0 8 64k/128k",
+		},
+		{
+			"đủ trường",
+			models.BandwidthPlan{UploadSpeed: 1024, DownloadSpeed: 4096, BurstLimit: "2M/8M", BurstThreshold: "768k/3M", BurstTime: "8s/16s", Priority: 2, LimitAt: "128k/512k"},
+			"1024k/4096k 2M/8M 768k/3M 8/16 2 128k/512k",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := planRateLimit(tt.plan); got != tt.want {
+				t.Errorf("planRateLimit() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
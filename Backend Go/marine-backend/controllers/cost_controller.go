@@ -0,0 +1,380 @@
+package controllers
+
+import (
+	"errors"
+	"marine-backend/database"
+	"marine-backend/models"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Chi phí 1 link trong tháng
+type linkCost struct {
+	LinkName    string  `json:"link_name"`
+	LinkKind    string  `json:"link_kind"`
+	Tariff      string  `json:"tariff"`
+	UsageGB     float64 `json:"usage_gb"`
+	BundleGB    float64 `json:"bundle_gb"`
+	OverageGB   float64 `json:"overage_gb"`
+	Fee         float64 `json:"fee"`
+	OverageCost float64 `json:"overage_cost"`
+	Total       float64 `json:"total"`
+}
+
+// Chi phí 1 tàu trong tháng, phân bổ cho phúc lợi thuyền viên / vận hành tàu theo tỉ lệ lưu lượng
+type shipCost struct {
+	ShipID         string     `json:"ship_id"`
+	ShipName       string     `json:"ship_name"`
+	Company        string     `json:"company"`
+	Links          []linkCost `json:"links"`
+	TotalGB        float64    `json:"total_gb"`
+	WelfareGB      float64    `json:"welfare_gb"`
+	OperationsGB   float64    `json:"operations_gb"`
+	TotalCost      float64    `json:"total_cost"`
+	WelfareCost    float64    `json:"welfare_cost"`
+	OperationsCost float64    `json:"operations_cost"`
+}
+
+func monthBounds(t time.Time) (time.Time, time.Time) {
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 1, 0)
+}
+
+// Chọn bảng giá cụ thể nhất: gán trực tiếp cho link > theo tàu > theo công ty > chung cho loại link
+func resolveTariff(tariffs []models.Tariff, link *models.ShipLink, kind string, ship models.Ship) *models.Tariff {
+	if link != nil && link.TariffID != nil {
+		for i := range tariffs {
+			if tariffs[i].ID == *link.TariffID {
+				return &tariffs[i]
+			}
+		}
+	}
+	var best *models.Tariff
+	bestScore := -1
+	for i := range tariffs {
+		t := &tariffs[i]
+		if t.LinkKind != kind {
+			continue
+		}
+		if t.ShipID != "" && t.ShipID != ship.ID {
+			continue
+		}
+		if t.Company != "" && !strings.EqualFold(t.Company, ship.Company) {
+			continue
+		}
+		score := 0
+		if t.ShipID != "" {
+			score += 2
+		}
+		if t.Company != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = t, score
+		}
+	}
+	return best
+}
+
+// Chi phí 1 link theo lưu lượng: phí tháng + phần vượt gói theo bảng giá,
+// chưa có bảng giá thì tính theo giá/GB khai báo trên link (chưa làm tròn)
+func linkUsageCost(name, kind string, bytes int64, t *models.Tariff, link *models.ShipLink) linkCost {
+	gb := bytesToGB(bytes)
+	lc := linkCost{LinkName: name, LinkKind: kind, UsageGB: gb}
+	if t != nil {
+		lc.Tariff = t.Name
+		lc.BundleGB = t.BundleGB
+		lc.Fee = t.MonthlyFee
+		lc.OverageGB = math.Max(0, gb-t.BundleGB)
+		lc.OverageCost = lc.OverageGB * t.OverageRatePerGB
+	} else if link != nil {
+		lc.Tariff = "cost_per_gb"
+		lc.OverageGB = gb
+		lc.OverageCost = gb * link.CostPerGB
+	}
+	lc.Total = lc.Fee + lc.OverageCost
+	return lc
+}
+
+// Tháng theo query ?month=YYYY-MM (mặc định tháng hiện tại)
+func queryMonth(c *gin.Context) (time.Time, time.Time, error) {
+	month := time.Now()
+	if v := c.Query("month"); v != "" {
+		t, err := time.ParseInLocation("2006-01", v, time.Local)
+		if err != nil {
+			return month, month, errors.New("month phải có dạng YYYY-MM")
+		}
+		month = t
+	}
+	start, end := monthBounds(month)
+	return start, end, nil
+}
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
+
+// Tính chi phí tháng của các tàu (shipID / company rỗng = tất cả; company so khớp đúng tên như khóa hóa đơn)
+func fleetMonthlyCosts(monthStart, monthEnd time.Time, shipID, company string) []shipCost {
+	var tariffs []models.Tariff
+	database.DB.Find(&tariffs)
+
+	var ships []models.Ship
+	query := database.DB.Select("id", "name", "company")
+	if shipID != "" {
+		query = query.Where("id = ?", shipID)
+	}
+	if company != "" {
+		query = query.Where("company = ?", company)
+	}
+	query.Find(&ships)
+
+	type usageRow struct {
+		ShipID   string
+		LinkName string
+		LinkKind string
+		Bytes    int64
+	}
+	var usage []usageRow
+	database.DB.Model(&models.LinkUsage{}).
+		Select("ship_id, link_name, MAX(link_kind) AS link_kind, SUM(rx_bytes + tx_bytes) AS bytes").
+		Where("period_start >= ? AND period_start < ?", monthStart, monthEnd).
+		Group("ship_id, link_name").Scan(&usage)
+
+	type welfareRow struct {
+		ShipID string
+		Bytes  int64
+	}
+	var welfare []welfareRow
+	database.DB.Model(&models.WelfareUsage{}).Select("ship_id, SUM(bytes) AS bytes").
+		Where("period_start >= ? AND period_start < ?", monthStart, monthEnd).
+		Group("ship_id").Scan(&welfare)
+	welfareByShip := make(map[string]int64, len(welfare))
+	for _, w := range welfare {
+		welfareByShip[w.ShipID] = w.Bytes
+	}
+
+	var links []models.ShipLink
+	database.DB.Find(&links)
+
+	results := make([]shipCost, 0, len(ships))
+	for _, ship := range ships {
+		sc := shipCost{ShipID: ship.ID, ShipName: ship.Name, Company: ship.Company}
+
+		// Link có dữ liệu lưu lượng + link đã khai báo (phí tháng vẫn tính khi không dùng)
+		usageByLink := map[string]usageRow{}
+		order := []string{}
+		for _, u := range usage {
+			if u.ShipID == ship.ID {
+				usageByLink[u.LinkName] = u
+				order = append(order, u.LinkName)
+			}
+		}
+		linkByName := map[string]*models.ShipLink{}
+		for i := range links {
+			if links[i].ShipID != ship.ID {
+				continue
+			}
+			linkByName[links[i].Name] = &links[i]
+			if _, ok := usageByLink[links[i].Name]; !ok && links[i].Enabled {
+				usageByLink[links[i].Name] = usageRow{ShipID: ship.ID, LinkName: links[i].Name, LinkKind: links[i].Kind}
+				order = append(order, links[i].Name)
+			}
+		}
+
+		var totalBytes int64
+		for _, name := range order {
+			u := usageByLink[name]
+			link := linkByName[name]
+			kind := u.LinkKind
+			if link != nil {
+				kind = link.Kind
+			}
+			lc := linkUsageCost(name, kind, u.Bytes, resolveTariff(tariffs, link, kind, ship), link)
+			if lc.Total == 0 && u.Bytes == 0 {
+				continue
+			}
+
+			totalBytes += u.Bytes
+			sc.TotalCost += lc.Total
+			lc.UsageGB, lc.OverageGB = round2(lc.UsageGB), round2(lc.OverageGB)
+			lc.OverageCost, lc.Total = round2(lc.OverageCost), round2(lc.Total)
+			sc.Links = append(sc.Links, lc)
+		}
+
+		welfareBytes := welfareByShip[ship.ID]
+		if len(sc.Links) == 0 && welfareBytes == 0 {
+			continue
+		}
+		share := 1.0 // Chưa đo được lưu lượng link: coi toàn bộ là phúc lợi
+		if totalBytes > 0 {
+			share = math.Min(1, float64(welfareBytes)/float64(totalBytes))
+		}
+		sc.TotalGB = round2(bytesToGB(totalBytes))
+		sc.WelfareGB = round2(bytesToGB(welfareBytes))
+		sc.OperationsGB = round2(math.Max(0, bytesToGB(totalBytes-welfareBytes)))
+		sc.WelfareCost = round2(sc.TotalCost * share)
+		sc.OperationsCost = round2(sc.TotalCost - sc.WelfareCost)
+		sc.TotalCost = round2(sc.TotalCost)
+		results = append(results, sc)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].TotalCost > results[j].TotalCost })
+	return results
+}
+
+// Ước tính chi phí cho khoảng [start, end] theo đơn giá bình quân của tháng hiện tại
+// và dự báo chi phí cả tháng theo tốc độ sử dụng tới hiện tại
+func estimateLinkCost(start, end time.Time) (float64, float64) {
+	now := time.Now()
+	monthStart, monthEnd := monthBounds(now)
+	costs := fleetMonthlyCosts(monthStart, monthEnd, "", "")
+
+	monthTotal := 0.0
+	rates := map[string]float64{} // ship/link -> USD/GB
+	for _, sc := range costs {
+		monthTotal += sc.TotalCost
+		for _, l := range sc.Links {
+			if l.UsageGB > 0 {
+				rates[sc.ShipID+"/"+l.LinkName] = l.Total / l.UsageGB
+			}
+		}
+	}
+
+	type usageRow struct {
+		ShipID   string
+		LinkName string
+		Bytes    int64
+	}
+	var usage []usageRow
+	database.DB.Model(&models.LinkUsage{}).
+		Select("ship_id, link_name, SUM(rx_bytes + tx_bytes) AS bytes").
+		Where("period_start >= ? AND period_start < ?", start.Truncate(time.Hour), end).
+		Group("ship_id, link_name").Scan(&usage)
+	rangeCost := 0.0
+	for _, u := range usage {
+		rangeCost += bytesToGB(u.Bytes) * rates[u.ShipID+"/"+u.LinkName]
+	}
+
+	elapsed := now.Sub(monthStart).Hours()
+	projection := monthTotal
+	if elapsed > 24 {
+		projection = monthTotal * monthEnd.Sub(monthStart).Hours() / elapsed
+	}
+	return rangeCost, projection
+}
+
+// --- CÁC API ---
+
+// GET /api/analytics/costs?month=YYYY-MM&ship_id=&company=
+// Chi phí theo tàu / link theo bảng giá, phân bổ phúc lợi thuyền viên vs vận hành tàu
+func GetCostReport(c *gin.Context) {
+	start, end, err := queryMonth(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	costs := fleetMonthlyCosts(start, end, c.Query("ship_id"), c.Query("company"))
+
+	var total, welfare, operations, totalGB float64
+	byKind := map[string]float64{}
+	for _, sc := range costs {
+		total += sc.TotalCost
+		welfare += sc.WelfareCost
+		operations += sc.OperationsCost
+		totalGB += sc.TotalGB
+		for _, l := range sc.Links {
+			byKind[l.LinkKind] += l.Total
+		}
+	}
+	for k, v := range byKind {
+		byKind[k] = round2(v)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"month": start.Format("2006-01"), "currency": "USD",
+		"total_cost": round2(total), "welfare_cost": round2(welfare), "operations_cost": round2(operations),
+		"total_gb": round2(totalGB), "by_link_kind": byKind, "ships": costs,
+	})
+}
+
+func validateTariff(t *models.Tariff) string {
+	if strings.TrimSpace(t.Name) == "" {
+		return "Thiếu tên bảng giá"
+	}
+	if !linkKinds[t.LinkKind] {
+		return "Loại link phải là vsat_ka, l_band, starlink, 4g_lte hoặc port_wifi"
+	}
+	if t.MonthlyFee < 0 || t.BundleGB < 0 || t.OverageRatePerGB < 0 {
+		return "Giá trị không được âm"
+	}
+	if t.Currency == "" {
+		t.Currency = "USD"
+	}
+	return ""
+}
+
+// 1. Danh sách bảng giá
+func GetTariffs(c *gin.Context) {
+	var tariffs []models.Tariff
+	database.DB.Order("link_kind, id").Find(&tariffs)
+	c.JSON(http.StatusOK, tariffs)
+}
+
+// 2. Tạo bảng giá
+func CreateTariff(c *gin.Context) {
+	var input models.Tariff
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateTariff(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID = 0
+	input.CreatedAt = time.Now()
+	if err := database.DB.Create(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	c.JSON(http.StatusCreated, input)
+}
+
+// 3. Sửa bảng giá
+func UpdateTariff(c *gin.Context) {
+	var tariff models.Tariff
+	if err := database.DB.First(&tariff, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bảng giá không tồn tại"})
+		return
+	}
+	var input models.Tariff
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateTariff(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID, input.CreatedAt = tariff.ID, tariff.CreatedAt
+	if err := database.DB.Save(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	c.JSON(http.StatusOK, input)
+}
+
+// 4. Xóa bảng giá (link đang gán sẽ quay về tự chọn theo loại)
+func DeleteTariff(c *gin.Context) {
+	id := c.Param("id")
+	if err := database.DB.Delete(&models.Tariff{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
+		return
+	}
+	database.DB.Model(&models.ShipLink{}).Where("tariff_id = ?", id).Update("tariff_id", nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa thành công"})
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"marine-backend/models"
+	"math"
+	"testing"
+)
+
+const gib = 1 << 30
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous, current int64
+		want              int64
+	}{
+		{"bộ đếm tăng", 1000, 1500, 500},
+		{"không đổi", 1500, 1500, 0},
+		{"lần đọc đầu tiên", 0, 4096, 4096},
+		{"router khởi động lại -> tính từ 0", 9_000_000, 1200, 1200},
+		{"reset về đúng 0", 9_000_000, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := counterDelta(tt.previous, tt.current); got != tt.want {
+				t.Errorf("counterDelta(%d, %d) = %d, want %d", tt.previous, tt.current, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveTariff(t *testing.T) {
+	tariffs := []models.Tariff{
+		{ID: 1, Name: "VSAT chung", LinkKind: "vsat_ka"},
+		{ID: 2, Name: "VSAT Acme", LinkKind: "vsat_ka", Company: "acme"},
+		{ID: 3, Name: "VSAT IMO1", LinkKind: "vsat_ka", ShipID: "IMO1"},
+		{ID: 4, Name: "Starlink chung", LinkKind: "starlink"},
+	}
+	assigned := uint(4)
+	tests := []struct {
+		name string
+		link *models.ShipLink
+		kind string
+		ship models.Ship
+		want string
+	}{
+		{"theo tàu thắng theo công ty", nil, "vsat_ka", models.Ship{ID: "IMO1", Company: "Acme"}, "VSAT IMO1"},
+		{"theo công ty (không phân biệt hoa thường)", nil, "vsat_ka", models.Ship{ID: "IMO2", Company: "ACME"}, "VSAT Acme"},
+		{"bảng giá chung", nil, "vsat_ka", models.Ship{ID: "IMO3", Company: "Khác"}, "VSAT chung"},
+		{"gán trực tiếp cho link", &models.ShipLink{TariffID: &assigned}, "vsat_ka", models.Ship{ID: "IMO1"}, "Starlink chung"},
+		{"không có bảng giá cho loại link", nil, "4g_lte", models.Ship{ID: "IMO1"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if tariff := resolveTariff(tariffs, tt.link, tt.kind, tt.ship); tariff != nil {
+				got = tariff.Name
+			}
+			if got != tt.want {
+				t.Errorf("resolveTariff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkUsageCost(t *testing.T) {
+	tariff := &models.Tariff{Name: "VSAT 100GB", MonthlyFee: 2000, BundleGB: 100, OverageRatePerGB: 15}
+	tests := []struct {
+		name      string
+		bytes     int64
+		tariff    *models.Tariff
+		link      *models.ShipLink
+		overageGB float64
+		total     float64
+	}{
+		{"trong gói -> chỉ phí tháng", 40 * gib, tariff, nil, 0, 2000},
+		{"đúng bằng gói", 100 * gib, tariff, nil, 0, 2000},
+		{"vượt gói 20GB", 120 * gib, tariff, nil, 20, 2000 + 20*15},
+		{"không dùng vẫn tính phí tháng", 0, tariff, nil, 0, 2000},
+		{"chưa có bảng giá -> giá/GB của link", 10 * gib, nil, &models.ShipLink{CostPerGB: 4.5}, 10, 45},
+		{"chưa có bảng giá lẫn link", 10 * gib, nil, nil, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lc := linkUsageCost("vsat", "vsat_ka", tt.bytes, tt.tariff, tt.link)
+			if math.Abs(lc.OverageGB-tt.overageGB) > 1e-9 || math.Abs(lc.Total-tt.total) > 1e-9 {
+				t.Errorf("linkUsageCost() = overage %v GB, total %v, want %v GB, %v", lc.OverageGB, lc.Total, tt.overageGB, tt.total)
+			}
+			if lc.Total != lc.Fee+lc.OverageCost {
+				t.Errorf("Total = %v, want Fee + OverageCost = %v", lc.Total, lc.Fee+lc.OverageCost)
+			}
+		})
+	}
+}
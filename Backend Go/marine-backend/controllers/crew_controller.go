@@ -1,12 +1,15 @@
 package controllers
 
 import (
+	"fmt"
 	"marine-backend/database"
 	"marine-backend/models"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 1. Lấy danh sách Thủy thủ theo Tàu
@@ -22,19 +25,40 @@ func GetCrewByShip(c *gin.Context) {
 	c.JSON(http.StatusOK, crews)
 }
 
+// Dữ liệu thêm / sửa crew: mật khẩu hotspot chỉ nhận vào, không bao giờ trả ra
+type crewInput struct {
+	models.Crew
+	HotspotPassword string `json:"hotspot_password"`
+}
+
 // 2. Thêm mới Thủy thủ
 func AddCrew(c *gin.Context) {
-	var input models.Crew
-	if err := c.ShouldBindJSON(&input); err != nil {
+	var req crewInput
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	input := req.Crew
+	input.HotspotPassword = req.HotspotPassword
 
 	// Gán giá trị mặc định
 	if input.Status == "" { input.Status = "Active" }
-	if input.DataPlan == "" { input.DataPlan = "Basic (1GB)" }
+	if input.PlanID == nil && input.DataPlan == "" {
+		if def := lookupPlan(nil, "Basic (1GB)"); def != nil {
+			input.PlanID = &def.ID
+		}
+	}
+	plan, msg := resolvePlan(input.PlanID, input.DataPlan)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.PlanID, input.DataPlan = &plan.ID, plan.Name
 	input.DataUsage = 0
 	input.CreatedAt = time.Now()
+	if input.SignOnAt == nil {
+		input.SignOnAt = &input.CreatedAt
+	}
 
 	if err := database.DB.Create(&input).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi Database"})
@@ -46,13 +70,15 @@ func AddCrew(c *gin.Context) {
 // 3. Cập nhật thông tin (Sửa)
 func UpdateCrew(c *gin.Context) {
 	id := c.Param("id")
-	var input models.Crew
+	var req crewInput
 
 	// Validate dữ liệu gửi lên
-	if err := c.ShouldBindJSON(&input); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	input := req.Crew
+	input.HotspotPassword = req.HotspotPassword // Rỗng = giữ mật khẩu cũ
 
 	// Tìm user trong DB
 	var crew models.Crew
@@ -61,22 +87,60 @@ func UpdateCrew(c *gin.Context) {
 		return
 	}
 
+	// Đổi gói: kiểm tra gói tồn tại, lưu tham chiếu PlanID
+	if input.PlanID != nil || input.DataPlan != "" {
+		plan, msg := resolvePlan(input.PlanID, input.DataPlan)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+		input.PlanID, input.DataPlan = &plan.ID, plan.Name
+		// Dung lượng chu kỳ hiện tại theo gói mới
+		database.DB.Model(&models.QuotaState{}).Where("crew_id = ?", crew.ID).
+			Update("allowance_bytes", plan.DataAllowanceMB<<20)
+	}
+
 	// Cập nhật các trường
 	database.DB.Model(&crew).Updates(models.Crew{
 		FullName:    input.FullName,
 		Username:    input.Username,
+		Email:       input.Email,
+		HotspotPassword: input.HotspotPassword,
 		Rank:        input.Rank,
+		PlanID:      input.PlanID,
 		DataPlan:    input.DataPlan,
 		Status:      input.Status,
 		Nationality: input.Nationality,
+		SignOnAt:    input.SignOnAt,
+		Language:    input.Language,
 	})
 
 	c.JSON(http.StatusOK, crew)
 }
 
+// Cộng dồn lưu lượng đã dùng (bytes) vào Crew.DataUsage (GB)
+func addCrewUsage(crewID uint, bytesIn, bytesOut int64) {
+	gb := float64(bytesIn+bytesOut) / 1024 / 1024 / 1024
+	database.DB.Model(&models.Crew{}).Where("id = ?", crewID).
+		Update("data_usage", gorm.Expr("data_usage + ?", gb))
+
+	// Lưu lượng thuyền viên = phần phúc lợi khi phân bổ chi phí link
+	var shipID string
+	database.DB.Model(&models.Crew{}).Select("ship_id").Where("id = ?", crewID).Scan(&shipID)
+	addWelfareUsage(shipID, bytesIn+bytesOut, time.Now())
+
+	// Trừ vào dung lượng gói của chu kỳ hiện tại
+	applyQuotaUsage(crewID, bytesIn+bytesOut, time.Now())
+}
+
 // 4. Xóa Thủy thủ
 func DeleteCrew(c *gin.Context) {
 	id := c.Param("id")
+	crewID, _ := strconv.Atoi(id)
+	if balance := walletBalance(database.DB, uint(crewID), nil); balance != 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Ví còn số dư %s %s, cần quyết toán trước khi xóa", formatCents(balance), walletCurrency)})
+		return
+	}
 	if err := database.DB.Delete(&models.Crew{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
 		return
@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var geofenceKinds = map[string]bool{"port": true, "anchorage": true, "high_risk": true, "coverage_gap": true, "custom": true}
+
+// Các chức danh được coi là thuyền trưởng khi gửi thông báo
+var captainRanks = []string{"Master", "Captain", "Thuyền trưởng"}
+
+// Tuần tự hóa việc xét vùng (AIS, agent, simulator có thể gửi vị trí cùng lúc)
+var geofenceMu sync.Mutex
+
+// Điểm có nằm trong đa giác không (ray casting trên lat/lon, đủ chính xác cho vùng cảng / neo đậu)
+func pointInPolygon(lat, lon float64, polygon [][2]float64) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		latI, lonI := polygon[i][0], polygon[i][1]
+		latJ, lonJ := polygon[j][0], polygon[j][1]
+		if (latI > lat) != (latJ > lat) && lon < (lonJ-lonI)*(lat-latI)/(latJ-latI)+lonI {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Vùng có áp dụng cho tàu này không (theo danh sách tàu / công ty)
+func geofenceAppliesTo(g models.Geofence, ship models.Ship) bool {
+	return shipTargeted(g.ShipIDs, g.Company, ship)
+}
+
+// Tàu có thuộc phạm vi "danh sách tàu (rỗng = tất cả) + công ty (rỗng = tất cả)" không
+func shipTargeted(shipIDs, company string, ship models.Ship) bool {
+	if company != "" && !strings.EqualFold(company, ship.Company) {
+		return false
+	}
+	if strings.TrimSpace(shipIDs) == "" {
+		return true
+	}
+	for _, id := range strings.Split(shipIDs, ",") {
+		if strings.TrimSpace(id) == ship.ID {
+			return true
+		}
+	}
+	return false
+}
+
+type geofenceTransition struct {
+	fence  models.Geofence
+	inside bool // true = vừa vào vùng, false = vừa rời vùng
+}
+
+// Các vùng mà tàu vừa đổi trạng thái trong/ngoài so với trạng thái đã lưu (chưa lưu = đang ở ngoài)
+func geofenceTransitions(fences []models.Geofence, ship models.Ship, inside map[uint]bool, lat, lon float64) []geofenceTransition {
+	var changes []geofenceTransition
+	for _, g := range fences {
+		if len(g.Polygon) < 3 || !geofenceAppliesTo(g, ship) {
+			continue
+		}
+		if now := pointInPolygon(lat, lon, g.Polygon); now != inside[g.ID] {
+			changes = append(changes, geofenceTransition{fence: g, inside: now})
+		}
+	}
+	return changes
+}
+
+// XÉT VÙNG: so sánh vị trí mới với trạng thái trong/ngoài đã lưu, chỉ kích hoạt hành động khi thay đổi
+func evaluateGeofences(shipID string, lat, lon float64) {
+	geofenceMu.Lock()
+	defer geofenceMu.Unlock()
+
+	var ship models.Ship
+	if err := database.DB.Select("id", "name", "company").Where("id = ?", shipID).First(&ship).Error; err != nil {
+		return
+	}
+	var fences []models.Geofence
+	database.DB.Where("enabled = ?", true).Find(&fences)
+	if len(fences) == 0 {
+		return
+	}
+
+	var states []models.ShipGeofenceState
+	database.DB.Where("ship_id = ?", shipID).Find(&states)
+	inside := make(map[uint]bool, len(states))
+	for _, s := range states {
+		inside[s.GeofenceID] = s.Inside
+	}
+
+	for _, tr := range geofenceTransitions(fences, ship, inside, lat, lon) {
+		g := tr.fence
+		database.DB.Save(&models.ShipGeofenceState{ShipID: shipID, GeofenceID: g.ID, Inside: tr.inside, ChangedAt: time.Now()})
+
+		eventType, actions := "exit", g.OnExit
+		if tr.inside {
+			eventType, actions = "enter", g.OnEnter
+		}
+		fmt.Printf("🧭 Tàu %s %s vùng %s\n", shipID, map[string]string{"enter": "vào", "exit": "rời"}[eventType], g.Name)
+		// Hành động có thể gọi router (chậm) -> chạy nền, không chặn luồng nhận vị trí
+		go runGeofenceActions(g, ship, eventType, actions, lat, lon)
+	}
+}
+
+func runGeofenceActions(g models.Geofence, ship models.Ship, eventType string, actions []models.GeofenceAction, lat, lon float64) {
+	results := make([]string, 0, len(actions))
+	for _, action := range actions {
+		status := "ok"
+		if err := executeGeofenceAction(action, g, ship, eventType, lat, lon); err != nil {
+			status = err.Error()
+		}
+		results = append(results, action.Type+": "+status)
+	}
+
+	event := models.GeofenceEvent{
+		GeofenceID: g.ID, GeofenceName: g.Name, ShipID: ship.ID, Type: eventType,
+		Lat: lat, Lon: lon, Result: strings.Join(results, "; "), CreatedAt: time.Now(),
+	}
+	database.DB.Create(&event)
+	PublishEvent(StreamEvent{Type: "geofence", ShipID: ship.ID, Company: ship.Company, Data: event})
+}
+
+func executeGeofenceAction(action models.GeofenceAction, g models.Geofence, ship models.Ship, eventType string, lat, lon float64) error {
+	verb := map[string]string{"enter": "vào", "exit": "rời"}[eventType]
+	n := Notification{
+		Event: "geofence", Severity: action.Severity, ShipID: ship.ID, Company: ship.Company,
+		Title:   fmt.Sprintf("Tàu %s %s vùng %s", ship.Name, verb, g.Name),
+		Message: action.Message,
+		Data:    map[string]interface{}{"geofence": g.Name, "kind": g.Kind, "action": eventType, "lat": lat, "lon": lon},
+	}
+	if n.Message == "" {
+		n.Message = n.Title
+	}
+
+	switch action.Type {
+	case "switch_link":
+		return switchPrimaryLink(ship.ID, action.Link)
+	case "firewall_policy":
+		if action.Firewall == nil {
+			return fmt.Errorf("thiếu chính sách tường lửa")
+		}
+		return applyFirewallPolicy(ship.ID, *action.Firewall)
+	case "alert":
+		Notify(n)
+		return nil
+	case "notify_captain":
+		var captains []models.Crew
+		database.DB.Where("ship_id = ? AND rank IN ? AND email <> ''", ship.ID, captainRanks).Find(&captains)
+		if len(captains) == 0 {
+			return fmt.Errorf("tàu chưa có email thuyền trưởng")
+		}
+		for _, crew := range captains {
+			if err := NotifyTarget("email", crew.Email, crewLanguage(crew), n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("hành động không hỗ trợ")
+}
+
+func validateGeofence(g *models.Geofence) string {
+	if strings.TrimSpace(g.Name) == "" {
+		return "Thiếu tên vùng"
+	}
+	if g.Kind == "" {
+		g.Kind = "custom"
+	}
+	if !geofenceKinds[g.Kind] {
+		return "Loại vùng phải là port, anchorage, high_risk, coverage_gap hoặc custom"
+	}
+	if len(g.Polygon) < 3 {
+		return "Đa giác cần ít nhất 3 đỉnh"
+	}
+	for _, p := range g.Polygon {
+		if p[0] < -90 || p[0] > 90 || p[1] < -180 || p[1] > 180 {
+			return "Tọa độ đỉnh không hợp lệ"
+		}
+	}
+	for _, a := range append(append([]models.GeofenceAction{}, g.OnEnter...), g.OnExit...) {
+		switch a.Type {
+		case "switch_link":
+			if strings.TrimSpace(a.Link) == "" {
+				return "Thiếu tên hoặc loại link cần chuyển"
+			}
+		case "firewall_policy":
+			if a.Firewall == nil {
+				return "Thiếu chính sách tường lửa"
+			}
+		case "alert":
+			if _, ok := severityRank[a.Severity]; a.Severity != "" && !ok {
+				return "Mức độ phải là info, warning hoặc critical"
+			}
+		case "notify_captain":
+		default:
+			return "Hành động không hỗ trợ: " + a.Type
+		}
+	}
+	return ""
+}
+
+// --- CÁC API ---
+
+// 1. Danh sách vùng
+func GetGeofences(c *gin.Context) {
+	var fences []models.Geofence
+	database.DB.Order("id").Find(&fences)
+	c.JSON(http.StatusOK, fences)
+}
+
+// 2. Tạo vùng
+func CreateGeofence(c *gin.Context) {
+	input := models.Geofence{Enabled: true} // Không gửi enabled = bật
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateGeofence(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID = 0
+	input.CreatedAt = time.Now()
+	if err := database.DB.Create(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	c.JSON(http.StatusCreated, input)
+}
+
+// 3. Cập nhật vùng (trạng thái trong/ngoài được xét lại ở vị trí kế tiếp)
+func UpdateGeofence(c *gin.Context) {
+	var fence models.Geofence
+	if err := database.DB.First(&fence, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vùng không tồn tại"})
+		return
+	}
+	input := models.Geofence{Enabled: fence.Enabled} // Không gửi enabled = giữ nguyên
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateGeofence(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID = fence.ID
+	input.CreatedAt = fence.CreatedAt
+	if err := database.DB.Save(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	c.JSON(http.StatusOK, input)
+}
+
+// 4. Xóa vùng
+func DeleteGeofence(c *gin.Context) {
+	id := c.Param("id")
+	if err := database.DB.Delete(&models.Geofence{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
+		return
+	}
+	database.DB.Where("geofence_id = ?", id).Delete(&models.ShipGeofenceState{})
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa thành công"})
+}
+
+// 5. Lịch sử vào/ra vùng (lọc theo ship_id, geofence_id, from/to)
+func GetGeofenceEvents(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var events []models.GeofenceEvent
+	query := database.DB.Where("created_at BETWEEN ? AND ?", from, to).Order("created_at desc").Limit(500)
+	if shipID := c.Query("ship_id"); shipID != "" {
+		query = query.Where("ship_id = ?", shipID)
+	}
+	if fenceID := c.Query("geofence_id"); fenceID != "" {
+		query = query.Where("geofence_id = ?", fenceID)
+	}
+	query.Find(&events)
+	c.JSON(http.StatusOK, events)
+}
+
+// 6. Các vùng tàu đang ở bên trong
+func GetShipGeofences(c *gin.Context) {
+	var fences []models.Geofence
+	database.DB.Joins("JOIN ship_geofence_states s ON s.geofence_id = geofences.id").
+		Where("s.ship_id = ? AND s.inside = ?", c.Param("ship_id"), true).Find(&fences)
+	c.JSON(http.StatusOK, fences)
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"marine-backend/models"
+	"testing"
+)
+
+// Vùng cảng hình vuông quanh (10, 107) và một vùng lõm hình chữ U
+var (
+	testSquare  = [][2]float64{{9, 106}, {9, 108}, {11, 108}, {11, 106}}
+	testUShaped = [][2]float64{{0, 0}, {0, 3}, {3, 3}, {3, 2}, {1, 2}, {1, 1}, {3, 1}, {3, 0}}
+)
+
+func TestPointInPolygon(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		polygon  [][2]float64
+		want     bool
+	}{
+		{"tâm vùng", 10, 107, testSquare, true},
+		{"ngoài về phía bắc", 11.5, 107, testSquare, false},
+		{"ngoài về phía đông", 10, 108.2, testSquare, false},
+		{"sát mép trong", 10.999, 107.999, testSquare, true},
+		{"đáy chữ U", 0.5, 1.5, testUShaped, true},
+		{"khe giữa chữ U", 2, 1.5, testUShaped, false},
+		{"nhánh trái chữ U", 2, 0.5, testUShaped, true},
+		{"nhánh phải chữ U", 2, 2.5, testUShaped, true},
+		{"đa giác rỗng", 10, 107, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pointInPolygon(tt.lat, tt.lon, tt.polygon); got != tt.want {
+				t.Errorf("pointInPolygon(%v, %v) = %v, want %v", tt.lat, tt.lon, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeofenceTransitions(t *testing.T) {
+	ship := models.Ship{ID: "IMO1", Company: "Acme"}
+	port := models.Geofence{ID: 1, Name: "Cảng", Polygon: testSquare}
+	otherCompany := models.Geofence{ID: 2, Name: "Cảng công ty khác", Polygon: testSquare, Company: "Other"}
+	otherShip := models.Geofence{ID: 3, Name: "Cảng tàu khác", Polygon: testSquare, ShipIDs: "IMO2, IMO3"}
+	line := models.Geofence{ID: 4, Name: "Thiếu đỉnh", Polygon: testSquare[:2]}
+	fences := []models.Geofence{port, otherCompany, otherShip, line}
+
+	tests := []struct {
+		name     string
+		inside   map[uint]bool
+		lat, lon float64
+		want     map[uint]bool // Vùng đổi trạng thái -> true = vào, false = rời
+	}{
+		{"lần đầu ở ngoài: không có sự kiện", map[uint]bool{}, 12, 107, map[uint]bool{}},
+		{"lần đầu ở trong: vào vùng", map[uint]bool{}, 10, 107, map[uint]bool{1: true}},
+		{"vẫn ở trong: không lặp lại", map[uint]bool{1: true}, 10.5, 107.5, map[uint]bool{}},
+		{"ra khỏi vùng", map[uint]bool{1: true}, 12, 107, map[uint]bool{1: false}},
+		{"vẫn ở ngoài", map[uint]bool{1: false}, 12, 107, map[uint]bool{}},
+		{"vùng không áp dụng cho tàu bị bỏ qua", map[uint]bool{2: false, 3: false}, 10, 107, map[uint]bool{1: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[uint]bool{}
+			for _, tr := range geofenceTransitions(fences, ship, tt.inside, tt.lat, tt.lon) {
+				got[tr.fence.ID] = tr.inside
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("geofenceTransitions() = %v, want %v", got, tt.want)
+			}
+			for id, in := range tt.want {
+				if v, ok := got[id]; !ok || v != in {
+					t.Errorf("geofenceTransitions() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,630 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+	"gorm.io/gorm"
+)
+
+var serviceRateKinds = map[string]bool{"crew_gb": true, "fixed_fee": true}
+
+// Trạng thái hóa đơn: draft -> issued -> paid
+var invoiceTransitions = map[string]string{"draft": "issued", "issued": "paid"}
+
+var invoiceCategories = []string{"airtime", "crew_usage", "voucher", "fixed_fee"}
+
+// Tuần tự hóa tạo hóa đơn / cấp số (số hóa đơn liên tục theo năm)
+var invoiceMu sync.Mutex
+
+var errInvoiceLocked = errors.New("Hóa đơn đã phát hành, không tạo lại được")
+
+// Chọn giá bán cụ thể nhất: theo tàu > theo công ty > chung
+func resolveServiceRate(rates []models.ServiceRate, kind string, ship models.Ship) *models.ServiceRate {
+	var best *models.ServiceRate
+	bestScore := -1
+	for i := range rates {
+		r := &rates[i]
+		if r.Kind != kind || (r.ShipID != "" && r.ShipID != ship.ID) {
+			continue
+		}
+		if r.Company != "" && !strings.EqualFold(r.Company, ship.Company) {
+			continue
+		}
+		score := 0
+		if r.ShipID != "" {
+			score += 2
+		}
+		if r.Company != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = r, score
+		}
+	}
+	return best
+}
+
+// Giá bán / GB cho thuyền viên: bảng giá crew_gb, chưa cấu hình thì theo giá airtime thực tế của tàu trong tháng
+type crewRates struct {
+	rates   []models.ServiceRate
+	ships   map[string]models.Ship
+	airtime map[string]float64
+}
+
+func loadCrewRates(monthStart, monthEnd time.Time) crewRates {
+	r := crewRates{ships: map[string]models.Ship{}, airtime: map[string]float64{}}
+	database.DB.Find(&r.rates)
+	var ships []models.Ship
+	database.DB.Select("id", "name", "company").Find(&ships)
+	for _, s := range ships {
+		r.ships[s.ID] = s
+	}
+	for _, sc := range fleetMonthlyCosts(monthStart, monthEnd, "", "") {
+		if sc.TotalGB > 0 {
+			r.airtime[sc.ShipID] = sc.TotalCost / sc.TotalGB
+		}
+	}
+	return r
+}
+
+func (r crewRates) perGB(shipID string) float64 {
+	if rate := resolveServiceRate(r.rates, "crew_gb", r.ships[shipID]); rate != nil {
+		return rate.Price
+	}
+	return round2(r.airtime[shipID])
+}
+
+// Các dòng hóa đơn của công ty trong tháng: airtime theo tàu / link, thuyền viên dùng vượt phụ cấp,
+// voucher bán ra và phí cố định
+func buildInvoiceLines(company string, start, end time.Time) []models.InvoiceLine {
+	lines := []models.InvoiceLine{}
+	add := func(category, shipID, desc string, qty float64, unit string, price float64) {
+		amount := round2(qty * price)
+		if amount <= 0 {
+			return
+		}
+		lines = append(lines, models.InvoiceLine{
+			Category: category, ShipID: shipID, Description: desc,
+			Quantity: round2(qty), Unit: unit, UnitPrice: round2(price), Amount: amount,
+		})
+	}
+
+	var ships []models.Ship
+	database.DB.Where("company = ?", company).Order("id").Find(&ships)
+	shipIDs := make([]string, 0, len(ships))
+	for _, s := range ships {
+		shipIDs = append(shipIDs, s.ID)
+	}
+
+	// 1. Airtime: phí thuê bao + vượt gói theo bảng giá nhà mạng
+	for _, sc := range fleetMonthlyCosts(start, end, "", company) {
+		for _, l := range sc.Links {
+			if l.Fee > 0 {
+				add("airtime", sc.ShipID, fmt.Sprintf("%s - %s subscription (%s, %.0f GB bundle)", sc.ShipName, l.LinkName, l.Tariff, l.BundleGB), 1, "month", l.Fee)
+			}
+			if l.OverageCost > 0 && l.OverageGB > 0 {
+				add("airtime", sc.ShipID, fmt.Sprintf("%s - %s usage beyond bundle", sc.ShipName, l.LinkName), l.OverageGB, "GB", l.OverageCost/l.OverageGB)
+			}
+		}
+	}
+
+	// 2. Thuyền viên dùng vượt phụ cấp công ty, gói và phần tự nạp (voucher đã tính ở mục 3, gói mua bằng ví)
+	rates := loadCrewRates(start, end)
+	for _, ship := range ships {
+		var crews []models.Crew
+		database.DB.Where("ship_id = ?", ship.ID).Find(&crews)
+		var paid int64
+		for _, crew := range crews {
+			var used, granted int64
+			database.DB.Model(&models.UsageDaily{}).Where("crew_id = ? AND day >= ? AND day < ?", crew.ID, start, end).
+				Select("COALESCE(SUM(bytes_in + bytes_out), 0)").Scan(&used)
+			var grants []models.AllowanceGrant
+			database.DB.Where("crew_id = ? AND period_start < ? AND period_end > ?", crew.ID, end, start).Find(&grants)
+			for _, g := range grants {
+				granted += grantWithin(g, start, end)
+			}
+			paid += crewOverageBytes(used, granted, planAllowance(crew.PlanID, crew.DataPlan), crewTopupBytes(crew.ID, start, end))
+		}
+		add("crew_usage", ship.ID, ship.Name+" - crew usage beyond allowance", bytesToGB(paid), "GB", rates.perGB(ship.ID))
+	}
+
+	// 3. Voucher phát hành trong tháng (trừ voucher đã thu hồi), theo tàu + gói
+	type voucherRow struct {
+		ShipID   string
+		PlanID   *uint
+		DataPlan string
+		Count    int64
+	}
+	var sold []voucherRow
+	if len(shipIDs) > 0 {
+		database.DB.Model(&models.Voucher{}).Select("ship_id, plan_id, data_plan, COUNT(*) AS count").
+			Where("ship_id IN ? AND status <> ? AND created_at >= ? AND created_at < ?", shipIDs, "Revoked", start, end).
+			Group("ship_id, plan_id, data_plan").Order("ship_id").Scan(&sold)
+	}
+	for _, v := range sold {
+		plan := lookupPlan(v.PlanID, v.DataPlan)
+		if plan == nil || (plan.Currency != "" && plan.Currency != walletCurrency) {
+			continue
+		}
+		add("voucher", v.ShipID, fmt.Sprintf("%s - vouchers %s", rates.ships[v.ShipID].Name, plan.Name), float64(v.Count), "voucher", plan.Price)
+	}
+
+	// 4. Phí cố định theo tàu
+	for _, ship := range ships {
+		if rate := resolveServiceRate(rates.rates, "fixed_fee", ship); rate != nil {
+			add("fixed_fee", ship.ID, fmt.Sprintf("%s - %s", ship.Name, rate.Name), 1, "month", rate.Price)
+		}
+	}
+	return lines
+}
+
+// Phần lưu lượng tính tiền theo crew_gb: trừ phụ cấp công ty, dung lượng gói và phần đã nạp thêm
+// (voucher / gói mua bằng ví đã được trả tiền riêng, không tính lần 2)
+func crewOverageBytes(used, granted, allowance, topup int64) int64 {
+	return max(0, used-granted-max(0, allowance)-max(0, topup))
+}
+
+// Dung lượng thuyền viên nạp thêm trong kỳ: voucher nạp vào tài khoản (không tính voucher quy đổi
+// thành tiền trong ví) + gói mua bằng ví
+func crewTopupBytes(crewID uint, start, end time.Time) int64 {
+	var credited []string
+	database.DB.Model(&models.WalletTransaction{}).Where("crew_id = ? AND source = ?", crewID, "voucher").Pluck("reference", &credited)
+	skip := make(map[string]bool, len(credited))
+	for _, code := range credited {
+		skip[code] = true
+	}
+
+	var total int64
+	var vouchers []models.Voucher
+	database.DB.Where("crew_id = ? AND used_at >= ? AND used_at < ?", crewID, start, end).Find(&vouchers)
+	for _, v := range vouchers {
+		if !skip[v.Code] {
+			total += planAllowance(v.PlanID, v.DataPlan)
+		}
+	}
+	var purchases []models.WalletTransaction
+	database.DB.Where("crew_id = ? AND source = ? AND created_at >= ? AND created_at < ?", crewID, "plan_purchase", start, end).Find(&purchases)
+	for _, p := range purchases {
+		if plan := lookupPlan(nil, p.Reference); plan != nil {
+			total += plan.DataAllowanceMB << 20
+		}
+	}
+	return total
+}
+
+// Tạo (hoặc tính lại) hóa đơn nháp của công ty cho tháng; hóa đơn đã phát hành giữ nguyên
+func generateInvoice(company string, start, end time.Time, username string) (models.Invoice, error) {
+	invoiceMu.Lock()
+	defer invoiceMu.Unlock()
+
+	var invoice models.Invoice
+	database.DB.Where("company = ? AND period_start = ?", company, start).Limit(1).Find(&invoice)
+	if invoice.ID != 0 && invoice.Status != "draft" {
+		return invoice, errInvoiceLocked
+	}
+	lines := buildInvoiceLines(company, start, end)
+	total := 0.0
+	for _, l := range lines {
+		total += l.Amount
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if invoice.ID == 0 {
+			invoice = models.Invoice{
+				Number: fmt.Sprintf("DRAFT-%d", time.Now().UnixNano()), Company: company, PeriodStart: start, PeriodEnd: end,
+				Status: "draft", Currency: walletCurrency, CreatedBy: username,
+			}
+			if err := tx.Create(&invoice).Error; err != nil {
+				return err
+			}
+			invoice.Number = fmt.Sprintf("DRAFT-%d", invoice.ID)
+		}
+		if err := tx.Where("invoice_id = ?", invoice.ID).Delete(&models.InvoiceLine{}).Error; err != nil {
+			return err
+		}
+		for i := range lines {
+			lines[i].InvoiceID = invoice.ID
+		}
+		if len(lines) > 0 {
+			if err := tx.Create(&lines).Error; err != nil {
+				return err
+			}
+		}
+		invoice.Total = round2(total)
+		return tx.Model(&invoice).Updates(map[string]interface{}{"number": invoice.Number, "total": invoice.Total}).Error
+	})
+	invoice.Lines = lines
+	return invoice, err
+}
+
+// Phần phụ cấp của chu kỳ quota rơi vào [start, end): chia theo thời gian khi chu kỳ lệch tháng (CycleDay != 1)
+func grantWithin(g models.AllowanceGrant, start, end time.Time) int64 {
+	from, to := g.PeriodStart, g.PeriodEnd
+	if start.After(from) {
+		from = start
+	}
+	if end.Before(to) {
+		to = end
+	}
+	cycle := g.PeriodEnd.Sub(g.PeriodStart)
+	if cycle <= 0 || !to.After(from) {
+		return 0
+	}
+	if to.Sub(from) == cycle {
+		return g.GrantedBytes
+	}
+	return int64(float64(g.GrantedBytes) * float64(to.Sub(from)) / float64(cycle))
+}
+
+func invoiceNumber(year, seq int) string { return fmt.Sprintf("INV-%d-%04d", year, seq) }
+
+// Số hóa đơn tiếp theo trong năm theo thứ tự số (không so chuỗi, qua 9999 vẫn tăng đúng); gọi khi đang giữ invoiceMu
+func nextInvoiceNumber(at time.Time) (string, int) {
+	var last int
+	database.DB.Model(&models.Invoice{}).Where("number_year = ?", at.Year()).Select("COALESCE(MAX(number_seq), 0)").Scan(&last)
+	return invoiceNumber(at.Year(), last+1), last + 1
+}
+
+func findInvoice(c *gin.Context) (models.Invoice, bool) {
+	var invoice models.Invoice
+	err := database.DB.Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).First(&invoice, c.Param("id")).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hóa đơn không tồn tại"})
+		return invoice, false
+	}
+	return invoice, true
+}
+
+// --- CÁC API ---
+
+// 1. GET /api/invoices?company=&month=YYYY-MM&status=
+func GetInvoices(c *gin.Context) {
+	var invoices []models.Invoice
+	query := database.DB.Order("period_start desc, company")
+	if company := c.Query("company"); company != "" {
+		query = query.Where("company = ?", company)
+	}
+	if c.Query("month") != "" {
+		start, _, err := queryMonth(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("period_start = ?", start)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Limit(500).Find(&invoices)
+	c.JSON(http.StatusOK, invoices)
+}
+
+// 2. POST /api/invoices/generate {company, month: YYYY-MM} : tạo hóa đơn nháp (company rỗng = mọi công ty)
+func GenerateInvoices(c *gin.Context) {
+	var req struct {
+		Company string `json:"company"`
+		Month   string `json:"month"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	month, err := time.ParseInLocation("2006-01", req.Month, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "month phải có dạng YYYY-MM"})
+		return
+	}
+	start, end := monthBounds(month)
+
+	companies := []string{strings.TrimSpace(req.Company)}
+	if companies[0] == "" {
+		companies = nil
+		database.DB.Model(&models.Ship{}).Where("company <> ''").Distinct().Order("company").Pluck("company", &companies)
+	}
+
+	invoices := []models.Invoice{}
+	skipped := []string{}
+	for _, company := range companies {
+		invoice, err := generateInvoice(company, start, end, c.GetString("username"))
+		if errors.Is(err, errInvoiceLocked) {
+			skipped = append(skipped, company)
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+			return
+		}
+		invoices = append(invoices, invoice)
+	}
+	recordAudit(c, fmt.Sprintf("Generated %d invoice(s) for %s", len(invoices), start.Format("2006-01")), "Success")
+	c.JSON(http.StatusOK, gin.H{"invoices": invoices, "skipped": skipped})
+}
+
+// 3. GET /api/invoices/:id : hóa đơn + các dòng
+func GetInvoice(c *gin.Context) {
+	invoice, ok := findInvoice(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, invoice)
+}
+
+// 4. POST /api/invoices/:id/status {status: issued|paid} : phát hành (cấp số) / xác nhận đã thanh toán
+func UpdateInvoiceStatus(c *gin.Context) {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	invoiceMu.Lock()
+	defer invoiceMu.Unlock()
+
+	invoice, ok := findInvoice(c)
+	if !ok {
+		return
+	}
+	if invoiceTransitions[invoice.Status] != req.Status {
+		c.JSON(http.StatusConflict, gin.H{"error": "Hóa đơn đang ở trạng thái " + invoice.Status + ", không chuyển sang " + req.Status + " được"})
+		return
+	}
+	now := time.Now()
+	updates := map[string]interface{}{"status": req.Status}
+	if req.Status == "issued" {
+		if len(invoice.Lines) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Hóa đơn không có dòng nào"})
+			return
+		}
+		number, seq := nextInvoiceNumber(now)
+		updates["number"], updates["number_year"], updates["number_seq"], updates["issued_at"] = number, now.Year(), seq, now
+	} else {
+		updates["paid_at"] = now
+	}
+	result := database.DB.Model(&models.Invoice{}).Where("id = ? AND status = ?", invoice.ID, invoice.Status).Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	database.DB.First(&invoice, invoice.ID)
+	recordAudit(c, fmt.Sprintf("Invoice %s (%s) marked %s", invoice.Number, invoice.Company, req.Status), "Success")
+	c.JSON(http.StatusOK, invoice)
+}
+
+// 5. Xóa hóa đơn nháp
+func DeleteInvoice(c *gin.Context) {
+	invoice, ok := findInvoice(c)
+	if !ok {
+		return
+	}
+	if invoice.Status != "draft" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Chỉ xóa được hóa đơn nháp"})
+		return
+	}
+	if err := database.DB.Select("Lines").Delete(&invoice).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
+		return
+	}
+	recordAudit(c, fmt.Sprintf("Deleted draft invoice #%d (%s, %s)", invoice.ID, invoice.Company, invoice.PeriodStart.Format("2006-01")), "Success")
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa thành công"})
+}
+
+// Các dòng theo nhóm, đúng thứ tự in trên hóa đơn
+func invoiceSections(invoice models.Invoice) map[string][]models.InvoiceLine {
+	sections := map[string][]models.InvoiceLine{}
+	for _, l := range invoice.Lines {
+		sections[l.Category] = append(sections[l.Category], l)
+	}
+	for _, lines := range sections {
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].ShipID < lines[j].ShipID })
+	}
+	return sections
+}
+
+func renderInvoicePDF(invoice models.Invoice) *gofpdf.Fpdf {
+	titles := map[string]string{"airtime": "Airtime", "crew_usage": "Crew paid usage", "voucher": "Vouchers sold", "fixed_fee": "Fixed fees"}
+	widths := []float64{95, 20, 15, 30, 30}
+
+	pdf := newPDF()
+	pdf.AddPage()
+	pdf.SetFont("DejaVu", "B", 20)
+	pdf.Cell(190, 10, "MARINE PORTAL - INVOICE")
+	pdf.Ln(14)
+
+	pdf.SetFont("DejaVu", "", 11)
+	for _, row := range [][2]string{
+		{"Invoice No.", invoice.Number},
+		{"Status", strings.ToUpper(invoice.Status)},
+		{"Bill to", invoice.Company},
+		{"Period", invoice.PeriodStart.Format("2006-01-02") + " - " + invoice.PeriodEnd.AddDate(0, 0, -1).Format("2006-01-02")},
+	} {
+		pdf.CellFormat(35, 7, row[0]+":", "", 0, "", false, 0, "")
+		pdf.CellFormat(0, 7, row[1], "", 1, "", false, 0, "")
+	}
+	if invoice.IssuedAt != nil {
+		pdf.CellFormat(35, 7, "Issued:", "", 0, "", false, 0, "")
+		pdf.CellFormat(0, 7, invoice.IssuedAt.Format("2006-01-02"), "", 1, "", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	sections := invoiceSections(invoice)
+	for _, category := range invoiceCategories {
+		lines := sections[category]
+		if len(lines) == 0 {
+			continue
+		}
+		pdf.SetFont("DejaVu", "B", 11)
+		pdf.CellFormat(0, 8, titles[category], "", 1, "", false, 0, "")
+		pdf.SetFont("DejaVu", "B", 9)
+		pdf.SetFillColor(240, 240, 240)
+		for i, h := range []string{"Description", "Qty", "Unit", "Unit price", "Amount"} {
+			align := "R"
+			if i == 0 || i == 2 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 7, h, "1", 0, align, true, 0, "")
+		}
+		pdf.Ln(-1)
+
+		pdf.SetFont("DejaVu", "", 9)
+		subtotal := 0.0
+		for _, l := range lines {
+			pdf.CellFormat(widths[0], 6, l.Description, "1", 0, "L", false, 0, "")
+			pdf.CellFormat(widths[1], 6, strconv.FormatFloat(l.Quantity, 'f', -1, 64), "1", 0, "R", false, 0, "")
+			pdf.CellFormat(widths[2], 6, l.Unit, "1", 0, "L", false, 0, "")
+			pdf.CellFormat(widths[3], 6, fmt.Sprintf("%.2f", l.UnitPrice), "1", 0, "R", false, 0, "")
+			pdf.CellFormat(widths[4], 6, fmt.Sprintf("%.2f", l.Amount), "1", 1, "R", false, 0, "")
+			subtotal += l.Amount
+		}
+		pdf.SetFont("DejaVu", "B", 9)
+		pdf.CellFormat(160, 6, "Subtotal", "1", 0, "R", false, 0, "")
+		pdf.CellFormat(30, 6, fmt.Sprintf("%.2f", round2(subtotal)), "1", 1, "R", false, 0, "")
+		pdf.Ln(4)
+	}
+
+	pdf.SetFont("DejaVu", "B", 12)
+	pdf.CellFormat(160, 9, "TOTAL ("+invoice.Currency+")", "1", 0, "R", true, 0, "")
+	pdf.CellFormat(30, 9, fmt.Sprintf("%.2f", invoice.Total), "1", 1, "R", true, 0, "")
+	if invoice.Status == "draft" {
+		pdf.Ln(6)
+		pdf.SetFont("DejaVu", "I", 10)
+		pdf.Cell(0, 8, "Draft - amounts may change until the invoice is issued.")
+	}
+	return pdf
+}
+
+// 6. GET /api/invoices/:id/pdf
+func DownloadInvoicePDF(c *gin.Context) {
+	invoice, ok := findInvoice(c)
+	if !ok {
+		return
+	}
+	pdf := renderInvoicePDF(invoice)
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf", invoice.Number))
+	if err := pdf.Output(c.Writer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi tạo file PDF"})
+	}
+}
+
+// 7. GET /api/invoices/:id/csv
+func DownloadInvoiceCSV(c *gin.Context) {
+	invoice, ok := findInvoice(c)
+	if !ok {
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", invoice.Number))
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"Invoice", "Company", "Period", "Status", "Category", "Ship ID", "Description", "Quantity", "Unit", "Unit price", "Amount", "Currency"})
+	period := invoice.PeriodStart.Format("2006-01")
+	sections := invoiceSections(invoice)
+	for _, category := range invoiceCategories {
+		for _, l := range sections[category] {
+			w.Write([]string{
+				invoice.Number, invoice.Company, period, invoice.Status, l.Category, l.ShipID, l.Description,
+				strconv.FormatFloat(l.Quantity, 'f', -1, 64), l.Unit, fmt.Sprintf("%.2f", l.UnitPrice), fmt.Sprintf("%.2f", l.Amount), invoice.Currency,
+			})
+		}
+	}
+	w.Write([]string{invoice.Number, invoice.Company, period, invoice.Status, "total", "", "Total", "", "", "", fmt.Sprintf("%.2f", invoice.Total), invoice.Currency})
+	w.Flush()
+}
+
+// --- Bảng giá bán ---
+
+func validateServiceRate(r *models.ServiceRate) string {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return "Thiếu tên bảng giá"
+	}
+	if !serviceRateKinds[r.Kind] {
+		return "Loại giá phải là crew_gb hoặc fixed_fee"
+	}
+	if r.Price < 0 || math.IsNaN(r.Price) {
+		return "Giá trị không được âm"
+	}
+	if r.Currency == "" {
+		r.Currency = walletCurrency
+	}
+	if r.Currency != walletCurrency {
+		return "Hóa đơn chỉ hỗ trợ " + walletCurrency
+	}
+	return ""
+}
+
+// 8. Danh sách giá bán
+func GetServiceRates(c *gin.Context) {
+	var rates []models.ServiceRate
+	database.DB.Order("kind, id").Find(&rates)
+	c.JSON(http.StatusOK, rates)
+}
+
+// 9. Tạo giá bán
+func CreateServiceRate(c *gin.Context) {
+	var input models.ServiceRate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateServiceRate(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID = 0
+	input.CreatedAt = time.Now()
+	if err := database.DB.Create(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	recordAudit(c, fmt.Sprintf("Created service rate #%d %s (%s %.2f)", input.ID, input.Name, input.Kind, input.Price), "Success")
+	c.JSON(http.StatusCreated, input)
+}
+
+// 10. Sửa giá bán (hóa đơn đã phát hành không đổi)
+func UpdateServiceRate(c *gin.Context) {
+	var rate models.ServiceRate
+	if err := database.DB.First(&rate, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bảng giá không tồn tại"})
+		return
+	}
+	var input models.ServiceRate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateServiceRate(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID, input.CreatedAt = rate.ID, rate.CreatedAt
+	if err := database.DB.Save(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	recordAudit(c, fmt.Sprintf("Updated service rate #%d %s (%s %.2f -> %.2f)", input.ID, input.Name, input.Kind, rate.Price, input.Price), "Success")
+	c.JSON(http.StatusOK, input)
+}
+
+// 11. Xóa giá bán
+func DeleteServiceRate(c *gin.Context) {
+	if err := database.DB.Delete(&models.ServiceRate{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
+		return
+	}
+	recordAudit(c, "Deleted service rate #"+c.Param("id"), "Success")
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa thành công"})
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"marine-backend/models"
+	"testing"
+	"time"
+)
+
+func TestInvoiceNumber(t *testing.T) {
+	tests := []struct {
+		year, seq int
+		want      string
+	}{
+		{2026, 1, "INV-2026-0001"},
+		{2026, 42, "INV-2026-0042"},
+		{2026, 9999, "INV-2026-9999"},
+		{2026, 10000, "INV-2026-10000"},
+		{2027, 123456, "INV-2027-123456"},
+	}
+	for _, tt := range tests {
+		if got := invoiceNumber(tt.year, tt.seq); got != tt.want {
+			t.Errorf("invoiceNumber(%d, %d) = %s, want %s", tt.year, tt.seq, got, tt.want)
+		}
+	}
+}
+
+func TestGrantWithin(t *testing.T) {
+	day := func(m time.Month, d int) time.Time { return time.Date(2026, m, d, 0, 0, 0, 0, time.UTC) }
+	const gb = int64(1 << 30)
+	monthStart, monthEnd := day(4, 1), day(5, 1)
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       int64
+	}{
+		{"chu kỳ trùng tháng", day(4, 1), day(5, 1), 30 * gb},
+		{"chu kỳ 15/3 - 15/4: 14/31 rơi vào tháng 4", day(3, 15), day(4, 15), 30 * gb * 14 / 31},
+		{"chu kỳ 15/4 - 15/5: 16/30 rơi vào tháng 4", day(4, 15), day(5, 15), 16 * gb},
+		{"chu kỳ tháng trước", day(3, 1), day(4, 1), 0},
+		{"chu kỳ tháng sau", day(5, 1), day(6, 1), 0},
+		{"chu kỳ rỗng", day(4, 10), day(4, 10), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := models.AllowanceGrant{PeriodStart: tt.start, PeriodEnd: tt.end, GrantedBytes: 30 * gb}
+			if got := grantWithin(g, monthStart, monthEnd); got != tt.want {
+				t.Errorf("grantWithin() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// Hai chu kỳ lệch tháng cộng lại đúng bằng phụ cấp 1 chu kỳ khi mức không đổi (30 ngày tháng 4)
+	a := grantWithin(models.AllowanceGrant{PeriodStart: day(3, 15), PeriodEnd: day(4, 15), GrantedBytes: 31 * gb}, monthStart, monthEnd)
+	b := grantWithin(models.AllowanceGrant{PeriodStart: day(4, 15), PeriodEnd: day(5, 15), GrantedBytes: 30 * gb}, monthStart, monthEnd)
+	if a+b != 30*gb {
+		t.Errorf("tổng 2 chu kỳ = %d, want %d", a+b, 30*gb)
+	}
+}
+
+func TestCrewOverageBytes(t *testing.T) {
+	const gb = int64(1 << 30)
+	tests := []struct {
+		name                            string
+		used, granted, allowance, topup int64
+		want                            int64
+	}{
+		{"trong phụ cấp", 4 * gb, 5 * gb, 0, 0, 0},
+		{"vượt phụ cấp, gói không giới hạn", 8 * gb, 5 * gb, 0, 0, 3 * gb},
+		{"gói 2GB đã trừ trước", 8 * gb, 5 * gb, 2 * gb, 0, 1 * gb},
+		{"voucher nạp thêm không tính lần 2", 8 * gb, 5 * gb, 2 * gb, 1 * gb, 0},
+		{"nạp thêm nhiều hơn phần vượt", 8 * gb, 5 * gb, 0, 10 * gb, 0},
+		{"vượt cả gói lẫn phần nạp", 12 * gb, 5 * gb, 2 * gb, 1 * gb, 4 * gb},
+		{"chưa có phụ cấp", 3 * gb, 0, 1 * gb, 0, 2 * gb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crewOverageBytes(tt.used, tt.granted, tt.allowance, tt.topup); got != tt.want {
+				t.Errorf("crewOverageBytes() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Giới hạn số mẫu trả về cho biểu đồ chất lượng link của 1 tàu
+const maxLinkSamples = 2000
+
+// Lưu mẫu chất lượng link và ghi nhận chuyển beam / vệ tinh (gọi từ recordHeartbeat)
+func recordLinkQuality(previous models.Ship, source string, hb HeartbeatInput, now time.Time) {
+	satellite, beam := previous.Satellite, previous.Beam
+	if hb.Satellite != "" {
+		satellite = hb.Satellite
+	}
+	if hb.Beam != "" {
+		beam = hb.Beam
+	}
+
+	// Heartbeat không mang thông tin link (VD: chỉ probe router) thì không lưu mẫu
+	if hb.SNR != nil || hb.ModemLock != nil || hb.Satellite != "" || hb.Beam != "" ||
+		hb.LatencyMs != nil || hb.ObstructionPct != nil || hb.UplinkState != "" {
+		database.DB.Create(&models.LinkSample{
+			ShipID: previous.ID, Satellite: satellite, Beam: beam,
+			SNR: hb.SNR, ModemLock: hb.ModemLock,
+			LatencyMs: hb.LatencyMs, ObstructionPct: hb.ObstructionPct, UplinkState: hb.UplinkState,
+			Source: source, RecordedAt: now,
+		})
+	}
+
+	// Lần đầu biết beam chưa tính là handover
+	if previous.Beam == "" && previous.Satellite == "" {
+		return
+	}
+	if satellite == previous.Satellite && beam == previous.Beam {
+		return
+	}
+
+	handover := models.BeamHandover{
+		ShipID:        previous.ID,
+		FromSatellite: previous.Satellite, FromBeam: previous.Beam,
+		ToSatellite: satellite, ToBeam: beam,
+		SNRBefore: previous.SNR, Lat: previous.Lat, Lon: previous.Lon, CreatedAt: now,
+	}
+	database.DB.Create(&handover)
+	fmt.Printf("🛰️ Tàu %s chuyển beam %s/%s → %s/%s\n", previous.ID, previous.Satellite, previous.Beam, satellite, beam)
+	PublishEvent(StreamEvent{Type: "handover", ShipID: previous.ID, Company: previous.Company, Data: handover})
+}
+
+// --- CÁC API ---
+
+// GET /api/ships/:ship_id/link-history?from=&to= : SNR, trạng thái khóa modem, beam theo thời gian + các lần handover
+func GetShipLinkHistory(c *gin.Context) {
+	shipID := c.Param("ship_id")
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var samples []models.LinkSample
+	if err := database.DB.Where("ship_id = ? AND recorded_at BETWEEN ? AND ?", shipID, from, to).
+		Order("recorded_at").Find(&samples).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lấy dữ liệu"})
+		return
+	}
+
+	// Thống kê trên toàn bộ mẫu trước khi lấy mẫu đều cho biểu đồ
+	threshold := currentSnrThreshold()
+	var snrSum, snrMin float64
+	var snrCount, below, locked, lockKnown int
+	snrMin = math.MaxFloat64
+	for _, s := range samples {
+		if s.SNR != nil {
+			snrSum += *s.SNR
+			snrMin = math.Min(snrMin, *s.SNR)
+			snrCount++
+			if *s.SNR < threshold {
+				below++
+			}
+		}
+		if s.ModemLock != nil {
+			lockKnown++
+			if *s.ModemLock {
+				locked++
+			}
+		}
+	}
+	summary := gin.H{"samples": len(samples), "snr_threshold": threshold}
+	if snrCount > 0 {
+		summary["avg_snr"] = math.Round(snrSum/float64(snrCount)*10) / 10
+		summary["min_snr"] = snrMin
+		summary["below_threshold_pct"] = math.Round(float64(below)/float64(snrCount)*1000) / 10
+	}
+	if lockKnown > 0 {
+		summary["lock_pct"] = math.Round(float64(locked)/float64(lockKnown)*1000) / 10
+	}
+
+	if len(samples) > maxLinkSamples {
+		step := float64(len(samples)-1) / float64(maxLinkSamples-1)
+		sampled := make([]models.LinkSample, 0, maxLinkSamples)
+		for i := 0; i < maxLinkSamples; i++ {
+			sampled = append(sampled, samples[int(math.Round(float64(i)*step))])
+		}
+		samples = sampled
+	}
+
+	var handovers []models.BeamHandover
+	database.DB.Where("ship_id = ? AND created_at BETWEEN ? AND ?", shipID, from, to).Order("created_at").Find(&handovers)
+	summary["handovers"] = len(handovers)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ship_id": shipID, "from": from, "to": to,
+		"summary": summary, "samples": samples, "handovers": handovers,
+	})
+}
+
+// GET /api/handovers?ship_id=&beam=&from=&to= : lịch sử chuyển beam toàn đội tàu
+func GetBeamHandovers(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var handovers []models.BeamHandover
+	query := database.DB.Where("created_at BETWEEN ? AND ?", from, to).Order("created_at desc").Limit(500)
+	if shipID := c.Query("ship_id"); shipID != "" {
+		query = query.Where("ship_id = ?", shipID)
+	}
+	if beam := c.Query("beam"); beam != "" {
+		query = query.Where("from_beam = ? OR to_beam = ?", beam, beam)
+	}
+	query.Find(&handovers)
+	c.JSON(http.StatusOK, handovers)
+}
+
+// Thống kê chất lượng theo vệ tinh / beam
+type beamStat struct {
+	Satellite         string   `json:"satellite"`
+	Beam              string   `json:"beam,omitempty"`
+	Ships             int      `json:"ships"`
+	Samples           int      `json:"samples"`
+	AvgSNR            *float64 `json:"avg_snr"` // nil = terminal không báo SNR trong khoảng thời gian
+	MinSNR            *float64 `json:"min_snr"`
+	P10SNR            *float64 `json:"p10_snr"` // 10% mẫu tệ nhất thấp hơn mức này
+	BelowThresholdPct float64  `json:"below_threshold_pct"`
+	UnlockPct         float64  `json:"unlock_pct"`
+	HandoversIn       int      `json:"handovers_in"`
+	HandoversOut      int      `json:"handovers_out"`
+}
+
+// Tệ nhất trước: nhiều thời gian dưới ngưỡng / mất khóa nhất, rồi SNR trung bình thấp nhất;
+// beam không có mẫu SNR không so được SNR -> xếp sau các beam có SNR cùng mức
+func sortBeamStats(stats []beamStat) {
+	sort.SliceStable(stats, func(i, j int) bool {
+		bi := stats[i].BelowThresholdPct + stats[i].UnlockPct
+		bj := stats[j].BelowThresholdPct + stats[j].UnlockPct
+		if bi != bj {
+			return bi > bj
+		}
+		ai, aj := stats[i].AvgSNR, stats[j].AvgSNR
+		if ai == nil || aj == nil {
+			return ai != nil && aj == nil
+		}
+		return *ai < *aj
+	})
+}
+
+// GET /api/analytics/beams?from=&to=&group=beam|satellite
+// Xếp hạng beam / vệ tinh từ tệ nhất tới tốt nhất để làm việc với nhà cung cấp VSAT
+func GetBeamStats(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	byBeam := c.DefaultQuery("group", "beam") != "satellite"
+	threshold := currentSnrThreshold()
+
+	groupCols := "satellite"
+	if byBeam {
+		groupCols = "satellite, beam"
+	}
+
+	var stats []beamStat
+	err = database.DB.Model(&models.LinkSample{}).
+		Select(groupCols+`,
+			COUNT(DISTINCT ship_id) AS ships,
+			COUNT(*) AS samples,
+			AVG(snr) AS avg_snr,
+			MIN(snr) AS min_snr,
+			PERCENTILE_CONT(0.1) WITHIN GROUP (ORDER BY snr) AS p10_snr,
+			COALESCE(100.0 * SUM(CASE WHEN snr < ? THEN 1 ELSE 0 END) / NULLIF(COUNT(snr), 0), 0) AS below_threshold_pct,
+			COALESCE(100.0 * SUM(CASE WHEN modem_lock = false THEN 1 ELSE 0 END) / NULLIF(COUNT(modem_lock), 0), 0) AS unlock_pct`, threshold).
+		Where("recorded_at BETWEEN ? AND ? AND satellite <> ''", from, to).
+		Group(groupCols).
+		Scan(&stats).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi tính thống kê"})
+		return
+	}
+
+	// Đếm handover vào / ra từng beam
+	var handovers []models.BeamHandover
+	database.DB.Where("created_at BETWEEN ? AND ?", from, to).Find(&handovers)
+	key := func(satellite, beam string) string {
+		if !byBeam {
+			return satellite
+		}
+		return satellite + "/" + beam
+	}
+	index := make(map[string]int, len(stats))
+	for i := range stats {
+		index[key(stats[i].Satellite, stats[i].Beam)] = i
+	}
+	for _, h := range handovers {
+		if i, ok := index[key(h.ToSatellite, h.ToBeam)]; ok {
+			stats[i].HandoversIn++
+		}
+		if i, ok := index[key(h.FromSatellite, h.FromBeam)]; ok {
+			stats[i].HandoversOut++
+		}
+	}
+
+	round := func(v *float64) {
+		if v != nil {
+			*v = math.Round(*v*10) / 10
+		}
+	}
+	for i := range stats {
+		round(stats[i].AvgSNR)
+		round(stats[i].P10SNR)
+		stats[i].BelowThresholdPct = math.Round(stats[i].BelowThresholdPct*10) / 10
+		stats[i].UnlockPct = math.Round(stats[i].UnlockPct*10) / 10
+	}
+
+	sortBeamStats(stats)
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "snr_threshold": threshold, "items": stats})
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortBeamStats(t *testing.T) {
+	snr := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name  string
+		stats []beamStat
+		want  []string
+	}{
+		{"dưới ngưỡng nhiều nhất lên đầu", []beamStat{
+			{Beam: "A", BelowThresholdPct: 5, AvgSNR: snr(6)},
+			{Beam: "B", BelowThresholdPct: 20, AvgSNR: snr(9)},
+			{Beam: "C", BelowThresholdPct: 1, UnlockPct: 10, AvgSNR: snr(12)},
+		}, []string{"B", "C", "A"}},
+		{"cùng mức: SNR thấp hơn lên trước", []beamStat{
+			{Beam: "A", AvgSNR: snr(11)},
+			{Beam: "B", AvgSNR: snr(7.5)},
+		}, []string{"B", "A"}},
+		{"không có SNR xếp sau beam có SNR cùng mức", []beamStat{
+			{Beam: "A"},
+			{Beam: "B", AvgSNR: snr(13)},
+			{Beam: "C"},
+			{Beam: "D", AvgSNR: snr(0)},
+		}, []string{"D", "B", "A", "C"}},
+		{"không có SNR vẫn xếp theo % mất khóa", []beamStat{
+			{Beam: "A", AvgSNR: snr(3)},
+			{Beam: "B", UnlockPct: 40},
+		}, []string{"B", "A"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sortBeamStats(tt.stats)
+			got := make([]string, len(tt.stats))
+			for i, s := range tt.stats {
+				got[i] = s.Beam
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortBeamStats() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Cộng lưu lượng vào ô giờ của link (upsert cộng dồn)
+func addLinkUsage(shipID, linkName, linkKind string, rxBytes, txBytes int64, at time.Time) {
+	if rxBytes <= 0 && txBytes <= 0 {
+		return
+	}
+	row := models.LinkUsage{
+		ShipID: shipID, LinkName: linkName, LinkKind: linkKind,
+		PeriodStart: at.Truncate(time.Hour), RxBytes: rxBytes, TxBytes: txBytes,
+	}
+	database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "ship_id"}, {Name: "link_name"}, {Name: "period_start"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"rx_bytes": gorm.Expr("link_usages.rx_bytes + EXCLUDED.rx_bytes"),
+			"tx_bytes": gorm.Expr("link_usages.tx_bytes + EXCLUDED.tx_bytes"),
+		}),
+	}).Create(&row)
+}
+
+// Cộng lưu lượng phúc lợi thuyền viên của tàu vào ô giờ
+func addWelfareUsage(shipID string, bytes int64, at time.Time) {
+	if shipID == "" || bytes <= 0 {
+		return
+	}
+	row := models.WelfareUsage{ShipID: shipID, PeriodStart: at.Truncate(time.Hour), Bytes: bytes}
+	database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "ship_id"}, {Name: "period_start"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"bytes": gorm.Expr("welfare_usages.bytes + EXCLUDED.bytes")}),
+	}).Create(&row)
+}
+
+// Chênh lệch bộ đếm; bộ đếm nhỏ hơn lần trước = router khởi động lại / reset -> tính từ 0
+func counterDelta(previous, current int64) int64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// Worker đọc bộ đếm rx/tx của các interface WAN trên router
+func StartLinkUsageCollector() {
+	interval := envSeconds("LINK_USAGE_INTERVAL", 5*time.Minute)
+	for {
+		var links []models.ShipLink
+		database.DB.Where("interface <> ''").Find(&links)
+		byShip := make(map[string][]models.ShipLink)
+		for _, l := range links {
+			byShip[l.ShipID] = append(byShip[l.ShipID], l)
+		}
+		for shipID, shipLinks := range byShip {
+			if err := collectLinkUsage(shipID, shipLinks); err != nil {
+				fmt.Printf("⚠️ Không đọc được bộ đếm interface tàu %s: %v\n", shipID, err)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+func collectLinkUsage(shipID string, links []models.ShipLink) error {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return err
+	}
+	res, err := client.Run("/interface/print", "=stats=")
+	client.Close()
+	if err != nil {
+		return err
+	}
+
+	counters := make(map[string][2]int64, len(res.Re))
+	for _, re := range res.Re {
+		rx, _ := strconv.ParseInt(re.Map["rx-byte"], 10, 64)
+		tx, _ := strconv.ParseInt(re.Map["tx-byte"], 10, 64)
+		counters[re.Map["name"]] = [2]int64{rx, tx}
+	}
+
+	now := time.Now()
+	for _, l := range links {
+		cur, ok := counters[l.Interface]
+		if !ok {
+			continue
+		}
+		var last models.InterfaceCounter
+		err := database.DB.Where("ship_id = ? AND interface = ?", shipID, l.Interface).First(&last).Error
+		// Lần đầu thấy interface: chỉ lưu mốc, chưa tính lưu lượng
+		if err == nil {
+			addLinkUsage(shipID, l.Name, l.Kind, counterDelta(last.RxBytes, cur[0]), counterDelta(last.TxBytes, cur[1]), now)
+		}
+		database.DB.Save(&models.InterfaceCounter{ShipID: shipID, Interface: l.Interface, RxBytes: cur[0], TxBytes: cur[1], UpdatedAt: now})
+	}
+	return nil
+}
+
+// --- API ---
+
+// GET /api/ships/:ship_id/link-usage?from=&to= : tổng và chuỗi theo giờ của từng link
+func GetShipLinkUsage(c *gin.Context) {
+	shipID := c.Param("ship_id")
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rows []models.LinkUsage
+	database.DB.Where("ship_id = ? AND period_start BETWEEN ? AND ?", shipID, from.Truncate(time.Hour), to).
+		Order("period_start").Find(&rows)
+
+	type linkTotal struct {
+		LinkName string             `json:"link_name"`
+		LinkKind string             `json:"link_kind"`
+		RxGB     float64            `json:"rx_gb"`
+		TxGB     float64            `json:"tx_gb"`
+		TotalGB  float64            `json:"total_gb"`
+		Series   []models.LinkUsage `json:"series"`
+	}
+	totals := []*linkTotal{}
+	index := map[string]*linkTotal{}
+	for _, r := range rows {
+		t, ok := index[r.LinkName]
+		if !ok {
+			t = &linkTotal{LinkName: r.LinkName, LinkKind: r.LinkKind}
+			index[r.LinkName] = t
+			totals = append(totals, t)
+		}
+		t.RxGB += bytesToGB(r.RxBytes)
+		t.TxGB += bytesToGB(r.TxBytes)
+		t.Series = append(t.Series, r)
+	}
+	for _, t := range totals {
+		t.RxGB = math.Round(t.RxGB*1000) / 1000
+		t.TxGB = math.Round(t.TxGB*1000) / 1000
+		t.TotalGB = math.Round((t.RxGB+t.TxGB)*1000) / 1000
+	}
+
+	var welfareBytes int64
+	database.DB.Model(&models.WelfareUsage{}).Select("COALESCE(SUM(bytes), 0)").
+		Where("ship_id = ? AND period_start BETWEEN ? AND ?", shipID, from.Truncate(time.Hour), to).Scan(&welfareBytes)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ship_id": shipID, "from": from, "to": to,
+		"links": totals, "welfare_gb": math.Round(bytesToGB(welfareBytes)*1000) / 1000,
+	})
+}
+
+func bytesToGB(b int64) float64 { return float64(b) / 1024 / 1024 / 1024 }
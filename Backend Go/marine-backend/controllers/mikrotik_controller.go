@@ -25,7 +25,7 @@ func ConnectToRouter(shipID string) (*routeros.Client, *models.Ship, error) {
 	if ship.RouterIP == "" { return nil, nil, fmt.Errorf("IP rỗng") }
 	if ship.RouterPort == 0 { ship.RouterPort = 8728 }
 
-	address := fmt.Sprintf("%s:%d", ship.RouterIP, ship.RouterPort)
+	address := net.JoinHostPort(ship.RouterIP, strconv.Itoa(ship.RouterPort))
 	conn, err := net.DialTimeout("tcp", address, 3*time.Second)
 	if err != nil { return nil, &ship, err }
 
@@ -67,7 +67,7 @@ func connectSFTP(ship *models.Ship) (*sftp.Client, *ssh.Client, error) {
 // API 1: Monitor Health
 func GetRouterHealth(c *gin.Context) {
 	shipID := c.Param("ship_id")
-	client, _, err := connectToRouter(shipID)
+	client, _, err := ConnectToRouter(shipID)
 	
 	if err != nil {
 		// Trả về data giả lập để Web không lỗi 502
@@ -112,7 +112,7 @@ func UploadConfigFile(c *gin.Context) {
 	defer file.Close()
 
 	// 1. Lấy thông tin tàu
-	_, ship, err := connectToRouter(shipID)
+	_, ship, err := ConnectToRouter(shipID)
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Không tìm thấy tàu hoặc Router Offline"})
 		return
@@ -143,7 +143,7 @@ func UploadConfigFile(c *gin.Context) {
 
 	// 4. (Tùy chọn) Tự động chạy lệnh Import file vừa up
 	// Cần kết nối lại API để chạy lệnh /import
-	apiClient, _, _ := connectToRouter(shipID)
+	apiClient, _, _ := ConnectToRouter(shipID)
 	if apiClient != nil {
 		defer apiClient.Close()
 		// Lệnh import file cấu hình
@@ -159,7 +159,7 @@ func RunTerminalCommand(c *gin.Context) {
 	var req struct { Command string `json:"command"` }
 	c.ShouldBindJSON(&req)
 
-	client, _, err := connectToRouter(shipID)
+	client, _, err := ConnectToRouter(shipID)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"output": "Error: Router Offline"})
 		return
@@ -185,25 +185,29 @@ func RunTerminalCommand(c *gin.Context) {
 }
 // HÀM MỚI: Áp dụng chặn ứng dụng theo cấu hình
 func ApplyFirewallRules(c *gin.Context) {
-	shipID := "IMO9562623" // ID tàu đang test (Hoặc lấy từ params)
+	shipID := c.DefaultQuery("ship_id", "IMO9562623") // Mặc định tàu đang test
 	
 	// Nhận cấu hình từ Frontend gửi lên
-	var config struct {
-		BlockYoutube  bool `json:"block_youtube"`
-		BlockFacebook bool `json:"block_facebook"`
-		BlockTiktok   bool `json:"block_tiktok"`
-		BlockTorrent  bool `json:"block_torrent"`
-	}
+	var config models.FirewallPolicy
 	if err := c.ShouldBindJSON(&config); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	client, _, err := connectToRouter(shipID)
-	if err != nil {
+	if err := applyFirewallPolicy(shipID, config); err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Router Offline"})
 		return
 	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Đã cập nhật Tường lửa thành công!"})
+}
+
+// Đẩy chính sách chặn ứng dụng xuống router của tàu
+func applyFirewallPolicy(shipID string, config models.FirewallPolicy) error {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return err
+	}
 	defer client.Close()
 
 	// 1. Xóa các luật cũ của Marine Pro để tránh trùng lặp
@@ -247,7 +251,7 @@ func ApplyFirewallRules(c *gin.Context) {
 	if config.BlockTiktok { createBlockRule("Tiktok", apps["Tiktok"]) }
 	if config.BlockTorrent { createBlockRule("Torrent", apps["Torrent"]) }
 
-	c.JSON(http.StatusOK, gin.H{"message": "Đã cập nhật Tường lửa thành công!"})
+	return nil
 }
 // Các hàm cũ (Sync, Reboot) giữ nguyên logic
 func SyncCrewToRouter(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"message": "Đã đồng bộ User"}) }
@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Trạng thái tàu suy ra từ tín hiệu thật (heartbeat agent, router API, telemetry modem)
+const (
+	StatusOnline   = "Online"
+	StatusDegraded = "Degraded"
+	StatusOffline  = "Offline"
+)
+
+// Dữ liệu agent trên tàu gửi lên định kỳ
+type HeartbeatInput struct {
+	SNR       *float64 `json:"snr"`
+	Satellite string   `json:"satellite"`
+	Beam      string   `json:"beam"`
+	ModemLock *bool    `json:"modem_lock"` // Modem đã khóa tín hiệu vệ tinh chưa
+
+	// Telemetry từ thiết bị vệ tinh (adapter hoặc agent)
+	LatencyMs      *float64 `json:"latency_ms"`
+	ObstructionPct *float64 `json:"obstruction_pct"`
+	UplinkState    string   `json:"uplink_state"`
+}
+
+func envSeconds(key string, def time.Duration) time.Duration {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return time.Duration(v) * time.Second
+	}
+	return def
+}
+
+// Ngưỡng đọc lúc chạy (sau khi godotenv.Load)
+func shipDegradedAfter() time.Duration { return envSeconds("SHIP_DEGRADED_AFTER", 90*time.Second) }
+func shipOfflineAfter() time.Duration  { return envSeconds("SHIP_OFFLINE_AFTER", 5*time.Minute) }
+
+// Tránh 2 luồng (worker + heartbeat) cùng ghi 1 lần chuyển trạng thái
+var statusMu sync.Mutex
+
+// GHI NHẬN HEARTBEAT: dùng chung cho agent, router probe và telemetry modem
+func recordHeartbeat(shipID, source string, hb HeartbeatInput) error {
+	now := time.Now()
+	var previous models.Ship
+	if err := database.DB.Select("id", "company", "satellite", "beam", "snr", "lat", "lon").Where("id = ?", shipID).First(&previous).Error; err != nil {
+		return fmt.Errorf("không tìm thấy tàu")
+	}
+
+	updates := map[string]interface{}{"last_seen_at": now, "last_seen_source": source, "updated_at": now}
+	if hb.SNR != nil {
+		updates["snr"] = *hb.SNR
+	}
+	if hb.Satellite != "" {
+		updates["satellite"] = hb.Satellite
+	}
+	if hb.Beam != "" {
+		updates["beam"] = hb.Beam
+	}
+	if hb.ModemLock != nil {
+		updates["modem_lock"] = *hb.ModemLock
+	}
+	if hb.LatencyMs != nil {
+		updates["latency_ms"] = *hb.LatencyMs
+	}
+	if hb.ObstructionPct != nil {
+		updates["obstruction_pct"] = *hb.ObstructionPct
+	}
+	if hb.UplinkState != "" {
+		updates["uplink_state"] = hb.UplinkState
+	}
+
+	if err := database.DB.Model(&models.Ship{}).Where("id = ?", shipID).Updates(updates).Error; err != nil {
+		return err
+	}
+	recordLinkQuality(previous, source, hb, now)
+
+	var ship models.Ship
+	if err := database.DB.Where("id = ?", shipID).First(&ship).Error; err == nil {
+		evaluateShipStatus(ship, currentSnrThreshold(), now)
+	}
+	publishShipChanges(shipID)
+	return nil
+}
+
+func currentSnrThreshold() float64 {
+	var config models.SystemConfig
+	if err := database.DB.First(&config).Error; err == nil && config.SnrThreshold > 0 {
+		return config.SnrThreshold
+	}
+	return 5.0
+}
+
+// Suy ra trạng thái từ thời điểm liên lạc cuối và chất lượng tín hiệu
+func deriveShipStatus(ship models.Ship, snrThreshold float64, now time.Time) (string, string) {
+	if ship.LastSeenAt == nil {
+		return StatusOffline, "Chưa nhận được tín hiệu"
+	}
+	age := now.Sub(*ship.LastSeenAt)
+	if age > shipOfflineAfter() {
+		return StatusOffline, fmt.Sprintf("Mất liên lạc %s", age.Round(time.Second))
+	}
+	if age > shipDegradedAfter() {
+		return StatusDegraded, fmt.Sprintf("Heartbeat trễ %s", age.Round(time.Second))
+	}
+	if ship.ModemLock != nil && !*ship.ModemLock {
+		return StatusDegraded, "Modem mất khóa tín hiệu vệ tinh"
+	}
+	if ship.UplinkState != "" && ship.UplinkState != "up" {
+		return StatusDegraded, "Đường lên vệ tinh: " + ship.UplinkState
+	}
+	// Starlink không báo SNR dạng số: dựa vào modem_lock / uplink ở trên
+	if ship.TerminalType != "starlink" && ship.SNR < snrThreshold {
+		return StatusDegraded, fmt.Sprintf("SNR %.1f dB dưới ngưỡng %.1f dB", ship.SNR, snrThreshold)
+	}
+	return StatusOnline, "Tín hiệu ổn định (" + ship.LastSeenSource + ")"
+}
+
+func evaluateShipStatus(ship models.Ship, snrThreshold float64, now time.Time) {
+	status, reason := deriveShipStatus(ship, snrThreshold, now)
+	if status == ship.Status {
+		return
+	}
+	transitionShipStatus(ship, status, reason, now)
+}
+
+// Ghi lại lần chuyển trạng thái + thông báo
+func transitionShipStatus(ship models.Ship, to, reason string, now time.Time) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	// Đọc lại để tránh ghi trùng khi worker và heartbeat chạy đồng thời
+	var current models.Ship
+	if err := database.DB.Select("id", "status").Where("id = ?", ship.ID).First(&current).Error; err != nil || current.Status == to {
+		return
+	}
+
+	database.DB.Create(&models.ShipStatusEvent{
+		ShipID: ship.ID, FromStatus: current.Status, ToStatus: to, Reason: reason, CreatedAt: now,
+	})
+	database.DB.Model(&models.Ship{}).Where("id = ?", ship.ID).Updates(map[string]interface{}{
+		"status": to, "status_changed_at": now,
+	})
+
+	severity := "info"
+	switch to {
+	case StatusOffline:
+		severity = "critical"
+	case StatusDegraded:
+		severity = "warning"
+	}
+	Notify(Notification{
+		Event: "ship_status", Severity: severity, ShipID: ship.ID, Company: ship.Company,
+		Title:   fmt.Sprintf("%s: %s → %s", ship.Name, current.Status, to),
+		Message: reason,
+		Data:    map[string]interface{}{"from": current.Status, "to": to},
+	})
+}
+
+// Kiểm tra cổng API router có phản hồi không (không cần đăng nhập)
+func probeRouter(ship models.Ship) bool {
+	if ship.RouterIP == "" {
+		return false
+	}
+	port := ship.RouterPort
+	if port == 0 {
+		port = 8728
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ship.RouterIP, strconv.Itoa(port)), 3*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Worker giám sát trạng thái tàu (thay cho simulator cũ)
+func StartShipMonitor() {
+	interval := envSeconds("SHIP_MONITOR_INTERVAL", 30*time.Second)
+	for {
+		checkFleetStatus()
+		time.Sleep(interval)
+	}
+}
+
+func checkFleetStatus() {
+	var ships []models.Ship
+	if err := database.DB.Find(&ships).Error; err != nil {
+		return
+	}
+
+	// 1. Probe router song song (giới hạn 16 kết nối cùng lúc)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 16)
+	for _, ship := range ships {
+		if ship.RouterIP == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(ship models.Ship) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if probeRouter(ship) {
+				now := time.Now()
+				database.DB.Model(&models.Ship{}).Where("id = ?", ship.ID).Updates(map[string]interface{}{
+					"last_seen_at": now, "last_seen_source": "router",
+				})
+			}
+		}(ship)
+	}
+	wg.Wait()
+
+	// 2. Đánh giá lại trạng thái toàn đội tàu
+	database.DB.Find(&ships)
+	threshold := currentSnrThreshold()
+	now := time.Now()
+	for _, ship := range ships {
+		evaluateShipStatus(ship, threshold, now)
+	}
+	publishShipChanges()
+}
+
+// Uptime đội tàu trong khoảng [start, end] tính từ các khoảng Offline thật
+func fleetUptime(start, end time.Time) (float64, bool) {
+	var ships []models.Ship
+	database.DB.Select("id", "status").Find(&ships)
+	if len(ships) == 0 || !end.After(start) {
+		return 0, false
+	}
+
+	var events []models.ShipStatusEvent
+	database.DB.Where("created_at <= ?", end).Order("created_at").Find(&events)
+	byShip := make(map[string][]models.ShipStatusEvent)
+	for _, e := range events {
+		byShip[e.ShipID] = append(byShip[e.ShipID], e)
+	}
+
+	window := end.Sub(start)
+	var downtime time.Duration
+	for _, ship := range ships {
+		evts := byShip[ship.ID]
+
+		// Trạng thái tại thời điểm bắt đầu
+		status := ship.Status
+		for i, e := range evts {
+			if e.CreatedAt.After(start) {
+				if i == 0 {
+					status = e.FromStatus
+				}
+				break
+			}
+			status = e.ToStatus
+		}
+
+		cursor := start
+		for _, e := range evts {
+			if !e.CreatedAt.After(start) {
+				continue
+			}
+			if status == StatusOffline {
+				downtime += e.CreatedAt.Sub(cursor)
+			}
+			cursor = e.CreatedAt
+			status = e.ToStatus
+		}
+		if status == StatusOffline {
+			downtime += end.Sub(cursor)
+		}
+	}
+
+	total := window * time.Duration(len(ships))
+	return (1 - float64(downtime)/float64(total)) * 100.0, true
+}
+
+// --- CÁC API ---
+
+// Kiểm tra token của agent; tàu chưa được cấp token thì từ chối mọi dữ liệu từ tàu
+func checkAgentToken(c *gin.Context, ship models.Ship) bool {
+	if ship.AgentToken == "" {
+		return false
+	}
+	token := c.GetHeader("X-Agent-Token")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(ship.AgentToken)) == 1
+}
+
+// POST /api/ships/:ship_id/heartbeat : agent trên tàu check-in
+func ShipHeartbeat(c *gin.Context) {
+	shipID := c.Param("ship_id")
+	var ship models.Ship
+	if err := database.DB.Where("id = ?", shipID).First(&ship).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tàu"})
+		return
+	}
+	if !checkAgentToken(c, ship) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sai agent token hoặc tàu chưa được cấp token"})
+		return
+	}
+
+	var input HeartbeatInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := recordHeartbeat(shipID, "agent", input); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "OK", "server_time": time.Now()})
+}
+
+// POST /api/ships/:ship_id/agent-token : cấp lại token cho agent (chỉ Admin)
+func RotateAgentToken(c *gin.Context) {
+	shipID := c.Param("ship_id")
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không tạo được token"})
+		return
+	}
+	token := hex.EncodeToString(buf)
+
+	result := database.DB.Model(&models.Ship{}).Where("id = ?", shipID).Update("agent_token", token)
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tàu"})
+		return
+	}
+	recordAudit(c, "Rotated agent token for ship "+shipID, "Success")
+	c.JSON(http.StatusOK, gin.H{"agent_token": token})
+}
+
+// GET /api/ships/:ship_id/status-history?range=7d
+func GetShipStatusHistory(c *gin.Context) {
+	shipID := c.Param("ship_id")
+	rng := getRangeParam(c)
+	start := time.Now().Add(-rangeToDuration(rng))
+
+	var events []models.ShipStatusEvent
+	database.DB.Where("ship_id = ? AND created_at >= ?", shipID, start).Order("created_at desc").Find(&events)
+	c.JSON(http.StatusOK, events)
+}
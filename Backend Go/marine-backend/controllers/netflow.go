@@ -0,0 +1,350 @@
+package controllers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// 1 luồng (flow) đã giải mã từ NetFlow v9 / IPFIX
+type flowRecord struct {
+	SrcIP, DstIP     net.IP
+	SrcPort, DstPort uint16
+	Proto            uint8
+	Bytes, Packets   uint64
+	End              time.Time
+}
+
+// Information Element cần dùng (NetFlow v9 dùng chung số hiệu với IPFIX)
+const (
+	ieOctetDelta       = 1
+	iePacketDelta      = 2
+	ieProtocol         = 4
+	ieSrcPort          = 7
+	ieSrcIPv4          = 8
+	ieDstPort          = 11
+	ieDstIPv4          = 12
+	ieLastSwitched     = 21 // v9: ms tính từ lúc router khởi động
+	ieFirstSwitched    = 22
+	ieSrcIPv6          = 27
+	ieDstIPv6          = 28
+	ieOctetTotal       = 85
+	ieFlowEndSeconds   = 151
+	ieFlowEndMillis    = 153
+	ieVariableLength   = 0xffff
+	enterpriseBit      = 0x8000
+	templateSetV9      = 0
+	optionsSetV9       = 1
+	templateSetIPFIX   = 2
+	optionsSetIPFIX    = 3
+	firstDataSetID     = 256
+	netflowHeaderV9    = 20
+	netflowHeaderIPFIX = 16
+)
+
+type templateField struct {
+	ID         uint16
+	Length     uint16
+	Enterprise bool
+}
+
+type templateKey struct {
+	exporter string
+	domain   uint32 // v9: source ID, IPFIX: observation domain
+	id       uint16
+}
+
+// Bộ giải mã giữ template theo từng exporter (template gửi định kỳ, data đến trước template sẽ bị bỏ)
+type flowDecoder struct {
+	mu        sync.RWMutex
+	templates map[templateKey][]templateField
+}
+
+func newFlowDecoder() *flowDecoder {
+	return &flowDecoder{templates: make(map[templateKey][]templateField)}
+}
+
+// Giải mã 1 datagram; trả về các flow và số data set bị bỏ do chưa có template
+func (d *flowDecoder) decode(exporter string, pkt []byte) ([]flowRecord, int, error) {
+	if len(pkt) < 4 {
+		return nil, 0, fmt.Errorf("gói quá ngắn")
+	}
+	version := binary.BigEndian.Uint16(pkt)
+	var domain uint32
+	var sets []byte
+	var uptimeMs uint32
+	var exportTime time.Time
+	switch version {
+	case 9:
+		if len(pkt) < netflowHeaderV9 {
+			return nil, 0, fmt.Errorf("header v9 quá ngắn")
+		}
+		uptimeMs = binary.BigEndian.Uint32(pkt[4:])
+		exportTime = time.Unix(int64(binary.BigEndian.Uint32(pkt[8:])), 0)
+		domain = binary.BigEndian.Uint32(pkt[16:])
+		sets = pkt[netflowHeaderV9:]
+	case 10:
+		if len(pkt) < netflowHeaderIPFIX {
+			return nil, 0, fmt.Errorf("header IPFIX quá ngắn")
+		}
+		length := int(binary.BigEndian.Uint16(pkt[2:]))
+		if length > len(pkt) || length < netflowHeaderIPFIX {
+			return nil, 0, fmt.Errorf("độ dài IPFIX không hợp lệ")
+		}
+		exportTime = time.Unix(int64(binary.BigEndian.Uint32(pkt[4:])), 0)
+		domain = binary.BigEndian.Uint32(pkt[12:])
+		sets = pkt[netflowHeaderIPFIX:length]
+	default:
+		return nil, 0, fmt.Errorf("chưa hỗ trợ NetFlow version %d", version)
+	}
+
+	var flows []flowRecord
+	missing := 0
+	for len(sets) >= 4 {
+		setID := binary.BigEndian.Uint16(sets)
+		setLen := int(binary.BigEndian.Uint16(sets[2:]))
+		if setLen < 4 || setLen > len(sets) {
+			return flows, missing, fmt.Errorf("flowset không hợp lệ")
+		}
+		body := sets[4:setLen]
+		sets = sets[setLen:]
+
+		switch {
+		case setID == templateSetV9 || setID == templateSetIPFIX:
+			d.parseTemplates(exporter, domain, body, version == 10)
+		case setID == optionsSetV9 || setID == optionsSetIPFIX:
+			// Options template (thông tin sampling, interface) chưa dùng
+		case setID >= firstDataSetID:
+			d.mu.RLock()
+			fields, ok := d.templates[templateKey{exporter, domain, setID}]
+			d.mu.RUnlock()
+			if !ok {
+				missing++
+				continue
+			}
+			flows = append(flows, parseDataSet(body, fields, uptimeMs, exportTime, version)...)
+		}
+	}
+	return flows, missing, nil
+}
+
+func (d *flowDecoder) parseTemplates(exporter string, domain uint32, b []byte, ipfix bool) {
+	for len(b) >= 4 {
+		id := binary.BigEndian.Uint16(b)
+		count := int(binary.BigEndian.Uint16(b[2:]))
+		b = b[4:]
+		if id < firstDataSetID {
+			return // Phần đệm cuối set
+		}
+		fields := make([]templateField, 0, count)
+		for i := 0; i < count; i++ {
+			if len(b) < 4 {
+				return
+			}
+			f := templateField{ID: binary.BigEndian.Uint16(b), Length: binary.BigEndian.Uint16(b[2:])}
+			b = b[4:]
+			if ipfix && f.ID&enterpriseBit != 0 {
+				if len(b) < 4 {
+					return
+				}
+				f.ID &^= enterpriseBit
+				f.Enterprise = true
+				b = b[4:]
+			}
+			fields = append(fields, f)
+		}
+		d.mu.Lock()
+		d.templates[templateKey{exporter, domain, id}] = fields
+		d.mu.Unlock()
+	}
+}
+
+func beUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func parseDataSet(b []byte, fields []templateField, uptimeMs uint32, exportTime time.Time, version uint16) []flowRecord {
+	minLen := 0
+	for _, f := range fields {
+		if f.Length == ieVariableLength {
+			minLen++
+		} else {
+			minLen += int(f.Length)
+		}
+	}
+	if minLen == 0 {
+		return nil
+	}
+
+	var flows []flowRecord
+	for len(b) >= minLen {
+		r := flowRecord{End: exportTime}
+		var lastSwitched uint32
+		hasLast := false
+		ok := true
+		for _, f := range fields {
+			size := int(f.Length)
+			if f.Length == ieVariableLength {
+				if len(b) < 1 {
+					ok = false
+					break
+				}
+				size, b = int(b[0]), b[1:]
+				if size == 255 {
+					if len(b) < 2 {
+						ok = false
+						break
+					}
+					size, b = int(binary.BigEndian.Uint16(b)), b[2:]
+				}
+			}
+			if len(b) < size {
+				ok = false
+				break
+			}
+			v := b[:size]
+			b = b[size:]
+			if f.Enterprise {
+				continue
+			}
+			switch f.ID {
+			case ieOctetDelta, ieOctetTotal:
+				if r.Bytes == 0 {
+					r.Bytes = beUint(v)
+				}
+			case iePacketDelta:
+				r.Packets = beUint(v)
+			case ieProtocol:
+				r.Proto = uint8(beUint(v))
+			case ieSrcPort:
+				r.SrcPort = uint16(beUint(v))
+			case ieDstPort:
+				r.DstPort = uint16(beUint(v))
+			case ieSrcIPv4, ieSrcIPv6:
+				r.SrcIP = append(net.IP(nil), v...)
+			case ieDstIPv4, ieDstIPv6:
+				r.DstIP = append(net.IP(nil), v...)
+			case ieLastSwitched:
+				lastSwitched, hasLast = uint32(beUint(v)), true
+			case ieFlowEndSeconds:
+				r.End = time.Unix(int64(beUint(v)), 0)
+			case ieFlowEndMillis:
+				r.End = time.UnixMilli(int64(beUint(v)))
+			}
+		}
+		if !ok {
+			break
+		}
+		if version == 9 && hasLast && uptimeMs >= lastSwitched {
+			r.End = exportTime.Add(-time.Duration(uptimeMs-lastSwitched) * time.Millisecond)
+		}
+		if r.SrcIP != nil && r.DstIP != nil {
+			flows = append(flows, r)
+		}
+	}
+	return flows
+}
+
+// --- PCAP (phát lại bản ghi gói tin) ---
+
+// Tách payload UDP từ file pcap (Ethernet / raw IP / Linux SLL), trả về IP nguồn + payload
+func readPcapUDP(data []byte, fn func(src net.IP, payload []byte)) (int, error) {
+	if len(data) < 24 {
+		return 0, fmt.Errorf("file pcap quá ngắn")
+	}
+	var order binary.ByteOrder
+	switch binary.LittleEndian.Uint32(data) {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		order = binary.LittleEndian
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		order = binary.BigEndian
+	default:
+		return 0, fmt.Errorf("không phải file pcap (pcapng chưa hỗ trợ)")
+	}
+	linkType := order.Uint32(data[20:])
+	data = data[24:]
+
+	count := 0
+	for len(data) >= 16 {
+		capLen := int(order.Uint32(data[8:]))
+		data = data[16:]
+		if capLen > len(data) {
+			break
+		}
+		frame := data[:capLen]
+		data = data[capLen:]
+
+		var ipPkt []byte
+		switch linkType {
+		case 1: // Ethernet
+			if len(frame) < 14 {
+				continue
+			}
+			etherType := binary.BigEndian.Uint16(frame[12:])
+			frame = frame[14:]
+			for etherType == 0x8100 && len(frame) >= 4 { // VLAN
+				etherType = binary.BigEndian.Uint16(frame[2:])
+				frame = frame[4:]
+			}
+			if etherType != 0x0800 && etherType != 0x86dd {
+				continue
+			}
+			ipPkt = frame
+		case 101, 12: // Raw IP
+			ipPkt = frame
+		case 113: // Linux cooked capture
+			if len(frame) < 16 {
+				continue
+			}
+			ipPkt = frame[16:]
+		default:
+			return count, fmt.Errorf("chưa hỗ trợ link type %d", linkType)
+		}
+
+		src, payload, ok := udpPayload(ipPkt)
+		if !ok {
+			continue
+		}
+		fn(src, payload)
+		count++
+	}
+	return count, nil
+}
+
+func udpPayload(p []byte) (net.IP, []byte, bool) {
+	if len(p) < 1 {
+		return nil, nil, false
+	}
+	var src net.IP
+	switch p[0] >> 4 {
+	case 4:
+		if len(p) < 20 {
+			return nil, nil, false
+		}
+		ihl := int(p[0]&0x0f) * 4
+		if p[9] != 17 || len(p) < ihl+8 {
+			return nil, nil, false
+		}
+		src = net.IP(append([]byte(nil), p[12:16]...))
+		p = p[ihl:]
+	case 6:
+		if len(p) < 48 || p[6] != 17 {
+			return nil, nil, false
+		}
+		src = net.IP(append([]byte(nil), p[8:24]...))
+		p = p[40:]
+	default:
+		return nil, nil, false
+	}
+	udpLen := int(binary.BigEndian.Uint16(p[4:]))
+	if udpLen < 8 || udpLen > len(p) {
+		udpLen = len(p)
+	}
+	return src, p[8:udpLen], true
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+// Datagram mẫu theo bố cục traffic-flow v9 của RouterOS: template 256 (bytes, packets, proto, cổng / IPv4 nguồn-đích,
+// last/first switched), sysUptime 3600000 ms, export 2026-01-01 00:00:00 UTC
+const (
+	v9TemplateOnly = "000900010036ee806955b90000000001000000000000002c010000090001000400020004000400010007000200080004000b0002000c00040015000400160004"
+	v9DataOnly     = "000900020036ee806955b900000000020000000001000040000005dc0000000306c8220a0a001501bb8efa04640036ea980036c7700000014000000002119c400a0a00160035080808080036daf80036d7100000"
+	v9Both         = "000900030036ee806955b90000000003000000000000002c010000090001000400020004000400010007000200080004000b0002000c0004001500040016000401000040000005dc0000000306c8220a0a001501bb8efa04640036ea980036c7700000014000000002119c400a0a00160035080808080036daf80036d7100000"
+	// IPFIX: template 300 có octetTotalCount, flowEndMilliseconds, 1 trường enterprise (PEN 29305) và interfaceName độ dài biến đổi
+	ipfixTemplateAndData = "000a00776955b93d0000000a0000000100020034012c000a00080004000c000400070002000b00020004000100550008000200080099000880640004000072790052ffff012c00330a0a001e9df00123c35001bb0600000000000f120600000000000002bc0000019b76db92db00000007056574686572"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFlowDecoderV9(t *testing.T) {
+	export := time.Unix(1767225600, 0)
+	want := []flowRecord{
+		{Proto: 6, SrcPort: 51234, DstPort: 443, Bytes: 1500, Packets: 3, End: export.Add(-time.Second)},
+		{Proto: 17, SrcPort: 40000, DstPort: 53, Bytes: 320, Packets: 2, End: export.Add(-5 * time.Second)},
+	}
+	wantIPs := [][2]string{{"10.10.0.21", "142.250.4.100"}, {"10.10.0.22", "8.8.8.8"}}
+
+	tests := []struct {
+		name        string
+		packets     []string // gửi lần lượt, kiểm tra kết quả gói cuối
+		exporter    string
+		wantFlows   int
+		wantMissing int
+	}{
+		{"template và data cùng gói", []string{v9Both}, "10.0.0.1", 2, 0},
+		{"data trước template bị bỏ", []string{v9DataOnly}, "10.0.0.1", 0, 1},
+		{"template gói trước, data gói sau", []string{v9TemplateOnly, v9DataOnly}, "10.0.0.1", 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newFlowDecoder()
+			var flows []flowRecord
+			var missing int
+			var err error
+			for _, p := range tt.packets {
+				flows, missing, err = d.decode(tt.exporter, decodeHex(t, p))
+				if err != nil {
+					t.Fatalf("decode() error = %v", err)
+				}
+			}
+			if len(flows) != tt.wantFlows || missing != tt.wantMissing {
+				t.Fatalf("decode() = %d flow, %d thiếu template; want %d, %d", len(flows), missing, tt.wantFlows, tt.wantMissing)
+			}
+			for i, f := range flows {
+				w := want[i]
+				if f.SrcIP.String() != wantIPs[i][0] || f.DstIP.String() != wantIPs[i][1] || f.Proto != w.Proto ||
+					f.SrcPort != w.SrcPort || f.DstPort != w.DstPort || f.Bytes != w.Bytes || f.Packets != w.Packets || !f.End.Equal(w.End) {
+					t.Errorf("flow %d = %+v, want %+v %v", i, f, w, wantIPs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFlowDecoderTemplateScope(t *testing.T) {
+	d := newFlowDecoder()
+	if _, _, err := d.decode("10.0.0.1", decodeHex(t, v9TemplateOnly)); err != nil {
+		t.Fatal(err)
+	}
+	// Template của router khác không dùng được
+	flows, missing, err := d.decode("10.0.0.2", decodeHex(t, v9DataOnly))
+	if err != nil || len(flows) != 0 || missing != 1 {
+		t.Errorf("decode() exporter khác = %d flow, %d thiếu, %v", len(flows), missing, err)
+	}
+}
+
+func TestFlowDecoderIPFIX(t *testing.T) {
+	d := newFlowDecoder()
+	flows, missing, err := d.decode("10.0.0.1", decodeHex(t, ipfixTemplateAndData))
+	if err != nil || missing != 0 || len(flows) != 1 {
+		t.Fatalf("decode() = %d flow, %d thiếu, %v", len(flows), missing, err)
+	}
+	f := flows[0]
+	if f.SrcIP.String() != "10.10.0.30" || f.DstIP.String() != "157.240.1.35" || f.SrcPort != 50000 || f.DstPort != 443 ||
+		f.Proto != 6 || f.Bytes != 987654 || f.Packets != 700 || !f.End.Equal(time.UnixMilli(1767225660123)) {
+		t.Errorf("flow = %+v", f)
+	}
+}
+
+func TestFlowDecoderErrors(t *testing.T) {
+	badSet := decodeHex(t, v9Both)
+	badSet[22] = 0xff // Độ dài flowset template vượt quá gói
+	tests := []struct {
+		name string
+		pkt  []byte
+	}{
+		{"gói quá ngắn", []byte{0, 9}},
+		{"header v9 thiếu", decodeHex(t, v9Both)[:12]},
+		{"NetFlow v5", append([]byte{0, 5}, make([]byte, 30)...)},
+		{"độ dài IPFIX vượt gói", decodeHex(t, ipfixTemplateAndData)[:40]},
+		{"flowset hỏng", badSet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := newFlowDecoder().decode("10.0.0.1", tt.pkt); err == nil {
+				t.Errorf("decode() không báo lỗi")
+			}
+		})
+	}
+}
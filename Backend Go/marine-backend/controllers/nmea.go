@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Câu NMEA 0183 đã tách trường: $GPRMC,... hoặc !AIVDM,...
+type nmeaSentence struct {
+	Talker string   // GP, GN, AI, ...
+	Type   string   // RMC, GGA, VDM, ...
+	Fields []string // Các trường sau tên câu
+}
+
+// Tách câu NMEA và kiểm tra checksum (*hh). Câu không có checksum vẫn được chấp nhận.
+func parseNMEA(line string) (nmeaSentence, error) {
+	var s nmeaSentence
+	line = strings.TrimSpace(line)
+	// Bỏ tag block IEC 61162-450 (\s:...,c:...*hh\) nếu có
+	if strings.HasPrefix(line, "\\") {
+		if end := strings.Index(line[1:], "\\"); end >= 0 {
+			line = line[end+2:]
+		}
+	}
+	if len(line) < 7 || (line[0] != '$' && line[0] != '!') {
+		return s, fmt.Errorf("không phải câu NMEA")
+	}
+
+	body := line[1:]
+	if star := strings.LastIndex(body, "*"); star >= 0 {
+		want, err := strconv.ParseUint(strings.TrimSpace(body[star+1:]), 16, 8)
+		if err != nil {
+			return s, fmt.Errorf("checksum không hợp lệ")
+		}
+		var sum byte
+		for i := 0; i < star; i++ {
+			sum ^= body[i]
+		}
+		if sum != byte(want) {
+			return s, fmt.Errorf("sai checksum")
+		}
+		body = body[:star]
+	}
+
+	parts := strings.Split(body, ",")
+	if len(parts[0]) < 5 {
+		return s, fmt.Errorf("thiếu tên câu")
+	}
+	s.Talker = parts[0][:len(parts[0])-3]
+	s.Type = parts[0][len(parts[0])-3:]
+	s.Fields = parts[1:]
+	return s, nil
+}
+
+// ddmm.mmmm + N/S -> độ thập phân
+func parseNMEACoord(value, hemi string) (float64, error) {
+	if value == "" {
+		return 0, fmt.Errorf("thiếu tọa độ")
+	}
+	dot := strings.Index(value, ".")
+	if dot < 0 {
+		dot = len(value)
+	}
+	if dot < 3 {
+		return 0, fmt.Errorf("tọa độ không hợp lệ")
+	}
+	deg, err := strconv.ParseFloat(value[:dot-2], 64)
+	if err != nil {
+		return 0, err
+	}
+	min, err := strconv.ParseFloat(value[dot-2:], 64)
+	if err != nil {
+		return 0, err
+	}
+	v := deg + min/60
+	if hemi == "S" || hemi == "W" {
+		v = -v
+	}
+	return v, nil
+}
+
+// hhmmss.ss (+ ddmmyy nếu có) -> thời gian UTC
+func parseNMEATime(hms, dmy string, now time.Time) (time.Time, error) {
+	if len(hms) < 6 {
+		return time.Time{}, fmt.Errorf("thiếu thời gian")
+	}
+	h, _ := strconv.Atoi(hms[0:2])
+	m, _ := strconv.Atoi(hms[2:4])
+	sec, _ := strconv.ParseFloat(hms[4:], 64)
+	nsec := int((sec - float64(int(sec))) * 1e9)
+
+	now = now.UTC()
+	if len(dmy) == 6 {
+		d, _ := strconv.Atoi(dmy[0:2])
+		mo, _ := strconv.Atoi(dmy[2:4])
+		y, _ := strconv.Atoi(dmy[4:6])
+		if y < 80 {
+			y += 2000
+		} else {
+			y += 1900
+		}
+		return time.Date(y, time.Month(mo), d, h, m, int(sec), nsec, time.UTC), nil
+	}
+
+	// GGA không có ngày: lấy ngày hiện tại, lùi 1 ngày nếu vượt quá hiện tại (qua nửa đêm)
+	t := time.Date(now.Year(), now.Month(), now.Day(), h, m, int(sec), nsec, time.UTC)
+	if t.After(now.Add(time.Hour)) {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t, nil
+}
+
+// Chuyển câu $--RMC / $--GGA thành vị trí tàu
+func nmeaToPosition(s nmeaSentence, now time.Time) (PositionFix, error) {
+	var fix PositionFix
+	f := s.Fields
+	switch s.Type {
+	case "RMC":
+		// 0 time, 1 status, 2 lat, 3 N/S, 4 lon, 5 E/W, 6 speed kn, 7 course, 8 date, (NMEA 2.3+) 11 mode
+		if len(f) < 9 {
+			return fix, fmt.Errorf("RMC thiếu trường")
+		}
+		// Mode N = không hợp lệ, E = ước tính (dead reckoning)
+		if f[1] != "A" || (len(f) > 11 && (f[11] == "N" || f[11] == "E")) {
+			return fix, fmt.Errorf("RMC chưa có fix")
+		}
+		lat, err := parseNMEACoord(f[2], f[3])
+		if err != nil {
+			return fix, err
+		}
+		lon, err := parseNMEACoord(f[4], f[5])
+		if err != nil {
+			return fix, err
+		}
+		at, err := parseNMEATime(f[0], f[8], now)
+		if err != nil {
+			return fix, err
+		}
+		fix = PositionFix{Lat: lat, Lon: lon, RecordedAt: at, Source: "nmea"}
+		if v, err := strconv.ParseFloat(f[6], 64); err == nil {
+			fix.SpeedKn = &v
+		}
+		if v, err := strconv.ParseFloat(f[7], 64); err == nil {
+			fix.Course = &v
+		}
+		return fix, nil
+
+	case "GGA":
+		// 0 time, 1 lat, 2 N/S, 3 lon, 4 E/W, 5 fix quality
+		if len(f) < 6 {
+			return fix, fmt.Errorf("GGA thiếu trường")
+		}
+		// Chất lượng 0 = không có fix, 6 = ước tính (dead reckoning)
+		if f[5] == "" || f[5] == "0" || f[5] == "6" {
+			return fix, fmt.Errorf("GGA chưa có fix")
+		}
+		lat, err := parseNMEACoord(f[1], f[2])
+		if err != nil {
+			return fix, err
+		}
+		lon, err := parseNMEACoord(f[3], f[4])
+		if err != nil {
+			return fix, err
+		}
+		at, err := parseNMEATime(f[0], "", now)
+		if err != nil {
+			return fix, err
+		}
+		return PositionFix{Lat: lat, Lon: lon, RecordedAt: at, Source: "nmea"}, nil
+	}
+	return fix, fmt.Errorf("chưa hỗ trợ câu %s", s.Type)
+}
+
+// --- AIS (AIVDM / AIVDO) ---
+
+// Payload AIS mã hóa 6-bit -> dãy bit
+type aisBits []byte
+
+func decodeAISPayload(payload string, fillBits int) (aisBits, error) {
+	bits := make(aisBits, 0, len(payload)*6)
+	for i := 0; i < len(payload); i++ {
+		// Ký tự hợp lệ: '0'..'W' (0-39) và '`'..'w' (40-63)
+		ch := payload[i]
+		if ch < '0' || ch > 'w' || (ch > 'W' && ch < '`') {
+			return nil, fmt.Errorf("ký tự payload không hợp lệ")
+		}
+		v := int(ch) - 48
+		if v > 39 {
+			v -= 8
+		}
+		for b := 5; b >= 0; b-- {
+			bits = append(bits, byte(v>>uint(b))&1)
+		}
+	}
+	if fillBits > 0 && fillBits <= len(bits) {
+		bits = bits[:len(bits)-fillBits]
+	}
+	return bits, nil
+}
+
+func (b aisBits) getUint(start, length int) uint64 {
+	var v uint64
+	for i := start; i < start+length; i++ {
+		v <<= 1
+		if i < len(b) {
+			v |= uint64(b[i])
+		}
+	}
+	return v
+}
+
+// Số có dấu (bù 2)
+func (b aisBits) getInt(start, length int) int64 {
+	v := b.getUint(start, length)
+	if v&(1<<uint(length-1)) != 0 {
+		return int64(v) - (1 << uint(length))
+	}
+	return int64(v)
+}
+
+// Chuỗi 6-bit ASCII, bỏ ký tự đệm '@' và khoảng trắng cuối
+func (b aisBits) getText(start, length int) string {
+	const table = "@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_ !\"#$%&'()*+,-./0123456789:;<=>?"
+	var sb strings.Builder
+	for i := start; i+6 <= start+length && i+6 <= len(b); i += 6 {
+		sb.WriteByte(table[b.getUint(i, 6)])
+	}
+	return strings.TrimRight(strings.TrimRight(sb.String(), "@"), " ")
+}
+
+// Bản tin AIS đã giải mã (type 1/2/3: vị trí, type 5: thông tin tĩnh & hành trình)
+type aisMessage struct {
+	Type        int
+	MMSI        string
+	NavStatus   int
+	SpeedKn     *float64
+	Lat, Lon    *float64
+	Course      *float64
+	Heading     *float64
+	IMO         string
+	CallSign    string
+	Name        string
+	ShipType    int
+	Draught     float64
+	Destination string
+	ETAMonth    int
+	ETADay      int
+	ETAHour     int
+	ETAMinute   int
+}
+
+func decodeAISMessage(bits aisBits) (aisMessage, error) {
+	var m aisMessage
+	if len(bits) < 38 {
+		return m, fmt.Errorf("bản tin AIS quá ngắn")
+	}
+	m.Type = int(bits.getUint(0, 6))
+	m.MMSI = fmt.Sprintf("%09d", bits.getUint(8, 30))
+
+	switch m.Type {
+	case 1, 2, 3:
+		if len(bits) < 168 {
+			return m, fmt.Errorf("bản tin vị trí quá ngắn")
+		}
+		m.NavStatus = int(bits.getUint(38, 4))
+		if sog := bits.getUint(50, 10); sog != 1023 {
+			v := float64(sog) / 10
+			m.SpeedKn = &v
+		}
+		lon := float64(bits.getInt(61, 28)) / 600000
+		lat := float64(bits.getInt(89, 27)) / 600000
+		if lon != 181 && lat != 91 {
+			m.Lat, m.Lon = &lat, &lon
+		}
+		if cog := bits.getUint(116, 12); cog != 3600 {
+			v := float64(cog) / 10
+			m.Course = &v
+		}
+		if hdg := bits.getUint(128, 9); hdg != 511 {
+			v := float64(hdg)
+			m.Heading = &v
+		}
+	case 5:
+		if len(bits) < 422 {
+			return m, fmt.Errorf("bản tin tĩnh quá ngắn")
+		}
+		if imo := bits.getUint(40, 30); imo != 0 {
+			m.IMO = fmt.Sprintf("%d", imo)
+		}
+		m.CallSign = bits.getText(70, 42)
+		m.Name = bits.getText(112, 120)
+		m.ShipType = int(bits.getUint(232, 8))
+		m.ETAMonth = int(bits.getUint(274, 4))
+		m.ETADay = int(bits.getUint(278, 5))
+		m.ETAHour = int(bits.getUint(283, 5))
+		m.ETAMinute = int(bits.getUint(288, 6))
+		m.Draught = float64(bits.getUint(294, 8)) / 10
+		m.Destination = bits.getText(302, 120)
+	default:
+		return m, fmt.Errorf("chưa hỗ trợ bản tin AIS type %d", m.Type)
+	}
+	return m, nil
+}
+
+// ETA trong AIS không có năm: chọn lần xuất hiện gần nhất kể từ hiện tại
+func (m aisMessage) eta(now time.Time) *time.Time {
+	if m.ETAMonth < 1 || m.ETAMonth > 12 || m.ETADay < 1 || m.ETAHour > 23 || m.ETAMinute > 59 {
+		return nil
+	}
+	t := time.Date(now.Year(), time.Month(m.ETAMonth), m.ETADay, m.ETAHour, m.ETAMinute, 0, 0, time.UTC)
+	if t.Before(now.AddDate(0, -1, 0)) {
+		t = t.AddDate(1, 0, 0)
+	}
+	return &t
+}
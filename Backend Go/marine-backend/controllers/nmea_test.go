@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNMEAToPositionFix(t *testing.T) {
+	now := time.Date(2026, 3, 23, 12, 40, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+	}{
+		{"RMC có fix", "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230326,003.1,W", false},
+		{"RMC có fix, mode A", "$GNRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230326,,,A", false},
+		{"RMC trạng thái V", "$GPRMC,123519,V,,,,,,,230326,,", true},
+		{"RMC mode N", "$GNRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230326,,,N", true},
+		{"RMC mode E (ước tính)", "$GNRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230326,,,E", true},
+		{"GGA có fix", "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,", false},
+		{"GGA chất lượng 0", "$GPGGA,123519,,,,,0,00,,,M,,M,,", true},
+		{"GGA chất lượng 6 (ước tính)", "$GPGGA,123519,4807.038,N,01131.000,E,6,00,,,M,,M,,", true},
+		{"GGA thiếu tọa độ", "$GPGGA,123519,,,,,1,08,0.9,545.4,M,46.9,M,,", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseNMEA(tt.line)
+			if err != nil {
+				t.Fatalf("parseNMEA() error = %v", err)
+			}
+			fix, err := nmeaToPosition(s, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nmeaToPosition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (fix.Lat < 48.11 || fix.Lat > 48.12 || fix.Lon < 11.51 || fix.Lon > 11.52) {
+				t.Errorf("nmeaToPosition() = %v, %v", fix.Lat, fix.Lon)
+			}
+		})
+	}
+}
+
+func TestDecodeAISPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		fill    int
+		want    string
+		wantErr bool
+	}{
+		{"'0' = 0", "0", 0, "000000", false},
+		{"'W' = 39", "W", 0, "100111", false},
+		{"'`' = 40 (nhảy qua 8 ký tự)", "`", 0, "101000", false},
+		{"'w' = 63", "w", 0, "111111", false},
+		{"bỏ bit đệm cuối", "15", 2, "0000010001", false},
+		{"ký tự ngoài bảng 6-bit", "1X", 0, "", true},
+		{"ký tự điều khiển", "1 ", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bits, err := decodeAISPayload(tt.payload, tt.fill)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeAISPayload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := ""
+			for _, b := range bits {
+				got += string('0' + b)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("decodeAISPayload() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeAISMessage(t *testing.T) {
+	// Mẫu trong tài liệu AIVDM của gpsd
+	position, _ := decodeAISPayload("13u?etPv2;0n:dDPwUM1U1Cb069D", 0)
+	static, _ := decodeAISPayload("55?MbV02;H;s<HtKR20EHE:0@T4@Dn2222222216L961O5Gf0NSQEp6ClRp8"+"88888888880", 2)
+
+	msg, err := decodeAISMessage(position)
+	if err != nil {
+		t.Fatalf("type 1: error = %v", err)
+	}
+	if msg.Type != 1 || msg.MMSI != "265547250" || msg.NavStatus != 0 {
+		t.Errorf("type 1: type %d, MMSI %s, status %d", msg.Type, msg.MMSI, msg.NavStatus)
+	}
+	if msg.Lat == nil || fmt.Sprintf("%.4f,%.4f", *msg.Lat, *msg.Lon) != "57.6604,11.8330" {
+		t.Errorf("type 1: vị trí = %v, %v", msg.Lat, msg.Lon)
+	}
+	if *msg.SpeedKn != 13.9 || *msg.Course != 40.4 || *msg.Heading != 41 {
+		t.Errorf("type 1: SOG %v, COG %v, HDG %v", *msg.SpeedKn, *msg.Course, *msg.Heading)
+	}
+
+	msg, err = decodeAISMessage(static)
+	if err != nil {
+		t.Fatalf("type 5: error = %v", err)
+	}
+	want := aisMessage{
+		Type: 5, MMSI: "351759000", IMO: "9134270", CallSign: "3FOF8", Name: "EVER DIADEM", ShipType: 70,
+		Draught: 12.2, Destination: "NEW YORK", ETAMonth: 5, ETADay: 15, ETAHour: 14, ETAMinute: 0,
+	}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("type 5 = %+v, want %+v", msg, want)
+	}
+
+	tests := []struct {
+		name string
+		bits aisBits
+	}{
+		{"quá ngắn", position[:30]},
+		{"vị trí thiếu bit", position[:100]},
+		{"type 5 thiếu bit", static[:300]},
+		{"type chưa hỗ trợ", append(aisBits{0, 1, 0, 0, 1, 0}, position[6:]...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeAISMessage(tt.bits); err == nil {
+				t.Error("decodeAISMessage() phải trả lỗi")
+			}
+		})
+	}
+}
@@ -0,0 +1,519 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sự kiện cần thông báo (cảnh báo, báo cáo, ...)
+type Notification struct {
+	Event    string                 `json:"event"`    // VD: alert, report, test
+	Severity string                 `json:"severity"` // info / warning / critical
+	ShipID   string                 `json:"ship_id"`
+	Company  string                 `json:"company"`
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Data     map[string]interface{} `json:"data"`
+}
+
+const (
+	notifyMaxAttempts = 5
+	notifyBaseBackoff = 30 * time.Second
+	notifyMaxBackoff  = 30 * time.Minute
+)
+
+var severityRank = map[string]int{"info": 0, "warning": 1, "critical": 2}
+
+// Đánh thức worker khi có thông báo mới (không chặn)
+var notifyWake = make(chan struct{}, 1)
+
+// Mẫu nội dung theo sự kiện và ngôn ngữ. "generic" dùng khi sự kiện chưa có mẫu riêng.
+var notificationTemplates = map[string]map[string][2]string{
+	"generic": {
+		"vi": {"[{{.SeverityVi}}] {{.Title}}", "{{.Message}}\n\nTàu: {{.ShipName}} ({{.ShipID}})\nCông ty: {{.Company}}\nThời gian: {{.Time}}\n\n-- Marine Portal"},
+		"en": {"[{{.SeverityEn}}] {{.Title}}", "{{.Message}}\n\nVessel: {{.ShipName}} ({{.ShipID}})\nCompany: {{.Company}}\nTime: {{.Time}}\n\n-- Marine Portal"},
+	},
+	"test": {
+		"vi": {"[Marine Portal] Thông báo thử nghiệm", "Đây là thông báo thử nghiệm từ Marine Portal.\n{{.Message}}\n\nThời gian: {{.Time}}"},
+		"en": {"[Marine Portal] Test notification", "This is a test notification from Marine Portal.\n{{.Message}}\n\nTime: {{.Time}}"},
+	},
+	"ship_status": {
+		"vi": {"[{{.SeverityVi}}] {{.Title}}", "Tàu {{.ShipName}} ({{.ShipID}}) chuyển trạng thái {{index .Data \"from\"}} → {{index .Data \"to\"}}.\nLý do: {{.Message}}\nThời gian: {{.Time}}"},
+		"en": {"[{{.SeverityEn}}] {{.Title}}", "Vessel {{.ShipName}} ({{.ShipID}}) changed status {{index .Data \"from\"}} → {{index .Data \"to\"}}.\nReason: {{.Message}}\nTime: {{.Time}}"},
+	},
+	"geofence": {
+		"vi": {"[{{.SeverityVi}}] {{.Title}}", "{{.Message}}\n\nTàu: {{.ShipName}} ({{.ShipID}})\nVùng: {{index .Data \"geofence\"}} ({{index .Data \"action\"}})\nVị trí: {{index .Data \"lat\"}}, {{index .Data \"lon\"}}\nThời gian: {{.Time}}"},
+		"en": {"[{{.SeverityEn}}] {{.Title}}", "{{.Message}}\n\nVessel: {{.ShipName}} ({{.ShipID}})\nZone: {{index .Data \"geofence\"}} ({{index .Data \"action\"}})\nPosition: {{index .Data \"lat\"}}, {{index .Data \"lon\"}}\nTime: {{.Time}}"},
+	},
+	"quota": {
+		"vi": {"[{{.SeverityVi}}] {{.Title}}", "{{.Message}}\n\nTài khoản: {{index .Data \"username\"}}\nĐã dùng: {{index .Data \"used_mb\"}} MB / {{index .Data \"allowance_mb\"}} MB\nThời gian: {{.Time}}"},
+		"en": {"[{{.SeverityEn}}] {{.Title}}", "{{.Message}}\n\nAccount: {{index .Data \"username\"}}\nUsed: {{index .Data \"used_mb\"}} MB of {{index .Data \"allowance_mb\"}} MB\nTime: {{.Time}}"},
+	},
+	"report": {
+		"vi": {"[Báo cáo] {{.Title}}", "Báo cáo cho tàu {{.ShipName}} ({{.ShipID}}) đã sẵn sàng.\n{{.Message}}\n\nThời gian: {{.Time}}"},
+		"en": {"[Report] {{.Title}}", "The report for vessel {{.ShipName}} ({{.ShipID}}) is ready.\n{{.Message}}\n\nTime: {{.Time}}"},
+	},
+}
+
+var severityLabels = map[string][2]string{
+	"info":     {"Thông tin", "Info"},
+	"warning":  {"Cảnh báo", "Warning"},
+	"critical": {"Nghiêm trọng", "Critical"},
+}
+
+// Render tiêu đề + nội dung theo ngôn ngữ
+func renderNotification(n Notification, shipName, lang string) (string, string) {
+	set, ok := notificationTemplates[n.Event]
+	if !ok {
+		set = notificationTemplates["generic"]
+	}
+	tpl, ok := set[lang]
+	if !ok {
+		tpl = set["vi"]
+	}
+
+	labels := severityLabels[n.Severity]
+	data := map[string]interface{}{
+		"Event": n.Event, "Severity": n.Severity, "SeverityVi": labels[0], "SeverityEn": labels[1],
+		"ShipID": n.ShipID, "ShipName": shipName, "Company": n.Company,
+		"Title": n.Title, "Message": n.Message, "Data": n.Data,
+		"Time": time.Now().Format("2006-01-02 15:04 MST"),
+	}
+
+	render := func(text string) string {
+		t, err := template.New("n").Parse(text)
+		if err != nil {
+			return text
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return text
+		}
+		return buf.String()
+	}
+	return render(tpl[0]), render(tpl[1])
+}
+
+// Kiểm tra quy tắc có khớp với sự kiện không
+func ruleMatches(rule models.NotificationRule, n Notification) bool {
+	if !rule.Enabled {
+		return false
+	}
+	if rule.ShipID != "" && rule.ShipID != n.ShipID {
+		return false
+	}
+	if rule.Company != "" && !strings.EqualFold(rule.Company, n.Company) {
+		return false
+	}
+	if severityRank[n.Severity] < severityRank[rule.MinSeverity] {
+		return false
+	}
+	if strings.TrimSpace(rule.Events) != "" {
+		for _, e := range strings.Split(rule.Events, ",") {
+			if strings.TrimSpace(e) == n.Event {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// GỬI THÔNG BÁO: xác định người nhận theo quy tắc, ghi vào hàng đợi (NotificationLog) rồi đánh thức worker
+func Notify(n Notification) {
+	if n.Severity == "" {
+		n.Severity = "info"
+	}
+	if n.Event == "" {
+		n.Event = "alert"
+	}
+
+	shipName := ""
+	if n.ShipID != "" {
+		var ship models.Ship
+		if err := database.DB.Where("id = ?", n.ShipID).First(&ship).Error; err == nil {
+			shipName = ship.Name
+			if n.Company == "" {
+				n.Company = ship.Company
+			}
+		}
+	}
+
+	// Đẩy cảnh báo lên Dashboard (SSE)
+	PublishEvent(StreamEvent{Type: "alert", ShipID: n.ShipID, Company: n.Company, Data: n})
+
+	var rules []models.NotificationRule
+	database.DB.Where("enabled = ?", true).Find(&rules)
+	var config models.SystemConfig
+	database.DB.First(&config)
+
+	logs := notificationLogs(rules, config, n, shipName)
+	if len(logs) == 0 {
+		return
+	}
+	if err := database.DB.Create(&logs).Error; err != nil {
+		fmt.Println("⚠️ Lỗi ghi hàng đợi thông báo:", err)
+		return
+	}
+	wakeNotificationWorker()
+}
+
+// Mỗi quy tắc khớp tạo 1 bản ghi hàng đợi; không có quy tắc nào khớp -> gửi email tới danh sách Recipients trong cấu hình hệ thống
+func notificationLogs(rules []models.NotificationRule, config models.SystemConfig, n Notification, shipName string) []models.NotificationLog {
+	var logs []models.NotificationLog
+	for _, rule := range rules {
+		if !ruleMatches(rule, n) {
+			continue
+		}
+		logs = append(logs, buildNotificationLog(rule.ID, rule.Channel, rule.Target, rule.Language, n, shipName))
+	}
+	if len(logs) == 0 && strings.TrimSpace(config.Recipients) != "" {
+		logs = append(logs, buildNotificationLog(0, "email", config.Recipients, notifyLanguage(config.NotifyLanguage), n, shipName))
+	}
+	return logs
+}
+
+// Ngôn ngữ mẫu thông báo (vi / en), giá trị khác -> vi
+func notifyLanguage(lang string) string {
+	if lang != "en" {
+		return "vi"
+	}
+	return lang
+}
+
+// Ngôn ngữ gửi cho thuyền viên: theo hồ sơ thuyền viên, chưa chọn thì theo cấu hình hệ thống
+func crewLanguage(crew models.Crew) string {
+	if crew.Language != "" {
+		return notifyLanguage(crew.Language)
+	}
+	var config models.SystemConfig
+	database.DB.Select("notify_language").First(&config)
+	return notifyLanguage(config.NotifyLanguage)
+}
+
+// Gửi thẳng tới 1 địa chỉ cụ thể (VD: email thuyền trưởng), không qua quy tắc
+func NotifyTarget(channel, target, lang string, n Notification) error {
+	if n.Severity == "" {
+		n.Severity = "info"
+	}
+	shipName := ""
+	if n.ShipID != "" {
+		var ship models.Ship
+		if err := database.DB.Select("name").Where("id = ?", n.ShipID).First(&ship).Error; err == nil {
+			shipName = ship.Name
+		}
+	}
+	entry := buildNotificationLog(0, channel, target, lang, n, shipName)
+	if err := database.DB.Create(&entry).Error; err != nil {
+		return err
+	}
+	wakeNotificationWorker()
+	return nil
+}
+
+func wakeNotificationWorker() {
+	select {
+	case notifyWake <- struct{}{}:
+	default:
+	}
+}
+
+func buildNotificationLog(ruleID uint, channel, target, lang string, n Notification, shipName string) models.NotificationLog {
+	subject, body := renderNotification(n, shipName, lang)
+	payload, _ := json.Marshal(gin.H{
+		"event": n.Event, "severity": n.Severity, "ship_id": n.ShipID, "ship_name": shipName,
+		"company": n.Company, "title": n.Title, "message": n.Message, "data": n.Data,
+		"subject": subject, "body": body, "timestamp": time.Now().UTC().Format(time.RFC3339),
+	})
+	return models.NotificationLog{
+		RuleID: ruleID, Channel: channel, Target: target,
+		Event: n.Event, Severity: n.Severity, ShipID: n.ShipID,
+		Subject: subject, Body: body, Payload: string(payload),
+		Status: "Pending", NextAttemptAt: time.Now(), CreatedAt: time.Now(),
+	}
+}
+
+// Worker gửi thông báo (Retry với backoff lũy thừa, lưu trạng thái trong DB)
+func StartNotificationWorker() {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		processNotificationQueue()
+		select {
+		case <-ticker.C:
+		case <-notifyWake:
+		}
+	}
+}
+
+func processNotificationQueue() {
+	var pending []models.NotificationLog
+	database.DB.Where("status IN ? AND next_attempt_at <= ?", []string{"Pending", "Retrying"}, time.Now()).
+		Order("id").Limit(50).Find(&pending)
+
+	for _, entry := range pending {
+		var err error
+		switch entry.Channel {
+		case "email":
+			err = sendEmail(entry.Target, entry.Subject, entry.Body)
+		case "webhook":
+			err = sendWebhook(entry)
+		default:
+			err = fmt.Errorf("kênh không hỗ trợ: %s", entry.Channel)
+		}
+
+		entry.Attempts++
+		if err == nil {
+			now := time.Now()
+			entry.Status = "Sent"
+			entry.SentAt = &now
+			entry.LastError = ""
+		} else if entry.Attempts >= notifyMaxAttempts {
+			entry.Status = "Failed"
+			entry.LastError = err.Error()
+			fmt.Println("❌ Gửi thông báo thất bại:", entry.Channel, entry.Target, err)
+		} else {
+			entry.Status = "Retrying"
+			entry.LastError = err.Error()
+			entry.NextAttemptAt = time.Now().Add(notifyBackoff(entry.Attempts))
+		}
+		database.DB.Save(&entry)
+	}
+}
+
+func notifyBackoff(attempt int) time.Duration {
+	d := notifyBaseBackoff << uint(attempt-1)
+	if d > notifyMaxBackoff {
+		d = notifyMaxBackoff
+	}
+	return d
+}
+
+// Gửi email qua SMTP (SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_PASS, SMTP_FROM)
+// Có thể chạy thử với SMTP giả lập cục bộ như MailHog (localhost:1025, không cần đăng nhập)
+func sendEmail(to, subject, body string) error {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return fmt.Errorf("chưa cấu hình SMTP_HOST")
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "25"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "noreply@marine-portal.local"
+	}
+
+	var recipients []string
+	for _, r := range strings.FieldsFunc(to, func(r rune) bool { return r == ',' || r == ';' }) {
+		if r = strings.TrimSpace(r); r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("không có người nhận")
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + from + "\r\n")
+	msg.WriteString("To: " + strings.Join(recipients, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USER"); user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASS"), host)
+	}
+	return smtp.SendMail(net.JoinHostPort(host, port), auth, from, recipients, msg.Bytes())
+}
+
+// Gửi webhook có chữ ký: X-Marine-Signature = sha256=HMAC(secret, timestamp + "." + body)
+func sendWebhook(entry models.NotificationLog) error {
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if entry.RuleID != 0 {
+		var rule models.NotificationRule
+		if err := database.DB.First(&rule, entry.RuleID).Error; err == nil && rule.Secret != "" {
+			secret = rule.Secret
+		}
+	}
+
+	body := []byte(entry.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, entry.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Marine-Event", entry.Event)
+	req.Header.Set("X-Marine-Delivery", strconv.FormatUint(uint64(entry.ID), 10))
+	req.Header.Set("X-Marine-Timestamp", timestamp)
+	if secret != "" {
+		req.Header.Set("X-Marine-Signature", "sha256="+signWebhook(secret, timestamp, body))
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook trả về HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// --- CÁC API ---
+
+// 1. Danh sách quy tắc
+func GetNotificationRules(c *gin.Context) {
+	var rules []models.NotificationRule
+	database.DB.Order("id").Find(&rules)
+	for i := range rules {
+		if rules[i].Secret != "" {
+			rules[i].Secret = "********"
+		}
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func validateNotificationRule(rule *models.NotificationRule) string {
+	if rule.Channel != "email" && rule.Channel != "webhook" {
+		return "Kênh phải là email hoặc webhook"
+	}
+	if strings.TrimSpace(rule.Target) == "" {
+		return "Thiếu người nhận / URL"
+	}
+	if rule.Channel == "webhook" && !strings.HasPrefix(rule.Target, "http://") && !strings.HasPrefix(rule.Target, "https://") {
+		return "URL webhook không hợp lệ"
+	}
+	if rule.MinSeverity == "" {
+		rule.MinSeverity = "info"
+	}
+	if _, ok := severityRank[rule.MinSeverity]; !ok {
+		return "Mức độ phải là info, warning hoặc critical"
+	}
+	if rule.Language != "en" {
+		rule.Language = "vi"
+	}
+	return ""
+}
+
+// 2. Tạo quy tắc
+func CreateNotificationRule(c *gin.Context) {
+	input := models.NotificationRule{Enabled: true} // Không gửi enabled = bật
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateNotificationRule(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID = 0
+	input.CreatedAt = time.Now()
+	if err := database.DB.Create(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	c.JSON(http.StatusCreated, input)
+}
+
+// 3. Cập nhật quy tắc
+func UpdateNotificationRule(c *gin.Context) {
+	id := c.Param("id")
+	var rule models.NotificationRule
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quy tắc không tồn tại"})
+		return
+	}
+
+	input := models.NotificationRule{Enabled: rule.Enabled} // Không gửi enabled = giữ nguyên
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateNotificationRule(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	// Giữ khóa cũ nếu client gửi lại giá trị đã che
+	if input.Secret == "" || input.Secret == "********" {
+		input.Secret = rule.Secret
+	}
+	input.ID = rule.ID
+	input.CreatedAt = rule.CreatedAt
+	if err := database.DB.Save(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	c.JSON(http.StatusOK, input)
+}
+
+// 4. Xóa quy tắc
+func DeleteNotificationRule(c *gin.Context) {
+	id := c.Param("id")
+	if err := database.DB.Delete(&models.NotificationRule{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa thành công"})
+}
+
+// 5. Nhật ký gửi (lọc theo status, ship_id)
+func GetNotificationLogs(c *gin.Context) {
+	var logs []models.NotificationLog
+	query := database.DB.Order("created_at desc").Limit(100)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if shipID := c.Query("ship_id"); shipID != "" {
+		query = query.Where("ship_id = ?", shipID)
+	}
+	query.Find(&logs)
+	c.JSON(http.StatusOK, logs)
+}
+
+// 6. Gửi thử thông báo
+func SendTestNotification(c *gin.Context) {
+	var input Notification
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Event == "" {
+		input.Event = "test"
+	}
+	Notify(input)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Đã đưa thông báo vào hàng đợi"})
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"io"
+	"marine-backend/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	// HMAC-SHA256(secret, timestamp + "." + body), so sánh với giá trị tính độc lập
+	got := signWebhook("bi-mat", "1767225600", []byte(`{"event":"test"}`))
+	want := "c41b08ef83b19d70056fb6d2fddc943985824e3b15ef1ae95d17fee2f20e3cbd"
+	if got != want {
+		t.Errorf("signWebhook() = %s, want %s", got, want)
+	}
+	if signWebhook("bi-mat", "1767225601", []byte(`{"event":"test"}`)) == want {
+		t.Error("đổi timestamp phải đổi chữ ký")
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	t.Setenv("WEBHOOK_SECRET", "bi-mat")
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"receiver trả 200", http.StatusOK, false},
+		{"receiver trả 204", http.StatusNoContent, false},
+		{"receiver lỗi -> thử lại sau", http.StatusBadGateway, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				want := "sha256=" + signWebhook("bi-mat", r.Header.Get("X-Marine-Timestamp"), body)
+				if got := r.Header.Get("X-Marine-Signature"); got != want {
+					t.Errorf("X-Marine-Signature = %s, want %s", got, want)
+				}
+				if got := r.Header.Get("X-Marine-Event"); got != "alert" {
+					t.Errorf("X-Marine-Event = %s, want alert", got)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			entry := models.NotificationLog{ID: 7, Channel: "webhook", Target: srv.URL, Event: "alert", Payload: `{"event":"alert"}`}
+			if err := sendWebhook(entry); (err != nil) != tt.wantErr {
+				t.Errorf("sendWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNotifyBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{6, 16 * time.Minute},
+		{7, 30 * time.Minute}, // Chạm trần notifyMaxBackoff
+		{12, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := notifyBackoff(tt.attempt); got != tt.want {
+			t.Errorf("notifyBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestNotificationLogs(t *testing.T) {
+	n := Notification{Event: "alert", Severity: "warning", ShipID: "IMO1", Company: "Acme", Title: "Mất kết nối"}
+	webhook := models.NotificationRule{ID: 1, Enabled: true, Channel: "webhook", Target: "https://hook.example/a", MinSeverity: "info"}
+	critical := models.NotificationRule{ID: 2, Enabled: true, Channel: "email", Target: "ops@acme.vn", MinSeverity: "critical"}
+	otherShip := models.NotificationRule{ID: 3, Enabled: true, Channel: "email", Target: "imo2@acme.vn", ShipID: "IMO2"}
+	disabled := models.NotificationRule{ID: 4, Channel: "email", Target: "off@acme.vn"}
+	config := models.SystemConfig{Recipients: "admin@acme.vn", NotifyLanguage: "en"}
+
+	tests := []struct {
+		name    string
+		rules   []models.NotificationRule
+		config  models.SystemConfig
+		targets []string
+		ruleIDs []uint
+	}{
+		{"quy tắc khớp -> không dùng Recipients", []models.NotificationRule{webhook, critical}, config, []string{"https://hook.example/a"}, []uint{1}},
+		{"không quy tắc nào khớp -> Recipients", []models.NotificationRule{critical, otherShip, disabled}, config, []string{"admin@acme.vn"}, []uint{0}},
+		{"chưa có quy tắc -> Recipients", nil, config, []string{"admin@acme.vn"}, []uint{0}},
+		{"không khớp và chưa cấu hình Recipients", []models.NotificationRule{critical}, models.SystemConfig{Recipients: "  "}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := notificationLogs(tt.rules, tt.config, n, "Tàu A")
+			if len(logs) != len(tt.targets) {
+				t.Fatalf("notificationLogs() trả %d bản ghi, want %d", len(logs), len(tt.targets))
+			}
+			for i, entry := range logs {
+				if entry.Target != tt.targets[i] || entry.RuleID != tt.ruleIDs[i] || entry.Status != "Pending" {
+					t.Errorf("log[%d] = {rule %d, %s, %s}, want {rule %d, %s, Pending}", i, entry.RuleID, entry.Target, entry.Status, tt.ruleIDs[i], tt.targets[i])
+				}
+			}
+		})
+	}
+
+	// Email dự phòng gửi theo ngôn ngữ trong cấu hình hệ thống
+	logs := notificationLogs(nil, config, n, "Tàu A")
+	if subject, _ := renderNotification(n, "Tàu A", "en"); logs[0].Channel != "email" || logs[0].Subject != subject {
+		t.Errorf("email dự phòng = %s %q, want email %q", logs[0].Channel, logs[0].Subject, subject)
+	}
+}
@@ -1,7 +1,6 @@
 package controllers
 
 import (
-	"marine-backend/models" // Cần import models để dùng struct Ship
 	"net/http"
 	"strconv"
 
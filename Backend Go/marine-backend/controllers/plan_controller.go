@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var profileNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// Tên profile MikroTik sinh từ tên gói lúc tạo (không dấu cách / ký tự đặc biệt), sau đó cố định
+func planProfileName(name string) string {
+	profile := strings.Trim(profileNameUnsafe.ReplaceAllString(strings.TrimSpace(name), "-"), "-")
+	if profile == "" {
+		profile = fmt.Sprintf("plan-%d", time.Now().Unix())
+	}
+	return profile
+}
+
+// Tìm gói theo ID, nếu không có thì theo tên (không phân biệt hoa thường)
+func lookupPlan(planID *uint, name string) *models.BandwidthPlan {
+	var plan models.BandwidthPlan
+	if planID != nil && database.DB.First(&plan, *planID).Error == nil {
+		return &plan
+	}
+	if strings.TrimSpace(name) != "" &&
+		database.DB.Where("LOWER(TRIM(name)) = LOWER(TRIM(?))", name).First(&plan).Error == nil {
+		return &plan
+	}
+	return nil
+}
+
+// Kiểm tra gói khi tạo / sửa crew, voucher: phải tồn tại và đang hoạt động
+func resolvePlan(planID *uint, name string) (*models.BandwidthPlan, string) {
+	if planID == nil && strings.TrimSpace(name) == "" {
+		return nil, "Thiếu gói cước"
+	}
+	plan := lookupPlan(planID, name)
+	if plan == nil {
+		return nil, "Gói cước không tồn tại"
+	}
+	if plan.Status == "Inactive" {
+		return nil, "Gói cước đã ngừng áp dụng"
+	}
+	return plan, ""
+}
+
+// Dung lượng gói (byte); gói chưa có bản ghi thì suy từ tên như trước
+func planAllowance(planID *uint, name string) int64 {
+	if plan := lookupPlan(planID, name); plan != nil {
+		return plan.DataAllowanceMB << 20
+	}
+	return planAllowanceBytes(name)
+}
+
+// Tên profile trên router của gói (gói chưa có bản ghi: dùng chính tên)
+func planProfile(planID *uint, name string) string {
+	if plan := lookupPlan(planID, name); plan != nil && plan.ProfileName != "" {
+		return plan.ProfileName
+	}
+	return name
+}
+
+// Tìm gói theo tên, chưa có thì tạo từ chuỗi cũ (profile = tên vì router đang dùng tên đó).
+// Gói tạo tự động chưa có tốc độ nên để Inactive: không đẩy 0k/0k (= không giới hạn) xuống router / RADIUS
+// cho tới khi Admin cấu hình và bật gói
+func planByNameOrCreate(name string) models.BandwidthPlan {
+	if plan := lookupPlan(nil, name); plan != nil {
+		return *plan
+	}
+	plan := models.BandwidthPlan{
+		Name: strings.TrimSpace(name), ProfileName: strings.TrimSpace(name), Status: "Inactive",
+		DataAllowanceMB: planAllowanceBytes(name) >> 20, CreatedAt: time.Now(),
+	}
+	database.DB.Create(&plan)
+	return plan
+}
+
+// Đổi tên gói: crew / voucher tham chiếu theo PlanID nên chỉ cần cập nhật tên hiển thị
+func renamePlanReferences(plan models.BandwidthPlan) {
+	database.DB.Model(&models.Crew{}).Where("plan_id = ?", plan.ID).Update("data_plan", plan.Name)
+	database.DB.Model(&models.Voucher{}).Where("plan_id = ?", plan.ID).Update("data_plan", plan.Name)
+}
+
+// Chuyển DataPlan dạng chuỗi cũ sang tham chiếu PlanID (chạy mỗi lần khởi động, idempotent)
+func MigratePlanReferences() {
+	// Gói tạo trước khi có ProfileName: profile trên router chính là tên gói
+	var legacy []models.BandwidthPlan
+	database.DB.Where("profile_name IS NULL OR profile_name = ''").Find(&legacy)
+	for _, plan := range legacy {
+		database.DB.Model(&plan).Updates(map[string]interface{}{
+			"profile_name": plan.Name, "data_allowance_mb": planAllowanceBytes(plan.Name) >> 20,
+		})
+	}
+
+	var names []string
+	database.DB.Model(&models.Crew{}).Where("plan_id IS NULL AND data_plan <> ''").Distinct().Pluck("data_plan", &names)
+	var voucherNames []string
+	database.DB.Model(&models.Voucher{}).Where("plan_id IS NULL AND data_plan <> ''").Distinct().Pluck("data_plan", &voucherNames)
+	names = append(names, voucherNames...)
+
+	migrated := 0
+	for _, name := range names {
+		plan := planByNameOrCreate(name)
+		updates := map[string]interface{}{"plan_id": plan.ID, "data_plan": plan.Name}
+		migrated += int(database.DB.Model(&models.Crew{}).Where("plan_id IS NULL AND data_plan = ?", name).Updates(updates).RowsAffected)
+		migrated += int(database.DB.Model(&models.Voucher{}).Where("plan_id IS NULL AND data_plan = ?", name).Updates(updates).RowsAffected)
+	}
+	if migrated > 0 {
+		fmt.Printf("📦 Đã gắn %d crew/voucher vào gói cước\n", migrated)
+	}
+}
@@ -0,0 +1,307 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"marine-backend/database"
+	"marine-backend/models"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// Một điểm vị trí nhận được (agent JSON, NMEA, AIS, simulator)
+type PositionFix struct {
+	Lat        float64   `json:"lat"`
+	Lon        float64   `json:"lon"`
+	SpeedKn    *float64  `json:"speed_kn"` // Bỏ trống -> tự tính từ điểm trước
+	Course     *float64  `json:"course"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Source     string    `json:"source"`
+}
+
+// Giới hạn số điểm trả về cho 1 track (lấy mẫu đều nếu nhiều hơn)
+const maxTrackPoints = 5000
+
+// --- HÌNH HỌC (hải lý) ---
+
+const earthRadiusNm = 3440.065
+
+func toRad(d float64) float64 { return d * math.Pi / 180 }
+
+// Khoảng cách great-circle giữa 2 điểm (hải lý)
+func haversineNm(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusNm * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// Hướng đi từ điểm 1 tới điểm 2 (độ, 0 = Bắc)
+func bearingDeg(lat1, lon1, lat2, lon2 float64) float64 {
+	y := math.Sin(toRad(lon2-lon1)) * math.Cos(toRad(lat2))
+	x := math.Cos(toRad(lat1))*math.Sin(toRad(lat2)) - math.Sin(toRad(lat1))*math.Cos(toRad(lat2))*math.Cos(toRad(lon2-lon1))
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// GHI NHẬN VỊ TRÍ: lưu lịch sử, tính tốc độ/hướng đi, cập nhật vị trí hiện tại của tàu
+func recordShipPosition(shipID string, fix PositionFix) error {
+	if fix.Lat < -90 || fix.Lat > 90 || fix.Lon < -180 || fix.Lon > 180 {
+		return fmt.Errorf("tọa độ không hợp lệ")
+	}
+	// Thiết bị chưa có fix (hoặc JSON thiếu lat/lon) thường gửi 0,0
+	if fix.Lat == 0 && fix.Lon == 0 {
+		return fmt.Errorf("chưa có fix (tọa độ 0,0)")
+	}
+	if fix.RecordedAt.IsZero() {
+		fix.RecordedAt = time.Now()
+	}
+
+	var ship models.Ship
+	if err := database.DB.Select("id", "position_at").Where("id = ?", shipID).First(&ship).Error; err != nil {
+		return fmt.Errorf("không tìm thấy tàu")
+	}
+
+	// Tính tốc độ / hướng đi từ điểm liền trước (theo thời gian ghi nhận)
+	measured := fix.SpeedKn != nil && fix.Course != nil
+	if !measured {
+		var prev models.ShipPosition
+		err := database.DB.Where("ship_id = ? AND recorded_at < ?", shipID, fix.RecordedAt).
+			Order("recorded_at desc").First(&prev).Error
+		if err == nil {
+			hours := fix.RecordedAt.Sub(prev.RecordedAt).Hours()
+			dist := haversineNm(prev.Lat, prev.Lon, fix.Lat, fix.Lon)
+			if fix.SpeedKn == nil && hours > 0 {
+				v := math.Round(dist/hours*10) / 10
+				fix.SpeedKn = &v
+			}
+			if fix.Course == nil && dist > 0.01 {
+				v := math.Round(bearingDeg(prev.Lat, prev.Lon, fix.Lat, fix.Lon)*10) / 10
+				fix.Course = &v
+			}
+		}
+	}
+
+	pos := models.ShipPosition{
+		ShipID: shipID, Lat: fix.Lat, Lon: fix.Lon,
+		Source: fix.Source, RecordedAt: fix.RecordedAt, CreatedAt: time.Now(),
+	}
+	if fix.SpeedKn != nil {
+		pos.SpeedKn = *fix.SpeedKn
+	}
+	if fix.Course != nil {
+		pos.Course = *fix.Course
+	}
+	// Trùng (tàu, thời điểm), VD cặp RMC + GGA: giữ 1 điểm, tốc độ / hướng đo được (RMC) thay cho giá trị tự tính
+	conflict := clause.OnConflict{Columns: []clause.Column{{Name: "ship_id"}, {Name: "recorded_at"}}, DoNothing: true}
+	if measured {
+		conflict = clause.OnConflict{Columns: conflict.Columns, DoUpdates: clause.AssignmentColumns([]string{"speed_kn", "course"})}
+	}
+	result := database.DB.Clauses(conflict).Create(&pos)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil // Đã ghi nhận điểm này
+	}
+
+	// Điểm đến trễ (cũ hơn vị trí hiện tại) chỉ lưu lịch sử
+	if ship.PositionAt != nil && fix.RecordedAt.Before(*ship.PositionAt) {
+		return nil
+	}
+	database.DB.Model(&models.Ship{}).Where("id = ?", shipID).Updates(map[string]interface{}{
+		"lat": pos.Lat, "lon": pos.Lon, "speed_kn": pos.SpeedKn, "course": pos.Course,
+		"position_at": pos.RecordedAt, "updated_at": time.Now(),
+	})
+	publishShipChanges(shipID)
+	evaluateGeofences(shipID, pos.Lat, pos.Lon)
+	return nil
+}
+
+// --- CÁC API ---
+
+// POST /api/ships/:ship_id/positions
+// - application/json: 1 điểm hoặc mảng điểm {lat, lon, speed_kn, course, recorded_at}
+// - text/plain: các câu NMEA $GPRMC / $GPGGA chuyển tiếp từ tàu (mỗi dòng 1 câu)
+func IngestPositions(c *gin.Context) {
+	shipID := c.Param("ship_id")
+	var ship models.Ship
+	if err := database.DB.Where("id = ?", shipID).First(&ship).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tàu"})
+		return
+	}
+	if !checkAgentToken(c, ship) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sai agent token hoặc tàu chưa được cấp token"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 5<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không đọc được dữ liệu"})
+		return
+	}
+
+	var fixes []PositionFix
+	var errs []string
+	if strings.Contains(c.ContentType(), "json") {
+		trimmed := strings.TrimSpace(string(body))
+		if strings.HasPrefix(trimmed, "[") {
+			err = json.Unmarshal(body, &fixes)
+		} else {
+			var fix PositionFix
+			err = json.Unmarshal(body, &fix)
+			fixes = append(fixes, fix)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for i := range fixes {
+			if fixes[i].Source == "" {
+				fixes[i].Source = "agent"
+			}
+		}
+	} else {
+		now := time.Now()
+		scanner := bufio.NewScanner(strings.NewReader(string(body)))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			s, err := parseNMEA(line)
+			if err == nil {
+				var fix PositionFix
+				if fix, err = nmeaToPosition(s, now); err == nil {
+					fixes = append(fixes, fix)
+					continue
+				}
+			}
+			errs = append(errs, fmt.Sprintf("%s: %v", line, err))
+		}
+	}
+
+	accepted := 0
+	for _, fix := range fixes {
+		if err := recordShipPosition(shipID, fix); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		accepted++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accepted": accepted, "rejected": len(errs), "errors": errs})
+}
+
+// Đọc from/to (RFC3339 hoặc YYYY-MM-DD), mặc định 24h gần nhất
+func parseTimeRange(c *gin.Context) (time.Time, time.Time, error) {
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	parse := func(v string, endOfDay bool) (time.Time, error) {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		t, err := time.Parse("2006-01-02", v)
+		if err == nil && endOfDay {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return t, err
+	}
+	if v := c.Query("from"); v != "" {
+		t, err := parse(v, false)
+		if err != nil {
+			return from, to, fmt.Errorf("from không hợp lệ")
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := parse(v, true)
+		if err != nil {
+			return from, to, fmt.Errorf("to không hợp lệ")
+		}
+		to = t
+	}
+	if !to.After(from) {
+		return from, to, fmt.Errorf("khoảng thời gian không hợp lệ")
+	}
+	return from, to, nil
+}
+
+// GET /api/ships/:ship_id/track?from=&to= : hành trình dạng GeoJSON LineString
+// Kèm các lần chuyển trạng thái kết nối tại vị trí tương ứng để đối chiếu sự cố
+func GetShipTrack(c *gin.Context) {
+	shipID := c.Param("ship_id")
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var positions []models.ShipPosition
+	if err := database.DB.Where("ship_id = ? AND recorded_at BETWEEN ? AND ?", shipID, from, to).
+		Order("recorded_at").Find(&positions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lấy dữ liệu"})
+		return
+	}
+
+	// Lấy mẫu đều nếu quá nhiều điểm (luôn giữ điểm cuối)
+	if len(positions) > maxTrackPoints {
+		step := float64(len(positions)-1) / float64(maxTrackPoints-1)
+		sampled := make([]models.ShipPosition, 0, maxTrackPoints)
+		for i := 0; i < maxTrackPoints; i++ {
+			sampled = append(sampled, positions[int(math.Round(float64(i)*step))])
+		}
+		positions = sampled
+	}
+
+	coords := make([][2]float64, 0, len(positions))
+	times := make([]time.Time, 0, len(positions))
+	speeds := make([]float64, 0, len(positions))
+	courses := make([]float64, 0, len(positions))
+	distance := 0.0
+	for i, p := range positions {
+		coords = append(coords, [2]float64{p.Lon, p.Lat}) // GeoJSON: [lon, lat]
+		times = append(times, p.RecordedAt)
+		speeds = append(speeds, p.SpeedKn)
+		courses = append(courses, p.Course)
+		if i > 0 {
+			distance += haversineNm(positions[i-1].Lat, positions[i-1].Lon, p.Lat, p.Lon)
+		}
+	}
+
+	// Sự kiện kết nối gắn với vị trí gần nhất trước thời điểm đó
+	var statusEvents []models.ShipStatusEvent
+	database.DB.Where("ship_id = ? AND created_at BETWEEN ? AND ?", shipID, from, to).Order("created_at").Find(&statusEvents)
+	events := make([]gin.H, 0, len(statusEvents))
+	idx := 0
+	for _, e := range statusEvents {
+		for idx+1 < len(positions) && !positions[idx+1].RecordedAt.After(e.CreatedAt) {
+			idx++
+		}
+		evt := gin.H{"time": e.CreatedAt, "from": e.FromStatus, "to": e.ToStatus, "reason": e.Reason}
+		if len(positions) > 0 {
+			evt["lat"], evt["lon"] = positions[idx].Lat, positions[idx].Lon
+		}
+		events = append(events, evt)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"type": "Feature",
+		"geometry": gin.H{
+			"type":        "LineString",
+			"coordinates": coords,
+		},
+		"properties": gin.H{
+			"ship_id": shipID, "from": from, "to": to,
+			"points": len(coords), "distance_nm": math.Round(distance*10) / 10,
+			"times": times, "speeds_kn": speeds, "courses": courses,
+			"status_events": events,
+		},
+	})
+}
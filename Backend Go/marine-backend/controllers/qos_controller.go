@@ -0,0 +1,537 @@
+package controllers
+
+import (
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cấu hình QoS do hệ thống tạo trên router: comment cho mangle / address-list / queue tree, tiền tố cho tên
+const (
+	qosComment = "MARINE_QOS"
+	qosPrefix  = "MQ_"
+)
+
+// Tiền tố tên queue / address-list luân phiên giữa 2 thế hệ: cấu hình mới được thêm song song
+// với cấu hình đang chạy rồi mới gỡ cấu hình cũ (mark kết nối / gói giữ nguyên qosPrefix)
+var qosGenerations = [2]string{qosPrefix, "MQ2_"}
+
+var qosClassKinds = map[string]bool{"operational": true, "crew": true, "default": true}
+
+var (
+	qosNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	qosPortPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+)
+
+// Lệnh RouterOS API (path + tham số "=key=value")
+type qosCommand struct {
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+}
+
+// Lớp không có điều kiện khớp = lớp mặc định
+func qosCatchAll(cl models.QosClass) bool {
+	return cl.Protocol == "" && cl.DstPorts == "" && cl.DstAddresses == "" && cl.SrcAddresses == "" && cl.DSCP == 0
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func validateQosPolicy(p *models.QosPolicy) string {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return "Thiếu tên chính sách"
+	}
+	if p.UplinkKbps <= 0 || p.DownlinkKbps <= 0 {
+		return "Dung lượng tải lên / tải xuống của đường truyền phải lớn hơn 0"
+	}
+	if len(p.Classes) == 0 {
+		return "Cần ít nhất 1 lớp lưu lượng"
+	}
+	for _, id := range splitList(p.ShipIDs) {
+		var count int64
+		database.DB.Model(&models.Ship{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			return "Tàu không tồn tại: " + id
+		}
+	}
+	p.ShipIDs = strings.Join(splitList(p.ShipIDs), ",")
+
+	names := map[string]bool{}
+	catchAll := 0
+	sumUp, sumDn := 0, 0
+	for i := range p.Classes {
+		cl := &p.Classes[i]
+		if !qosNamePattern.MatchString(cl.Name) {
+			return "Tên lớp chỉ gồm chữ, số và dấu gạch dưới: " + cl.Name
+		}
+		if names[strings.ToLower(cl.Name)] {
+			return "Trùng tên lớp: " + cl.Name
+		}
+		names[strings.ToLower(cl.Name)] = true
+		if cl.Kind == "" {
+			cl.Kind = "operational"
+		}
+		if !qosClassKinds[cl.Kind] {
+			return "Loại lớp phải là operational, crew hoặc default"
+		}
+		if cl.Kind == "crew" {
+			cl.Fair = true
+		}
+		if cl.Priority == 0 {
+			cl.Priority = 8
+		}
+		if cl.Priority < 1 || cl.Priority > 8 {
+			return "Độ ưu tiên phải từ 1 đến 8"
+		}
+		if cl.GuaranteedUpKbps < 0 || cl.GuaranteedDnKbps < 0 || cl.MaxUpKbps < 0 || cl.MaxDnKbps < 0 {
+			return "Băng thông không được âm"
+		}
+		if cl.MaxUpKbps > p.UplinkKbps || cl.MaxDnKbps > p.DownlinkKbps {
+			return "Băng thông tối đa của lớp " + cl.Name + " vượt dung lượng đường truyền"
+		}
+		if (cl.MaxUpKbps > 0 && cl.GuaranteedUpKbps > cl.MaxUpKbps) || (cl.MaxDnKbps > 0 && cl.GuaranteedDnKbps > cl.MaxDnKbps) {
+			return "Băng thông đảm bảo của lớp " + cl.Name + " lớn hơn mức tối đa"
+		}
+		sumUp += cl.GuaranteedUpKbps
+		sumDn += cl.GuaranteedDnKbps
+
+		cl.Protocol = strings.ToLower(strings.TrimSpace(cl.Protocol))
+		if cl.Protocol != "" && cl.Protocol != "tcp" && cl.Protocol != "udp" {
+			return "Giao thức phải là tcp hoặc udp"
+		}
+		cl.DstPorts = strings.ReplaceAll(cl.DstPorts, " ", "")
+		if cl.DstPorts != "" {
+			if cl.Protocol == "" {
+				return "Lọc theo cổng cần chọn giao thức tcp / udp"
+			}
+			if !qosPortPattern.MatchString(cl.DstPorts) {
+				return "Danh sách cổng không hợp lệ: " + cl.DstPorts
+			}
+		}
+		for _, addr := range append(splitList(cl.DstAddresses), splitList(cl.SrcAddresses)...) {
+			if net.ParseIP(addr) == nil {
+				if _, _, err := net.ParseCIDR(addr); err != nil {
+					return "Địa chỉ không hợp lệ: " + addr
+				}
+			}
+		}
+		if cl.DSCP < 0 || cl.DSCP > 63 {
+			return "DSCP phải từ 0 đến 63"
+		}
+		if qosCatchAll(*cl) {
+			catchAll++
+			if i != len(p.Classes)-1 {
+				return "Lớp không có điều kiện khớp (" + cl.Name + ") phải đặt cuối cùng"
+			}
+		}
+	}
+	if catchAll > 1 {
+		return "Chỉ được 1 lớp không có điều kiện khớp"
+	}
+	if sumUp > p.UplinkKbps || sumDn > p.DownlinkKbps {
+		return "Tổng băng thông đảm bảo vượt dung lượng đường truyền"
+	}
+	return ""
+}
+
+// Chính sách áp dụng cho tàu: cụ thể nhất thắng (chỉ định tàu > theo công ty > toàn đội), hòa thì ID nhỏ
+func qosPolicyFor(ship models.Ship) *models.QosPolicy {
+	var policies []models.QosPolicy
+	database.DB.Where("enabled = ?", true).Order("id").Find(&policies)
+	var best *models.QosPolicy
+	bestScore := -1
+	for i, p := range policies {
+		if !shipTargeted(p.ShipIDs, p.Company, ship) {
+			continue
+		}
+		score := 0
+		if p.ShipIDs != "" {
+			score += 2
+		}
+		if p.Company != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = &policies[i], score
+		}
+	}
+	return best
+}
+
+// Sinh cấu hình RouterOS cho chính sách:
+// mangle đánh dấu kết nối theo lớp -> đánh dấu gói theo chiều (ra WAN = up, vào từ WAN = down)
+// -> queue tree 2 gốc MQ_UP / MQ_DOWN (max-limit = dung lượng link), mỗi lớp 1 queue con với limit-at = mức đảm bảo
+func renderQos(p models.QosPolicy) []qosCommand {
+	return renderQosGen(p, qosPrefix)
+}
+
+// gen: tiền tố tên queue type / queue tree / address-list của thế hệ cấu hình
+func renderQosGen(p models.QosPolicy, gen string) []qosCommand {
+	add := func(cmds []qosCommand, path string, args ...string) []qosCommand {
+		return append(cmds, qosCommand{Path: path, Args: args})
+	}
+	wanOut, wanIn := "=out-interface-list=WAN", "=in-interface-list=WAN"
+	if p.WanInterface != "" {
+		wanOut, wanIn = "=out-interface="+p.WanInterface, "=in-interface="+p.WanInterface
+	}
+	kbps := func(v int) string { return strconv.Itoa(v) + "k" }
+
+	var cmds []qosCommand
+	cmds = add(cmds, "/queue/type/add", "=name="+gen+"PCQ_UP", "=kind=pcq", "=pcq-classifier=src-address")
+	cmds = add(cmds, "/queue/type/add", "=name="+gen+"PCQ_DOWN", "=kind=pcq", "=pcq-classifier=dst-address")
+
+	// 1. Đánh dấu kết nối (chỉ kết nối chưa có mark -> lớp khớp đầu tiên thắng)
+	for _, cl := range p.Classes {
+		mark := qosPrefix + cl.Name
+		args := []string{"=chain=forward", "=connection-mark=no-mark"}
+		if cl.Protocol != "" {
+			args = append(args, "=protocol="+cl.Protocol)
+		}
+		if cl.DstPorts != "" {
+			args = append(args, "=dst-port="+cl.DstPorts)
+		}
+		if cl.DSCP > 0 {
+			args = append(args, "=dscp="+strconv.Itoa(cl.DSCP))
+		}
+		for _, side := range []struct{ dir, list string }{{"dst", cl.DstAddresses}, {"src", cl.SrcAddresses}} {
+			addrs := splitList(side.list)
+			if len(addrs) == 0 {
+				continue
+			}
+			list := gen + cl.Name + "_" + side.dir
+			for _, a := range addrs {
+				cmds = add(cmds, "/ip/firewall/address-list/add", "=list="+list, "=address="+a, "=comment="+qosComment)
+			}
+			args = append(args, "="+side.dir+"-address-list="+list)
+		}
+		args = append(args, "=action=mark-connection", "=new-connection-mark="+mark, "=passthrough=yes", "=comment="+qosComment)
+		cmds = add(cmds, "/ip/firewall/mangle/add", args...)
+	}
+
+	// 2. Đánh dấu gói theo chiều
+	for _, cl := range p.Classes {
+		mark := qosPrefix + cl.Name
+		cmds = add(cmds, "/ip/firewall/mangle/add", "=chain=forward", "=connection-mark="+mark, wanOut,
+			"=action=mark-packet", "=new-packet-mark="+mark+"_up", "=passthrough=no", "=comment="+qosComment)
+		cmds = add(cmds, "/ip/firewall/mangle/add", "=chain=forward", "=connection-mark="+mark, wanIn,
+			"=action=mark-packet", "=new-packet-mark="+mark+"_down", "=passthrough=no", "=comment="+qosComment)
+	}
+
+	// 3. Queue tree
+	cmds = add(cmds, "/queue/tree/add", "=name="+gen+"UP", "=parent=global", "=max-limit="+kbps(p.UplinkKbps), "=comment="+qosComment)
+	cmds = add(cmds, "/queue/tree/add", "=name="+gen+"DOWN", "=parent=global", "=max-limit="+kbps(p.DownlinkKbps), "=comment="+qosComment)
+	for _, cl := range p.Classes {
+		mark := qosPrefix + cl.Name
+		for _, d := range []struct {
+			dir, parent, pcq string
+			limitAt, max     int
+		}{
+			{"up", gen + "UP", gen + "PCQ_UP", cl.GuaranteedUpKbps, cl.MaxUpKbps},
+			{"down", gen + "DOWN", gen + "PCQ_DOWN", cl.GuaranteedDnKbps, cl.MaxDnKbps},
+		} {
+			if d.max == 0 {
+				d.max = p.UplinkKbps
+				if d.dir == "down" {
+					d.max = p.DownlinkKbps
+				}
+			}
+			queue := "default-small"
+			if cl.Fair {
+				queue = d.pcq
+			}
+			cmds = add(cmds, "/queue/tree/add", "=name="+gen+cl.Name+"_"+d.dir, "=parent="+d.parent, "=packet-mark="+mark+"_"+d.dir,
+				"=limit-at="+kbps(d.limitAt), "=max-limit="+kbps(d.max), "=priority="+strconv.Itoa(cl.Priority),
+				"=queue="+queue, "=comment="+qosComment)
+		}
+	}
+	return cmds
+}
+
+// Đẩy cấu hình mới song song với cấu hình đang chạy (thế hệ tên còn lại), thành công mới gỡ cấu hình cũ;
+// lỗi giữa chừng thì gỡ phần vừa thêm, router giữ nguyên QoS cũ (policy nil = chỉ gỡ)
+func pushQosConfig(shipID string, policy *models.QosPolicy) error {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	type item struct{ path, id string }
+	var old []item
+	gen := qosGenerations[0]
+	// Queue tree trước (tham chiếu queue type), rồi mangle, address-list
+	for _, path := range []string{"/queue/tree", "/ip/firewall/mangle", "/ip/firewall/address-list"} {
+		res, err := client.Run(path+"/print", "?comment="+qosComment)
+		if err != nil {
+			return err
+		}
+		for _, re := range res.Re {
+			old = append(old, item{path, re.Map[".id"]})
+			if path == "/queue/tree" && strings.HasPrefix(re.Map["name"], qosGenerations[0]) {
+				gen = qosGenerations[1]
+			}
+		}
+	}
+	types, err := client.Run("/queue/type/print")
+	if err != nil {
+		return err
+	}
+	for _, re := range types.Re {
+		if strings.HasPrefix(re.Map["name"], qosGenerations[0]) || strings.HasPrefix(re.Map["name"], qosGenerations[1]) {
+			old = append(old, item{"/queue/type", re.Map[".id"]})
+		}
+	}
+
+	if policy != nil {
+		var staged []item
+		for _, cmd := range renderQosGen(*policy, gen) {
+			res, err := client.Run(append([]string{cmd.Path}, cmd.Args...)...)
+			if err != nil {
+				for i := len(staged) - 1; i >= 0; i-- {
+					client.Run(staged[i].path+"/remove", "=.id="+staged[i].id)
+				}
+				return fmt.Errorf("%s %s: %v", cmd.Path, strings.Join(cmd.Args, " "), err)
+			}
+			staged = append(staged, item{strings.TrimSuffix(cmd.Path, "/add"), res.Done.Map["ret"]})
+		}
+	}
+
+	for _, it := range old {
+		client.Run(it.path+"/remove", "=.id="+it.id)
+	}
+	return nil
+}
+
+// ÁP DỤNG QoS cho 1 tàu theo chính sách hiệu lực, lưu kết quả
+func applyShipQos(ship models.Ship) models.ShipQosState {
+	policy := qosPolicyFor(ship)
+	now := time.Now()
+	state := models.ShipQosState{ShipID: ship.ID, Status: "ok", AppliedAt: &now}
+	if policy != nil {
+		state.PolicyID = &policy.ID
+	}
+	if err := pushQosConfig(ship.ID, policy); err != nil {
+		state.Status, state.Error = "failed", err.Error()
+		fmt.Printf("⚠️ Không áp dụng QoS cho tàu %s: %v\n", ship.ID, err)
+	}
+	database.DB.Save(&state)
+	return state
+}
+
+// Áp dụng lại cho các tàu bị ảnh hưởng khi thêm / sửa / xóa chính sách (chạy nền, báo tiến độ qua job)
+func applyQosToShips(policies []models.QosPolicy, owner string) string {
+	jobID := fmt.Sprintf("qos-%d", time.Now().UnixNano())
+	var ships []models.Ship
+	database.DB.Where("router_ip <> ''").Order("id").Find(&ships)
+	var affected []models.Ship
+	for _, ship := range ships {
+		for _, p := range policies {
+			if shipTargeted(p.ShipIDs, p.Company, ship) {
+				affected = append(affected, ship)
+				break
+			}
+		}
+	}
+
+	go func() {
+		failed := 0
+		for i, ship := range affected {
+			state := applyShipQos(ship)
+			if state.Status != "ok" {
+				failed++
+			}
+			PublishJobProgress(jobID, owner, i+1, len(affected), "running",
+				fmt.Sprintf("%s: %s %s", ship.Name, state.Status, state.Error))
+		}
+		status := "done"
+		if failed > 0 {
+			status = "failed"
+		}
+		PublishJobProgress(jobID, owner, len(affected), len(affected), status,
+			fmt.Sprintf("QoS: %d/%d tàu thành công", len(affected)-failed, len(affected)))
+	}()
+	return jobID
+}
+
+// Thống kê queue tree trên router (rate hiện tại, byte, gói bị drop, ...)
+type qosQueueStat struct {
+	Name        string `json:"name"`
+	Class       string `json:"class"`
+	Direction   string `json:"direction"` // up / down / root
+	Parent      string `json:"parent"`
+	LimitAt     string `json:"limit_at"`
+	MaxLimit    string `json:"max_limit"`
+	Priority    int    `json:"priority"`
+	RateBps     int64  `json:"rate_bps"`
+	PacketRate  int64  `json:"packet_rate"`
+	Bytes       int64  `json:"bytes"`
+	Packets     int64  `json:"packets"`
+	Dropped     int64  `json:"dropped"`
+	QueuedBytes int64  `json:"queued_bytes"`
+}
+
+func fetchQosStats(shipID string) ([]qosQueueStat, error) {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	res, err := client.Run("/queue/tree/print", "=stats=", "?comment="+qosComment)
+	if err != nil {
+		return nil, err
+	}
+	num := func(s string) int64 {
+		v, _ := strconv.ParseInt(s, 10, 64)
+		return v
+	}
+	stats := []qosQueueStat{}
+	for _, re := range res.Re {
+		name := re.Map["name"]
+		st := qosQueueStat{
+			Name: name, Parent: re.Map["parent"], LimitAt: re.Map["limit-at"], MaxLimit: re.Map["max-limit"],
+			Priority: int(num(re.Map["priority"])), RateBps: num(re.Map["rate"]), PacketRate: num(re.Map["packet-rate"]),
+			Bytes: num(re.Map["bytes"]), Packets: num(re.Map["packets"]), Dropped: num(re.Map["dropped"]),
+			QueuedBytes: num(re.Map["queued-bytes"]), Direction: "root",
+		}
+		base := strings.TrimPrefix(strings.TrimPrefix(name, qosGenerations[0]), qosGenerations[1])
+		if strings.HasSuffix(base, "_up") {
+			st.Class, st.Direction = strings.TrimSuffix(base, "_up"), "up"
+		} else if strings.HasSuffix(base, "_down") {
+			st.Class, st.Direction = strings.TrimSuffix(base, "_down"), "down"
+		}
+		stats = append(stats, st)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats, nil
+}
+
+// --- CÁC API ---
+
+// 1. Danh sách chính sách
+func GetQosPolicies(c *gin.Context) {
+	var policies []models.QosPolicy
+	database.DB.Order("id").Find(&policies)
+	c.JSON(http.StatusOK, policies)
+}
+
+// 2. Tạo chính sách (áp dụng ngay cho các tàu trong phạm vi)
+func CreateQosPolicy(c *gin.Context) {
+	input := models.QosPolicy{Enabled: true} // Không gửi enabled = bật
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateQosPolicy(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID = 0
+	if err := database.DB.Create(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	jobID := applyQosToShips([]models.QosPolicy{input}, c.GetString("username"))
+	c.JSON(http.StatusCreated, gin.H{"policy": input, "job_id": jobID})
+}
+
+// 3. Sửa chính sách (áp dụng lại cho tàu thuộc phạm vi cũ và mới)
+func UpdateQosPolicy(c *gin.Context) {
+	var policy models.QosPolicy
+	if err := database.DB.First(&policy, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chính sách không tồn tại"})
+		return
+	}
+	input := models.QosPolicy{Enabled: policy.Enabled} // Không gửi enabled = giữ nguyên
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateQosPolicy(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID, input.CreatedAt = policy.ID, policy.CreatedAt
+	if err := database.DB.Save(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	jobID := applyQosToShips([]models.QosPolicy{policy, input}, c.GetString("username"))
+	c.JSON(http.StatusOK, gin.H{"policy": input, "job_id": jobID})
+}
+
+// 4. Xóa chính sách (tàu chuyển sang chính sách khác nếu có, không thì gỡ cấu hình)
+func DeleteQosPolicy(c *gin.Context) {
+	var policy models.QosPolicy
+	if err := database.DB.First(&policy, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chính sách không tồn tại"})
+		return
+	}
+	if err := database.DB.Delete(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
+		return
+	}
+	jobID := applyQosToShips([]models.QosPolicy{policy}, c.GetString("username"))
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa thành công", "job_id": jobID})
+}
+
+// 5. Xem trước lệnh RouterOS sinh ra từ chính sách
+func PreviewQosPolicy(c *gin.Context) {
+	var policy models.QosPolicy
+	if err := database.DB.First(&policy, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chính sách không tồn tại"})
+		return
+	}
+	c.JSON(http.StatusOK, renderQos(policy))
+}
+
+// 6. GET /api/ships/:ship_id/qos : chính sách hiệu lực, kết quả áp dụng gần nhất và thống kê queue trực tiếp
+func GetShipQos(c *gin.Context) {
+	var ship models.Ship
+	if err := database.DB.Where("id = ?", c.Param("ship_id")).First(&ship).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tàu"})
+		return
+	}
+	var state models.ShipQosState
+	database.DB.Where("ship_id = ?", ship.ID).Limit(1).Find(&state)
+
+	resp := gin.H{"policy": qosPolicyFor(ship), "state": state, "queues": []qosQueueStat{}}
+	if stats, err := fetchQosStats(ship.ID); err != nil {
+		resp["router_error"] = err.Error()
+	} else {
+		resp["queues"] = stats
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// 7. POST /api/ships/:ship_id/qos/apply : áp dụng lại (VD: router vừa online trở lại)
+func ApplyShipQos(c *gin.Context) {
+	var ship models.Ship
+	if err := database.DB.Where("id = ?", c.Param("ship_id")).First(&ship).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tàu"})
+		return
+	}
+	state := applyShipQos(ship)
+	if state.Status != "ok" {
+		c.JSON(http.StatusBadGateway, gin.H{"error": state.Error})
+		return
+	}
+	c.JSON(http.StatusOK, state)
+}
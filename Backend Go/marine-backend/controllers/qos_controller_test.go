@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"marine-backend/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Hai thế hệ cấu hình phải cùng tồn tại được trên router: không trùng tên queue / address-list,
+// nhưng giữ nguyên mark kết nối / gói
+func TestRenderQosGenerations(t *testing.T) {
+	policy := models.QosPolicy{
+		UplinkKbps: 1024, DownlinkKbps: 4096,
+		Classes: []models.QosClass{
+			{Name: "VoIP", Protocol: "udp", DstPorts: "5060", DstAddresses: "10.0.0.0/8", Priority: 1},
+			{Name: "Crew", SrcAddresses: "192.168.88.0/24", Fair: true, Priority: 6},
+			{Name: "Other", Priority: 8},
+		},
+	}
+	collect := func(gen string) (names map[string]bool, marks []string) {
+		names = map[string]bool{}
+		for _, cmd := range renderQosGen(policy, gen) {
+			for _, arg := range cmd.Args {
+				switch {
+				case strings.HasPrefix(arg, "=name="), strings.HasPrefix(arg, "=list="):
+					names[cmd.Path+arg] = true
+				case strings.HasPrefix(arg, "=new-connection-mark="), strings.HasPrefix(arg, "=new-packet-mark="), strings.HasPrefix(arg, "=packet-mark="):
+					marks = append(marks, arg)
+				}
+			}
+		}
+		return names, marks
+	}
+
+	namesA, marksA := collect(qosGenerations[0])
+	namesB, marksB := collect(qosGenerations[1])
+	for name := range namesA {
+		if namesB[name] {
+			t.Errorf("trùng tên giữa 2 thế hệ: %s", name)
+		}
+	}
+	if !reflect.DeepEqual(marksA, marksB) {
+		t.Errorf("mark khác nhau giữa 2 thế hệ:\n%v\n%v", marksA, marksB)
+	}
+	if !reflect.DeepEqual(renderQos(policy), renderQosGen(policy, qosPrefix)) {
+		t.Error("renderQos() phải dùng thế hệ mặc định")
+	}
+}
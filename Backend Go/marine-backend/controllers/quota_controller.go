@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var quotaActions = map[string]bool{"throttle": true, "disconnect": true, "topup": true}
+
+// Loại sự kiện timeline ứng với từng hành động khi hết dung lượng
+var quotaActionEvents = map[string]string{"throttle": "throttled", "disconnect": "disconnected", "topup": "topup_required"}
+
+// Tuần tự hóa cập nhật dung lượng (router, RADIUS, simulator cùng cộng lưu lượng)
+var quotaMu sync.Mutex
+
+var planSizePattern = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(TB|GB|MB)`)
+
+// Dung lượng gói suy từ tên, VD "Basic (1GB)" -> 1 GB; không có số = không giới hạn (0)
+func planAllowanceBytes(planName string) int64 {
+	m := planSizePattern.FindStringSubmatch(planName)
+	if m == nil {
+		return 0
+	}
+	v, _ := strconv.ParseFloat(m[1], 64)
+	unit := map[string]float64{"MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40}[strings.ToUpper(m[2])]
+	return int64(v * unit)
+}
+
+type quotaConfig struct {
+	WarnPct      int
+	Action       string
+	FallbackPlan string
+	CycleDay     int
+}
+
+func currentQuotaConfig() quotaConfig {
+	var cfg models.SystemConfig
+	database.DB.First(&cfg)
+	q := quotaConfig{WarnPct: cfg.QuotaWarning, Action: cfg.QuotaAction, FallbackPlan: cfg.QuotaFallbackPlan, CycleDay: cfg.BillingCycleDay}
+	if q.WarnPct <= 0 || q.WarnPct >= 100 {
+		q.WarnPct = 80
+	}
+	if !quotaActions[q.Action] {
+		q.Action = "throttle"
+	}
+	if q.CycleDay < 1 || q.CycleDay > 28 {
+		q.CycleDay = 1
+	}
+	return q
+}
+
+// Chu kỳ tính dung lượng chứa thời điểm at (bắt đầu từ ngày cycleDay hằng tháng)
+func billingPeriod(at time.Time, cycleDay int) (time.Time, time.Time) {
+	start := time.Date(at.Year(), at.Month(), cycleDay, 0, 0, 0, 0, at.Location())
+	if at.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start, start.AddDate(0, 1, 0)
+}
+
+// Dung lượng được dùng trong chu kỳ: gói + nạp thêm + phụ cấp công ty
+func quotaLimit(st models.QuotaState) int64 {
+	return st.AllowanceBytes + st.TopupBytes + st.WelfareBytes
+}
+
+func addCrewUsageEvent(st models.QuotaState, eventType, message string) {
+	event := models.CrewUsageEvent{
+		CrewID: st.CrewID, ShipID: st.ShipID, Username: st.Username, Type: eventType, Message: message,
+		UsedBytes: st.UsedBytes, AllowanceBytes: quotaLimit(st), CreatedAt: time.Now(),
+	}
+	database.DB.Create(&event)
+	PublishEvent(StreamEvent{Type: "quota", ShipID: st.ShipID, Data: event})
+}
+
+// Phần dung lượng nạp thêm chưa dùng hết của chu kỳ: gói + phụ cấp được trừ trước, nạp thêm trừ sau
+func unusedTopup(st models.QuotaState) int64 {
+	if st.AllowanceBytes <= 0 {
+		return st.TopupBytes // Gói không giới hạn: chưa đụng tới phần nạp thêm
+	}
+	over := max(0, st.UsedBytes-st.AllowanceBytes-st.WelfareBytes)
+	return max(0, st.TopupBytes-over)
+}
+
+// Trạng thái chu kỳ hiện tại; sang chu kỳ mới thì reset (gỡ giới hạn trên router nếu đang bị chặn).
+// Dung lượng nạp voucher không mất theo chu kỳ: phần chưa dùng được chuyển sang chu kỳ mới,
+// dùng hết thì các voucher đã nạp (Assigned) chuyển sang Expired.
+func loadQuotaState(crew models.Crew, cfg quotaConfig, at time.Time) models.QuotaState {
+	var st models.QuotaState
+	found := database.DB.First(&st, crew.ID).Error == nil
+	if found && at.Before(st.PeriodEnd) {
+		return st
+	}
+
+	start, end := billingPeriod(at, cfg.CycleDay)
+	previous := st
+	st = models.QuotaState{
+		CrewID: crew.ID, ShipID: crew.ShipID, Username: crew.Username, PeriodStart: start, PeriodEnd: end,
+		AllowanceBytes: planAllowance(crew.PlanID, crew.DataPlan), State: "normal", UpdatedAt: at,
+	}
+	if found {
+		msg := fmt.Sprintf("Bắt đầu chu kỳ mới %s", start.Format("2006-01-02"))
+		if st.TopupBytes = unusedTopup(previous); st.TopupBytes > 0 {
+			msg += fmt.Sprintf(", chuyển %d MB nạp thêm chưa dùng", st.TopupBytes>>20)
+		} else if previous.TopupBytes > 0 {
+			expireTopupVouchers(crew.ID)
+		}
+		if previous.State == "exceeded" {
+			go restoreQuotaAccess(st, planProfile(crew.PlanID, crew.DataPlan), "reset", msg)
+		} else {
+			addCrewUsageEvent(st, "reset", msg)
+		}
+	}
+	grantAllowance(crew, &st)
+	return st
+}
+
+// Voucher đã nạp hết dung lượng: user hotspot đã gỡ khi nạp nên chỉ cần đánh dấu Expired
+func expireTopupVouchers(crewID uint) {
+	database.DB.Model(&models.Voucher{}).Where("crew_id = ? AND status = ?", crewID, "Assigned").
+		Updates(map[string]interface{}{"status": "Expired", "disabled_on_router": true})
+}
+
+// Cộng lưu lượng vào chu kỳ hiện tại và xét ngưỡng cảnh báo / hết dung lượng
+func applyQuotaUsage(crewID uint, bytes int64, at time.Time) {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+
+	var crew models.Crew
+	if err := database.DB.First(&crew, crewID).Error; err != nil {
+		return
+	}
+	cfg := currentQuotaConfig()
+	st := loadQuotaState(crew, cfg, at)
+	st.UsedBytes += bytes
+	st.Username, st.ShipID = crew.Username, crew.ShipID
+	evaluateQuota(&st, crew, cfg)
+	st.UpdatedAt = at
+	database.DB.Save(&st)
+}
+
+// Chuyển trạng thái normal -> warned -> exceeded (và ngược lại khi được nạp thêm)
+func evaluateQuota(st *models.QuotaState, crew models.Crew, cfg quotaConfig) {
+	if st.AllowanceBytes <= 0 {
+		return // Gói không giới hạn
+	}
+	limit := quotaLimit(*st)
+	pct := int(st.UsedBytes * 100 / limit)
+
+	switch {
+	case st.UsedBytes >= limit && st.State != "exceeded":
+		st.State, st.Action = "exceeded", cfg.Action
+		go enforceQuota(*st, crew, cfg.FallbackPlan)
+	case st.UsedBytes < limit && st.State == "exceeded":
+		st.State, st.Action = "normal", ""
+		if pct >= cfg.WarnPct {
+			st.State = "warned"
+		}
+		go restoreQuotaAccess(*st, planProfile(crew.PlanID, crew.DataPlan), "restored", "Đã được nạp thêm dung lượng")
+	case pct >= cfg.WarnPct && st.State == "normal":
+		st.State = "warned"
+		msg := fmt.Sprintf("Đã dùng %d%% dung lượng gói %s", pct, crew.DataPlan)
+		addCrewUsageEvent(*st, "warning", msg)
+		notifyCrewQuota(*st, crew, "warning", "Sắp hết dung lượng Internet", msg)
+	}
+}
+
+func notifyCrewQuota(st models.QuotaState, crew models.Crew, severity, title, message string) {
+	n := Notification{
+		Event: "quota", Severity: severity, ShipID: crew.ShipID, Title: title, Message: message,
+		Data: map[string]interface{}{
+			"username": crew.Username, "used_mb": st.UsedBytes >> 20, "allowance_mb": quotaLimit(st) >> 20,
+		},
+	}
+	if crew.Email != "" {
+		NotifyTarget("email", crew.Email, crewLanguage(crew), n)
+	}
+}
+
+// Chạy lệnh lên tài khoản hotspot cục bộ trên router: đổi profile / khóa, rồi ngắt phiên để áp dụng ngay
+func setHotspotUserAccess(shipID, username, profile string, disabled bool) error {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	res, err := client.Run("/ip/hotspot/user/print", "?name="+username)
+	if err != nil {
+		return err
+	}
+	// Tài khoản RADIUS không có trên router: lần đăng nhập sau server RADIUS tự áp dụng
+	if len(res.Re) > 0 {
+		args := []string{"/ip/hotspot/user/set", "=.id=" + res.Re[0].Map[".id"], "=disabled=" + strconv.FormatBool(disabled)}
+		if profile != "" {
+			args = append(args, "=profile="+profile)
+		}
+		if _, err := client.Run(args...); err != nil {
+			return err
+		}
+	}
+	active, err := client.Run("/ip/hotspot/active/print", "?user="+username)
+	if err != nil {
+		return err
+	}
+	for _, re := range active.Re {
+		client.Run("/ip/hotspot/active/remove", "=.id="+re.Map[".id"])
+	}
+	return nil
+}
+
+// Gói tốc độ thấp dùng khi throttle; nil = chưa cấu hình, không tồn tại hoặc đã ngừng áp dụng
+func throttlePlan(name string) *models.BandwidthPlan {
+	plan, msg := resolvePlan(nil, name)
+	if msg != "" {
+		return nil
+	}
+	return plan
+}
+
+func enforceQuota(st models.QuotaState, crew models.Crew, fallbackPlan string) {
+	var err error
+	msg := ""
+	event := quotaActionEvents[st.Action]
+	switch st.Action {
+	case "throttle":
+		if plan := throttlePlan(fallbackPlan); plan != nil {
+			msg = "Hết dung lượng, chuyển sang gói " + plan.Name
+			err = setHotspotUserAccess(st.ShipID, st.Username, planProfile(&plan.ID, plan.Name), false)
+			break
+		}
+		// Không có gói tốc độ thấp hợp lệ: ngắt truy cập thay vì để dùng tiếp không giới hạn
+		event, msg = "disconnected", "Hết dung lượng, chưa có gói tốc độ thấp hợp lệ để throttle, đã ngắt truy cập"
+		err = setHotspotUserAccess(st.ShipID, st.Username, "", true)
+	case "disconnect":
+		msg = "Hết dung lượng, đã ngắt truy cập"
+		err = setHotspotUserAccess(st.ShipID, st.Username, "", true)
+	case "topup":
+		msg = "Hết dung lượng, cần nạp voucher để tiếp tục"
+		err = setHotspotUserAccess(st.ShipID, st.Username, "", true)
+	}
+	if err != nil {
+		msg += " (lỗi router: " + err.Error() + ")"
+	}
+	addCrewUsageEvent(st, event, msg)
+	notifyCrewQuota(st, crew, "critical", "Đã hết dung lượng Internet", msg)
+}
+
+func restoreQuotaAccess(st models.QuotaState, plan, eventType, msg string) {
+	if err := setHotspotUserAccess(st.ShipID, st.Username, plan, false); err != nil {
+		msg += " (lỗi router: " + err.Error() + ")"
+	}
+	addCrewUsageEvent(st, eventType, msg)
+}
+
+// Worker: reset dung lượng khi sang chu kỳ mới kể cả khi thuyền viên không dùng mạng
+func StartQuotaWorker() {
+	interval := envSeconds("QUOTA_CHECK_INTERVAL", 5*time.Minute)
+	for {
+		var due []models.QuotaState
+		database.DB.Where("period_end <= ?", time.Now()).Find(&due)
+		for _, st := range due {
+			applyQuotaUsage(st.CrewID, 0, time.Now())
+		}
+		time.Sleep(interval)
+	}
+}
+
+// --- API ---
+
+func quotaView(st models.QuotaState) gin.H {
+	limit := quotaLimit(st)
+	pct := 0.0
+	if limit > 0 {
+		pct = math.Round(float64(st.UsedBytes)*1000/float64(limit)) / 10
+	}
+	return gin.H{
+		"crew_id": st.CrewID, "ship_id": st.ShipID, "username": st.Username,
+		"period_start": st.PeriodStart, "period_end": st.PeriodEnd,
+		"allowance_mb": st.AllowanceBytes >> 20, "topup_mb": st.TopupBytes >> 20, "welfare_mb": st.WelfareBytes >> 20, "used_mb": st.UsedBytes >> 20,
+		"used_pct": pct, "unlimited": st.AllowanceBytes == 0, "state": st.State, "action": st.Action,
+	}
+}
+
+// GET /api/crew/:id/quota : dung lượng chu kỳ hiện tại
+func GetCrewQuota(c *gin.Context) {
+	var crew models.Crew
+	if err := database.DB.First(&crew, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User không tồn tại"})
+		return
+	}
+	quotaMu.Lock()
+	st := loadQuotaState(crew, currentQuotaConfig(), time.Now())
+	database.DB.Save(&st)
+	quotaMu.Unlock()
+	c.JSON(http.StatusOK, quotaView(st))
+}
+
+// POST /api/crew/:id/topup {voucher_code} : nạp thêm dung lượng bằng voucher
+func TopupCrewQuota(c *gin.Context) {
+	var req struct {
+		VoucherCode string `json:"voucher_code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Thiếu mã voucher"})
+		return
+	}
+	crewID, _ := strconv.Atoi(c.Param("id"))
+	var voucher models.Voucher
+	if err := database.DB.Where("code = ?", strings.TrimSpace(req.VoucherCode)).First(&voucher).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Voucher không tồn tại"})
+		return
+	}
+	voucher, st, status, msg := creditVoucherToCrew(voucher.ID, uint(crewID))
+	if msg != "" {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	recordAudit(c, fmt.Sprintf("Topped up crew %s (#%d) with voucher %s", voucher.AssignTo, crewID, voucher.Code), "Success")
+
+	c.JSON(http.StatusOK, quotaView(st))
+}
+
+// GET /api/crew/:id/timeline?from=&to= : phiên đăng nhập + sự kiện dung lượng theo thời gian
+func GetCrewTimeline(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	crewID := c.Param("id")
+
+	type timelineItem struct {
+		Time    time.Time   `json:"time"`
+		Type    string      `json:"type"`
+		Message string      `json:"message"`
+		Data    interface{} `json:"data"`
+	}
+	items := []timelineItem{}
+
+	var events []models.CrewUsageEvent
+	database.DB.Where("crew_id = ? AND created_at BETWEEN ? AND ?", crewID, from, to).Find(&events)
+	for _, e := range events {
+		items = append(items, timelineItem{Time: e.CreatedAt, Type: e.Type, Message: e.Message, Data: e})
+	}
+
+	var sessions []models.UsageSession
+	database.DB.Where("crew_id = ? AND started_at < ? AND COALESCE(ended_at, last_seen_at) > ?", crewID, to, from).Find(&sessions)
+	for _, s := range sessions {
+		mb := (s.BytesIn + s.BytesOut) >> 20
+		if !s.StartedAt.Before(from) {
+			items = append(items, timelineItem{Time: s.StartedAt, Type: "login", Message: "Đăng nhập từ " + s.Address, Data: s})
+		}
+		if s.EndedAt != nil && !s.EndedAt.After(to) {
+			items = append(items, timelineItem{Time: *s.EndedAt, Type: "logout", Message: fmt.Sprintf("Đăng xuất, phiên dùng %d MB", mb), Data: s})
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Time.After(items[j].Time) })
+	c.JSON(http.StatusOK, items)
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"marine-backend/models"
+	"testing"
+	"time"
+)
+
+func TestBillingPeriod(t *testing.T) {
+	day := func(y int, m time.Month, d, h int) time.Time { return time.Date(y, m, d, h, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name       string
+		at         time.Time
+		cycleDay   int
+		start, end time.Time
+	}{
+		{"đầu tháng, chu kỳ ngày 1", day(2026, 4, 1, 0), 1, day(2026, 4, 1, 0), day(2026, 5, 1, 0)},
+		{"cuối tháng, chu kỳ ngày 1", day(2026, 4, 30, 23), 1, day(2026, 4, 1, 0), day(2026, 5, 1, 0)},
+		{"trước ngày chu kỳ -> chu kỳ tháng trước", day(2026, 4, 14, 23), 15, day(2026, 3, 15, 0), day(2026, 4, 15, 0)},
+		{"đúng ngày chu kỳ", day(2026, 4, 15, 0), 15, day(2026, 4, 15, 0), day(2026, 5, 15, 0)},
+		{"sau ngày chu kỳ", day(2026, 4, 20, 8), 15, day(2026, 4, 15, 0), day(2026, 5, 15, 0)},
+		{"tháng 1 lùi về tháng 12 năm trước", day(2026, 1, 10, 0), 15, day(2025, 12, 15, 0), day(2026, 1, 15, 0)},
+		{"tháng 12 sang tháng 1 năm sau", day(2026, 12, 20, 0), 15, day(2026, 12, 15, 0), day(2027, 1, 15, 0)},
+		{"chu kỳ ngày 28 qua tháng 2", day(2026, 2, 27, 0), 28, day(2026, 1, 28, 0), day(2026, 2, 28, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := billingPeriod(tt.at, tt.cycleDay)
+			if !start.Equal(tt.start) || !end.Equal(tt.end) {
+				t.Errorf("billingPeriod() = %v - %v, want %v - %v", start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestUnusedTopup(t *testing.T) {
+	tests := []struct {
+		name string
+		st   models.QuotaState
+		want int64
+	}{
+		{"không nạp thêm", models.QuotaState{AllowanceBytes: 100, UsedBytes: 150}, 0},
+		{"chưa dùng hết gói", models.QuotaState{AllowanceBytes: 100, TopupBytes: 50, UsedBytes: 80}, 50},
+		{"dùng một phần nạp thêm", models.QuotaState{AllowanceBytes: 100, TopupBytes: 50, UsedBytes: 120}, 30},
+		{"phụ cấp trừ trước nạp thêm", models.QuotaState{AllowanceBytes: 100, WelfareBytes: 20, TopupBytes: 50, UsedBytes: 120}, 50},
+		{"dùng hết nạp thêm", models.QuotaState{AllowanceBytes: 100, TopupBytes: 50, UsedBytes: 150}, 0},
+		{"vượt cả nạp thêm", models.QuotaState{AllowanceBytes: 100, TopupBytes: 50, UsedBytes: 400}, 0},
+		{"gói không giới hạn", models.QuotaState{TopupBytes: 50, UsedBytes: 400}, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unusedTopup(tt.st); got != tt.want {
+				t.Errorf("unusedTopup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
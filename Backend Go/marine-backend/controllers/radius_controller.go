@@ -0,0 +1,299 @@
+package controllers
+
+import (
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"marine-backend/radius"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Thống kê server RADIUS
+var radiusStats = struct {
+	mu             sync.Mutex
+	AccessRequests int64
+	Accepts        int64
+	Rejects        int64
+	AcctRequests   int64
+	Dropped        int64 // NAS lạ / sai secret
+	LastRequestAt  *time.Time
+}{}
+
+// Quyền truy cập cấp cho 1 tài khoản hotspot
+type radiusGrant struct {
+	Plan           *models.BandwidthPlan
+	SessionTimeout time.Duration // 0 = không giới hạn
+	Voucher        string        // Mã voucher (đăng nhập bằng voucher)
+}
+
+// Tìm tàu gửi request: NAS-Identifier = mã tàu, nếu không thì theo IP nguồn / NAS-IP-Address
+func radiusShipFor(src net.IP, p *radius.Packet) (models.Ship, bool) {
+	var ship models.Ship
+	if id := p.String(radius.AttrNASIdentifier); id != "" {
+		if database.DB.Where("id = ?", id).First(&ship).Error == nil {
+			return ship, true
+		}
+	}
+	ips := []string{src.String()}
+	if nasIP := p.IP(radius.AttrNASIPAddress); nasIP != nil {
+		ips = append(ips, nasIP.String())
+	}
+	err := database.DB.Where("router_ip IN ? OR flow_exporter IN ?", ips, ips).First(&ship).Error
+	return ship, err == nil
+}
+
+func radiusSecretFor(ship models.Ship) []byte {
+	if ship.RadiusSecret != "" {
+		return []byte(ship.RadiusSecret)
+	}
+	return []byte(os.Getenv("RADIUS_SECRET"))
+}
+
+// Xác thực crew (username + mật khẩu hotspot) hoặc voucher (mã = username = mật khẩu)
+func radiusAuthorize(shipID, username string, checkPassword func(string) bool) (radiusGrant, string) {
+	var grant radiusGrant
+	var planID *uint
+	planName := ""
+
+	var crew models.Crew
+	var voucher models.Voucher
+	if database.DB.Where("ship_id = ? AND username = ?", shipID, username).First(&crew).Error == nil {
+		if crew.Status != "" && crew.Status != "Active" {
+			return grant, "Tài khoản đang bị khóa"
+		}
+		if crew.HotspotPassword == "" || !checkPassword(crew.HotspotPassword) {
+			return grant, "Sai tên đăng nhập hoặc mật khẩu"
+		}
+		planID, planName = crew.PlanID, crew.DataPlan
+		// Hết dung lượng: throttle -> cấp gói tốc độ thấp, còn lại (hoặc chưa có gói tốc độ thấp hợp lệ) từ chối
+		var quota models.QuotaState
+		if database.DB.First(&quota, crew.ID).Error == nil && quota.State == "exceeded" && time.Now().Before(quota.PeriodEnd) {
+			fallback := throttlePlan(currentQuotaConfig().FallbackPlan)
+			if quota.Action != "throttle" || fallback == nil {
+				return grant, "Đã hết dung lượng gói"
+			}
+			planID, planName = &fallback.ID, fallback.Name
+		}
+	} else if database.DB.Where("code = ?", username).First(&voucher).Error == nil {
+		if !checkPassword(voucher.Code) {
+			return grant, "Sai mã voucher"
+		}
+		if voucher.CrewID != 0 {
+			return grant, "Voucher đã nạp vào tài khoản thuyền viên"
+		}
+		if voucher.Status == "Expired" || voucher.Status == "Revoked" {
+			return grant, "Voucher không còn hiệu lực"
+		}
+		if voucher.ShipID != "" && voucher.ShipID != shipID {
+			return grant, "Voucher không dùng được trên tàu này"
+		}
+		if voucher.ExpiresAt != nil {
+			remaining := time.Until(*voucher.ExpiresAt)
+			if remaining <= 0 {
+				return grant, "Voucher đã hết hạn"
+			}
+			grant.SessionTimeout = remaining
+		} else if voucher.ValidDays > 0 {
+			// Lần đầu đăng nhập: hạn dùng bắt đầu tính từ bây giờ
+			grant.SessionTimeout = time.Duration(voucher.ValidDays) * 24 * time.Hour
+		}
+		grant.Voucher = voucher.Code
+		planID, planName = voucher.PlanID, voucher.DataPlan
+	} else {
+		return grant, "Sai tên đăng nhập hoặc mật khẩu"
+	}
+
+	if plan := lookupPlan(planID, planName); plan != nil && plan.Status != "Inactive" {
+		grant.Plan = plan
+	}
+	return grant, ""
+}
+
+func handleRadiusAccess(ship models.Ship, secret []byte, p *radius.Packet) *radius.Packet {
+	username := p.String(radius.AttrUserName)
+	grant, reason := radiusAuthorize(ship.ID, username, func(password string) bool {
+		return p.CheckPassword(password, secret)
+	})
+
+	radiusStats.mu.Lock()
+	defer radiusStats.mu.Unlock()
+	if reason != "" {
+		radiusStats.Rejects++
+		fmt.Printf("🚫 RADIUS từ chối %s (tàu %s): %s\n", username, ship.ID, reason)
+		reply := p.Reply(radius.AccessReject)
+		reply.AddString(radius.AttrReplyMessage, reason)
+		return reply
+	}
+	radiusStats.Accepts++
+	if grant.Voucher != "" {
+		markVoucherUsed(grant.Voucher, time.Now())
+	}
+
+	reply := p.Reply(radius.AccessAccept)
+	if grant.Plan != nil {
+		reply.AddVendor(radius.VendorMikrotik, radius.MikrotikRateLimit, []byte(planRateLimit(*grant.Plan)))
+		reply.AddVendor(radius.VendorMikrotik, radius.MikrotikGroup, []byte(grant.Plan.ProfileName))
+	}
+	if grant.SessionTimeout > 0 {
+		reply.AddUint32(radius.AttrSessionTimeout, uint32(grant.SessionTimeout.Seconds()))
+	}
+	return reply
+}
+
+// Ghi Acct-Start / Interim-Update / Stop vào bảng phiên + lưu lượng theo ngày
+func handleRadiusAccounting(ship models.Ship, p *radius.Packet) {
+	now := time.Now()
+	status := p.Uint32(radius.AttrAcctStatusType)
+
+	radiusStats.mu.Lock()
+	radiusStats.AcctRequests++
+	radiusStats.mu.Unlock()
+
+	// NAS khởi động lại: mọi phiên RADIUS đang mở của tàu coi như kết thúc
+	if status == radius.AcctOn || status == radius.AcctOff {
+		database.DB.Model(&models.UsageSession{}).
+			Where("ship_id = ? AND source = ? AND ended_at IS NULL", ship.ID, "radius").Update("ended_at", now)
+		return
+	}
+
+	username := p.String(radius.AttrUserName)
+	key := p.String(radius.AttrAcctSessionID)
+	if username == "" || key == "" {
+		return
+	}
+	bytesIn := int64(p.Uint32(radius.AttrAcctInputGigawords))<<32 | int64(p.Uint32(radius.AttrAcctInputOctets))
+	bytesOut := int64(p.Uint32(radius.AttrAcctOutputGigawords))<<32 | int64(p.Uint32(radius.AttrAcctOutputOctets))
+
+	// Tìm phiên theo Acct-Session-Id kể cả phiên đã đóng: gói Stop / Interim gửi lại hoặc đến muộn không mở phiên mới
+	var row models.UsageSession
+	err := database.DB.Where("ship_id = ? AND source = ? AND session_key = ?", ship.ID, "radius", key).Order("id desc").First(&row).Error
+	if err != nil || (row.EndedAt != nil && status == radius.AcctStart) {
+		// Mất gói Start (hoặc đây chính là Start / NAS dùng lại mã phiên): mở phiên mới
+		row = models.UsageSession{
+			ShipID: ship.ID, CrewID: crewIDFor(ship.ID, username), Username: username, SessionKey: key,
+			MAC: p.String(radius.AttrCallingStationID), Source: "radius",
+			StartedAt:  now.Add(-time.Duration(p.Uint32(radius.AttrAcctSessionTime)) * time.Second),
+			LastSeenAt: now,
+		}
+		if ip := p.IP(radius.AttrFramedIPAddress); ip != nil {
+			row.Address = ip.String()
+		}
+		database.DB.Create(&row)
+		if status == radius.AcctStart {
+			markVoucherUsed(username, now)
+		}
+	}
+
+	// Bộ đếm trong 1 phiên RADIUS chỉ tăng: không lớn hơn giá trị đã lưu (gói gửi lại) thì bỏ qua
+	deltaIn, deltaOut := max(0, bytesIn-row.BytesIn), max(0, bytesOut-row.BytesOut)
+	if deltaIn > 0 || deltaOut > 0 {
+		recordUserUsage(ship.ID, username, deltaIn, deltaOut, now)
+	}
+	updates := map[string]interface{}{"last_seen_at": now}
+	if bytesIn > row.BytesIn {
+		updates["bytes_in"] = bytesIn
+	}
+	if bytesOut > row.BytesOut {
+		updates["bytes_out"] = bytesOut
+	}
+	if status == radius.AcctStop && row.EndedAt == nil {
+		updates["ended_at"] = now
+	}
+	database.DB.Model(&row).Updates(updates)
+}
+
+func serveRadius(addr, name string, handle func(conn net.PacketConn, from net.Addr, raw []byte)) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		fmt.Printf("❌ Không mở được cổng RADIUS %s: %v\n", name, err)
+		return
+	}
+	defer conn.Close()
+	fmt.Printf("🔐 RADIUS %s listening on %s\n", name, addr)
+
+	buf := make([]byte, 4096)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			continue
+		}
+		go handle(conn, from, append([]byte(nil), buf[:n]...))
+	}
+}
+
+// Nhận gói, xác định tàu + secret; trả về nil nếu phải bỏ gói
+func radiusRequest(from net.Addr, raw []byte, code byte) (*radius.Packet, models.Ship, []byte) {
+	now := time.Now()
+	radiusStats.mu.Lock()
+	radiusStats.LastRequestAt = &now
+	radiusStats.mu.Unlock()
+
+	p, err := radius.Parse(raw)
+	if err != nil || p.Code != code {
+		return nil, models.Ship{}, nil
+	}
+	host, _, _ := net.SplitHostPort(from.String())
+	ship, ok := radiusShipFor(net.ParseIP(host), p)
+	secret := radiusSecretFor(ship)
+	valid := ok && len(secret) > 0
+	if valid && code == radius.AccountingRequest {
+		valid = radius.VerifyAccounting(raw, secret)
+	}
+	if valid && code == radius.AccessRequest {
+		valid = radius.VerifyMessageAuth(raw, secret)
+	}
+	if !valid {
+		radiusStats.mu.Lock()
+		radiusStats.Dropped++
+		radiusStats.mu.Unlock()
+		fmt.Printf("⚠️ Bỏ gói RADIUS từ %s: NAS chưa khai báo hoặc sai secret\n", host)
+		return nil, ship, nil
+	}
+	return p, ship, secret
+}
+
+// Worker: server RADIUS xác thực (1812) + accounting (1813) cho hotspot MikroTik
+func StartRadiusServer() {
+	if addr := os.Getenv("RADIUS_AUTH_ADDR"); addr != "" {
+		go serveRadius(addr, "auth", func(conn net.PacketConn, from net.Addr, raw []byte) {
+			p, ship, secret := radiusRequest(from, raw, radius.AccessRequest)
+			if p == nil {
+				return
+			}
+			radiusStats.mu.Lock()
+			radiusStats.AccessRequests++
+			radiusStats.mu.Unlock()
+			reply := handleRadiusAccess(ship, secret, p)
+			conn.WriteTo(reply.EncodeResponse(secret, true), from)
+		})
+	}
+	if addr := os.Getenv("RADIUS_ACCT_ADDR"); addr != "" {
+		go serveRadius(addr, "accounting", func(conn net.PacketConn, from net.Addr, raw []byte) {
+			p, ship, secret := radiusRequest(from, raw, radius.AccountingRequest)
+			if p == nil {
+				return
+			}
+			handleRadiusAccounting(ship, p)
+			conn.WriteTo(p.Reply(radius.AccountingResponse).EncodeResponse(secret, false), from)
+		})
+	}
+}
+
+// --- API ---
+
+// GET /api/radius/status
+func GetRadiusStatus(c *gin.Context) {
+	radiusStats.mu.Lock()
+	defer radiusStats.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{
+		"access_requests": radiusStats.AccessRequests, "accepts": radiusStats.Accepts,
+		"rejects": radiusStats.Rejects, "accounting_requests": radiusStats.AcctRequests,
+		"dropped": radiusStats.Dropped, "last_request_at": radiusStats.LastRequestAt,
+	})
+}
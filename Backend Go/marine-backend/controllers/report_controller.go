@@ -3,6 +3,7 @@ package controllers
 import (
 	"fmt"
 	"marine-backend/database"
+	"marine-backend/fonts"
 	"marine-backend/models"
 	"net/http"
 	"time"
@@ -11,6 +12,15 @@ import (
 	"github.com/jung-kurt/gofpdf"
 )
 
+// PDF A4 dùng font UTF-8 nhúng sẵn (family "DejaVu": "", "B", "I") để tên tàu / thuyền viên tiếng Việt không bị lỗi dấu
+func newPDF() *gofpdf.Fpdf {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes("DejaVu", "", fonts.Regular)
+	pdf.AddUTF8FontFromBytes("DejaVu", "B", fonts.Bold)
+	pdf.AddUTF8FontFromBytes("DejaVu", "I", fonts.Italic)
+	return pdf
+}
+
 func DownloadReport(c *gin.Context) {
 	id := c.Param("id")
 	var ship models.Ship
@@ -22,13 +32,13 @@ func DownloadReport(c *gin.Context) {
 	}
 
 	// Tạo PDF
-	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf := newPDF()
 	pdf.AddPage()
-	pdf.SetFont("Arial", "B", 20)
+	pdf.SetFont("DejaVu", "B", 20)
 	pdf.Cell(190, 10, "MARINE PORTAL - VESSEL REPORT")
 	pdf.Ln(20)
 
-	pdf.SetFont("Arial", "", 12)
+	pdf.SetFont("DejaVu", "", 12)
 	pdf.Cell(0, 10, fmt.Sprintf("Report Date: %s", time.Now().Format("2006-01-02 15:04")))
 	pdf.Ln(10)
 	pdf.Cell(0, 10, fmt.Sprintf("Vessel Name: %s", ship.Name))
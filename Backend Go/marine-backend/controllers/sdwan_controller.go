@@ -0,0 +1,557 @@
+package controllers
+
+import (
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Chế độ điều phối nhiều đường truyền
+var sdwanModes = map[string]bool{"failover": true, "cost_optimized": true, "load_balance": true}
+
+var linkKinds = map[string]bool{"vsat_ka": true, "l_band": true, "starlink": true, "4g_lte": true, "port_wifi": true}
+
+const (
+	linkCommentPrefix  = "MARINE_LINK:"  // Route mặc định + netwatch của link
+	checkCommentPrefix = "MARINE_CHECK:" // Route /32 ép netwatch đi qua đúng link
+	maxLinkWeight      = 10              // Mỗi đơn vị tỉ trọng = 1 route ECMP trên router
+)
+
+// Hai thế hệ comment luân phiên: cấu hình mới được thêm dưới thế hệ còn lại rồi mới gỡ thế hệ đang chạy
+type linkCommentGen struct{ link, check string }
+
+var linkGenerations = [2]linkCommentGen{{linkCommentPrefix, checkCommentPrefix}, {"MARINE_LINK2:", "MARINE_CHECK2:"}}
+
+// Comment do hệ thống tạo: trả về tên link và thế hệ (0 / 1)
+func parseLinkComment(comment string) (string, int, bool) {
+	for i, g := range linkGenerations {
+		for _, prefix := range []string{g.link, g.check} {
+			if name, ok := strings.CutPrefix(comment, prefix); ok {
+				return name, i, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// Chế độ và link ưu tiên của tàu (tàu không cấu hình riêng thì theo SystemConfig)
+func shipSdwanSettings(ship models.Ship) (string, string) {
+	mode, primary := ship.SdwanMode, ship.PrimaryLink
+	if mode == "" || primary == "" {
+		var config models.SystemConfig
+		if err := database.DB.First(&config).Error; err == nil {
+			if mode == "" {
+				mode = config.SdwanMode
+			}
+			if primary == "" {
+				primary = config.PrimaryLink
+			}
+		}
+	}
+	if !sdwanModes[mode] {
+		mode = "failover"
+	}
+	return mode, primary
+}
+
+// Link khớp theo tên hoặc loại (VD: geofence yêu cầu "4g_lte")
+func matchLink(l models.ShipLink, name string) bool {
+	return name != "" && (l.Name == name || l.Kind == name)
+}
+
+// Sắp xếp link theo chế độ: link đang down luôn xuống cuối
+func rankLinks(links []models.ShipLink, mode, primary string) []models.ShipLink {
+	ranked := make([]models.ShipLink, 0, len(links))
+	for _, l := range links {
+		if l.Enabled {
+			ranked = append(ranked, l)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if (a.Status == "down") != (b.Status == "down") {
+			return b.Status == "down"
+		}
+		switch mode {
+		case "cost_optimized":
+			if a.CostPerGB != b.CostPerGB {
+				return a.CostPerGB < b.CostPerGB
+			}
+		case "load_balance":
+			if a.Weight != b.Weight {
+				return a.Weight > b.Weight
+			}
+		default:
+			if matchLink(a, primary) != matchLink(b, primary) {
+				return matchLink(a, primary)
+			}
+		}
+		return a.Priority < b.Priority
+	})
+	return ranked
+}
+
+// Distance các route mặc định của link thứ i (theo thứ tự ưu tiên).
+// load_balance: link sống có Weight route cùng distance 1 -> ECMP chia tải theo tỉ trọng;
+// link chết vẫn xếp sau để dự phòng. Netwatch bật/tắt cùng lúc mọi route theo comment của link.
+func linkRouteDistances(i int, l models.ShipLink, mode string) []int {
+	if mode != "load_balance" || l.Status == "down" {
+		return []int{i + 1}
+	}
+	distances := make([]int, max(l.Weight, 1))
+	for j := range distances {
+		distances[j] = 1
+	}
+	return distances
+}
+
+// Gỡ route + netwatch của 1 link trên router (khi xóa link)
+func removeLinkConfig(shipID, name string) error {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for _, path := range []string{"/ip/route", "/tool/netwatch"} {
+		res, err := client.Run(path + "/print")
+		if err != nil {
+			return err
+		}
+		for _, re := range res.Re {
+			if link, _, ok := parseLinkComment(re.Map["comment"]); ok && link == name {
+				client.Run(path+"/remove", "=.id="+re.Map[".id"])
+			}
+		}
+	}
+	return nil
+}
+
+// Đẩy cấu hình link xuống router: route mặc định theo distance + netwatch bật/tắt route khi link chết.
+// Cấu hình mới được thêm dưới thế hệ comment còn lại, thành công mới gỡ cấu hình cũ;
+// lỗi giữa chừng thì gỡ phần vừa thêm, router giữ nguyên route cũ (tàu không mất đường ra Internet)
+func pushSdwanConfig(shipID string, ranked []models.ShipLink, mode string) error {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	type item struct{ path, id string }
+	var old []item
+	gen := linkGenerations[0]
+	for _, path := range []string{"/ip/route", "/tool/netwatch"} {
+		res, err := client.Run(path + "/print")
+		if err != nil {
+			return err
+		}
+		for _, re := range res.Re {
+			if _, g, ok := parseLinkComment(re.Map["comment"]); ok {
+				old = append(old, item{path, re.Map[".id"]})
+				if g == 0 {
+					gen = linkGenerations[1]
+				}
+			}
+		}
+	}
+
+	var staged []item
+	add := func(path string, args ...string) error {
+		res, err := client.Run(append([]string{path + "/add"}, args...)...)
+		if err != nil {
+			return err
+		}
+		staged = append(staged, item{path, res.Done.Map["ret"]})
+		return nil
+	}
+	stage := func() error {
+		for i, l := range ranked {
+			gateway := l.Gateway
+			if gateway == "" {
+				gateway = l.Interface
+			}
+			comment := gen.link + l.Name
+			for _, distance := range linkRouteDistances(i, l, mode) {
+				if err := add("/ip/route", "=dst-address=0.0.0.0/0", "=gateway="+gateway,
+					fmt.Sprintf("=distance=%d", distance), "=check-gateway=ping", "=comment="+comment); err != nil {
+					return fmt.Errorf("route %s: %v", l.Name, err)
+				}
+			}
+
+			if l.CheckHost == "" {
+				continue
+			}
+			if err := add("/ip/route", "=dst-address="+l.CheckHost+"/32", "=gateway="+gateway,
+				"=comment="+gen.check+l.Name); err != nil {
+				return fmt.Errorf("route kiểm tra %s: %v", l.Name, err)
+			}
+			find := fmt.Sprintf(`[find comment="%s"]`, comment)
+			if err := add("/tool/netwatch", "=host="+l.CheckHost, "=interval=10s", "=comment="+comment,
+				"=down-script=/ip route disable "+find, "=up-script=/ip route enable "+find); err != nil {
+				return fmt.Errorf("netwatch %s: %v", l.Name, err)
+			}
+		}
+		return nil
+	}
+	if err := stage(); err != nil {
+		for i := len(staged) - 1; i >= 0; i-- {
+			client.Run(staged[i].path+"/remove", "=.id="+staged[i].id)
+		}
+		return err
+	}
+
+	for _, it := range old {
+		client.Run(it.path+"/remove", "=.id="+it.id)
+	}
+	return nil
+}
+
+// Link đang chạy = link đầu tiên chưa down theo thứ tự ưu tiên
+func pickActiveLink(ranked []models.ShipLink) string {
+	for _, l := range ranked {
+		if l.Status != "down" {
+			return l.Name
+		}
+	}
+	return ""
+}
+
+// Ghi nhận đổi link đang chạy (nếu có)
+func recordLinkSwitch(ship models.Ship, to, mode, reason string) {
+	if to == ship.ActiveLink {
+		return
+	}
+	event := models.LinkSwitchEvent{
+		ShipID: ship.ID, FromLink: ship.ActiveLink, ToLink: to, Mode: mode, Reason: reason, CreatedAt: time.Now(),
+	}
+	database.DB.Create(&event)
+	database.DB.Model(&models.Ship{}).Where("id = ?", ship.ID).Update("active_link", to)
+	fmt.Printf("🔀 Tàu %s chuyển link %s → %s (%s)\n", ship.ID, ship.ActiveLink, to, reason)
+	PublishEvent(StreamEvent{Type: "link", ShipID: ship.ID, Company: ship.Company, Data: event})
+	if ship.ActiveLink != "" {
+		Notify(Notification{
+			Event: "link_switch", Severity: "warning", ShipID: ship.ID, Company: ship.Company,
+			Title:   fmt.Sprintf("%s: chuyển link %s → %s", ship.Name, ship.ActiveLink, to),
+			Message: reason,
+			Data:    map[string]interface{}{"from": ship.ActiveLink, "to": to, "mode": mode},
+		})
+	}
+}
+
+// ÁP DỤNG SD-WAN cho 1 tàu: sắp xếp link theo chế độ, đẩy xuống router, cập nhật link đang chạy
+func applyShipSdwan(shipID, reason string) error {
+	var ship models.Ship
+	if err := database.DB.Where("id = ?", shipID).First(&ship).Error; err != nil {
+		return fmt.Errorf("không tìm thấy tàu")
+	}
+	var links []models.ShipLink
+	database.DB.Where("ship_id = ?", shipID).Find(&links)
+	if len(links) == 0 {
+		return fmt.Errorf("tàu chưa khai báo đường truyền")
+	}
+
+	mode, primary := shipSdwanSettings(ship)
+	ranked := rankLinks(links, mode, primary)
+	if err := pushSdwanConfig(shipID, ranked, mode); err != nil {
+		return err
+	}
+	recordLinkSwitch(ship, pickActiveLink(ranked), mode, reason)
+	return nil
+}
+
+// Áp dụng lại cho các tàu theo cấu hình hệ thống (khi đổi chế độ / link ưu tiên toàn đội)
+func applyFleetSdwan(reason string) {
+	var shipIDs []string
+	database.DB.Model(&models.ShipLink{}).Distinct("ship_id").Pluck("ship_id", &shipIDs)
+	for _, id := range shipIDs {
+		if err := applyShipSdwan(id, reason); err != nil {
+			fmt.Printf("⚠️ Không áp dụng SD-WAN cho tàu %s: %v\n", id, err)
+		}
+	}
+}
+
+// Đổi link ưu tiên (dùng bởi Geofence): link có thể là tên hoặc loại
+func switchPrimaryLink(shipID, link string) error {
+	var links []models.ShipLink
+	database.DB.Where("ship_id = ?", shipID).Find(&links)
+	found := len(links) == 0 // Tàu chưa khai báo link: chỉ lưu lựa chọn
+	for _, l := range links {
+		if matchLink(l, link) {
+			link, found = l.Name, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("tàu không có link %s", link)
+	}
+
+	database.DB.Model(&models.Ship{}).Where("id = ?", shipID).Update("primary_link", link)
+	publishShipChanges(shipID)
+	if len(links) == 0 {
+		return nil
+	}
+	return applyShipSdwan(shipID, "Đổi link ưu tiên sang "+link)
+}
+
+// Worker đọc trạng thái netwatch trên router, cập nhật tình trạng link và ghi nhận lần chuyển link
+func StartSdwanMonitor() {
+	interval := envSeconds("SDWAN_CHECK_INTERVAL", 60*time.Second)
+	for {
+		var shipIDs []string
+		database.DB.Model(&models.ShipLink{}).Distinct("ship_id").Pluck("ship_id", &shipIDs)
+		for _, id := range shipIDs {
+			checkShipLinks(id)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func checkShipLinks(shipID string) {
+	client, ship, err := ConnectToRouter(shipID)
+	if err != nil {
+		return // Router offline: trạng thái tàu đã do ShipMonitor xử lý
+	}
+	res, err := client.Run("/tool/netwatch/print")
+	client.Close()
+	if err != nil {
+		return
+	}
+	netwatch := make(map[string]string)
+	for _, re := range res.Re {
+		if name, _, ok := parseLinkComment(re.Map["comment"]); ok {
+			netwatch[name] = re.Map["status"]
+		}
+	}
+
+	var links []models.ShipLink
+	database.DB.Where("ship_id = ?", shipID).Find(&links)
+	now := time.Now()
+	var changed []string
+	for i := range links {
+		status := "unknown"
+		if s, ok := netwatch[links[i].Name]; ok && (s == "up" || s == "down") {
+			status = s
+		}
+		if status != links[i].Status {
+			changed = append(changed, fmt.Sprintf("%s %s", links[i].Name, status))
+		}
+		links[i].Status = status
+		links[i].LastCheckAt = &now
+		database.DB.Model(&links[i]).Updates(map[string]interface{}{"status": status, "last_check_at": now})
+	}
+
+	mode, primary := shipSdwanSettings(*ship)
+	active := pickActiveLink(rankLinks(links, mode, primary))
+	reason := "Netwatch: " + strings.Join(changed, ", ")
+	if len(changed) == 0 {
+		reason = "Đồng bộ trạng thái router"
+	}
+	recordLinkSwitch(*ship, active, mode, reason)
+}
+
+func validateShipLink(l *models.ShipLink) string {
+	l.Name = strings.TrimSpace(l.Name)
+	if l.Name == "" || strings.ContainsAny(l.Name, `"[]`) {
+		return "Tên link không hợp lệ"
+	}
+	if !linkKinds[l.Kind] {
+		return "Loại link phải là vsat_ka, l_band, starlink, 4g_lte hoặc port_wifi"
+	}
+	if l.Gateway == "" && l.Interface == "" {
+		return "Cần gateway hoặc interface"
+	}
+	if l.Gateway != "" && net.ParseIP(l.Gateway) == nil {
+		return "Gateway phải là địa chỉ IP"
+	}
+	if l.CheckHost != "" && net.ParseIP(l.CheckHost) == nil {
+		return "Check host phải là địa chỉ IP"
+	}
+	if l.CostPerGB < 0 {
+		return "Chi phí không hợp lệ"
+	}
+	if l.Weight <= 0 {
+		l.Weight = 1
+	}
+	if l.Weight > maxLinkWeight {
+		return fmt.Sprintf("Tỉ trọng phải từ 1 đến %d", maxLinkWeight)
+	}
+	return ""
+}
+
+// Tên và check host không được trùng với link khác của cùng tàu
+func shipLinkConflict(l models.ShipLink) string {
+	var others []models.ShipLink
+	database.DB.Where("ship_id = ? AND id <> ?", l.ShipID, l.ID).Find(&others)
+	for _, o := range others {
+		if strings.EqualFold(o.Name, l.Name) {
+			return "Tên link đã tồn tại"
+		}
+		if l.CheckHost != "" && o.CheckHost == l.CheckHost {
+			return "Mỗi link cần 1 check host riêng"
+		}
+	}
+	return ""
+}
+
+// --- CÁC API ---
+
+// 1. Danh sách link của tàu
+func GetShipLinks(c *gin.Context) {
+	var links []models.ShipLink
+	database.DB.Where("ship_id = ?", c.Param("ship_id")).Order("priority, id").Find(&links)
+	c.JSON(http.StatusOK, links)
+}
+
+// 2. Thêm link
+func CreateShipLink(c *gin.Context) {
+	input := models.ShipLink{Enabled: true} // Không gửi enabled = bật
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.ID = 0
+	input.ShipID = c.Param("ship_id")
+	if msg := validateShipLink(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if msg := shipLinkConflict(input); msg != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": msg})
+		return
+	}
+	input.Status = "unknown"
+	input.CreatedAt = time.Now()
+	if err := database.DB.Create(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	c.JSON(http.StatusCreated, input)
+}
+
+// 3. Sửa link (cần gọi /sdwan/apply để đẩy xuống router)
+func UpdateShipLink(c *gin.Context) {
+	var link models.ShipLink
+	if err := database.DB.Where("ship_id = ?", c.Param("ship_id")).First(&link, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link không tồn tại"})
+		return
+	}
+	input := models.ShipLink{Enabled: link.Enabled} // Không gửi enabled = giữ nguyên
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.ID, input.ShipID = link.ID, link.ShipID
+	if msg := validateShipLink(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if msg := shipLinkConflict(input); msg != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": msg})
+		return
+	}
+	input.Status, input.LastCheckAt, input.CreatedAt = link.Status, link.LastCheckAt, link.CreatedAt
+	if err := database.DB.Save(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	c.JSON(http.StatusOK, input)
+}
+
+// 4. Xóa link (gỡ luôn route + netwatch của link trên router)
+func DeleteShipLink(c *gin.Context) {
+	var link models.ShipLink
+	if err := database.DB.Where("ship_id = ?", c.Param("ship_id")).First(&link, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link không tồn tại"})
+		return
+	}
+	if err := database.DB.Delete(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
+		return
+	}
+	if err := removeLinkConfig(link.ShipID, link.Name); err != nil {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Đã xóa, chưa gỡ được cấu hình trên router", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa thành công"})
+}
+
+// 5. GET /api/ships/:ship_id/sdwan : chế độ, link đang chạy, thứ tự ưu tiên và lịch sử chuyển link
+func GetShipSdwan(c *gin.Context) {
+	var ship models.Ship
+	if err := database.DB.Where("id = ?", c.Param("ship_id")).First(&ship).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tàu"})
+		return
+	}
+	var links []models.ShipLink
+	database.DB.Where("ship_id = ?", ship.ID).Find(&links)
+	mode, primary := shipSdwanSettings(ship)
+
+	var switches []models.LinkSwitchEvent
+	database.DB.Where("ship_id = ?", ship.ID).Order("created_at desc").Limit(50).Find(&switches)
+
+	c.JSON(http.StatusOK, gin.H{
+		"mode": mode, "mode_override": ship.SdwanMode != "",
+		"primary_link": primary, "active_link": ship.ActiveLink,
+		"links": rankLinks(links, mode, primary), "switches": switches,
+	})
+}
+
+// 6. PUT /api/ships/:ship_id/sdwan : {mode, primary_link} (rỗng = theo cấu hình hệ thống) rồi áp dụng
+func UpdateShipSdwan(c *gin.Context) {
+	var input struct {
+		Mode        string `json:"mode"`
+		PrimaryLink string `json:"primary_link"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Mode != "" && !sdwanModes[input.Mode] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chế độ phải là failover, cost_optimized hoặc load_balance"})
+		return
+	}
+	shipID := c.Param("ship_id")
+	result := database.DB.Model(&models.Ship{}).Where("id = ?", shipID).
+		Updates(map[string]interface{}{"sdwan_mode": input.Mode, "primary_link": input.PrimaryLink})
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tàu"})
+		return
+	}
+	if err := applyShipSdwan(shipID, "Cập nhật chế độ SD-WAN"); err != nil {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Đã lưu, chưa đẩy được xuống router", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã áp dụng SD-WAN"})
+}
+
+// 7. POST /api/ships/:ship_id/sdwan/apply : đẩy lại cấu hình link xuống router
+func ApplyShipSdwan(c *gin.Context) {
+	if err := applyShipSdwan(c.Param("ship_id"), "Áp dụng thủ công"); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã áp dụng SD-WAN"})
+}
+
+// 8. GET /api/link-switches?ship_id=&from=&to= : lịch sử chuyển link toàn đội tàu
+func GetLinkSwitches(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var events []models.LinkSwitchEvent
+	query := database.DB.Where("created_at BETWEEN ? AND ?", from, to).Order("created_at desc").Limit(500)
+	if shipID := c.Query("ship_id"); shipID != "" {
+		query = query.Where("ship_id = ?", shipID)
+	}
+	query.Find(&events)
+	c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"marine-backend/models"
+	"reflect"
+	"testing"
+)
+
+func TestLinkRouteDistances(t *testing.T) {
+	tests := []struct {
+		name string
+		i    int
+		link models.ShipLink
+		mode string
+		want []int
+	}{
+		{"failover theo thứ tự", 2, models.ShipLink{Weight: 3}, "failover", []int{3}},
+		{"cost_optimized bỏ qua tỉ trọng", 0, models.ShipLink{Weight: 5}, "cost_optimized", []int{1}},
+		{"load_balance tỉ trọng 1", 1, models.ShipLink{Weight: 1}, "load_balance", []int{1}},
+		{"load_balance tỉ trọng 3", 1, models.ShipLink{Weight: 3}, "load_balance", []int{1, 1, 1}},
+		{"load_balance chưa đặt tỉ trọng", 0, models.ShipLink{}, "load_balance", []int{1}},
+		{"load_balance link chết xếp sau", 2, models.ShipLink{Weight: 3, Status: "down"}, "load_balance", []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := linkRouteDistances(tt.i, tt.link, tt.mode); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("linkRouteDistances() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLinkComment(t *testing.T) {
+	tests := []struct {
+		comment string
+		name    string
+		gen     int
+		ok      bool
+	}{
+		{"MARINE_LINK:vsat", "vsat", 0, true},
+		{"MARINE_CHECK:starlink", "starlink", 0, true},
+		{"MARINE_LINK2:vsat", "vsat", 1, true},
+		{"MARINE_CHECK2:4g", "4g", 1, true},
+		{"MARINE_QOS:voip", "", 0, false},
+		{"route tay", "", 0, false},
+	}
+	for _, tt := range tests {
+		name, gen, ok := parseLinkComment(tt.comment)
+		if name != tt.name || gen != tt.gen || ok != tt.ok {
+			t.Errorf("parseLinkComment(%q) = %q, %d, %v, want %q, %d, %v", tt.comment, name, gen, ok, tt.name, tt.gen, tt.ok)
+		}
+	}
+}
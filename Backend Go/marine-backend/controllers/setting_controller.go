@@ -17,6 +17,7 @@ func GetSettings(c *gin.Context) {
 		config = models.SystemConfig{
 			PrimaryLink: "vsat_ka", SdwanMode: "failover", Firewall: true,
 			SnrThreshold: 5.0, QuotaWarning: 80, Recipients: "admin@marine.com",
+			QuotaAction: "throttle", BillingCycleDay: 1,
 		}
 		database.DB.Create(&config)
 	}
@@ -31,6 +32,18 @@ func UpdateSettings(c *gin.Context) {
 		return
 	}
 
+	// Throttle cần gói tốc độ thấp đang hoạt động, nếu không thuyền viên hết dung lượng vẫn dùng không giới hạn
+	if input.QuotaAction != "" && !quotaActions[input.QuotaAction] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hành động khi hết dung lượng không hợp lệ"})
+		return
+	}
+	if input.QuotaAction == "" || input.QuotaAction == "throttle" {
+		if _, msg := resolvePlan(nil, input.QuotaFallbackPlan); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Gói tốc độ thấp khi throttle: " + msg})
+			return
+		}
+	}
+
 	// Cập nhật vào DB (Bản ghi ID=1)
 	// Sử dụng Model để đảm bảo chỉ update ID 1
 	var config models.SystemConfig
@@ -44,21 +57,31 @@ func UpdateSettings(c *gin.Context) {
 	}
 
 	// --- GHI AUDIT LOG ---
-	// Lấy IP người dùng (Giả lập hoặc lấy từ Header)
-	clientIP := c.ClientIP()
-	
-	logEntry := models.AuditLog{
-		User:      "admin", // Thực tế lấy từ JWT Token
-		Action:    "Updated System Configuration",
-		IPAddress: clientIP,
-		Status:    "Success",
-		CreatedAt: time.Now(),
+	recordAudit(c, "Updated System Configuration", "Success")
+
+	// Đổi chế độ / link ưu tiên toàn đội -> áp dụng lại cho các tàu dùng cấu hình chung
+	if input.SdwanMode != config.SdwanMode || input.PrimaryLink != config.PrimaryLink {
+		go applyFleetSdwan("Cập nhật cấu hình hệ thống")
 	}
-	database.DB.Create(&logEntry)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Cấu hình đã lưu & Ghi nhật ký thành công"})
 }
 
+// Ghi nhật ký thao tác của người dùng đang đăng nhập (username từ JWT)
+func recordAudit(c *gin.Context, action, status string) {
+	user := c.GetString("username")
+	if user == "" {
+		user = "system"
+	}
+	database.DB.Create(&models.AuditLog{
+		User:      user,
+		Action:    action,
+		IPAddress: c.ClientIP(),
+		Status:    status,
+		CreatedAt: time.Now(),
+	})
+}
+
 // 3. Lấy danh sách Audit Logs
 func GetAuditLogs(c *gin.Context) {
 	var logs []models.AuditLog
@@ -28,20 +28,13 @@ func CreateShip(c *gin.Context) {
 	if input.Status == "" { input.Status = "Online" }
 	if input.SNR == 0 { input.SNR = 12.0 }
 	input.UpdatedAt = time.Now()
+	input.StatusChangedAt = input.UpdatedAt
 
 	result := database.DB.Create(&input)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "ID đã tồn tại hoặc lỗi DB"})
 		return
 	}
+	publishShipChanges(input.ID)
 	c.JSON(http.StatusCreated, input)
 }
-
-// Chạy ngầm Simulator (Dùng GORM)
-func StartSimulation() {
-	for {
-		// Update SNR ngẫu nhiên cho tàu Online
-		database.DB.Exec("UPDATE ships SET snr = ROUND((snr + (random() - 0.5))::numeric, 1), updated_at = NOW() WHERE status = 'Online'")
-		time.Sleep(2 * time.Second)
-	}
-}
\ No newline at end of file
@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Chế độ mô phỏng theo kịch bản (SIMULATOR_SCENARIO=scenarios/demo.json)
+// Dữ liệu sinh ra đi qua đúng các pipeline như dữ liệu thật (heartbeat, vị trí, usage, voucher)
+// Cùng seed -> cùng chuỗi sự kiện, dùng để demo và load test khi không có phần cứng
+
+// Vùng phủ beam vệ tinh hoặc vùng thời tiết xấu
+type ScenarioZone struct {
+	Name       string  `json:"name"`
+	Satellite  string  `json:"satellite"`
+	Lat        float64 `json:"lat"`
+	Lon        float64 `json:"lon"`
+	RadiusNm   float64 `json:"radius_nm"`
+	BaseSNR    float64 `json:"base_snr"`    // Beam: SNR tại tâm beam
+	SNRPenalty float64 `json:"snr_penalty"` // Thời tiết: SNR bị trừ tại tâm vùng
+	DriftLat   float64 `json:"drift_lat"`   // Độ / giờ mô phỏng
+	DriftLon   float64 `json:"drift_lon"`
+}
+
+type ScenarioShip struct {
+	ID            string       `json:"id"`
+	Name          string       `json:"name"`
+	Type          string       `json:"type"`
+	SpeedKn       float64      `json:"speed_kn"`
+	Route         [][2]float64 `json:"route"` // [[lat, lon], ...] - đi vòng tròn
+	Crew          int          `json:"crew"`
+	OutageRate    float64      `json:"outage_rate"`    // Xác suất mất link mỗi tick
+	OutageSeconds int          `json:"outage_seconds"` // Thời gian mất link (giây thật)
+	Link          string       `json:"link"`           // Loại link ghi lưu lượng (mặc định vsat_ka)
+}
+
+type Scenario struct {
+	Name        string         `json:"name"`
+	Seed        int64          `json:"seed"`
+	TickSeconds int            `json:"tick_seconds"` // Chu kỳ tick (giây thật)
+	TimeScale   float64        `json:"time_scale"`   // 1 giây thật = N giây mô phỏng (di chuyển tàu)
+	Company     string         `json:"company"`
+	Beams       []ScenarioZone `json:"beams"`
+	Weather     []ScenarioZone `json:"weather"`
+	Ships       []ScenarioShip `json:"ships"`
+
+	// Sinh thêm tàu ngẫu nhiên (theo seed) giữa các cảng để load test
+	FleetSize   int          `json:"fleet_size"`
+	CrewPerShip int          `json:"crew_per_ship"`
+	Ports       [][2]float64 `json:"ports"`
+
+	Crew struct {
+		LoginRate   float64 `json:"login_rate"`
+		LogoutRate  float64 `json:"logout_rate"`
+		MBPerMinute float64 `json:"mb_per_minute"`
+	} `json:"crew"`
+
+	// Lưu lượng vận hành tàu (email, ERP, telemetry) mỗi phút, cộng vào link cùng với crew
+	OpsMBPerMinute float64 `json:"ops_mb_per_minute"`
+
+	Vouchers struct {
+		Stock      int     `json:"stock"`
+		RedeemRate float64 `json:"redeem_rate"`
+		DataPlan   string  `json:"data_plan"`
+		ValidDays  int     `json:"valid_days"`
+	} `json:"vouchers"`
+}
+
+type simCrew struct {
+	id       uint
+	username string
+	session  *hotspotSession
+}
+
+type simShip struct {
+	cfg         ScenarioShip
+	company     string
+	leg         int
+	progressNm  float64
+	lat, lon    float64
+	course      float64
+	outageTicks int
+	crew        []*simCrew
+}
+
+type simulator struct {
+	mu       sync.Mutex
+	scenario Scenario
+	rng      *rand.Rand
+	tick     int
+	simTime  time.Duration
+	ships    []*simShip
+	weather  []ScenarioZone
+	vouchers []string
+	guests   uint
+}
+
+var activeSimulator *simulator
+
+var simRanks = []string{"Master", "Chief Officer", "2nd Officer", "3rd Officer", "Chief Engineer", "2nd Engineer",
+	"3rd Engineer", "Bosun", "AB", "AB", "OS", "Oiler", "Oiler", "Cook", "Messman"}
+
+// --- KHỞI TẠO ---
+
+func loadScenario(path string) (Scenario, error) {
+	var sc Scenario
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return sc, err
+	}
+	if err := json.Unmarshal(raw, &sc); err != nil {
+		return sc, err
+	}
+	if sc.TickSeconds <= 0 {
+		sc.TickSeconds = 5
+	}
+	if sc.TimeScale <= 0 {
+		sc.TimeScale = 1
+	}
+	if sc.Company == "" {
+		sc.Company = "Simulated Lines"
+	}
+	if sc.CrewPerShip <= 0 {
+		sc.CrewPerShip = 10
+	}
+	if sc.Vouchers.DataPlan == "" {
+		sc.Vouchers.DataPlan = "Basic (1GB)"
+	}
+	if sc.Vouchers.ValidDays <= 0 {
+		sc.Vouchers.ValidDays = 30
+	}
+	return sc, nil
+}
+
+func newSimulator(sc Scenario) *simulator {
+	s := &simulator{scenario: sc, rng: rand.New(rand.NewSource(sc.Seed))}
+	s.weather = append(s.weather, sc.Weather...)
+
+	ships := append([]ScenarioShip{}, sc.Ships...)
+	// Sinh thêm tàu giữa các cảng (thứ tự rng cố định -> tái lập được)
+	for i := 0; i < sc.FleetSize && len(sc.Ports) >= 2; i++ {
+		n := 2 + s.rng.Intn(3)
+		route := make([][2]float64, 0, n)
+		for len(route) < n {
+			p := sc.Ports[s.rng.Intn(len(sc.Ports))]
+			if len(route) > 0 && route[len(route)-1] == p {
+				continue
+			}
+			route = append(route, p)
+		}
+		ships = append(ships, ScenarioShip{
+			ID: fmt.Sprintf("SIM%05d", i+1), Name: fmt.Sprintf("Sim Vessel %d", i+1), Type: "Bulk",
+			SpeedKn: 10 + s.rng.Float64()*8, Route: route, Crew: sc.CrewPerShip,
+			OutageRate: 0.002, OutageSeconds: 240,
+		})
+	}
+
+	for _, cfg := range ships {
+		if len(cfg.Route) == 0 {
+			continue
+		}
+		if cfg.Crew <= 0 {
+			cfg.Crew = sc.CrewPerShip
+		}
+		s.ships = append(s.ships, &simShip{cfg: cfg, company: sc.Company, lat: cfg.Route[0][0], lon: cfg.Route[0][1]})
+	}
+	return s
+}
+
+// Tạo tàu, thuyền viên và voucher trong DB nếu chưa có
+func (s *simulator) setup() {
+	now := time.Now()
+	plan := planByNameOrCreate(s.scenario.Vouchers.DataPlan)
+	for _, sh := range s.ships {
+		ship := models.Ship{
+			ID: sh.cfg.ID, Name: sh.cfg.Name, Company: sh.company, Type: sh.cfg.Type,
+			Lat: sh.lat, Lon: sh.lon, SNR: 12.0, Status: StatusOffline,
+			UpdatedAt: now, StatusChangedAt: now,
+		}
+		database.DB.Where("id = ?", ship.ID).FirstOrCreate(&ship)
+
+		for i := 0; i < sh.cfg.Crew; i++ {
+			crew := models.Crew{
+				ShipID: sh.cfg.ID, Username: fmt.Sprintf("sim.%s.%02d", sh.cfg.ID, i+1),
+				FullName: fmt.Sprintf("Crew %02d", i+1), Rank: simRanks[i%len(simRanks)],
+				Nationality: "Vietnam", PlanID: &plan.ID, DataPlan: plan.Name, Status: "Active", CreatedAt: now,
+			}
+			database.DB.Where("ship_id = ? AND username = ?", crew.ShipID, crew.Username).FirstOrCreate(&crew)
+			sh.crew = append(sh.crew, &simCrew{id: crew.ID, username: crew.Username})
+		}
+	}
+
+	for i := 0; i < s.scenario.Vouchers.Stock; i++ {
+		v := models.Voucher{
+			Code: fmt.Sprintf("SIM-%06d", s.rng.Intn(1000000)), PlanID: &plan.ID, DataPlan: plan.Name,
+			Status: "Unused", CreatedBy: "simulator", ValidDays: s.scenario.Vouchers.ValidDays, CreatedAt: now,
+		}
+		database.DB.Where("code = ?", v.Code).FirstOrCreate(&v)
+		if v.Status == "Unused" {
+			s.vouchers = append(s.vouchers, v.Code)
+		}
+	}
+}
+
+// --- MỖI TICK ---
+
+func (s *simulator) step() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tick++
+	dt := time.Duration(float64(s.scenario.TickSeconds)*s.scenario.TimeScale) * time.Second
+	s.simTime += dt
+	hours := dt.Hours()
+
+	// Vùng thời tiết trôi dần
+	for i := range s.weather {
+		s.weather[i].Lat += s.weather[i].DriftLat * hours
+		s.weather[i].Lon += s.weather[i].DriftLon * hours
+	}
+
+	for _, sh := range s.ships {
+		s.advance(sh, hours)
+
+		// Đang mất link: không có heartbeat, vị trí hay usage -> monitor tự chuyển Degraded/Offline
+		if sh.outageTicks > 0 {
+			sh.outageTicks--
+			continue
+		}
+		if s.rng.Float64() < sh.cfg.OutageRate {
+			sh.outageTicks = int(math.Ceil(float64(sh.cfg.OutageSeconds) / float64(s.scenario.TickSeconds)))
+			s.dropSessions(sh)
+			continue
+		}
+
+		speed, course := sh.cfg.SpeedKn, sh.course
+		recordShipPosition(sh.cfg.ID, PositionFix{Lat: sh.lat, Lon: sh.lon, SpeedKn: &speed, Course: &course, Source: "simulator"})
+		beam, snr := s.linkQuality(sh)
+		recordHeartbeat(sh.cfg.ID, "simulator", HeartbeatInput{SNR: &snr, Satellite: beam.Satellite, Beam: beam.Name})
+		up, down := s.stepCrew(sh, dt.Minutes())
+
+		ops := int64(s.scenario.OpsMBPerMinute * dt.Minutes() * (0.5 + s.rng.Float64()) * 1024 * 1024)
+		link := sh.cfg.Link
+		if link == "" {
+			link = "vsat_ka"
+		}
+		addLinkUsage(sh.cfg.ID, link, link, down+ops*3/4, up+ops/4, time.Now())
+	}
+
+	// Khách lên tàu đổi voucher: thêm vào danh sách người dùng hotspot của 1 tàu,
+	// lần đăng nhập đầu được ghi nhận qua bảng phiên như router thật
+	if len(s.vouchers) > 0 && len(s.ships) > 0 && s.rng.Float64() < s.scenario.Vouchers.RedeemRate {
+		code := s.vouchers[0]
+		s.vouchers = s.vouchers[1:]
+		sh := s.ships[s.rng.Intn(len(s.ships))]
+		s.guests++
+		sh.crew = append(sh.crew, &simCrew{id: 100000 + s.guests, username: code})
+	}
+}
+
+// Di chuyển tàu dọc theo tuyến
+func (s *simulator) advance(sh *simShip, hours float64) {
+	route := sh.cfg.Route
+	if len(route) < 2 {
+		return
+	}
+	sh.progressNm += sh.cfg.SpeedKn * hours
+	for {
+		from, to := route[sh.leg], route[(sh.leg+1)%len(route)]
+		legNm := haversineNm(from[0], from[1], to[0], to[1])
+		if legNm <= 0 || sh.progressNm < legNm {
+			f := 0.0
+			if legNm > 0 {
+				f = sh.progressNm / legNm
+			}
+			sh.lat = from[0] + (to[0]-from[0])*f
+			sh.lon = from[1] + (to[1]-from[1])*f
+			sh.course = math.Round(bearingDeg(from[0], from[1], to[0], to[1])*10) / 10
+			return
+		}
+		sh.progressNm -= legNm
+		sh.leg = (sh.leg + 1) % len(route)
+	}
+}
+
+// SNR phụ thuộc khoảng cách tới tâm beam và vùng thời tiết xấu
+func (s *simulator) linkQuality(sh *simShip) (ScenarioZone, float64) {
+	var best ScenarioZone
+	snr := 2.0 // Ngoài vùng phủ
+	found := false
+	for _, b := range s.scenario.Beams {
+		d := haversineNm(sh.lat, sh.lon, b.Lat, b.Lon)
+		if d > b.RadiusNm {
+			continue
+		}
+		v := b.BaseSNR - 4*math.Pow(d/b.RadiusNm, 2)
+		if !found || v > snr {
+			best, snr, found = b, v, true
+		}
+	}
+	for _, w := range s.weather {
+		d := haversineNm(sh.lat, sh.lon, w.Lat, w.Lon)
+		if d < w.RadiusNm {
+			snr -= w.SNRPenalty * (1 - d/w.RadiusNm)
+		}
+	}
+	snr += s.rng.NormFloat64() * 0.3
+	return best, math.Round(snr*10) / 10
+}
+
+// Thuyền viên đăng nhập / đăng xuất và tiêu thụ dữ liệu (trả về tổng byte gửi / nhận)
+func (s *simulator) stepCrew(sh *simShip, minutes float64) (int64, int64) {
+	changed := false
+	var totalUp, totalDown int64
+	for _, cr := range sh.crew {
+		if cr.session == nil {
+			if s.rng.Float64() < s.scenario.Crew.LoginRate {
+				cr.session = &hotspotSession{
+					ID: fmt.Sprintf("*sim%d", cr.id), User: cr.username,
+					Address: fmt.Sprintf("10.5.50.%d", 10+cr.id%240), Uptime: "0s",
+				}
+				changed = true
+				PublishEvent(StreamEvent{Type: "session", ShipID: sh.cfg.ID, Company: sh.company, Data: gin.H{"action": "login", "session": *cr.session}})
+			}
+			continue
+		}
+
+		mb := s.scenario.Crew.MBPerMinute * minutes * (0.5 + s.rng.Float64())
+		down := int64(mb * 0.8 * 1024 * 1024)
+		up := int64(mb * 0.2 * 1024 * 1024)
+		cr.session.BytesIn += up
+		cr.session.BytesOut += down
+		recordUserUsage(sh.cfg.ID, cr.username, up, down, time.Now())
+		totalUp += up
+		totalDown += down
+		changed = true
+
+		if s.rng.Float64() < s.scenario.Crew.LogoutRate {
+			PublishEvent(StreamEvent{Type: "session", ShipID: sh.cfg.ID, Company: sh.company, Data: gin.H{"action": "logout", "session": *cr.session}})
+			cr.session = nil
+		}
+	}
+	if changed {
+		s.syncSessions(sh)
+	}
+	return totalUp, totalDown
+}
+
+// Mất link -> mọi phiên hotspot bị ngắt
+func (s *simulator) dropSessions(sh *simShip) {
+	for _, cr := range sh.crew {
+		if cr.session != nil {
+			PublishEvent(StreamEvent{Type: "session", ShipID: sh.cfg.ID, Company: sh.company, Data: gin.H{"action": "logout", "session": *cr.session}})
+			cr.session = nil
+		}
+	}
+	s.syncSessions(sh)
+}
+
+// Cập nhật ảnh chụp phiên online giống như session watcher đọc từ router
+func (s *simulator) syncSessions(sh *simShip) {
+	sessions := make(map[string]hotspotSession)
+	for _, cr := range sh.crew {
+		if cr.session != nil {
+			sessions[cr.session.ID] = *cr.session
+		}
+	}
+	activeSessions.Lock()
+	activeSessions.m[sh.cfg.ID] = sessions
+	activeSessions.Unlock()
+	trackUsageSessions(sh.cfg.ID, "simulator", sessions, time.Now())
+}
+
+// Worker mô phỏng: chỉ chạy khi có SIMULATOR_SCENARIO
+func StartScenarioSimulator() {
+	path := os.Getenv("SIMULATOR_SCENARIO")
+	if path == "" {
+		return
+	}
+	sc, err := loadScenario(path)
+	if err != nil {
+		fmt.Println("❌ Không đọc được kịch bản mô phỏng:", err)
+		return
+	}
+
+	sim := newSimulator(sc)
+	sim.setup()
+	activeSimulator = sim
+	fmt.Printf("🧪 Simulator '%s' chạy với %d tàu (seed=%d)\n", sc.Name, len(sim.ships), sc.Seed)
+
+	ticker := time.NewTicker(time.Duration(sc.TickSeconds) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		sim.step()
+	}
+}
+
+// GET /api/simulator : trạng thái simulator
+func GetSimulatorStatus(c *gin.Context) {
+	sim := activeSimulator
+	if sim == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	online, outages := 0, 0
+	for _, sh := range sim.ships {
+		if sh.outageTicks > 0 {
+			outages++
+		}
+		for _, cr := range sh.crew {
+			if cr.session != nil {
+				online++
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": true, "scenario": sim.scenario.Name, "seed": sim.scenario.Seed,
+		"tick": sim.tick, "sim_elapsed": sim.simTime.String(),
+		"ships": len(sim.ships), "ships_in_outage": outages,
+		"crew_online": online, "vouchers_left": len(sim.vouchers),
+	})
+}
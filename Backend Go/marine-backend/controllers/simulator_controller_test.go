@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Vết chạy của kịch bản không đụng DB: cấu hình tàu sinh ra + vị trí / SNR sau mỗi tick
+type simTrace struct {
+	ships []ScenarioShip
+	steps [][4]float64 // lat, lon, course, snr
+}
+
+func runSimulatorTrace(t *testing.T, seed int64, fleetSize, ticks int) simTrace {
+	t.Helper()
+	sc, err := loadScenario("../scenarios/demo.json")
+	if err != nil {
+		t.Fatalf("loadScenario() error = %v", err)
+	}
+	sc.Seed, sc.FleetSize = seed, fleetSize
+
+	s := newSimulator(sc)
+	var tr simTrace
+	for _, sh := range s.ships {
+		tr.ships = append(tr.ships, sh.cfg)
+	}
+	hours := float64(sc.TickSeconds) * sc.TimeScale / 3600
+	for i := 0; i < ticks; i++ {
+		for _, sh := range s.ships {
+			s.advance(sh, hours)
+			_, snr := s.linkQuality(sh)
+			tr.steps = append(tr.steps, [4]float64{sh.lat, sh.lon, sh.course, snr})
+		}
+	}
+	return tr
+}
+
+func TestSimulatorDeterminism(t *testing.T) {
+	tests := []struct {
+		name      string
+		seedA     int64
+		seedB     int64
+		fleetSize int
+		wantSame  bool
+		wantShips int
+	}{
+		{"cùng seed, tàu trong kịch bản", 42, 42, 0, true, 2},
+		{"cùng seed, sinh thêm đội tàu", 42, 42, 25, true, 27},
+		{"khác seed", 42, 43, 25, false, 27},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := runSimulatorTrace(t, tt.seedA, tt.fleetSize, 200)
+			b := runSimulatorTrace(t, tt.seedB, tt.fleetSize, 200)
+			if len(a.ships) != tt.wantShips {
+				t.Fatalf("số tàu = %d, want %d", len(a.ships), tt.wantShips)
+			}
+			if same := reflect.DeepEqual(a, b); same != tt.wantSame {
+				t.Errorf("hai lần chạy giống nhau = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
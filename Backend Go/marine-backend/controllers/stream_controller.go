@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"marine-backend/database"
+	"marine-backend/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sự kiện đẩy xuống Dashboard qua Server-Sent Events
+type StreamEvent struct {
+	Type    string      `json:"type"` // ship / alert / session / job
+	ShipID  string      `json:"ship_id,omitempty"`
+	Company string      `json:"company,omitempty"`
+	Owner   string      `json:"-"` // Nếu có: chỉ gửi cho người tạo job (và Admin)
+	Data    interface{} `json:"data"`
+	Time    time.Time   `json:"time"`
+}
+
+type streamSubscriber struct {
+	ch       chan StreamEvent
+	username string
+	company  string
+	admin    bool
+	types    map[string]bool
+}
+
+// Chỉ gửi sự kiện thuộc phạm vi quyền của người xem; không phải Admin thì sự kiện không rõ công ty bị chặn
+func (s *streamSubscriber) allowed(evt StreamEvent) bool {
+	if len(s.types) > 0 && !s.types[evt.Type] {
+		return false
+	}
+	if s.admin {
+		return true
+	}
+	if evt.Owner != "" {
+		return evt.Owner == s.username
+	}
+	if s.company == "" || evt.Company == "" {
+		return false
+	}
+	return strings.EqualFold(evt.Company, s.company)
+}
+
+type eventHub struct {
+	mu   sync.RWMutex
+	subs map[*streamSubscriber]struct{}
+}
+
+var streamHub = &eventHub{subs: make(map[*streamSubscriber]struct{})}
+
+func (h *eventHub) subscribe(s *streamSubscriber) {
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+}
+
+func (h *eventHub) unsubscribe(s *streamSubscriber) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+}
+
+// Phát sự kiện tới mọi client đang kết nối (client chậm sẽ bị bỏ qua, không chặn luồng chính)
+func PublishEvent(evt StreamEvent) {
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	// Sự kiện theo tàu chưa ghi công ty: lấy công ty của tàu để lọc quyền
+	if evt.Company == "" && evt.ShipID != "" {
+		database.DB.Model(&models.Ship{}).Select("company").Where("id = ?", evt.ShipID).Scan(&evt.Company)
+	}
+	streamHub.mu.RLock()
+	defer streamHub.mu.RUnlock()
+	for s := range streamHub.subs {
+		if !s.allowed(evt) {
+			continue
+		}
+		select {
+		case s.ch <- evt:
+		default:
+		}
+	}
+}
+
+// Tiến độ job chạy lâu (đồng bộ router, tạo voucher hàng loạt, ...)
+func PublishJobProgress(jobID, owner string, done, total int, status, message string) {
+	PublishEvent(StreamEvent{
+		Type:  "job",
+		Owner: owner,
+		Data: gin.H{
+			"job_id": jobID, "done": done, "total": total,
+			"status": status, "message": message,
+		},
+	})
+}
+
+// --- TRẠNG THÁI TÀU ---
+
+type shipState struct {
+	Status      string
+	SNR         float64
+	Lat, Lon    float64
+	PrimaryLink string
+}
+
+var shipStates = struct {
+	sync.Mutex
+	m map[string]shipState
+}{m: make(map[string]shipState)}
+
+// So sánh trạng thái tàu với lần trước, chỉ phát sự kiện khi có thay đổi
+// Truyền shipIDs để chỉ kiểm tra một số tàu (tránh quét cả bảng mỗi heartbeat)
+func publishShipChanges(shipIDs ...string) {
+	var ships []models.Ship
+	query := database.DB
+	if len(shipIDs) > 0 {
+		query = query.Where("id IN ?", shipIDs)
+	}
+	if err := query.Find(&ships).Error; err != nil {
+		return
+	}
+
+	shipStates.Lock()
+	defer shipStates.Unlock()
+	for _, ship := range ships {
+		state := shipState{Status: ship.Status, SNR: ship.SNR, Lat: ship.Lat, Lon: ship.Lon, PrimaryLink: ship.PrimaryLink}
+		if old, ok := shipStates.m[ship.ID]; ok && old == state {
+			continue
+		}
+		shipStates.m[ship.ID] = state
+		PublishEvent(StreamEvent{Type: "ship", ShipID: ship.ID, Company: ship.Company, Data: ship})
+	}
+}
+
+// --- PHIÊN HOTSPOT ĐANG ONLINE ---
+
+type hotspotSession struct {
+	ID       string `json:"id"`
+	User     string `json:"username"`
+	Address  string `json:"address"`
+	MAC      string `json:"mac"`
+	Uptime   string `json:"uptime"`
+	BytesIn  int64  `json:"bytes_in"`
+	BytesOut int64  `json:"bytes_out"`
+	Radius   bool   `json:"radius"` // Phiên xác thực qua RADIUS (lưu lượng lấy từ accounting)
+}
+
+// Ảnh chụp phiên đang online theo tàu: shipID -> sessionID -> session
+var activeSessions = struct {
+	sync.RWMutex
+	m map[string]map[string]hotspotSession
+}{m: make(map[string]map[string]hotspotSession)}
+
+// Đọc /ip/hotspot/active của một tàu
+func fetchActiveSessions(shipID string) (map[string]hotspotSession, error) {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	res, err := client.Run("/ip/hotspot/active/print")
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make(map[string]hotspotSession, len(res.Re))
+	for _, re := range res.Re {
+		data := re.Map
+		bytesIn, _ := strconv.ParseInt(data["bytes-in"], 10, 64)
+		bytesOut, _ := strconv.ParseInt(data["bytes-out"], 10, 64)
+		sessions[data[".id"]] = hotspotSession{
+			ID: data[".id"], User: data["user"], Address: data["address"],
+			MAC: data["mac-address"], Uptime: data["uptime"],
+			BytesIn: bytesIn, BytesOut: bytesOut, Radius: data["radius"] == "true",
+		}
+	}
+	return sessions, nil
+}
+
+// Worker theo dõi phiên online: 1 lần quét cho mọi client thay vì mỗi client tự gọi router
+func StartSessionWatcher() {
+	interval := envSeconds("SESSION_POLL_INTERVAL", 30*time.Second)
+	for {
+		pollHotspotSessions()
+		time.Sleep(interval)
+	}
+}
+
+func pollHotspotSessions() {
+	var ships []models.Ship
+	database.DB.Where("router_ip <> ''").Find(&ships)
+
+	for _, ship := range ships {
+		sessions, err := fetchActiveSessions(ship.ID)
+		if err != nil {
+			// Router mất kết nối: giữ nguyên ảnh chụp cũ, không báo logout giả
+			continue
+		}
+
+		activeSessions.Lock()
+		previous := activeSessions.m[ship.ID]
+		activeSessions.m[ship.ID] = sessions
+		activeSessions.Unlock()
+
+		// Ghi phiên + lưu lượng theo tài khoản từ bộ đếm router
+		now := time.Now()
+		trackUsageSessions(ship.ID, "router", sessions, now)
+		if err := collectHotspotUsage(ship.ID, sessions, now); err != nil {
+			fmt.Printf("⚠️ Không đọc được bộ đếm hotspot tàu %s: %v\n", ship.ID, err)
+		}
+
+		for id, s := range sessions {
+			if _, ok := previous[id]; !ok {
+				PublishEvent(StreamEvent{Type: "session", ShipID: ship.ID, Company: ship.Company, Data: gin.H{"action": "login", "session": s}})
+			}
+		}
+		for id, s := range previous {
+			if _, ok := sessions[id]; !ok {
+				PublishEvent(StreamEvent{Type: "session", ShipID: ship.ID, Company: ship.Company, Data: gin.H{"action": "logout", "session": s}})
+			}
+		}
+	}
+}
+
+// --- API ---
+
+// GET /api/stream?types=ship,alert : luồng SSE cho Dashboard
+func StreamEvents(c *gin.Context) {
+	sub := &streamSubscriber{
+		ch:       make(chan StreamEvent, 64),
+		username: c.GetString("username"),
+		company:  c.GetString("company"),
+		admin:    c.GetString("role") == "Admin",
+		types:    map[string]bool{},
+	}
+	for _, t := range strings.Split(c.Query("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			sub.types[t] = true
+		}
+	}
+
+	// Ảnh chụp ban đầu để client không phải gọi GET /api/ships; tài khoản không phải Admin chỉ thấy tàu của công ty mình
+	ships := []models.Ship{}
+	if sub.admin {
+		database.DB.Order("updated_at desc").Find(&ships)
+	} else if sub.company != "" {
+		database.DB.Where("company = ?", sub.company).Order("updated_at desc").Find(&ships)
+	}
+
+	streamHub.subscribe(sub)
+	defer streamHub.unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.SSEvent("snapshot", gin.H{"ships": ships})
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(25 * time.Second)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case evt := <-sub.ch:
+			c.SSEvent(evt.Type, evt)
+			return true
+		case t := <-keepAlive.C:
+			c.SSEvent("ping", fmt.Sprint(t.Unix()))
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
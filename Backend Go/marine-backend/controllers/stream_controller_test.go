@@ -0,0 +1,35 @@
+package controllers
+
+import "testing"
+
+func TestStreamSubscriberAllowed(t *testing.T) {
+	admin := &streamSubscriber{username: "root", admin: true}
+	acme := &streamSubscriber{username: "alice", company: "Acme"}
+	noCompany := &streamSubscriber{username: "bob"}
+	shipsOnly := &streamSubscriber{username: "carol", company: "Acme", types: map[string]bool{"ship": true}}
+
+	tests := []struct {
+		name string
+		sub  *streamSubscriber
+		evt  StreamEvent
+		want bool
+	}{
+		{"Admin nhận mọi sự kiện", admin, StreamEvent{Type: "ship"}, true},
+		{"Admin nhận job của người khác", admin, StreamEvent{Type: "job", Owner: "alice"}, true},
+		{"cùng công ty (không phân biệt hoa thường)", acme, StreamEvent{Type: "ship", Company: "ACME"}, true},
+		{"khác công ty", acme, StreamEvent{Type: "ship", Company: "Other"}, false},
+		{"sự kiện không có công ty bị chặn", acme, StreamEvent{Type: "quota", ShipID: "IMO1"}, false},
+		{"người xem không có công ty", noCompany, StreamEvent{Type: "ship", Company: "Acme"}, false},
+		{"job của chính mình", noCompany, StreamEvent{Type: "job", Owner: "bob"}, true},
+		{"job của người khác", acme, StreamEvent{Type: "job", Owner: "bob", Company: "Acme"}, false},
+		{"lọc theo loại sự kiện", shipsOnly, StreamEvent{Type: "alert", Company: "Acme"}, false},
+		{"đúng loại sự kiện", shipsOnly, StreamEvent{Type: "ship", Company: "Acme"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sub.allowed(tt.evt); got != tt.want {
+				t.Errorf("allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"marine-backend/terminals"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Kết quả đọc thiết bị gần nhất của từng tàu (hiển thị trên trang chi tiết tàu)
+type terminalReading struct {
+	Adapter string            `json:"adapter"`
+	Status  *terminals.Status `json:"status,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	At      time.Time         `json:"at"`
+}
+
+var terminalReadings = struct {
+	sync.RWMutex
+	m map[string]terminalReading
+}{m: make(map[string]terminalReading)}
+
+func terminalAdapterFor(ship models.Ship) (terminals.Adapter, error) {
+	if ship.TerminalType == "" {
+		return nil, fmt.Errorf("tàu chưa cấu hình thiết bị vệ tinh")
+	}
+	cfg := terminals.Config{Type: ship.TerminalType, Addr: ship.TerminalAddr, Secret: ship.TerminalSecret}
+	if ship.TerminalType == "starlink" {
+		var config models.SystemConfig
+		if err := database.DB.First(&config).Error; err == nil {
+			cfg.APIKey = config.StarlinkApiKey
+		}
+	}
+	return terminals.New(cfg)
+}
+
+// Đọc thiết bị của 1 tàu và đưa vào pipeline heartbeat (nguồn "telemetry")
+func pollTerminal(ship models.Ship) terminalReading {
+	reading := terminalReading{Adapter: ship.TerminalType, At: time.Now()}
+	adapter, err := terminalAdapterFor(ship)
+	if err == nil {
+		var st terminals.Status
+		if st, err = adapter.Status(context.Background()); err == nil {
+			reading.Status = &st
+			err = recordHeartbeat(ship.ID, "telemetry", HeartbeatInput{
+				SNR: st.SNR, ModemLock: st.ModemLock, Satellite: st.Satellite, Beam: st.Beam,
+				LatencyMs: st.LatencyMs, ObstructionPct: st.ObstructionPct, UplinkState: st.UplinkState,
+			})
+		}
+	}
+	if err != nil {
+		reading.Error = err.Error()
+	}
+
+	terminalReadings.Lock()
+	terminalReadings.m[ship.ID] = reading
+	terminalReadings.Unlock()
+	return reading
+}
+
+// Worker đọc telemetry thiết bị vệ tinh (thay cho SNR giả lập)
+func StartTerminalPoller() {
+	interval := envSeconds("TERMINAL_POLL_INTERVAL", 30*time.Second)
+	for {
+		var ships []models.Ship
+		database.DB.Where("terminal_type <> ''").Find(&ships)
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, 16)
+		for _, ship := range ships {
+			wg.Add(1)
+			go func(ship models.Ship) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				if r := pollTerminal(ship); r.Error != "" {
+					fmt.Printf("⚠️ Không đọc được thiết bị %s của tàu %s: %s\n", r.Adapter, ship.ID, r.Error)
+				}
+			}(ship)
+		}
+		wg.Wait()
+		time.Sleep(interval)
+	}
+}
+
+// --- CÁC API ---
+
+// GET /api/ships/:ship_id/terminal : cấu hình + lần đọc gần nhất
+func GetShipTerminal(c *gin.Context) {
+	var ship models.Ship
+	if err := database.DB.Where("id = ?", c.Param("ship_id")).First(&ship).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tàu"})
+		return
+	}
+	terminalReadings.RLock()
+	reading, ok := terminalReadings.m[ship.ID]
+	terminalReadings.RUnlock()
+
+	resp := gin.H{
+		"terminal_type": ship.TerminalType, "terminal_addr": ship.TerminalAddr,
+		"has_secret": ship.TerminalSecret != "", "supported": terminals.Types,
+	}
+	if ok {
+		resp["last_reading"] = reading
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// PUT /api/ships/:ship_id/terminal : {terminal_type, terminal_addr, terminal_secret}
+func UpdateShipTerminal(c *gin.Context) {
+	var input struct {
+		TerminalType   string  `json:"terminal_type"`
+		TerminalAddr   string  `json:"terminal_addr"`
+		TerminalSecret *string `json:"terminal_secret"` // Bỏ trống = giữ nguyên
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.TerminalType != "" {
+		if _, err := terminals.New(terminals.Config{Type: input.TerminalType, Addr: input.TerminalAddr}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	updates := map[string]interface{}{"terminal_type": input.TerminalType, "terminal_addr": input.TerminalAddr}
+	if input.TerminalSecret != nil {
+		updates["terminal_secret"] = *input.TerminalSecret
+	}
+	result := database.DB.Model(&models.Ship{}).Where("id = ?", c.Param("ship_id")).Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tàu"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã lưu cấu hình thiết bị"})
+}
+
+// POST /api/ships/:ship_id/terminal/poll : đọc thiết bị ngay (kiểm tra cấu hình)
+func PollShipTerminal(c *gin.Context) {
+	var ship models.Ship
+	if err := database.DB.Where("id = ?", c.Param("ship_id")).First(&ship).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Không tìm thấy tàu"})
+		return
+	}
+	reading := pollTerminal(ship)
+	if reading.Error != "" {
+		c.JSON(http.StatusBadGateway, reading)
+		return
+	}
+	c.JSON(http.StatusOK, reading)
+}
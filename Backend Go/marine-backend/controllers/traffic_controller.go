@@ -0,0 +1,620 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"marine-backend/database"
+	"marine-backend/models"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Nhóm ứng dụng hiển thị trên biểu đồ radar (thứ tự cố định cho FE)
+var appCategories = []string{"VoIP", "Video", "ERP", "Email", "Social", "IoT"}
+
+// Tỉ trọng tối đa (%) mong muốn của từng nhóm trên tổng lưu lượng
+var appCategoryLimits = map[string]int{"VoIP": 60, "Video": 70, "ERP": 90, "Email": 90, "Social": 50, "IoT": 100}
+
+const otherCategory = "Other"
+
+// Luật mặc định khi bảng còn trống (cổng chuẩn + tên miền phổ biến)
+var defaultAppRules = []models.AppCategoryRule{
+	{Category: "VoIP", Protocol: 17, PortFrom: 5060, PortTo: 5061},
+	{Category: "VoIP", Protocol: 6, PortFrom: 5060, PortTo: 5061},
+	{Category: "VoIP", Protocol: 17, PortFrom: 3478, PortTo: 3481}, // STUN/TURN (WhatsApp, Teams)
+	{Category: "VoIP", Protocol: 17, PortFrom: 10000, PortTo: 20000},
+	{Category: "Email", Protocol: 6, PortFrom: 25},
+	{Category: "Email", Protocol: 6, PortFrom: 110},
+	{Category: "Email", Protocol: 6, PortFrom: 143},
+	{Category: "Email", Protocol: 6, PortFrom: 465},
+	{Category: "Email", Protocol: 6, PortFrom: 587},
+	{Category: "Email", Protocol: 6, PortFrom: 993},
+	{Category: "Email", Protocol: 6, PortFrom: 995},
+	{Category: "ERP", Protocol: 6, PortFrom: 3200, PortTo: 3299}, // SAP
+	{Category: "ERP", Protocol: 6, PortFrom: 1433},               // SQL Server
+	{Category: "IoT", Protocol: 6, PortFrom: 1883},               // MQTT
+	{Category: "IoT", Protocol: 6, PortFrom: 8883},
+	{Category: "IoT", Protocol: 6, PortFrom: 502},  // Modbus TCP
+	{Category: "IoT", Protocol: 6, PortFrom: 4840}, // OPC UA
+	{Category: "IoT", Protocol: 17, PortFrom: 5683},
+	{Category: "Video", Domain: "youtube.com", Priority: 10},
+	{Category: "Video", Domain: "netflix.com", Priority: 10},
+	{Category: "Social", Domain: "facebook.com", Priority: 10},
+	{Category: "Social", Domain: "instagram.com", Priority: 10},
+	{Category: "Social", Domain: "tiktok.com", Priority: 10},
+}
+
+type compiledAppRule struct {
+	models.AppCategoryRule
+	nets []*net.IPNet
+}
+
+// IP -> các tên miền đã phân giải ra IP đó (gồm cả tên gốc trước CNAME)
+type dnsNames map[string][]string
+
+// Trạng thái bộ thu NetFlow (thống kê + luật + ánh xạ exporter -> tàu + DNS cache của tàu + bộ đệm gộp)
+var flowCollector = struct {
+	mu              sync.Mutex
+	decoder         *flowDecoder
+	rules           []compiledAppRule
+	exporters       map[string]string
+	dns             map[string]dnsNames // Theo tàu: lượt đọc DNS cache mới nhất
+	dnsPrev         map[string]dnsNames // Lượt trước: bản ghi đã hết TTL trên router nhưng flow đến trễ vẫn khớp
+	buffer          map[trafficKey]*models.TrafficAggregate
+	Packets         int64
+	Flows           int64
+	NoTemplate      int64
+	UnknownExporter int64
+	Errors          int64
+	LastPacketAt    *time.Time
+}{
+	decoder:   newFlowDecoder(),
+	exporters: make(map[string]string),
+	dns:       make(map[string]dnsNames),
+	dnsPrev:   make(map[string]dnsNames),
+	buffer:    make(map[trafficKey]*models.TrafficAggregate),
+}
+
+type trafficKey struct {
+	shipID, username, category string
+	period                     time.Time
+}
+
+func seedAppCategoryRules() {
+	var count int64
+	database.DB.Model(&models.AppCategoryRule{}).Count(&count)
+	if count > 0 {
+		return
+	}
+	for _, r := range defaultAppRules {
+		r.CreatedAt = time.Now()
+		database.DB.Create(&r)
+	}
+}
+
+// Nạp lại luật phân loại (luật theo tên miền khớp qua DNS cache của tàu, xem refreshShipDNS)
+func refreshAppRules() {
+	var rows []models.AppCategoryRule
+	database.DB.Order("priority, id").Find(&rows)
+
+	rules := make([]compiledAppRule, 0, len(rows))
+	for _, r := range rows {
+		cr := compiledAppRule{AppCategoryRule: r}
+		if r.CIDR != "" {
+			if _, n, err := net.ParseCIDR(r.CIDR); err == nil {
+				cr.nets = append(cr.nets, n)
+			}
+		}
+		rules = append(rules, cr)
+	}
+
+	flowCollector.mu.Lock()
+	flowCollector.rules = rules
+	flowCollector.mu.Unlock()
+}
+
+func normalizeDomain(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "*."), ".")
+}
+
+// Bản ghi /ip/dns/cache/all (name, type, data) -> tên miền theo IP.
+// Lần ngược chuỗi CNAME để IP của CDN (VD: *.googlevideo.com) vẫn mang tên được hỏi (youtube.com)
+func dnsCacheNames(records []map[string]string) dnsNames {
+	aliases := map[string][]string{} // Đích CNAME -> các tên trỏ tới
+	for _, r := range records {
+		if r["type"] == "CNAME" {
+			target := normalizeDomain(r["data"])
+			aliases[target] = append(aliases[target], normalizeDomain(r["name"]))
+		}
+	}
+
+	names := dnsNames{}
+	seen := map[string]map[string]bool{}
+	for _, r := range records {
+		if r["type"] != "A" && r["type"] != "AAAA" {
+			continue
+		}
+		ip := net.ParseIP(r["data"])
+		if ip == nil {
+			continue
+		}
+		key := ip.String()
+		if seen[key] == nil {
+			seen[key] = map[string]bool{}
+		}
+		queue := []string{normalizeDomain(r["name"])}
+		for depth := 0; len(queue) > 0 && depth < 16; depth++ { // Giới hạn độ sâu (CNAME vòng)
+			var next []string
+			for _, n := range queue {
+				if !seen[key][n] {
+					seen[key][n] = true
+					names[key] = append(names[key], n)
+					next = append(next, aliases[n]...)
+				}
+			}
+			queue = next
+		}
+	}
+	return names
+}
+
+// Đọc DNS cache trên router của tàu (resolver thuyền viên dùng qua hotspot)
+func fetchShipDNS(shipID string) (dnsNames, error) {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	res, err := client.Run("/ip/dns/cache/all/print")
+	if err != nil {
+		return nil, err
+	}
+	records := make([]map[string]string, 0, len(res.Re))
+	for _, re := range res.Re {
+		records = append(records, re.Map)
+	}
+	return dnsCacheNames(records), nil
+}
+
+// Cập nhật DNS cache của các tàu đang gửi NetFlow; router không kết nối được thì giữ bản cũ
+func refreshShipDNS() {
+	flowCollector.mu.Lock()
+	ships := map[string]bool{}
+	for _, id := range flowCollector.exporters {
+		ships[id] = true
+	}
+	flowCollector.mu.Unlock()
+
+	for id := range ships {
+		names, err := fetchShipDNS(id)
+		if err != nil {
+			continue
+		}
+		flowCollector.mu.Lock()
+		flowCollector.dnsPrev[id] = flowCollector.dns[id]
+		flowCollector.dns[id] = names
+		flowCollector.mu.Unlock()
+	}
+}
+
+// Ánh xạ IP exporter -> tàu (FlowExporter ưu tiên hơn RouterIP)
+func refreshFlowExporters() {
+	var ships []models.Ship
+	database.DB.Select("id", "router_ip", "flow_exporter").Find(&ships)
+	exporters := make(map[string]string, len(ships))
+	for _, s := range ships {
+		if s.RouterIP != "" {
+			exporters[s.RouterIP] = s.ID
+		}
+	}
+	for _, s := range ships {
+		if s.FlowExporter != "" {
+			exporters[s.FlowExporter] = s.ID
+		}
+	}
+	flowCollector.mu.Lock()
+	flowCollector.exporters = exporters
+	flowCollector.mu.Unlock()
+}
+
+func portInRule(port uint16, r compiledAppRule) bool {
+	to := r.PortTo
+	if to == 0 {
+		to = r.PortFrom
+	}
+	return port >= r.PortFrom && port <= to
+}
+
+func ipInNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tên miền hoặc tên miền con của domain
+func domainInNames(domain string, names []string) bool {
+	domain = normalizeDomain(domain)
+	for _, n := range names {
+		if n == domain || strings.HasSuffix(n, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Phân loại 1 flow: luật đầu tiên khớp (cổng và/hoặc IP / tên miền ở một trong hai đầu) thắng.
+// lookup: tên miền của IP theo DNS cache của tàu
+func classifyFlow(f flowRecord, rules []compiledAppRule, lookup func(net.IP) []string) string {
+	for _, r := range rules {
+		if r.Protocol != 0 && r.Protocol != f.Proto {
+			continue
+		}
+		hasPort := r.PortFrom > 0
+		hasIP := r.CIDR != "" || r.Domain != ""
+		if !hasPort && !hasIP {
+			continue
+		}
+		if hasPort && !portInRule(f.SrcPort, r) && !portInRule(f.DstPort, r) {
+			continue
+		}
+		if hasIP && !ipInNets(f.SrcIP, r.nets) && !ipInNets(f.DstIP, r.nets) &&
+			(r.Domain == "" || (!domainInNames(r.Domain, lookup(f.SrcIP)) && !domainInNames(r.Domain, lookup(f.DstIP)))) {
+			continue
+		}
+		return r.Category
+	}
+	return otherCategory
+}
+
+// Nhận 1 datagram NetFlow/IPFIX; shipID rỗng = tra theo IP exporter
+func ingestFlowDatagram(exporter, shipID string, pkt []byte) {
+	flows, missing, err := flowCollector.decoder.decode(exporter, pkt)
+
+	now := time.Now()
+	flowCollector.mu.Lock()
+	defer flowCollector.mu.Unlock()
+	flowCollector.Packets++
+	flowCollector.LastPacketAt = &now
+	flowCollector.NoTemplate += int64(missing)
+	if err != nil {
+		flowCollector.Errors++
+	}
+	if len(flows) == 0 {
+		return
+	}
+	if shipID == "" {
+		shipID = flowCollector.exporters[exporter]
+	}
+	if shipID == "" {
+		flowCollector.UnknownExporter++
+		return
+	}
+
+	// IP trong hotspot -> tài khoản thuyền viên; còn lại tính là vận hành tàu
+	users := map[string]string{}
+	activeSessions.RLock()
+	for _, s := range activeSessions.m[shipID] {
+		users[s.Address] = s.User
+	}
+	activeSessions.RUnlock()
+
+	dns, dnsPrev := flowCollector.dns[shipID], flowCollector.dnsPrev[shipID]
+	lookup := func(ip net.IP) []string {
+		if names, ok := dns[ip.String()]; ok {
+			return names
+		}
+		return dnsPrev[ip.String()]
+	}
+
+	for _, f := range flows {
+		username := users[f.SrcIP.String()]
+		if username == "" {
+			username = users[f.DstIP.String()]
+		}
+		key := trafficKey{shipID, username, classifyFlow(f, flowCollector.rules, lookup), f.End.Truncate(time.Hour)}
+		agg, ok := flowCollector.buffer[key]
+		if !ok {
+			agg = &models.TrafficAggregate{ShipID: key.shipID, Username: key.username, Category: key.category, PeriodStart: key.period}
+			flowCollector.buffer[key] = agg
+		}
+		agg.Bytes += int64(f.Bytes)
+		agg.Packets += int64(f.Packets)
+		agg.Flows++
+		flowCollector.Flows++
+	}
+}
+
+// Ghi bộ đệm xuống DB (upsert cộng dồn theo ô giờ)
+func flushTrafficAggregates() {
+	flowCollector.mu.Lock()
+	buffer := flowCollector.buffer
+	flowCollector.buffer = make(map[trafficKey]*models.TrafficAggregate)
+	flowCollector.mu.Unlock()
+
+	for _, agg := range buffer {
+		database.DB.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "ship_id"}, {Name: "username"}, {Name: "category"}, {Name: "period_start"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"bytes":   gorm.Expr("traffic_aggregates.bytes + EXCLUDED.bytes"),
+				"packets": gorm.Expr("traffic_aggregates.packets + EXCLUDED.packets"),
+				"flows":   gorm.Expr("traffic_aggregates.flows + EXCLUDED.flows"),
+			}),
+		}).Create(agg)
+	}
+}
+
+// Phát lại file pcap chứa NetFlow/IPFIX; exporter/shipID rỗng = lấy theo IP nguồn trong file
+func replayFlowCapture(data []byte, exporter, shipID string) (int, error) {
+	count, err := readPcapUDP(data, func(src net.IP, payload []byte) {
+		from := exporter
+		if from == "" {
+			from = src.String()
+		}
+		ingestFlowDatagram(from, shipID, payload)
+	})
+	flushTrafficAggregates()
+	return count, err
+}
+
+// Worker: nghe UDP NetFlow/IPFIX (MikroTik Traffic Flow), nạp luật và ghi bộ đệm định kỳ
+func StartNetflowCollector() {
+	seedAppCategoryRules()
+	refreshAppRules()
+	refreshFlowExporters()
+
+	go func() {
+		for {
+			time.Sleep(envSeconds("NETFLOW_RULE_REFRESH", 10*time.Minute))
+			refreshAppRules()
+		}
+	}()
+	go func() {
+		for {
+			refreshShipDNS()
+			time.Sleep(envSeconds("NETFLOW_DNS_REFRESH", 2*time.Minute))
+		}
+	}()
+	go func() {
+		for {
+			time.Sleep(envSeconds("NETFLOW_FLUSH_INTERVAL", 30*time.Second))
+			refreshFlowExporters()
+			flushTrafficAggregates()
+		}
+	}()
+
+	if path := os.Getenv("NETFLOW_REPLAY_FILE"); path != "" {
+		if data, err := os.ReadFile(path); err != nil {
+			fmt.Println("⚠️ Lỗi đọc file NetFlow replay:", err)
+		} else if _, err := replayFlowCapture(data, "", ""); err != nil {
+			fmt.Println("⚠️ Lỗi replay NetFlow:", err)
+		}
+	}
+
+	addr := os.Getenv("NETFLOW_UDP_ADDR")
+	if addr == "" {
+		return
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		fmt.Println("❌ Không mở được cổng UDP NetFlow:", err)
+		return
+	}
+	defer conn.Close()
+	fmt.Println("📡 NetFlow/IPFIX UDP listening on", addr)
+
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			continue
+		}
+		host, _, _ := net.SplitHostPort(from.String())
+		ingestFlowDatagram(host, "", append([]byte(nil), buf[:n]...))
+	}
+}
+
+// --- CÁC API ---
+
+// GET /api/netflow/status
+func GetNetflowStatus(c *gin.Context) {
+	flowCollector.mu.Lock()
+	defer flowCollector.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{
+		"packets": flowCollector.Packets, "flows": flowCollector.Flows,
+		"no_template": flowCollector.NoTemplate, "unknown_exporter": flowCollector.UnknownExporter,
+		"errors": flowCollector.Errors, "last_packet_at": flowCollector.LastPacketAt,
+		"rules": len(flowCollector.rules), "pending_aggregates": len(flowCollector.buffer),
+	})
+}
+
+// POST /api/netflow/replay (multipart: file pcap, exporter, ship_id) : phát lại bản ghi để kiểm thử
+func ReplayNetflowUpload(c *gin.Context) {
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chưa chọn file"})
+		return
+	}
+	defer file.Close()
+	var data bytes.Buffer
+	if _, err := io.Copy(&data, file); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không đọc được file"})
+		return
+	}
+	shipID := c.PostForm("ship_id")
+	if shipID != "" {
+		var count int64
+		database.DB.Model(&models.Ship{}).Where("id = ?", shipID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Không tìm thấy tàu"})
+			return
+		}
+	}
+
+	flowCollector.mu.Lock()
+	before := [3]int64{flowCollector.Flows, flowCollector.NoTemplate, flowCollector.UnknownExporter}
+	flowCollector.mu.Unlock()
+
+	packets, err := replayFlowCapture(data.Bytes(), c.PostForm("exporter"), shipID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	flowCollector.mu.Lock()
+	after := [3]int64{flowCollector.Flows, flowCollector.NoTemplate, flowCollector.UnknownExporter}
+	flowCollector.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"packets": packets, "flows": after[0] - before[0],
+		"no_template": after[1] - before[1], "unknown_exporter": after[2] - before[2],
+	})
+}
+
+func validateAppRule(r *models.AppCategoryRule) string {
+	r.Category = strings.TrimSpace(r.Category)
+	if r.Category == "" {
+		return "Thiếu nhóm ứng dụng"
+	}
+	if r.PortFrom == 0 && r.CIDR == "" && r.Domain == "" {
+		return "Cần ít nhất cổng, dải IP hoặc tên miền"
+	}
+	if r.PortTo != 0 && r.PortTo < r.PortFrom {
+		return "Dải cổng không hợp lệ"
+	}
+	if r.CIDR != "" {
+		if _, _, err := net.ParseCIDR(r.CIDR); err != nil {
+			return "CIDR không hợp lệ"
+		}
+	}
+	r.Domain = normalizeDomain(r.Domain)
+	if strings.ContainsAny(r.Domain, " /:*") {
+		return "Tên miền không hợp lệ"
+	}
+	return ""
+}
+
+// 1. Danh sách luật phân loại
+func GetAppCategoryRules(c *gin.Context) {
+	var rules []models.AppCategoryRule
+	database.DB.Order("priority, id").Find(&rules)
+	c.JSON(http.StatusOK, rules)
+}
+
+// 2. Thêm luật
+func CreateAppCategoryRule(c *gin.Context) {
+	var input models.AppCategoryRule
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateAppRule(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID = 0
+	input.CreatedAt = time.Now()
+	if err := database.DB.Create(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	go refreshAppRules()
+	c.JSON(http.StatusCreated, input)
+}
+
+// 3. Cập nhật luật
+func UpdateAppCategoryRule(c *gin.Context) {
+	var rule models.AppCategoryRule
+	if err := database.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Luật không tồn tại"})
+		return
+	}
+	var input models.AppCategoryRule
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateAppRule(&input); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	input.ID = rule.ID
+	input.CreatedAt = rule.CreatedAt
+	if err := database.DB.Save(&input).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	go refreshAppRules()
+	c.JSON(http.StatusOK, input)
+}
+
+// 4. Xóa luật
+func DeleteAppCategoryRule(c *gin.Context) {
+	if err := database.DB.Delete(&models.AppCategoryRule{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
+		return
+	}
+	go refreshAppRules()
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa thành công"})
+}
+
+// Tổng bytes theo nhóm và theo người dùng trong khoảng thời gian (lọc tàu / người dùng nếu có)
+func appUsageTotals(from, to time.Time, shipID, username string) (map[string]int64, []gin.H) {
+	query := func() *gorm.DB {
+		q := database.DB.Model(&models.TrafficAggregate{}).Where("period_start BETWEEN ? AND ?", from.Truncate(time.Hour), to)
+		if shipID != "" {
+			q = q.Where("ship_id = ?", shipID)
+		}
+		if username != "" {
+			q = q.Where("username = ?", username)
+		}
+		return q
+	}
+
+	var byCategory []struct {
+		Category string
+		Bytes    int64
+	}
+	query().Select("category, SUM(bytes) AS bytes").Group("category").Scan(&byCategory)
+	totals := make(map[string]int64, len(byCategory))
+	for _, r := range byCategory {
+		totals[r.Category] = r.Bytes
+	}
+
+	var byUser []struct {
+		ShipID   string
+		Username string
+		Category string
+		Bytes    int64
+	}
+	query().Select("ship_id, username, category, SUM(bytes) AS bytes").
+		Group("ship_id, username, category").Order("ship_id, username").Scan(&byUser)
+	users := []gin.H{}
+	index := map[string]gin.H{}
+	for _, r := range byUser {
+		k := r.ShipID + "/" + r.Username
+		u, ok := index[k]
+		if !ok {
+			u = gin.H{"ship_id": r.ShipID, "username": r.Username, "categories": map[string]float64{}, "total_gb": 0.0}
+			index[k] = u
+			users = append(users, u)
+		}
+		gb := math.Round(bytesToGB(r.Bytes)*1000) / 1000
+		u["categories"].(map[string]float64)[r.Category] = gb
+		u["total_gb"] = math.Round((u["total_gb"].(float64)+gb)*1000) / 1000
+	}
+	return totals, users
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"marine-backend/models"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDNSCacheNames(t *testing.T) {
+	records := []map[string]string{
+		{"name": "www.youtube.com", "type": "CNAME", "data": "youtube-ui.l.google.com"},
+		{"name": "youtube-ui.l.google.com", "type": "A", "data": "142.250.66.78"},
+		{"name": "rr3---sn-8pxuuxa-nbo6.googlevideo.com", "type": "A", "data": "74.125.166.8"},
+		{"name": "m.facebook.com.", "type": "CNAME", "data": "star-mini.c10r.facebook.com."},
+		{"name": "star-mini.c10r.facebook.com.", "type": "AAAA", "data": "2a03:2880:f10d:83:face:b00c:0:25de"},
+		{"name": "loop-a.example", "type": "CNAME", "data": "loop-b.example"},
+		{"name": "loop-b.example", "type": "CNAME", "data": "loop-a.example"},
+		{"name": "loop-b.example", "type": "A", "data": "10.0.0.1"},
+		{"name": "bad.example", "type": "A", "data": "not-an-ip"},
+	}
+	got := dnsCacheNames(records)
+	for _, names := range got {
+		sort.Strings(names)
+	}
+	want := dnsNames{
+		"142.250.66.78":                      {"www.youtube.com", "youtube-ui.l.google.com"},
+		"74.125.166.8":                       {"rr3---sn-8pxuuxa-nbo6.googlevideo.com"},
+		"2a03:2880:f10d:83:face:b00c:0:25de": {"m.facebook.com", "star-mini.c10r.facebook.com"},
+		"10.0.0.1":                           {"loop-a.example", "loop-b.example"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dnsCacheNames() = %v, want %v", got, want)
+	}
+}
+
+func TestClassifyFlowDomain(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("10.20.0.0/16")
+	rules := []compiledAppRule{
+		{AppCategoryRule: models.AppCategoryRule{Category: "VoIP", Protocol: 17, PortFrom: 5060}},
+		{AppCategoryRule: models.AppCategoryRule{Category: "ERP", CIDR: "10.20.0.0/16"}, nets: []*net.IPNet{lan}},
+		{AppCategoryRule: models.AppCategoryRule{Category: "Video", Domain: "youtube.com"}},
+		{AppCategoryRule: models.AppCategoryRule{Category: "Social", Protocol: 6, PortFrom: 443, Domain: "facebook.com"}},
+	}
+	dns := dnsNames{
+		"142.250.66.78": {"www.youtube.com", "youtube-ui.l.google.com"},
+		"157.240.1.35":  {"m.facebook.com"},
+		"203.0.113.9":   {"notyoutube.com"},
+	}
+	lookup := func(ip net.IP) []string { return dns[ip.String()] }
+	flow := func(dst string, proto uint8, port uint16) flowRecord {
+		return flowRecord{SrcIP: net.ParseIP("192.168.88.10"), DstIP: net.ParseIP(dst), SrcPort: 50000, DstPort: port, Proto: proto}
+	}
+	tests := []struct {
+		name string
+		f    flowRecord
+		want string
+	}{
+		{"theo cổng", flow("8.8.8.8", 17, 5060), "VoIP"},
+		{"theo CIDR", flow("10.20.1.1", 6, 443), "ERP"},
+		{"tên miền con qua CNAME", flow("142.250.66.78", 6, 443), "Video"},
+		{"tên miền + cổng", flow("157.240.1.35", 6, 443), "Social"},
+		{"tên miền nhưng sai cổng", flow("157.240.1.35", 17, 443), otherCategory},
+		{"không khớp hậu tố giả", flow("203.0.113.9", 6, 443), otherCategory},
+		{"IP không có trong DNS cache", flow("198.51.100.1", 6, 443), otherCategory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyFlow(tt.f, rules, lookup); got != tt.want {
+				t.Errorf("classifyFlow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
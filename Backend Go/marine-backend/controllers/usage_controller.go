@@ -1,13 +1,17 @@
 package controllers
 
 import (
+	"fmt"
 	"marine-backend/database"
 	"marine-backend/models"
-	"math/rand"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Struct trả về cho Frontend (Report Row)
@@ -26,8 +30,187 @@ type UsageFilter struct {
 	Username  string `form:"username"`
 	StartDate string `form:"start_date"`
 	EndDate   string `form:"end_date"`
+	ShipID    string `form:"ship_id"`
 }
 
+// Thời lượng kiểu RouterOS: "1w2d3h4m5s" hoặc "01:02:03"
+func parseRouterOSDuration(s string) time.Duration {
+	if strings.Contains(s, ":") {
+		var h, m, sec int
+		fmt.Sscanf(s, "%d:%d:%d", &h, &m, &sec)
+		return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	}
+	units := map[byte]time.Duration{'w': 7 * 24 * time.Hour, 'd': 24 * time.Hour, 'h': time.Hour, 'm': time.Minute, 's': time.Second}
+	var total time.Duration
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			n = n*10 + int(s[i]-'0')
+			continue
+		}
+		total += time.Duration(n) * units[s[i]]
+		n = 0
+	}
+	return total
+}
+
+func crewIDFor(shipID, username string) *uint {
+	var crew models.Crew
+	if err := database.DB.Select("id").Where("ship_id = ? AND username = ?", shipID, username).First(&crew).Error; err != nil {
+		return nil
+	}
+	return &crew.ID
+}
+
+// Ghi lưu lượng của 1 tài khoản hotspot: bảng theo ngày + DataUsage của crew + phần phúc lợi của tàu
+func recordUserUsage(shipID, username string, bytesIn, bytesOut int64, at time.Time) {
+	if username == "" || (bytesIn <= 0 && bytesOut <= 0) {
+		return
+	}
+	crewID := crewIDFor(shipID, username)
+	row := models.UsageDaily{
+		ShipID: shipID, Username: username, CrewID: crewID,
+		Day:     time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location()),
+		BytesIn: bytesIn, BytesOut: bytesOut,
+	}
+	database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "ship_id"}, {Name: "username"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"bytes_in":  gorm.Expr("usage_dailies.bytes_in + EXCLUDED.bytes_in"),
+			"bytes_out": gorm.Expr("usage_dailies.bytes_out + EXCLUDED.bytes_out"),
+		}),
+	}).Create(&row)
+
+	if crewID != nil {
+		addCrewUsage(*crewID, bytesIn, bytesOut)
+	} else {
+		addVoucherUsage(username, bytesIn, bytesOut)
+		addWelfareUsage(shipID, bytesIn+bytesOut, at) // Voucher cũng là lưu lượng phúc lợi
+	}
+}
+
+// Đồng bộ bảng phiên với ảnh chụp /ip/hotspot/active: mở phiên mới, cập nhật bộ đếm, đóng phiên đã logout
+func trackUsageSessions(shipID, source string, sessions map[string]hotspotSession, at time.Time) {
+	var open []models.UsageSession
+	database.DB.Where("ship_id = ? AND source = ? AND ended_at IS NULL", shipID, source).Find(&open)
+	byKey := make(map[string]models.UsageSession, len(open))
+	for _, row := range open {
+		byKey[row.SessionKey] = row
+	}
+
+	seen := make(map[string]bool, len(sessions))
+	for _, s := range sessions {
+		if s.Radius {
+			continue // Đã ghi theo Acct-Session-Id khi nhận accounting
+		}
+		key := s.ID + "|" + s.User + "|" + s.MAC
+		seen[key] = true
+		row, ok := byKey[key]
+		// Bộ đếm giảm = router khởi động lại và dùng lại .id -> đóng phiên cũ, mở phiên mới
+		if ok && (s.BytesIn < row.BytesIn || s.BytesOut < row.BytesOut) {
+			database.DB.Model(&row).Update("ended_at", row.LastSeenAt)
+			ok = false
+		}
+		if ok {
+			database.DB.Model(&row).Updates(map[string]interface{}{"bytes_in": s.BytesIn, "bytes_out": s.BytesOut, "last_seen_at": at})
+			continue
+		}
+		row = models.UsageSession{
+			ShipID: shipID, CrewID: crewIDFor(shipID, s.User), Username: s.User, SessionKey: key,
+			Address: s.Address, MAC: s.MAC, Source: source,
+			StartedAt: at.Add(-parseRouterOSDuration(s.Uptime)), LastSeenAt: at,
+			BytesIn: s.BytesIn, BytesOut: s.BytesOut,
+		}
+		database.DB.Create(&row)
+		if row.CrewID == nil {
+			markVoucherUsed(s.User, row.StartedAt) // Lần đăng nhập đầu của voucher
+		}
+	}
+	for key, row := range byKey {
+		if !seen[key] {
+			database.DB.Model(&row).Update("ended_at", at)
+		}
+	}
+}
+
+// Đọc bộ đếm /ip/hotspot/user (cộng dồn các phiên đã đóng)
+func fetchHotspotUserCounters(shipID string) (map[string][2]int64, error) {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	res, err := client.Run("/ip/hotspot/user/print", "=stats=")
+	if err != nil {
+		return nil, err
+	}
+	counters := make(map[string][2]int64, len(res.Re))
+	for _, re := range res.Re {
+		in, _ := strconv.ParseInt(re.Map["bytes-in"], 10, 64)
+		out, _ := strconv.ParseInt(re.Map["bytes-out"], 10, 64)
+		counters[re.Map["name"]] = [2]int64{in, out}
+	}
+	return counters, nil
+}
+
+// Lưu lượng theo tài khoản = bộ đếm user (phiên đã đóng) + bộ đếm phiên đang mở.
+// Tổng này liên tục qua logout (phiên đóng được cộng vào user); giảm xuống = reset / khởi động lại.
+func collectHotspotUsage(shipID string, sessions map[string]hotspotSession, at time.Time) error {
+	counters, err := fetchHotspotUserCounters(shipID)
+	if err != nil {
+		return err
+	}
+
+	var last []models.HotspotUserCounter
+	database.DB.Where("ship_id = ?", shipID).Find(&last)
+	previous := make(map[string]models.HotspotUserCounter, len(last))
+	for _, l := range last {
+		previous[l.Username] = l
+	}
+
+	totals, deltas := hotspotUsageDeltas(counters, sessions, previous)
+	for username, cur := range totals {
+		if d, ok := deltas[username]; ok {
+			recordUserUsage(shipID, username, d[0], d[1], at)
+		}
+		database.DB.Save(&models.HotspotUserCounter{ShipID: shipID, Username: username, BytesIn: cur[0], BytesOut: cur[1], UpdatedAt: at})
+	}
+	return nil
+}
+
+// Tổng bộ đếm của các tài khoản đã đổi so với mốc trước (cần lưu mốc mới) và phần lưu lượng phát sinh.
+// Lần đầu thấy tài khoản chỉ lưu mốc, chưa tính lưu lượng
+func hotspotUsageDeltas(counters map[string][2]int64, sessions map[string]hotspotSession, previous map[string]models.HotspotUserCounter) (map[string][2]int64, map[string][2]int64) {
+	sums := make(map[string][2]int64, len(counters))
+	for username, cur := range counters {
+		sums[username] = cur
+	}
+	for _, s := range sessions {
+		if s.Radius {
+			continue
+		}
+		cur := sums[s.User]
+		sums[s.User] = [2]int64{cur[0] + s.BytesIn, cur[1] + s.BytesOut}
+	}
+
+	totals := make(map[string][2]int64)
+	deltas := make(map[string][2]int64)
+	for username, cur := range sums {
+		if username == "" {
+			continue
+		}
+		if p, ok := previous[username]; ok {
+			if p.BytesIn == cur[0] && p.BytesOut == cur[1] {
+				continue
+			}
+			deltas[username] = [2]int64{counterDelta(p.BytesIn, cur[0]), counterDelta(p.BytesOut, cur[1])}
+		}
+		totals[username] = cur
+	}
+	return totals, deltas
+}
+
+// Báo cáo lưu lượng theo tài khoản từ bảng theo ngày (mặc định: đầu tháng đến hôm nay)
 func GetMonthlyUsage(c *gin.Context) {
 	var filter UsageFilter
 	if err := c.ShouldBindQuery(&filter); err != nil {
@@ -35,47 +218,122 @@ func GetMonthlyUsage(c *gin.Context) {
 		return
 	}
 
-	// 1. Lấy danh sách Crew (Có thể lọc theo username)
-	var crews []models.Crew
-	query := database.DB.Model(&models.Crew{})
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if filter.StartDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", filter.StartDate, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_date phải có dạng YYYY-MM-DD"})
+			return
+		}
+		start = t
+	}
+	if filter.EndDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", filter.EndDate, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_date phải có dạng YYYY-MM-DD"})
+			return
+		}
+		end = t
+	}
+	if end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_date phải sau start_date"})
+		return
+	}
+
+	// 1. Lưu lượng theo tài khoản trong khoảng ngày (tính cả ngày cuối)
+	var usage []struct {
+		Username string
+		BytesIn  int64
+		BytesOut int64
+	}
+	query := database.DB.Model(&models.UsageDaily{}).Select("username, SUM(bytes_in) AS bytes_in, SUM(bytes_out) AS bytes_out").
+		Where("day BETWEEN ? AND ?", start, end).Group("username")
 	if filter.Username != "" {
 		query = query.Where("username ILIKE ?", "%"+filter.Username+"%")
 	}
-	query.Find(&crews)
+	if filter.ShipID != "" {
+		query = query.Where("ship_id = ?", filter.ShipID)
+	}
+	query.Scan(&usage)
 
-	// 2. Tính toán dữ liệu báo cáo (Simulated Aggregation)
-	var reports []UsageReport
+	// 2. Thời gian online: phần giao của từng phiên với khoảng báo cáo
+	var timeUsed []struct {
+		Username string
+		Seconds  float64
+	}
+	rangeEnd := end.AddDate(0, 0, 1)
+	sessions := database.DB.Model(&models.UsageSession{}).
+		Select("username, SUM(EXTRACT(EPOCH FROM LEAST(COALESCE(ended_at, last_seen_at), ?) - GREATEST(started_at, ?))) AS seconds", rangeEnd, start).
+		Where("started_at < ? AND COALESCE(ended_at, last_seen_at) > ?", rangeEnd, start).Group("username")
+	if filter.Username != "" {
+		sessions = sessions.Where("username ILIKE ?", "%"+filter.Username+"%")
+	}
+	if filter.ShipID != "" {
+		sessions = sessions.Where("ship_id = ?", filter.ShipID)
+	}
+	sessions.Scan(&timeUsed)
+	seconds := make(map[string]int64, len(timeUsed))
+	for _, t := range timeUsed {
+		seconds[t.Username] = int64(t.Seconds)
+	}
 
-	// Tính số ngày trong khoảng thời gian chọn (để fake dữ liệu cho hợp lý)
-	days := 1.0
-	if t1, err := time.Parse("2006-01-02", filter.StartDate); err == nil {
-		if t2, err := time.Parse("2006-01-02", filter.EndDate); err == nil {
-			days = t2.Sub(t1).Hours() / 24
-			if days < 1 { days = 1 }
-		}
+	// 3. Crew (kể cả chưa dùng) + tài khoản voucher có lưu lượng
+	var crews []models.Crew
+	crewQuery := database.DB.Model(&models.Crew{})
+	if filter.Username != "" {
+		crewQuery = crewQuery.Where("username ILIKE ?", "%"+filter.Username+"%")
+	}
+	if filter.ShipID != "" {
+		crewQuery = crewQuery.Where("ship_id = ?", filter.ShipID)
 	}
+	crewQuery.Find(&crews)
 
+	reports := []UsageReport{}
+	index := map[string]int{}
 	for _, crew := range crews {
-		// Giả lập: Mỗi ngày dùng khoảng 50-200MB
-		// Dùng ID để seed random giúp số liệu ổn định khi refresh
-		r := rand.New(rand.NewSource(int64(crew.ID) * int64(days))) 
-		
-		dl := (50.0 + r.Float64()*150.0) * days
-		ul := dl * 0.2 // Upload bằng 20% Download
-		
-		// Thời gian online (Giả sử 2-5 tiếng/ngày)
-		timeUsed := int64((2.0 + r.Float64()*3.0) * 3600 * days)
-
-		reports = append(reports, UsageReport{
-			ID:        crew.ID,
-			Username:  crew.Username,
-			Download:  dl,
-			Upload:    ul,
-			TotalData: dl + ul,
-			TimeUsed:  timeUsed,
-			Status:    crew.Status,
-		})
+		if _, ok := index[crew.Username]; ok {
+			continue
+		}
+		index[crew.Username] = len(reports)
+		reports = append(reports, UsageReport{ID: crew.ID, Username: crew.Username, Status: crew.Status})
+	}
+	for _, u := range usage {
+		i, ok := index[u.Username]
+		if !ok {
+			i = len(reports)
+			index[u.Username] = i
+			reports = append(reports, UsageReport{Username: u.Username, Status: "Voucher"})
+		}
+		r := &reports[i]
+		r.Upload = float64(u.BytesIn) / 1024 / 1024
+		r.Download = float64(u.BytesOut) / 1024 / 1024
+		r.TotalData = r.Upload + r.Download
+	}
+	for i := range reports {
+		reports[i].TimeUsed = seconds[reports[i].Username]
 	}
 
 	c.JSON(http.StatusOK, reports)
-}
\ No newline at end of file
+}
+
+// GET /api/usage-sessions?ship_id=&username=&from=&to= : lịch sử phiên hotspot
+func GetUsageSessions(c *gin.Context) {
+	from, to, err := parseTimeRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var rows []models.UsageSession
+	query := database.DB.Where("started_at < ? AND COALESCE(ended_at, last_seen_at) > ?", to, from).
+		Order("started_at desc").Limit(1000)
+	if shipID := c.Query("ship_id"); shipID != "" {
+		query = query.Where("ship_id = ?", shipID)
+	}
+	if username := c.Query("username"); username != "" {
+		query = query.Where("username = ?", username)
+	}
+	query.Find(&rows)
+	c.JSON(http.StatusOK, rows)
+}
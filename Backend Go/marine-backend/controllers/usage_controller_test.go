@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"marine-backend/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRouterOSDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"45s", 45 * time.Second},
+		{"5m30s", 5*time.Minute + 30*time.Second},
+		{"1w2d3h4m5s", 7*24*time.Hour + 2*24*time.Hour + 3*time.Hour + 4*time.Minute + 5*time.Second},
+		{"2d", 48 * time.Hour},
+		{"01:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"00:00:59", 59 * time.Second},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRouterOSDuration(tt.in); got != tt.want {
+			t.Errorf("parseRouterOSDuration(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHotspotUsageDeltas(t *testing.T) {
+	previous := map[string]models.HotspotUserCounter{
+		"an":   {Username: "an", BytesIn: 1000, BytesOut: 200},
+		"binh": {Username: "binh", BytesIn: 5000, BytesOut: 800},
+	}
+	tests := []struct {
+		name     string
+		counters map[string][2]int64
+		sessions map[string]hotspotSession
+		totals   map[string][2]int64
+		deltas   map[string][2]int64
+	}{
+		{
+			"bộ đếm tăng",
+			map[string][2]int64{"an": {1500, 260}},
+			nil,
+			map[string][2]int64{"an": {1500, 260}},
+			map[string][2]int64{"an": {500, 60}},
+		},
+		{
+			"cộng phiên đang mở, bỏ phiên RADIUS",
+			map[string][2]int64{"an": {1000, 200}},
+			map[string]hotspotSession{
+				"*1": {User: "an", BytesIn: 300, BytesOut: 40},
+				"*2": {User: "an", BytesIn: 9999, BytesOut: 9999, Radius: true},
+			},
+			map[string][2]int64{"an": {1300, 240}},
+			map[string][2]int64{"an": {300, 40}},
+		},
+		{
+			"không đổi -> không ghi",
+			map[string][2]int64{"an": {1000, 200}, "binh": {5000, 800}},
+			nil,
+			map[string][2]int64{},
+			map[string][2]int64{},
+		},
+		{
+			"router khởi động lại -> tính từ 0",
+			map[string][2]int64{"binh": {120, 30}},
+			nil,
+			map[string][2]int64{"binh": {120, 30}},
+			map[string][2]int64{"binh": {120, 30}},
+		},
+		{
+			"tài khoản mới chỉ lưu mốc",
+			map[string][2]int64{"chi": {700, 70}, "": {1, 1}},
+			nil,
+			map[string][2]int64{"chi": {700, 70}},
+			map[string][2]int64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := make(map[string][2]int64, len(tt.counters))
+			for k, v := range tt.counters {
+				before[k] = v
+			}
+			totals, deltas := hotspotUsageDeltas(tt.counters, tt.sessions, previous)
+			if !reflect.DeepEqual(totals, tt.totals) {
+				t.Errorf("totals = %v, want %v", totals, tt.totals)
+			}
+			if !reflect.DeepEqual(deltas, tt.deltas) {
+				t.Errorf("deltas = %v, want %v", deltas, tt.deltas)
+			}
+			if !reflect.DeepEqual(tt.counters, before) {
+				t.Errorf("hotspotUsageDeltas() sửa map counters: %v", tt.counters)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"marine-backend/qrcode"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	maxVoucherBatch     = 1000
+	voucherProgressStep = 50 // Báo tiến độ sau mỗi 50 mã
+)
+
+// URL đăng nhập hotspot in trong QR (điền sẵn username = password = mã voucher)
+func hotspotLoginURL(code string) string {
+	base := os.Getenv("HOTSPOT_LOGIN_URL")
+	if base == "" {
+		base = "http://10.5.50.1/login"
+	}
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + url.Values{"username": {code}, "password": {code}}.Encode()
+}
+
+// 1. TẠO LÔ VOUCHER: {plan_id | data_plan, ship_id, count, valid_days, note}
+func CreateVoucherBatch(c *gin.Context) {
+	var req struct {
+		PlanID    *uint  `json:"plan_id"`
+		DataPlan  string `json:"data_plan"`
+		ShipID    string `json:"ship_id"`
+		Count     int    `json:"count"`
+		ValidDays int    `json:"valid_days"`
+		Note      string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Count < 1 || req.Count > maxVoucherBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Số lượng voucher phải từ 1 đến %d", maxVoucherBatch)})
+		return
+	}
+	if req.ShipID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Thiếu tàu phát hành"})
+		return
+	}
+
+	template := models.Voucher{PlanID: req.PlanID, DataPlan: req.DataPlan, ShipID: req.ShipID, ValidDays: req.ValidDays}
+	plan, msg := prepareVoucher(&template, c.GetString("username"))
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	batch := models.VoucherBatch{
+		PlanID: plan.ID, DataPlan: plan.Name, ShipID: req.ShipID, Count: req.Count, ValidDays: template.ValidDays,
+		Note: req.Note, CreatedBy: template.CreatedBy, CreatedAt: template.CreatedAt,
+	}
+	if err := database.DB.Create(&batch).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+	template.BatchID = &batch.ID
+	vouchers, err := insertVouchers(template, req.Count)
+	if err != nil {
+		database.DB.Delete(&batch)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+
+	jobID := provisionVoucherBatch(batch, plan.ProfileName, vouchers, c.GetString("username"))
+	c.JSON(http.StatusCreated, gin.H{"batch": batch, "vouchers": vouchers, "job_id": jobID})
+}
+
+// Đẩy lô voucher xuống router ở nền (lô lớn mất vài phút), tiến độ gửi qua luồng sự kiện job
+func provisionVoucherBatch(batch models.VoucherBatch, profile string, vouchers []models.Voucher, owner string) string {
+	jobID := fmt.Sprintf("voucher-batch-%d-%d", batch.ID, time.Now().UnixNano())
+	total := len(vouchers)
+	go func() {
+		failed := provisionVouchers(batch.ShipID, profile, vouchers, func(done, failed int) {
+			if done%voucherProgressStep == 0 && done < total {
+				PublishJobProgress(jobID, owner, done, total, "running", fmt.Sprintf("%d/%d mã, %d lỗi router", done, total, failed))
+			}
+		})
+		status := "done"
+		if failed > 0 {
+			status = "failed"
+		}
+		PublishJobProgress(jobID, owner, total, total, status,
+			fmt.Sprintf("Lô voucher #%d: %d/%d mã đã tạo trên router", batch.ID, total-failed, total))
+		fmt.Printf("🎫 Lô voucher #%d: %d mã gói %s cho tàu %s (%d lỗi router)\n", batch.ID, total, batch.DataPlan, batch.ShipID, failed)
+	}()
+	return jobID
+}
+
+// 2. Danh sách lô (?ship_id=)
+func GetVoucherBatches(c *gin.Context) {
+	var batches []models.VoucherBatch
+	query := database.DB.Order("created_at desc").Limit(200)
+	if shipID := c.Query("ship_id"); shipID != "" {
+		query = query.Where("ship_id = ?", shipID)
+	}
+	query.Find(&batches)
+	c.JSON(http.StatusOK, batches)
+}
+
+// Vẽ mã QR (mỗi ô tối 1 hình vuông) trong khung size x size mm, chừa quiet zone 2 ô
+func drawQR(pdf *gofpdf.Fpdf, q *qrcode.Code, x, y, size float64) {
+	cell := size / float64(q.Size+4)
+	x += 2 * cell
+	y += 2 * cell
+	pdf.SetFillColor(0, 0, 0)
+	for row := 0; row < q.Size; row++ {
+		for col := 0; col < q.Size; col++ {
+			if q.Dark(col, row) {
+				pdf.Rect(x+float64(col)*cell, y+float64(row)*cell, cell, cell, "F")
+			}
+		}
+	}
+}
+
+// Tờ A4 3 x 8 thẻ, mỗi thẻ: tên tàu, mã, gói, hạn dùng và QR đăng nhập
+func renderVoucherCards(batch models.VoucherBatch, shipName string, vouchers []models.Voucher) *gofpdf.Fpdf {
+	const (
+		cols, rows      = 3, 8
+		margin          = 10.0
+		cardW, cardH    = (210 - 2*margin) / cols, (297 - 2*margin) / rows
+		qrSize, padding = 26.0, 3.0
+	)
+	pdf := newPDF()
+	pdf.SetAutoPageBreak(false, 0)
+	validity := "Valid: unlimited"
+	if batch.ValidDays > 0 {
+		validity = fmt.Sprintf("Valid: %d days from first login", batch.ValidDays)
+	}
+
+	for i, v := range vouchers {
+		if i%(cols*rows) == 0 {
+			pdf.AddPage()
+		}
+		slot := i % (cols * rows)
+		x := margin + float64(slot%cols)*cardW
+		y := margin + float64(slot/cols)*cardH
+
+		// Đường cắt
+		pdf.SetDrawColor(160, 160, 160)
+		pdf.SetDashPattern([]float64{1, 1}, 0)
+		pdf.Rect(x, y, cardW, cardH, "D")
+		pdf.SetDashPattern([]float64{}, 0)
+
+		textW := cardW - qrSize - 2*padding
+		pdf.SetTextColor(90, 90, 90)
+		pdf.SetFont("DejaVu", "B", 7)
+		pdf.SetXY(x+padding, y+padding)
+		pdf.CellFormat(textW, 3.5, "CREW WIFI VOUCHER", "", 2, "L", false, 0, "")
+		pdf.SetFont("DejaVu", "", 6.5)
+		pdf.CellFormat(textW, 3.5, shipName, "", 2, "L", false, 0, "")
+
+		pdf.SetTextColor(0, 0, 0)
+		pdf.SetFont("Courier", "B", 13)
+		pdf.SetXY(x+padding, y+12)
+		pdf.CellFormat(textW, 7, v.Code, "", 2, "L", false, 0, "")
+
+		pdf.SetFont("DejaVu", "", 7)
+		pdf.SetXY(x+padding, y+21)
+		pdf.CellFormat(textW, 3.5, "Plan: "+batch.DataPlan, "", 2, "L", false, 0, "")
+		pdf.MultiCell(textW, 3.2, validity, "", "L", false)
+
+		if q, err := qrcode.Encode(hotspotLoginURL(v.Code)); err == nil {
+			drawQR(pdf, q, x+cardW-qrSize-padding/2, y+(cardH-qrSize)/2, qrSize)
+		}
+	}
+	if len(vouchers) == 0 {
+		pdf.AddPage()
+		pdf.SetFont("DejaVu", "", 12)
+		pdf.Cell(0, 10, "No vouchers in this batch")
+	}
+
+	return pdf
+}
+
+// 3. GET /api/voucher-batches/:id/pdf : tờ A4 thẻ cắt rời (mã, gói, hạn dùng, QR đăng nhập); ?status=Unused để chỉ in mã chưa dùng
+func DownloadVoucherBatchPDF(c *gin.Context) {
+	var batch models.VoucherBatch
+	if err := database.DB.First(&batch, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lô voucher không tồn tại"})
+		return
+	}
+	var vouchers []models.Voucher
+	query := database.DB.Where("batch_id = ?", batch.ID).Order("id")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Find(&vouchers)
+	var ship models.Ship
+	database.DB.Where("id = ?", batch.ShipID).Limit(1).Find(&ship)
+
+	pdf := renderVoucherCards(batch, ship.Name, vouchers)
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=Vouchers-%d-%s.pdf", batch.ID, time.Now().Format("20060102")))
+	if err := pdf.Output(c.Writer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi tạo file PDF"})
+	}
+}
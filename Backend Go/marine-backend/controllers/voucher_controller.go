@@ -1,82 +1,584 @@
 package controllers
 
 import (
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"marine-backend/database"
 	"marine-backend/models"
-	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// ... Giữ nguyên hàm GetVouchers ...
+// Vòng đời voucher: trạng thái được phép chuyển tới (Revoked là trạng thái cuối; Expired chỉ quay lại Active khi gia hạn)
+var voucherTransitions = map[string][]string{
+	"Unused":   {"Assigned", "Active", "Expired", "Revoked"},
+	"Assigned": {"Active", "Expired", "Revoked"},
+	"Active":   {"Expired", "Revoked"},
+	"Expired":  {"Active"},
+}
 
-// TẠO VOUCHER MỚI
-func CreateVoucher(c *gin.Context) {
-	var input models.Voucher
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+func voucherCanMove(from, to string) bool {
+	for _, s := range voucherTransitions[from] {
+		if s == to {
+			return true
+		}
 	}
+	return false
+}
 
-	// Sinh mã
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	input.Code = fmt.Sprintf("VOU-%05d", r.Intn(99999))
-	input.Status = "Unused"
-	input.CreatedAt = time.Now()
+// Chuyển trạng thái có điều kiện trên DB (tránh 2 request đổi cùng lúc); trả về false nếu không hợp lệ
+func moveVoucher(v *models.Voucher, to string, updates map[string]interface{}) bool {
+	if !voucherCanMove(v.Status, to) {
+		return false
+	}
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	updates["status"] = to
+	result := database.DB.Model(&models.Voucher{}).Where("id = ? AND status = ?", v.ID, v.Status).Updates(updates)
+	if result.RowsAffected == 0 {
+		return false
+	}
+	database.DB.First(v, v.ID)
+	return true
+}
+
+// Xóa tài khoản hotspot của voucher trên router và ngắt phiên đang chạy
+func removeHotspotUser(shipID, username string) error {
+	client, _, err := ConnectToRouter(shipID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for _, path := range []string{"/ip/hotspot/active", "/ip/hotspot/user"} {
+		key := "?name="
+		if path == "/ip/hotspot/active" {
+			key = "?user="
+		}
+		res, err := client.Run(path+"/print", key+username)
+		if err != nil {
+			return err
+		}
+		for _, re := range res.Re {
+			if _, err := client.Run(path+"/remove", "=.id="+re.Map[".id"]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Gỡ voucher khỏi router (voucher không gắn tàu chỉ dùng qua RADIUS, không có user cục bộ)
+func unprovisionVoucher(v models.Voucher) string {
+	if v.ShipID == "" {
+		return ""
+	}
+	if err := removeHotspotUser(v.ShipID, v.Code); err != nil {
+		fmt.Printf("⚠️ Không gỡ voucher %s khỏi router tàu %s: %v\n", v.Code, v.ShipID, err)
+		return err.Error()
+	}
+	return ""
+}
+
+// DANH SÁCH VOUCHER: lọc theo status, plan_id / data_plan, ship_id, created_by, assign_to, code, from/to (ngày tạo); phân trang
+func GetVouchers(c *gin.Context) {
+	query := database.DB.Model(&models.Voucher{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if planID := c.Query("plan_id"); planID != "" {
+		query = query.Where("plan_id = ?", planID)
+	}
+	if plan := c.Query("data_plan"); plan != "" {
+		query = query.Where("data_plan = ?", plan)
+	}
+	if shipID := c.Query("ship_id"); shipID != "" {
+		query = query.Where("ship_id = ?", shipID)
+	}
+	if createdBy := c.Query("created_by"); createdBy != "" {
+		query = query.Where("created_by = ?", createdBy)
+	}
+	if assignTo := c.Query("assign_to"); assignTo != "" {
+		query = query.Where("assign_to ILIKE ?", "%"+assignTo+"%")
+	}
+	if code := c.Query("code"); code != "" {
+		query = query.Where("code ILIKE ?", "%"+code+"%")
+	}
+	if c.Query("from") != "" || c.Query("to") != "" {
+		from, to, err := parseTimeRange(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("created_at BETWEEN ? AND ?", from, to)
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 500 {
+		size = 50
+	}
+	var total int64
+	query.Count(&total)
+	vouchers := []models.Voucher{}
+	query.Order("created_at desc, id desc").Offset((page - 1) * size).Limit(size).Find(&vouchers)
+	c.JSON(http.StatusOK, gin.H{"items": vouchers, "total": total, "page": page, "page_size": size})
+}
+
+// Bảng chữ không gây nhầm khi đọc / gõ tay (bỏ 0/O, 1/I/L)
+const voucherAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
 
-	// Lưu DB
-	database.DB.Create(&input)
+// Mã ngẫu nhiên mật mã dạng XXXX-XXXX (31^8 ≈ 8.5e11 tổ hợp)
+func randomVoucherCode() (string, error) {
+	buf := make([]byte, 0, 9)
+	b := make([]byte, 1)
+	for len(buf) < 9 {
+		if len(buf) == 4 {
+			buf = append(buf, '-')
+			continue
+		}
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		// Bỏ giá trị >= 248 để phân bố đều trên 31 ký tự
+		if int(b[0]) >= 256/len(voucherAlphabet)*len(voucherAlphabet) {
+			continue
+		}
+		buf = append(buf, voucherAlphabet[int(b[0])%len(voucherAlphabet)])
+	}
+	return string(buf), nil
+}
+
+// Sinh n mã chưa có trong DB (unique index trên code chặn trường hợp 2 request trùng nhau)
+func newVoucherCodes(n int) ([]string, error) {
+	seen := map[string]bool{}
+	codes := make([]string, 0, n)
+	for len(codes) < n {
+		var batch []string
+		for len(batch) < n-len(codes) {
+			code, err := randomVoucherCode()
+			if err != nil {
+				return nil, err
+			}
+			if !seen[code] {
+				seen[code] = true
+				batch = append(batch, code)
+			}
+		}
+		var taken []string
+		database.DB.Model(&models.Voucher{}).Where("code IN ?", batch).Pluck("code", &taken)
+		exists := map[string]bool{}
+		for _, code := range taken {
+			exists[code] = true
+		}
+		for _, code := range batch {
+			if !exists[code] {
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes, nil
+}
 
-	// Đẩy xuống MikroTik ngay lập tức (Tạo sẵn user chờ khách nhập)
-	shipID := "IMO9562623" // ID tàu đang test
+// Lưu voucher với mã mới; trùng mã (race giữa các request) thì sinh lại, tối đa 3 lần
+func insertVouchers(template models.Voucher, n int) ([]models.Voucher, error) {
+	var lastErr error
+	for attempt := 0; attempt < 3; attempt++ {
+		codes, err := newVoucherCodes(n)
+		if err != nil {
+			return nil, err
+		}
+		vouchers := make([]models.Voucher, n)
+		for i, code := range codes {
+			vouchers[i] = template
+			vouchers[i].Code = code
+		}
+		if lastErr = database.DB.CreateInBatches(&vouchers, 200).Error; lastErr == nil {
+			return vouchers, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// Tạo sẵn user hotspot trên router của tàu (1 kết nối cho cả lô); trả về số mã lỗi.
+// progress (có thể nil) được gọi sau mỗi mã với số mã đã xử lý / số lỗi
+func provisionVouchers(shipID, profile string, vouchers []models.Voucher, progress func(done, failed int)) int {
+	if shipID == "" {
+		return 0
+	}
 	client, _, err := ConnectToRouter(shipID)
-	
-	if err == nil {
-		defer client.Close()
-		// Tạo User: Name=Code, Password=Code, Profile=DataPlan
+	if err != nil {
+		fmt.Println("⚠️ Lỗi kết nối Router khi tạo Voucher:", err)
+		return len(vouchers)
+	}
+	defer client.Close()
+
+	failed := 0
+	for i, v := range vouchers {
+		// Tạo User: Name=Code, Password=Code, Profile=ProfileName của gói
 		_, err := client.Run(
 			"/ip/hotspot/user/add",
-			"=name=" + input.Code,
-			"=password=" + input.Code,
-			"=profile=" + input.DataPlan, // Tên gói cước phải khớp với tên Profile
+			"=name="+v.Code,
+			"=password="+v.Code,
+			"=profile="+profile, // Profile cố định của gói (không đổi khi đổi tên gói)
 			"=comment=Voucher",
 		)
 		if err != nil {
 			fmt.Println("⚠️ Lỗi tạo Voucher trên Router:", err)
+			failed++
+		}
+		if progress != nil {
+			progress(i+1, failed)
+		}
+	}
+	return failed
+}
+
+// Kiểm tra gói + tàu chung cho tạo lẻ và tạo theo lô
+func prepareVoucher(input *models.Voucher, username string) (*models.BandwidthPlan, string) {
+	plan, msg := resolvePlan(input.PlanID, input.DataPlan)
+	if msg != "" {
+		return nil, msg
+	}
+	input.PlanID, input.DataPlan = &plan.ID, plan.Name
+	if input.ValidDays <= 0 {
+		input.ValidDays = plan.ValidityDays
+	}
+	if input.ShipID != "" {
+		var count int64
+		database.DB.Model(&models.Ship{}).Where("id = ?", input.ShipID).Count(&count)
+		if count == 0 {
+			return nil, "Không tìm thấy tàu"
+		}
+	}
+	input.Status = "Unused"
+	if input.CreatedBy == "" {
+		input.CreatedBy = username
+	}
+	input.CreatedAt = time.Now()
+	return plan, ""
+}
+
+// TẠO VOUCHER MỚI
+func CreateVoucher(c *gin.Context) {
+	var input models.Voucher
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	plan, msg := prepareVoucher(&input, c.GetString("username"))
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Sinh mã + lưu DB
+	vouchers, err := insertVouchers(input, 1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+		return
+	}
+
+	// Đẩy xuống MikroTik của tàu phát hành ngay lập tức (Tạo sẵn user chờ khách nhập); voucher không gắn tàu thì bỏ qua
+	if input.ShipID != "" && provisionVouchers(input.ShipID, plan.ProfileName, vouchers, nil) == 0 {
+		fmt.Println("✅ Đã bắn Voucher vào MikroTik:", vouchers[0].Code)
+	}
+
+	c.JSON(http.StatusCreated, vouchers[0])
+}
+
+// Ghi nhận đổi voucher (lần đăng nhập hotspot / RADIUS đầu tiên): Unused / Assigned -> Active,
+// hạn dùng tính từ lúc này
+func markVoucherUsed(code string, at time.Time) bool {
+	var voucher models.Voucher
+	if err := database.DB.Where("code = ? AND status IN ?", code, []string{"Unused", "Assigned"}).First(&voucher).Error; err != nil {
+		return false
+	}
+	updates := map[string]interface{}{"used_at": at}
+	if voucher.ValidDays > 0 {
+		updates["expires_at"] = at.AddDate(0, 0, voucher.ValidDays)
+	}
+	if !moveVoucher(&voucher, "Active", updates) {
+		return false
+	}
+	fmt.Printf("🎫 Voucher %s bắt đầu sử dụng\n", code)
+	return true
+}
+
+// Cộng lưu lượng vào voucher (username hotspot = mã voucher)
+func addVoucherUsage(code string, bytesIn, bytesOut int64) {
+	database.DB.Model(&models.Voucher{}).Where("code = ?", code).Updates(map[string]interface{}{
+		"bytes_in":  gorm.Expr("bytes_in + ?", bytesIn),
+		"bytes_out": gorm.Expr("bytes_out + ?", bytesOut),
+	})
+}
+
+// Voucher cũ dùng trạng thái "Used" -> "Active" theo vòng đời mới, bổ sung hạn dùng từ UsedAt
+func MigrateVoucherStatus() {
+	database.DB.Model(&models.Voucher{}).Where("status = ?", "Used").Update("status", "Active")
+	database.DB.Model(&models.Voucher{}).Where("status = ? AND expires_at IS NULL AND valid_days > 0", "Active").
+		Update("expires_at", gorm.Expr("used_at + valid_days * INTERVAL '1 day'"))
+}
+
+// Khóa voucher trên router: tàu phát hành + các tàu đang có phiên của mã này (voucher RADIUS)
+func disableVoucherOnRouters(v models.Voucher) error {
+	shipIDs := []string{}
+	database.DB.Model(&models.UsageSession{}).Where("username = ? AND ended_at IS NULL", v.Code).Distinct().Pluck("ship_id", &shipIDs)
+	if v.ShipID != "" {
+		shipIDs = append(shipIDs, v.ShipID)
+	}
+	var lastErr error
+	done := map[string]bool{}
+	for _, shipID := range shipIDs {
+		if done[shipID] {
+			continue
+		}
+		done[shipID] = true
+		if err := setHotspotUserAccess(shipID, v.Code, "", true); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Chuyển voucher quá hạn sang Expired và khóa trên router; thử lại voucher chưa khóa được lần trước
+func expireVouchers(now time.Time) {
+	var due []models.Voucher
+	database.DB.Where("status = ? AND expires_at <= ?", "Active", now).Find(&due)
+	for _, v := range due {
+		if moveVoucher(&v, "Expired", nil) {
+			fmt.Printf("⌛ Voucher %s hết hạn\n", v.Code)
+			PublishEvent(StreamEvent{Type: "voucher", ShipID: v.ShipID, Data: gin.H{"action": "expired", "voucher": v}})
+		}
+	}
+
+	var pending []models.Voucher
+	database.DB.Where("status IN ? AND disabled_on_router = ?", []string{"Expired", "Revoked"}, false).Limit(200).Find(&pending)
+	for _, v := range pending {
+		var err error
+		if v.Status == "Revoked" && v.ShipID != "" {
+			err = removeHotspotUser(v.ShipID, v.Code)
 		} else {
-			fmt.Println("✅ Đã bắn Voucher vào MikroTik:", input.Code)
+			err = disableVoucherOnRouters(v)
+		}
+		if err != nil {
+			fmt.Printf("⚠️ Chưa khóa được voucher %s trên router: %v\n", v.Code, err)
+			continue
+		}
+		database.DB.Model(&v).Update("disabled_on_router", true)
+	}
+}
+
+// Worker: hết hạn voucher theo ExpiresAt
+func StartVoucherExpiryWorker() {
+	interval := envSeconds("VOUCHER_EXPIRY_INTERVAL", time.Minute)
+	for {
+		expireVouchers(time.Now())
+		time.Sleep(interval)
+	}
+}
+
+func findVoucher(c *gin.Context) (models.Voucher, bool) {
+	var voucher models.Voucher
+	if err := database.DB.First(&voucher, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Voucher không tồn tại"})
+		return voucher, false
+	}
+	return voucher, true
+}
+
+// Nạp voucher vào tài khoản hotspot của thuyền viên: khóa dòng voucher trong transaction để không gán 2 lần,
+// cộng dung lượng gói vào chu kỳ hiện tại rồi gỡ mã khỏi router (mã không còn đăng nhập riêng được)
+func creditVoucherToCrew(voucherID, crewID uint) (models.Voucher, models.QuotaState, int, string) {
+	var voucher models.Voucher
+	var crew models.Crew
+	var bytes int64
+	status, msg := http.StatusOK, ""
+	fail := func(code int, m string) error {
+		status, msg = code, m
+		return errors.New(m)
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&voucher, voucherID).Error; err != nil {
+			return fail(http.StatusNotFound, "Voucher không tồn tại")
+		}
+		if voucher.CrewID != 0 {
+			return fail(http.StatusConflict, "Voucher đã được gán cho "+voucher.AssignTo)
+		}
+		if voucher.Status != "Unused" {
+			return fail(http.StatusConflict, "Voucher đang ở trạng thái "+voucher.Status+", không thể gán")
+		}
+		if err := tx.First(&crew, crewID).Error; err != nil {
+			return fail(http.StatusNotFound, "Thuyền viên không tồn tại")
+		}
+		if crew.Status != "" && crew.Status != "Active" {
+			return fail(http.StatusBadRequest, "Tài khoản thuyền viên đang bị khóa")
+		}
+		if voucher.ShipID != "" && voucher.ShipID != crew.ShipID {
+			return fail(http.StatusBadRequest, "Voucher phát hành cho tàu "+voucher.ShipID+", thuyền viên thuộc tàu khác")
+		}
+		if bytes = planAllowance(voucher.PlanID, voucher.DataPlan); bytes <= 0 {
+			return fail(http.StatusBadRequest, "Voucher không có dung lượng để nạp")
 		}
+		return tx.Model(&voucher).Updates(map[string]interface{}{
+			"status": "Assigned", "crew_id": crew.ID, "assign_to": crew.FullName, "used_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		if msg == "" {
+			status, msg = http.StatusInternalServerError, "Lỗi lưu DB"
+		}
+		return voucher, models.QuotaState{}, status, msg
 	}
 
-	c.JSON(http.StatusCreated, input)
+	quotaMu.Lock()
+	cfg := currentQuotaConfig()
+	st := loadQuotaState(crew, cfg, time.Now())
+	st.TopupBytes += bytes
+	addCrewUsageEvent(st, "topup", fmt.Sprintf("Nạp voucher %s (+%d MB)", voucher.Code, bytes>>20))
+	evaluateQuota(&st, crew, cfg)
+	st.UpdatedAt = time.Now()
+	database.DB.Save(&st)
+	quotaMu.Unlock()
+
+	unprovisionVoucher(voucher)
+	return voucher, st, http.StatusOK, ""
 }
 
-// 3. Gán Voucher cho Crew
+// 3. Gán Voucher cho Crew: nạp dung lượng gói vào tài khoản hotspot của thuyền viên (chỉ voucher chưa dùng, cùng tàu)
 func AssignVoucher(c *gin.Context) {
-	id := c.Param("id")
 	var req struct {
-		CrewID   uint   `json:"crew_id"`
-		CrewName string `json:"crew_name"`
+		CrewID uint `json:"crew_id" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu sai"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Thiếu thuyền viên"})
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	voucher, st, status, msg := creditVoucherToCrew(uint(id), req.CrewID)
+	if msg != "" {
+		if status == http.StatusConflict {
+			recordAudit(c, fmt.Sprintf("Assign voucher %s to crew #%d: %s", voucher.Code, req.CrewID, msg), "Failed")
+		}
+		c.JSON(status, gin.H{"error": msg})
 		return
 	}
+	recordAudit(c, fmt.Sprintf("Assigned voucher %s to crew %s (#%d)", voucher.Code, voucher.AssignTo, req.CrewID), "Success")
 
-	// Cập nhật DB
-	result := database.DB.Model(&models.Voucher{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"status":    "Assigned",
-		"crew_id":   req.CrewID,
-		"assign_to": req.CrewName,
-	})
+	c.JSON(http.StatusOK, gin.H{"message": "Đã gán thành công", "voucher": voucher, "quota": quotaView(st)})
+}
 
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Voucher không tồn tại"})
+// 4. Thu hồi voucher: khóa vĩnh viễn, gỡ khỏi router và ngắt phiên đang dùng
+func RevokeVoucher(c *gin.Context) {
+	voucher, ok := findVoucher(c)
+	if !ok {
+		return
+	}
+	if !moveVoucher(&voucher, "Revoked", nil) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Voucher đang ở trạng thái " + voucher.Status + ", không thể thu hồi"})
+		return
+	}
+	routerErr := unprovisionVoucher(voucher)
+	if routerErr == "" {
+		// Voucher RADIUS đang online trên tàu khác: ngắt phiên
+		if err := disableVoucherOnRouters(models.Voucher{Code: voucher.Code}); err == nil {
+			database.DB.Model(&voucher).Update("disabled_on_router", true)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"voucher": voucher, "router_error": routerErr})
+}
+
+// 5. Gia hạn voucher thêm N ngày (chưa bị thu hồi); voucher đã hết hạn được mở lại, hạn mới tính từ bây giờ
+func ExtendVoucher(c *gin.Context) {
+	var req struct {
+		Days int `json:"days"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Số ngày gia hạn phải lớn hơn 0"})
+		return
+	}
+	voucher, ok := findVoucher(c)
+	if !ok {
+		return
+	}
+	if len(voucherTransitions[voucher.Status]) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Voucher đang ở trạng thái " + voucher.Status + ", không thể gia hạn"})
+		return
+	}
+	if voucher.Status == "Expired" {
+		from := time.Now()
+		if voucher.ExpiresAt != nil && voucher.ExpiresAt.After(from) {
+			from = *voucher.ExpiresAt
+		}
+		updates := map[string]interface{}{
+			"valid_days": gorm.Expr("valid_days + ?", req.Days), "expires_at": from.AddDate(0, 0, req.Days), "disabled_on_router": false,
+		}
+		if !moveVoucher(&voucher, "Active", updates) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Voucher vừa thay đổi trạng thái, vui lòng thử lại"})
+			return
+		}
+		// Mở khóa tài khoản hotspot đã bị khóa khi hết hạn (voucher RADIUS: lần đăng nhập sau tự hợp lệ)
+		if voucher.ShipID != "" {
+			if err := setHotspotUserAccess(voucher.ShipID, voucher.Code, "", false); err != nil {
+				fmt.Printf("⚠️ Không mở lại voucher %s trên router tàu %s: %v\n", voucher.Code, voucher.ShipID, err)
+			}
+		}
+		c.JSON(http.StatusOK, voucher)
+		return
+	}
+	updates := map[string]interface{}{"valid_days": gorm.Expr("valid_days + ?", req.Days)}
+	if voucher.ExpiresAt != nil {
+		updates["expires_at"] = voucher.ExpiresAt.AddDate(0, 0, req.Days)
+	}
+	result := database.DB.Model(&models.Voucher{}).Where("id = ? AND status = ?", voucher.ID, voucher.Status).Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Voucher vừa thay đổi trạng thái, vui lòng thử lại"})
 		return
 	}
+	database.DB.First(&voucher, voucher.ID)
+	c.JSON(http.StatusOK, voucher)
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Đã gán thành công"})
-}
\ No newline at end of file
+// 6. Xóa voucher (voucher đang dùng phải thu hồi trước)
+func DeleteVoucher(c *gin.Context) {
+	voucher, ok := findVoucher(c)
+	if !ok {
+		return
+	}
+	if voucher.Status == "Active" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Voucher đang được sử dụng, hãy thu hồi trước khi xóa"})
+		return
+	}
+	if err := database.DB.Delete(&voucher).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi xóa dữ liệu"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa thành công", "router_error": unprovisionVoucher(voucher)})
+}
+
+// 7. Lưu lượng của voucher: tổng, theo ngày và các phiên đăng nhập
+func GetVoucherUsage(c *gin.Context) {
+	voucher, ok := findVoucher(c)
+	if !ok {
+		return
+	}
+	var daily []models.UsageDaily
+	database.DB.Where("username = ?", voucher.Code).Order("day").Find(&daily)
+	var sessions []models.UsageSession
+	database.DB.Where("username = ?", voucher.Code).Order("started_at desc").Limit(200).Find(&sessions)
+	c.JSON(http.StatusOK, gin.H{
+		"voucher": voucher, "total_mb": (voucher.BytesIn + voucher.BytesOut) >> 20,
+		"daily": daily, "sessions": sessions,
+	})
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import "testing"
+
+func TestVoucherCanMove(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"Unused", "Assigned", true},
+		{"Unused", "Active", true},
+		{"Unused", "Expired", true},
+		{"Unused", "Revoked", true},
+		{"Assigned", "Active", true},
+		{"Assigned", "Unused", false},
+		{"Assigned", "Revoked", true},
+		{"Active", "Expired", true},
+		{"Active", "Revoked", true},
+		{"Active", "Assigned", false},
+		{"Active", "Unused", false},
+		{"Expired", "Active", true}, // Gia hạn voucher đã hết hạn
+		{"Expired", "Unused", false},
+		{"Expired", "Revoked", false},
+		{"Revoked", "Active", false},
+		{"Revoked", "Unused", false},
+		{"Used", "Active", false}, // Trạng thái cũ trước khi chuyển đổi
+	}
+	for _, tt := range tests {
+		if got := voucherCanMove(tt.from, tt.to); got != tt.want {
+			t.Errorf("voucherCanMove(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"marine-backend/database"
+	"marine-backend/models"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const walletCurrency = "USD"
+
+// Nguồn ghi có / ghi nợ do người dùng nhập (adjustment dùng được cả 2 chiều)
+var walletCredits = map[string]bool{"voucher": true, "purchase": true, "allowance": true, "adjustment": true}
+var walletDebits = map[string]bool{"plan_purchase": true, "overage": true, "adjustment": true}
+
+var errInsufficientBalance = errors.New("Số dư ví không đủ")
+
+// Sổ ví lưu tiền bằng cent (int64) để số dư và file trừ lương khớp tuyệt đối; API nhận số tiền dạng 12.34
+func toCents(amount float64) int64 { return int64(math.Round(amount * 100)) }
+
+func formatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Số dư (cent) trước thời điểm at (nil = hiện tại) = số dư của giao dịch gần nhất
+func walletBalance(db *gorm.DB, crewID uint, at *time.Time) int64 {
+	var last models.WalletTransaction
+	query := db.Where("crew_id = ?", crewID)
+	if at != nil {
+		query = query.Where("created_at < ?", *at)
+	}
+	query.Order("id desc").Limit(1).Find(&last)
+	return last.BalanceCents
+}
+
+// Số dư sau giao dịch = số dư trước + số tiền; ghi nợ không được làm âm ví trừ khi allowNegative
+func chainBalance(previous, amount int64, allowNegative bool) (int64, error) {
+	balance := previous + amount
+	if amount < 0 && balance < 0 && !allowNegative {
+		return previous, errInsufficientBalance
+	}
+	return balance, nil
+}
+
+// Ghi 1 giao dịch vào sổ cái: khóa dòng crew để các giao dịch cùng ví chạy tuần tự, số dư nối tiếp giao dịch trước.
+// Ghi nợ không được làm âm ví trừ khi allowNegative (phí vượt gói, điều chỉnh: trừ lương khi quyết toán)
+func postWalletTx(tx *gorm.DB, entry *models.WalletTransaction, allowNegative bool) (models.Crew, error) {
+	var crew models.Crew
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&crew, entry.CrewID).Error; err != nil {
+		return crew, err
+	}
+	balance, err := chainBalance(walletBalance(tx, crew.ID, nil), entry.AmountCents, allowNegative)
+	if err != nil {
+		return crew, err
+	}
+	entry.BalanceCents = balance
+	entry.ShipID, entry.Currency, entry.CreatedAt = crew.ShipID, walletCurrency, time.Now()
+	return crew, tx.Create(entry).Error
+}
+
+// Lỗi ghi sổ -> HTTP status + thông báo
+func walletError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thuyền viên không tồn tại"})
+	case errors.Is(err, errInsufficientBalance):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+	default:
+		var conflict walletConflict
+		if errors.As(err, &conflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": string(conflict)})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi lưu DB"})
+	}
+}
+
+type walletConflict string
+
+func (e walletConflict) Error() string { return string(e) }
+
+type walletRequest struct {
+	Source      string  `json:"source"`
+	Amount      float64 `json:"amount"`       // USD, làm tròn tới cent
+	VoucherCode string  `json:"voucher_code"` // source = voucher
+	PlanID      uint    `json:"plan_id"`      // source = plan_purchase
+	Reference   string  `json:"reference"`
+	Note        string  `json:"note"`
+}
+
+func crewIDParam(c *gin.Context) uint {
+	id, _ := strconv.Atoi(c.Param("id"))
+	return uint(id)
+}
+
+// 1. GET /api/crew/:id/wallet : số dư + 50 giao dịch gần nhất
+func GetCrewWallet(c *gin.Context) {
+	var crew models.Crew
+	if err := database.DB.First(&crew, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thuyền viên không tồn tại"})
+		return
+	}
+	var txs []models.WalletTransaction
+	database.DB.Where("crew_id = ?", crew.ID).Order("id desc").Limit(50).Find(&txs)
+	c.JSON(http.StatusOK, gin.H{
+		"crew_id": crew.ID, "full_name": crew.FullName, "ship_id": crew.ShipID,
+		"balance_cents": walletBalance(database.DB, crew.ID, nil), "currency": walletCurrency, "transactions": txs,
+	})
+}
+
+// 2. POST /api/crew/:id/wallet/credit {source: voucher|purchase|allowance|adjustment, amount, voucher_code, reference, note}
+// Voucher: nạp giá trị gói của voucher chưa dùng (cùng tàu), voucher chuyển sang Assigned cho thuyền viên
+func CreditCrewWallet(c *gin.Context) {
+	var req walletRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !walletCredits[req.Source] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nguồn ghi có phải là voucher, purchase, allowance hoặc adjustment"})
+		return
+	}
+	if req.Source != "voucher" && toCents(req.Amount) <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Số tiền phải lớn hơn 0"})
+		return
+	}
+	entry := models.WalletTransaction{
+		CrewID: crewIDParam(c), Source: req.Source, AmountCents: toCents(req.Amount),
+		Reference: req.Reference, Note: req.Note, CreatedBy: c.GetString("username"),
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Source != "voucher" {
+			_, err := postWalletTx(tx, &entry, false)
+			return err
+		}
+		var voucher models.Voucher
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", strings.TrimSpace(req.VoucherCode)).First(&voucher).Error; err != nil {
+			return walletConflict("Voucher không tồn tại")
+		}
+		if voucher.Status != "Unused" || voucher.CrewID != 0 {
+			return walletConflict("Voucher đang ở trạng thái " + voucher.Status + ", không thể nạp")
+		}
+		plan := lookupPlan(voucher.PlanID, voucher.DataPlan)
+		if plan == nil || plan.Price <= 0 || (plan.Currency != "" && plan.Currency != walletCurrency) {
+			return walletConflict("Voucher không có giá trị " + walletCurrency + " để nạp")
+		}
+		entry.AmountCents, entry.Reference = toCents(plan.Price), voucher.Code
+		crew, err := postWalletTx(tx, &entry, false)
+		if err != nil {
+			return err
+		}
+		if voucher.ShipID != "" && voucher.ShipID != crew.ShipID {
+			return walletConflict("Voucher phát hành cho tàu " + voucher.ShipID + ", thuyền viên thuộc tàu khác")
+		}
+		return tx.Model(&voucher).Updates(map[string]interface{}{
+			"status": "Assigned", "crew_id": crew.ID, "assign_to": crew.FullName, "used_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		walletError(c, err)
+		return
+	}
+	if req.Source == "voucher" {
+		unprovisionVoucher(models.Voucher{Code: entry.Reference, ShipID: entry.ShipID})
+	}
+	recordAudit(c, fmt.Sprintf("Wallet credit %s %s %s to crew #%d", entry.Source, formatCents(entry.AmountCents), walletCurrency, entry.CrewID), "Success")
+	c.JSON(http.StatusCreated, entry)
+}
+
+// 3. POST /api/crew/:id/wallet/debit {source: plan_purchase|overage|adjustment, amount, plan_id, reference, note}
+// Mua gói: trừ giá gói (không được âm ví) và nạp dung lượng gói vào chu kỳ hiện tại
+func DebitCrewWallet(c *gin.Context) {
+	var req walletRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !walletDebits[req.Source] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nguồn ghi nợ phải là plan_purchase, overage hoặc adjustment"})
+		return
+	}
+	entry := models.WalletTransaction{
+		CrewID: crewIDParam(c), Source: req.Source, AmountCents: -toCents(req.Amount),
+		Reference: req.Reference, Note: req.Note, CreatedBy: c.GetString("username"),
+	}
+
+	var plan models.BandwidthPlan
+	if req.Source == "plan_purchase" {
+		if err := database.DB.First(&plan, req.PlanID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Gói cước không tồn tại"})
+			return
+		}
+		if plan.Status == "Inactive" || plan.Price <= 0 || (plan.Currency != "" && plan.Currency != walletCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Gói không bán được qua ví (" + walletCurrency + ")"})
+			return
+		}
+		entry.AmountCents, entry.Reference = -toCents(plan.Price), plan.Name
+	} else if entry.AmountCents >= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Số tiền phải lớn hơn 0"})
+		return
+	}
+
+	var crew models.Crew
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		crew, err = postWalletTx(tx, &entry, req.Source != "plan_purchase")
+		return err
+	})
+	if err != nil {
+		walletError(c, err)
+		return
+	}
+
+	if bytes := plan.DataAllowanceMB << 20; bytes > 0 {
+		quotaMu.Lock()
+		cfg := currentQuotaConfig()
+		st := loadQuotaState(crew, cfg, time.Now())
+		st.TopupBytes += bytes
+		addCrewUsageEvent(st, "topup", fmt.Sprintf("Mua gói %s bằng ví (+%d MB)", plan.Name, plan.DataAllowanceMB))
+		evaluateQuota(&st, crew, cfg)
+		st.UpdatedAt = time.Now()
+		database.DB.Save(&st)
+		quotaMu.Unlock()
+	}
+	recordAudit(c, fmt.Sprintf("Wallet debit %s %s %s from crew #%d", entry.Source, formatCents(-entry.AmountCents), walletCurrency, entry.CrewID), "Success")
+	c.JSON(http.StatusCreated, entry)
+}
+
+// 4. POST /api/wallet-transactions/:id/reverse {note} : đảo giao dịch sai (giao dịch gốc giữ nguyên)
+func ReverseWalletTransaction(c *gin.Context) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	c.ShouldBindJSON(&req)
+	var original models.WalletTransaction
+	if err := database.DB.First(&original, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Giao dịch không tồn tại"})
+		return
+	}
+	if original.ReversalOf != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Không đảo được giao dịch đảo"})
+		return
+	}
+	entry := models.WalletTransaction{
+		CrewID: original.CrewID, Source: "reversal", AmountCents: -original.AmountCents, ReversalOf: &original.ID,
+		Reference: fmt.Sprintf("TX-%d", original.ID), Note: req.Note, CreatedBy: c.GetString("username"),
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		tx.Model(&models.WalletTransaction{}).Where("reversal_of = ?", original.ID).Count(&count)
+		if count > 0 {
+			return walletConflict("Giao dịch đã được đảo")
+		}
+		_, err := postWalletTx(tx, &entry, true)
+		return err
+	})
+	if err != nil {
+		walletError(c, err)
+		return
+	}
+	recordAudit(c, fmt.Sprintf("Reversed wallet transaction #%d of crew #%d", original.ID, original.CrewID), "Success")
+	c.JSON(http.StatusCreated, entry)
+}
+
+// 5. GET /api/crew/:id/wallet/statement?month=YYYY-MM : sao kê tháng (số dư đầu / cuối kỳ, tổng có / nợ)
+func GetWalletStatement(c *gin.Context) {
+	start, end, err := queryMonth(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var crew models.Crew
+	if err := database.DB.First(&crew, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thuyền viên không tồn tại"})
+		return
+	}
+	var txs []models.WalletTransaction
+	database.DB.Where("crew_id = ? AND created_at >= ? AND created_at < ?", crew.ID, start, end).Order("id").Find(&txs)
+
+	opening := walletBalance(database.DB, crew.ID, &start)
+	credits, debits, bySource := walletTotals(txs)
+	c.JSON(http.StatusOK, gin.H{
+		"crew_id": crew.ID, "full_name": crew.FullName, "rank": crew.Rank, "ship_id": crew.ShipID,
+		"month": start.Format("2006-01"), "currency": walletCurrency,
+		"opening_balance_cents": opening, "total_credits_cents": credits, "total_debits_cents": debits,
+		"closing_balance_cents": opening + credits - debits, "by_source_cents": bySource, "transactions": txs,
+	})
+}
+
+// Tổng ghi có / ghi nợ (cent, cùng dương) và tổng theo nguồn của các giao dịch
+func walletTotals(txs []models.WalletTransaction) (int64, int64, map[string]int64) {
+	var credits, debits int64
+	bySource := map[string]int64{}
+	for _, t := range txs {
+		if t.AmountCents > 0 {
+			credits += t.AmountCents
+		} else {
+			debits -= t.AmountCents
+		}
+		bySource[t.Source] += t.AmountCents
+	}
+	return credits, debits, bySource
+}
+
+// Bút toán quyết toán đưa ví về 0: ví âm -> ghi có (trừ lương), ví dương -> ghi nợ (hoàn tiền)
+func settlementEntry(balance int64) (int64, string) {
+	switch {
+	case balance < 0:
+		return -balance, "Trừ lương khi quyết toán"
+	case balance > 0:
+		return -balance, "Hoàn tiền khi quyết toán"
+	}
+	return 0, ""
+}
+
+// 6. POST /api/crew/:id/wallet/settle {reference} : quyết toán khi rời tàu, đưa ví về 0
+// (ví âm -> trừ lương, ví dương -> hoàn tiền)
+func SettleCrewWallet(c *gin.Context) {
+	var req struct {
+		Reference string `json:"reference"`
+	}
+	c.ShouldBindJSON(&req)
+	if req.Reference == "" {
+		req.Reference = "SIGNOFF-" + time.Now().Format("20060102")
+	}
+	entry := models.WalletTransaction{
+		CrewID: crewIDParam(c), Source: "settlement", Reference: req.Reference, CreatedBy: c.GetString("username"),
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Khóa trước khi đọc số dư để không lệch với giao dịch đang ghi
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Crew{}, entry.CrewID).Error; err != nil {
+			return err
+		}
+		entry.AmountCents, entry.Note = settlementEntry(walletBalance(tx, entry.CrewID, nil))
+		if entry.AmountCents == 0 {
+			return nil
+		}
+		_, err := postWalletTx(tx, &entry, true)
+		return err
+	})
+	if err != nil {
+		walletError(c, err)
+		return
+	}
+	if entry.ID == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "Ví đã về 0, không cần quyết toán", "deduction_cents": 0, "refund_cents": 0})
+		return
+	}
+	recordAudit(c, fmt.Sprintf("Settled wallet of crew #%d: %s %s", entry.CrewID, formatCents(entry.AmountCents), walletCurrency), "Success")
+	c.JSON(http.StatusCreated, gin.H{
+		"transaction": entry, "deduction_cents": max(entry.AmountCents, 0), "refund_cents": max(-entry.AmountCents, 0),
+	})
+}
+
+// 7. GET /api/wallet/payroll?month=YYYY-MM&ship_id=&company=&format=csv|json
+// Khoản trừ lương theo thuyền viên: đã quyết toán trong tháng + nợ còn lại cuối tháng
+func ExportPayrollDeductions(c *gin.Context) {
+	start, end, err := queryMonth(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ships := []models.Ship{}
+	query := database.DB.Order("id")
+	if shipID := c.Query("ship_id"); shipID != "" {
+		query = query.Where("id = ?", shipID)
+	}
+	if company := c.Query("company"); company != "" {
+		query = query.Where("company = ?", company)
+	}
+	query.Find(&ships)
+
+	type payrollRow struct {
+		ShipID           string `json:"ship_id"`
+		ShipName         string `json:"ship_name"`
+		CrewID           uint   `json:"crew_id"`
+		FullName         string `json:"full_name"`
+		Rank             string `json:"rank"`
+		Username         string `json:"username"`
+		SettledCents     int64  `json:"settled_cents"`
+		OutstandingCents int64  `json:"outstanding_cents"`
+		DeductionCents   int64  `json:"deduction_cents"`
+	}
+	rows := []payrollRow{}
+	for _, ship := range ships {
+		var crews []models.Crew
+		database.DB.Where("ship_id = ?", ship.ID).Order("full_name").Find(&crews)
+		for _, crew := range crews {
+			var settled int64
+			database.DB.Model(&models.WalletTransaction{}).
+				Where("crew_id = ? AND source = ? AND amount_cents > 0 AND created_at >= ? AND created_at < ?", crew.ID, "settlement", start, end).
+				Select("COALESCE(SUM(amount_cents), 0)").Scan(&settled)
+			var outstanding int64
+			if balance := walletBalance(database.DB, crew.ID, &end); balance < 0 {
+				outstanding = -balance
+			}
+			if settled == 0 && outstanding == 0 {
+				continue
+			}
+			rows = append(rows, payrollRow{
+				ShipID: ship.ID, ShipName: ship.Name, CrewID: crew.ID, FullName: crew.FullName, Rank: crew.Rank,
+				Username: crew.Username, SettledCents: settled, OutstandingCents: outstanding, DeductionCents: settled + outstanding,
+			})
+		}
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, gin.H{"month": start.Format("2006-01"), "currency": walletCurrency, "items": rows})
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=Payroll-%s.csv", start.Format("2006-01")))
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"Month", "Ship ID", "Ship", "Crew ID", "Full name", "Rank", "Username", "Settled", "Outstanding", "Deduction", "Currency"})
+	for _, r := range rows {
+		w.Write([]string{
+			start.Format("2006-01"), r.ShipID, r.ShipName, strconv.Itoa(int(r.CrewID)), r.FullName, r.Rank, r.Username,
+			formatCents(r.SettledCents), formatCents(r.OutstandingCents), formatCents(r.DeductionCents), walletCurrency,
+		})
+	}
+	w.Flush()
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"marine-backend/models"
+	"testing"
+)
+
+func TestChainBalance(t *testing.T) {
+	// Chuỗi giao dịch của 1 ví: mỗi số dư nối tiếp số dư của giao dịch trước
+	steps := []struct {
+		name          string
+		source        string
+		amount        int64
+		allowNegative bool
+		want          int64
+		wantErr       error
+	}{
+		{"nạp voucher", "voucher", 2500, false, 2500, nil},
+		{"mua gói vượt số dư -> từ chối", "plan_purchase", -3000, false, 2500, errInsufficientBalance},
+		{"mua gói", "plan_purchase", -2000, false, 500, nil},
+		{"phí vượt gói được phép âm", "overage", -1234, true, -734, nil},
+		{"đảo phí vượt gói", "reversal", 1234, true, 500, nil},
+		{"điều chỉnh trừ", "adjustment", -800, true, -300, nil},
+		{"ghi có khi ví âm", "allowance", 100, false, -200, nil},
+	}
+	balance := int64(0)
+	var posted []models.WalletTransaction
+	for _, st := range steps {
+		got, err := chainBalance(balance, st.amount, st.allowNegative)
+		if !errors.Is(err, st.wantErr) || got != st.want {
+			t.Fatalf("%s: chainBalance(%d, %d) = %d, %v, want %d, %v", st.name, balance, st.amount, got, err, st.want, st.wantErr)
+		}
+		if err == nil {
+			posted = append(posted, models.WalletTransaction{Source: st.source, AmountCents: st.amount, BalanceCents: got})
+		}
+		balance = got
+	}
+
+	// Sao kê: số dư đầu (0) + có - nợ = số dư của giao dịch cuối
+	credits, debits, bySource := walletTotals(posted)
+	if credits != 3834 || debits != 4034 {
+		t.Errorf("walletTotals() = có %d, nợ %d, want 3834, 4034", credits, debits)
+	}
+	if closing := credits - debits; closing != posted[len(posted)-1].BalanceCents {
+		t.Errorf("số dư cuối kỳ = %d, want %d", closing, posted[len(posted)-1].BalanceCents)
+	}
+	if bySource["overage"]+bySource["reversal"] != 0 || bySource["plan_purchase"] != -2000 {
+		t.Errorf("by_source = %v", bySource)
+	}
+}
+
+func TestSettlementEntry(t *testing.T) {
+	tests := []struct {
+		name       string
+		balance    int64
+		wantAmount int64
+		wantNote   string
+	}{
+		{"ví âm -> trừ lương", -300, 300, "Trừ lương khi quyết toán"},
+		{"ví dương -> hoàn tiền", 1250, -1250, "Hoàn tiền khi quyết toán"},
+		{"ví bằng 0 -> không ghi", 0, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, note := settlementEntry(tt.balance)
+			if amount != tt.wantAmount || note != tt.wantNote {
+				t.Errorf("settlementEntry(%d) = %d, %q, want %d, %q", tt.balance, amount, note, tt.wantAmount, tt.wantNote)
+			}
+			// Quyết toán luôn được ghi (kể cả làm âm ví) và đưa ví về 0
+			if after, err := chainBalance(tt.balance, amount, true); err != nil || after != 0 {
+				t.Errorf("số dư sau quyết toán = %d, %v, want 0", after, err)
+			}
+		})
+	}
+}
+
+func TestFormatCents(t *testing.T) {
+	tests := []struct {
+		cents int64
+		want  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1234, "12.34"},
+		{-734, "-7.34"},
+		{-5, "-0.05"},
+	}
+	for _, tt := range tests {
+		if got := formatCents(tt.cents); got != tt.want {
+			t.Errorf("formatCents(%d) = %s, want %s", tt.cents, got, tt.want)
+		}
+	}
+	// Làm tròn tới cent, không cắt phần lẻ dấu phẩy động
+	for amount, want := range map[float64]int64{12.34: 1234, 0.1 + 0.2: 30, 19.999: 2000, -4.5: -450} {
+		if got := toCents(amount); got != want {
+			t.Errorf("toCents(%v) = %d, want %d", amount, got, want)
+		}
+	}
+}
@@ -28,8 +28,28 @@ func Connect() {
 		log.Fatal("❌ Kết nối DB thất bại:", err)
 	}
 
+	// Mã voucher cũ (VOU-%05d) có thể trùng: đổi tên bản trùng trước khi tạo unique index
+	if err := dedupeVoucherCodes(); err != nil {
+		fmt.Println("❌ Không xử lý được mã voucher trùng:", err)
+		os.Exit(1)
+	}
+
 	// Tự động tạo bảng nếu chưa có (Migration)
-	DB.AutoMigrate(&models.Ship{}, &models.User{}, &models.Crew{}, &models.Voucher{}, &models.BandwidthPlan{}, &models.SystemConfig{}, &models.AuditLog{})
+	err = DB.AutoMigrate(&models.Ship{}, &models.User{}, &models.Crew{}, &models.Voucher{}, &models.BandwidthPlan{}, &models.SystemConfig{}, &models.AuditLog{},
+		&models.NotificationRule{}, &models.NotificationLog{}, &models.ShipStatusEvent{},
+		&models.ShipPosition{}, &models.Geofence{}, &models.ShipGeofenceState{}, &models.GeofenceEvent{},
+		&models.LinkSample{}, &models.BeamHandover{}, &models.ShipLink{}, &models.LinkSwitchEvent{},
+		&models.LinkUsage{}, &models.InterfaceCounter{}, &models.WelfareUsage{}, &models.Tariff{},
+		&models.AppCategoryRule{}, &models.TrafficAggregate{},
+		&models.UsageSession{}, &models.UsageDaily{}, &models.HotspotUserCounter{},
+		&models.QuotaState{}, &models.CrewUsageEvent{}, &models.PlanDeployment{},
+		&models.QosPolicy{}, &models.ShipQosState{}, &models.VoucherBatch{}, &models.WalletTransaction{},
+		&models.AllowancePolicy{}, &models.AllowanceGrant{},
+		&models.ServiceRate{}, &models.Invoice{}, &models.InvoiceLine{})
+	if err != nil {
+		fmt.Println("❌ Migration thất bại:", err)
+		os.Exit(1)
+	}
 
 	// Cấu hình Connection Pool
 	sqlDB, _ := DB.DB()
@@ -38,4 +58,21 @@ func Connect() {
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	fmt.Println("✅ Kết nối Database GORM thành công!")
-}
\ No newline at end of file
+}
+
+// Giữ bản ghi đầu tiên của mỗi mã, các bản trùng đổi thành <mã>-D<id>
+func dedupeVoucherCodes() error {
+	if !DB.Migrator().HasTable("vouchers") {
+		return nil
+	}
+	result := DB.Exec(`UPDATE vouchers v SET code = v.code || '-D' || v.id
+		FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY code ORDER BY id) AS rn FROM vouchers) d
+		WHERE v.id = d.id AND d.rn > 1`)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		fmt.Printf("⚠️ Đã đổi mã %d voucher trùng (thêm hậu tố -D<id>)\n", result.RowsAffected)
+	}
+	return nil
+}
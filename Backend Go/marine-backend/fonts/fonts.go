@@ -0,0 +1,15 @@
+// Package fonts nhúng font DejaVu Sans Condensed (UTF-8, đủ dấu tiếng Việt) cho các file PDF xuất ra.
+//
+// Font lấy nguyên bản từ gofpdf v1.16.2, giấy phép DejaVu Fonts License (https://dejavu-fonts.github.io/License.html).
+package fonts
+
+import _ "embed"
+
+//go:embed DejaVuSansCondensed.ttf
+var Regular []byte
+
+//go:embed DejaVuSansCondensed-Bold.ttf
+var Bold []byte
+
+//go:embed DejaVuSansCondensed-Oblique.ttf
+var Italic []byte
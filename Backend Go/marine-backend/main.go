@@ -18,7 +18,20 @@ func main() {
 
 	// 3. Init Data & Workers
 	controllers.SeedAdmin()
-	go controllers.StartSimulation()
+	controllers.MigratePlanReferences()
+	controllers.MigrateVoucherStatus()
+	go controllers.StartShipMonitor()
+	go controllers.StartNotificationWorker()
+	go controllers.StartSessionWatcher()
+	go controllers.StartTerminalPoller()
+	go controllers.StartSdwanMonitor()
+	go controllers.StartLinkUsageCollector()
+	go controllers.StartNetflowCollector()
+	go controllers.StartQuotaWorker()
+	go controllers.StartVoucherExpiryWorker()
+	controllers.StartRadiusServer()
+	go controllers.StartScenarioSimulator() // Chỉ chạy khi có SIMULATOR_SCENARIO
+	controllers.StartAISListener()
 
 	// 4. Start Server (Gin)
 	r := routes.SetupRouter()
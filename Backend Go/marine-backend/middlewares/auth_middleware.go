@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Xác thực JWT (Bearer token) và lưu thông tin người dùng vào context
+// EventSource của trình duyệt không gửi được header -> chấp nhận thêm ?token=
+func AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" {
+			tokenString = c.Query("token")
+		}
+		if tokenString == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Thiếu token"})
+			return
+		}
+
+		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+			return []byte(os.Getenv("JWT_KEY")), nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+		if err != nil || !token.Valid {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token không hợp lệ"})
+			return
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token không hợp lệ"})
+			return
+		}
+
+		username, _ := claims["username"].(string)
+		role, _ := claims["role"].(string)
+		company, _ := claims["company"].(string)
+		c.Set("username", username)
+		c.Set("role", role)
+		c.Set("company", company)
+		c.Next()
+	}
+}
+
+// Chỉ cho tài khoản Admin (đặt sau AuthRequired)
+func AdminRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != "Admin" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Chỉ Admin được thực hiện thao tác này"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWT gửi qua ?token= (EventSource) không được ghi ra access log
+var tokenQueryPattern = regexp.MustCompile(`([?&]token=)[^&]*`)
+
+func redactToken(path string) string {
+	return tokenQueryPattern.ReplaceAllString(path, "${1}***")
+}
+
+// Access log như gin.Logger() nhưng che token trên query string
+func RequestLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(p gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			p.TimeStamp.Format("2006/01/02 - 15:04:05"), p.StatusCode, p.Latency, p.ClientIP, p.Method, redactToken(p.Path), p.ErrorMessage)
+	})
+}
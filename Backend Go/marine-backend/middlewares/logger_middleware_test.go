@@ -0,0 +1,21 @@
+package middlewares
+
+import "testing"
+
+func TestRedactToken(t *testing.T) {
+	tests := []struct {
+		name, path, want string
+	}{
+		{"không có query", "/api/ships", "/api/ships"},
+		{"chỉ có token", "/api/stream?token=eyJhbGci.x.y", "/api/stream?token=***"},
+		{"token ở giữa", "/api/stream?types=ship&token=eyJ.a.b&x=1", "/api/stream?types=ship&token=***&x=1"},
+		{"tham số khác tên token", "/api/vouchers?mytoken=abc", "/api/vouchers?mytoken=abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactToken(tt.path); got != tt.want {
+				t.Errorf("redactToken() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // 1. Tàu (Ship) - Đã có thông tin Router
 type Ship struct {
@@ -16,12 +21,49 @@ type Ship struct {
 	Lon       float64   `json:"lon"`
 	SNR       float64   `json:"snr"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Hành trình (cập nhật từ ship_positions)
+	SpeedKn    float64    `json:"speed_kn"`
+	Course     float64    `json:"course"`
+	PositionAt *time.Time `json:"position_at"`
+
+	// AIS / NMEA
+	MMSI        string     `json:"mmsi" gorm:"index"`
+	CallSign    string     `json:"call_sign"`
+	Heading     float64    `json:"heading"`
+	NavStatus   int        `json:"nav_status"`
+	Destination string     `json:"destination"`
+	ETA         *time.Time `json:"eta"`
+	Draught     float64    `json:"draught"`
+	NmeaSource  string     `json:"nmea_source"` // IP thiết bị gửi câu GPS của tàu
+
+	// SD-WAN: link ưu tiên (tên hoặc loại link, có thể đổi tự động theo Geofence), chế độ riêng của tàu, link đang chạy
+	PrimaryLink string `json:"primary_link"`
+	SdwanMode   string `json:"sdwan_mode"` // Rỗng = theo cấu hình hệ thống
+	ActiveLink  string `json:"active_link"`
+
+	// Giám sát trạng thái (Heartbeat)
+	LastSeenAt      *time.Time `json:"last_seen_at"`
+	LastSeenSource  string     `json:"last_seen_source"` // agent / router / telemetry
+	StatusChangedAt time.Time  `json:"status_changed_at"`
+	ModemLock       *bool      `json:"modem_lock"` // nil = modem chưa báo trạng thái khóa tín hiệu
+
+	// Thiết bị vệ tinh (đọc telemetry qua adapter: starlink / idirect / snmp)
+	TerminalType   string  `json:"terminal_type"`
+	TerminalAddr   string  `json:"terminal_addr"`
+	TerminalSecret string  `json:"-"` // Token HTTP hoặc SNMP community
+	LatencyMs      float64 `json:"latency_ms"`
+	ObstructionPct float64 `json:"obstruction_pct"`
+	UplinkState    string  `json:"uplink_state"` // up / down / obstructed / muted
+	AgentToken      string     `json:"-"` // Token cho agent trên tàu gửi heartbeat
 	
 	// Thông tin quản lý Router MikroTik
 	RouterIP   string `json:"router_ip"`
 	RouterPort int    `json:"router_port"`
 	RouterUser string `json:"router_user"`
 	RouterPass string `json:"-"` // Không trả về JSON
+	FlowExporter string `json:"flow_exporter"` // IP nguồn gửi NetFlow/IPFIX nếu khác RouterIP (NAT / IP quản lý)
+	RadiusSecret string `json:"-"`             // Shared secret RADIUS riêng của tàu (rỗng = RADIUS_SECRET)
 
 	Crews     []Crew    `json:"crews" gorm:"foreignKey:ShipID"`
 }
@@ -34,24 +76,37 @@ type Crew struct {
 	Rank        string    `json:"rank"`
 	Nationality string    `json:"nationality"`
 	Username    string    `json:"username"`
-	DataPlan    string    `json:"data_plan"`
+	Email       string    `json:"email"` // Dùng gửi thông báo (VD: thuyền trưởng)
+	HotspotPassword string `json:"-"` // Mật khẩu đăng nhập hotspot (RADIUS PAP/CHAP cần bản rõ), không trả ra API
+	PlanID      *uint     `json:"plan_id" gorm:"index"`
+	DataPlan    string    `json:"data_plan"` // Tên gói (hiển thị), đồng bộ theo PlanID
 	DataUsage   float64   `json:"data_usage"`
 	Status      string    `json:"status"`
 	CreatedAt   time.Time `json:"created_at"`
+	SignOnAt    *time.Time `json:"sign_on_at"` // Ngày lên tàu (tính tỉ lệ phụ cấp chu kỳ đầu), nil = CreatedAt
+	Language    string    `json:"language"` // Ngôn ngữ thông báo: vi / en (rỗng = theo cấu hình hệ thống)
 }
 
 // 3. Voucher
 type Voucher struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
-	Code      string    `json:"code"`
-	DataPlan  string    `json:"data_plan"`
-	Status    string    `json:"status"`
+	Code      string    `json:"code" gorm:"uniqueIndex"`
+	PlanID    *uint     `json:"plan_id" gorm:"index"`
+	BatchID   *uint     `json:"batch_id" gorm:"index"`
+	DataPlan  string    `json:"data_plan"` // Tên gói (hiển thị), đồng bộ theo PlanID
+	Status    string    `json:"status"` // Unused -> Assigned -> Active -> Expired / Revoked
+	ShipID    string    `json:"ship_id" gorm:"index"` // Tàu phát hành (rỗng = dùng được trên mọi tàu qua RADIUS)
 	CreatedBy string    `json:"created_by"`
 	AssignTo  string    `json:"assign_to"`
 	CrewID    uint      `json:"crew_id"`
 	UsedAt    time.Time `json:"used_at"`
 	CreatedAt time.Time `json:"created_at"`
 	ValidDays int       `json:"valid_days"`
+
+	ExpiresAt        *time.Time `json:"expires_at" gorm:"index"` // = lần đăng nhập đầu + ValidDays (nil = không hết hạn / chưa dùng)
+	BytesIn          int64      `json:"bytes_in"`
+	BytesOut         int64      `json:"bytes_out"`
+	DisabledOnRouter bool       `json:"disabled_on_router"` // Đã khóa / gỡ user hotspot sau khi hết hạn / thu hồi
 }
 
 // 4. Gói Băng thông (BandwidthPlan)
@@ -67,6 +122,14 @@ type BandwidthPlan struct {
 	LimitAt        string    `json:"limit_at"`
 	Status         string    `json:"status"`
 	CreatedAt      time.Time `json:"created_at"`
+
+	ProfileName     string  `json:"profile_name" gorm:"index"` // Tên profile trên MikroTik, giữ nguyên khi đổi tên gói
+	DataAllowanceMB int64   `json:"data_allowance_mb"`         // 0 = không giới hạn
+	ValidityDays    int     `json:"validity_days"`             // Hạn dùng mặc định của voucher theo gói
+	Price           float64 `json:"price"`
+	Currency        string  `json:"currency"`
+	ShipIDs         string  `json:"ship_ids"` // Tàu áp dụng: rỗng = mọi tàu; danh sách phân tách dấu phẩy
+	Company         string  `json:"company"`  // Rỗng = mọi công ty
 }
 
 // 5. Admin User
@@ -75,6 +138,7 @@ type User struct {
 	Password string `json:"-"`
 	FullName string `json:"full_name"`
 	Role     string `json:"role"`
+	Company  string `json:"company"` // Chỉ xem tàu của công ty này; Admin xem toàn bộ đội tàu, tài khoản khác để rỗng thì không thấy tàu nào
 }
 
 // 6. Input Structs
@@ -102,7 +166,11 @@ type SystemConfig struct {
 	// Alert Config
 	SnrThreshold  float64 `json:"snr_threshold"`
 	QuotaWarning  int     `json:"quota_warning"`
+	QuotaAction       string `json:"quota_action"`        // Khi hết dung lượng: throttle / disconnect / topup
+	QuotaFallbackPlan string `json:"quota_fallback_plan"` // Gói (profile) tốc độ thấp khi throttle
+	BillingCycleDay   int    `json:"billing_cycle_day"`   // Ngày bắt đầu chu kỳ tính dung lượng (1-28)
 	Recipients    string  `json:"recipients"`
+	NotifyLanguage string `json:"notify_language"` // Ngôn ngữ mặc định của thông báo: vi / en
 	
 	// Integration
 	StarlinkApiKey string `json:"starlink_api_key"`
@@ -117,4 +185,468 @@ type AuditLog struct {
 	IPAddress string    `json:"ip_address"` // IP người dùng
 	Status    string    `json:"status"`    // Success/Failed
 	CreatedAt time.Time `json:"created_at"` // Thời gian
-}
\ No newline at end of file
+}
+// 9. Quy tắc định tuyến thông báo (Notification Rules)
+type NotificationRule struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name"`
+	ShipID      string    `json:"ship_id"`      // Rỗng = áp dụng mọi tàu
+	Company     string    `json:"company"`      // Rỗng = áp dụng mọi công ty
+	MinSeverity string    `json:"min_severity"` // info / warning / critical
+	Events      string    `json:"events"`       // Danh sách sự kiện, phân tách dấu phẩy (rỗng = tất cả)
+	Channel     string    `json:"channel"`      // email / webhook
+	Target      string    `json:"target"`       // Danh sách email hoặc URL webhook
+	Secret      string    `json:"secret"`       // Khóa ký HMAC cho webhook
+	Language    string    `json:"language"`     // vi / en
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// 10. Nhật ký gửi thông báo (Delivery Log)
+type NotificationLog struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	RuleID        uint       `json:"rule_id"`
+	Channel       string     `json:"channel"`
+	Target        string     `json:"target"`
+	Event         string     `json:"event"`
+	Severity      string     `json:"severity"`
+	ShipID        string     `json:"ship_id"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body"`
+	Payload       string     `json:"-"` // JSON gửi cho webhook
+	Status        string     `json:"status"` // Pending / Retrying / Sent / Failed
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// 11. Lịch sử chuyển trạng thái tàu (Online / Degraded / Offline)
+type ShipStatusEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ShipID     string    `json:"ship_id" gorm:"index"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// 12. Lịch sử vị trí tàu (Voyage History)
+type ShipPosition struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ShipID     string    `json:"ship_id" gorm:"uniqueIndex:idx_ship_position_time"`
+	Lat        float64   `json:"lat"`
+	Lon        float64   `json:"lon"`
+	SpeedKn    float64   `json:"speed_kn"`
+	Course     float64   `json:"course"`
+	Source     string    `json:"source"` // agent / nmea / ais / simulator
+	RecordedAt time.Time `json:"recorded_at" gorm:"uniqueIndex:idx_ship_position_time"` // 1 điểm / tàu / thời điểm (RMC + GGA cùng giây)
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// 13. Vùng địa lý (Geofence): cảng, khu neo đậu, vùng rủi ro cao, vùng mất phủ sóng
+type Geofence struct {
+	ID        uint             `json:"id" gorm:"primaryKey"`
+	Name      string           `json:"name"`
+	Kind      string           `json:"kind"`                             // port / anchorage / high_risk / coverage_gap / custom
+	Polygon   [][2]float64     `json:"polygon" gorm:"serializer:json"`   // Các đỉnh [lat, lon]
+	ShipIDs   string           `json:"ship_ids"`                         // Rỗng = mọi tàu; danh sách phân tách dấu phẩy
+	Company   string           `json:"company"`                          // Rỗng = mọi công ty
+	OnEnter   []GeofenceAction `json:"on_enter" gorm:"serializer:json"`
+	OnExit    []GeofenceAction `json:"on_exit" gorm:"serializer:json"`
+	Enabled   bool             `json:"enabled"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// Hành động khi tàu vào / ra vùng
+type GeofenceAction struct {
+	Type     string          `json:"type"`               // switch_link / firewall_policy / alert / notify_captain
+	Link     string          `json:"link,omitempty"`     // switch_link: tên hoặc loại link (VD: 4g_lte, port_wifi)
+	Firewall *FirewallPolicy `json:"firewall,omitempty"` // firewall_policy
+	Severity string          `json:"severity,omitempty"` // alert: info / warning / critical
+	Message  string          `json:"message,omitempty"`  // alert / notify_captain
+}
+
+// Chính sách chặn ứng dụng đẩy xuống router
+type FirewallPolicy struct {
+	BlockYoutube  bool `json:"block_youtube"`
+	BlockFacebook bool `json:"block_facebook"`
+	BlockTiktok   bool `json:"block_tiktok"`
+	BlockTorrent  bool `json:"block_torrent"`
+}
+
+// Trạng thái tàu đang ở trong vùng nào (tránh báo vào/ra lặp lại)
+type ShipGeofenceState struct {
+	ShipID     string    `json:"ship_id" gorm:"primaryKey"`
+	GeofenceID uint      `json:"geofence_id" gorm:"primaryKey"`
+	Inside     bool      `json:"inside"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// 14. Lịch sử vào / ra vùng và kết quả thực hiện hành động
+type GeofenceEvent struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	GeofenceID   uint      `json:"geofence_id" gorm:"index"`
+	GeofenceName string    `json:"geofence_name"`
+	ShipID       string    `json:"ship_id" gorm:"index"`
+	Type         string    `json:"type"` // enter / exit
+	Lat          float64   `json:"lat"`
+	Lon          float64   `json:"lon"`
+	Result       string    `json:"result"` // Tóm tắt kết quả từng hành động
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+}
+
+// 15. Lịch sử chất lượng đường truyền vệ tinh (mỗi heartbeat / telemetry)
+type LinkSample struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ShipID     string    `json:"ship_id" gorm:"index:idx_link_sample_time"`
+	Satellite  string    `json:"satellite" gorm:"index:idx_link_sample_beam"`
+	Beam       string    `json:"beam" gorm:"index:idx_link_sample_beam"`
+	SNR        *float64  `json:"snr"`        // nil = nguồn không đo SNR
+	ModemLock  *bool     `json:"modem_lock"` // nil = không rõ
+	LatencyMs      *float64 `json:"latency_ms"`
+	ObstructionPct *float64 `json:"obstruction_pct"`
+	UplinkState    string   `json:"uplink_state"`
+	Source     string    `json:"source"`     // agent / router / telemetry / simulator
+	RecordedAt time.Time `json:"recorded_at" gorm:"index:idx_link_sample_time"`
+}
+
+// 16. Chuyển beam / vệ tinh (Beam Handover)
+type BeamHandover struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	ShipID        string    `json:"ship_id" gorm:"index"`
+	FromSatellite string    `json:"from_satellite"`
+	FromBeam      string    `json:"from_beam"`
+	ToSatellite   string    `json:"to_satellite"`
+	ToBeam        string    `json:"to_beam"`
+	SNRBefore     float64   `json:"snr_before"`
+	Lat           float64   `json:"lat"`
+	Lon           float64   `json:"lon"`
+	CreatedAt     time.Time `json:"created_at" gorm:"index"`
+}
+
+// 17. Đường truyền của tàu (VSAT Ka, LEO, 4G/LTE khi ở cảng, ...)
+type ShipLink struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	ShipID      string     `json:"ship_id" gorm:"index"`
+	Name        string     `json:"name"`       // Duy nhất trong 1 tàu, dùng làm comment MARINE_LINK:<name> trên router
+	Kind        string     `json:"kind"`       // vsat_ka / l_band / starlink / 4g_lte / port_wifi
+	Interface   string     `json:"interface"`  // Cổng WAN trên router (VD: ether1, lte1)
+	Gateway     string     `json:"gateway"`    // IP gateway (rỗng = dùng interface)
+	Priority    int        `json:"priority"`   // Nhỏ = ưu tiên hơn (chế độ failover)
+	CostPerGB   float64    `json:"cost_per_gb"` // USD / GB (chế độ cost_optimized)
+	Weight      int        `json:"weight"`     // Tỉ trọng khi load_balance (1-10 = số route ECMP)
+	CheckHost   string     `json:"check_host"` // IP netwatch kiểm tra link (mỗi link 1 IP riêng)
+	TariffID    *uint      `json:"tariff_id"`  // Bảng giá áp dụng (nil = tự chọn theo loại link)
+	Enabled     bool       `json:"enabled"`
+	Status      string     `json:"status"` // up / down / unknown
+	LastCheckAt *time.Time `json:"last_check_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// 18. Lịch sử chuyển link
+type LinkSwitchEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ShipID    string    `json:"ship_id" gorm:"index"`
+	FromLink  string    `json:"from_link"`
+	ToLink    string    `json:"to_link"`
+	Mode      string    `json:"mode"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// 19. Lưu lượng theo đường truyền (gộp theo giờ)
+type LinkUsage struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	ShipID      string    `json:"ship_id" gorm:"uniqueIndex:idx_link_usage_period"`
+	LinkName    string    `json:"link_name" gorm:"uniqueIndex:idx_link_usage_period"`
+	LinkKind    string    `json:"link_kind"`
+	PeriodStart time.Time `json:"period_start" gorm:"uniqueIndex:idx_link_usage_period"` // Đầu giờ
+	RxBytes     int64     `json:"rx_bytes"`
+	TxBytes     int64     `json:"tx_bytes"`
+}
+
+// Bộ đếm interface lần đọc trước (phát hiện reset khi router khởi động lại)
+type InterfaceCounter struct {
+	ShipID    string    `json:"ship_id" gorm:"primaryKey"`
+	Interface string    `json:"interface" gorm:"primaryKey"`
+	RxBytes   int64     `json:"rx_bytes"`
+	TxBytes   int64     `json:"tx_bytes"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Lưu lượng của thuyền viên (phúc lợi) theo giờ, phần còn lại của link là vận hành tàu
+type WelfareUsage struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	ShipID      string    `json:"ship_id" gorm:"uniqueIndex:idx_welfare_usage_period"`
+	PeriodStart time.Time `json:"period_start" gorm:"uniqueIndex:idx_welfare_usage_period"`
+	Bytes       int64     `json:"bytes"`
+}
+
+// 20. Bảng giá đường truyền theo nhà cung cấp (phí tháng + dung lượng gói + giá vượt gói)
+type Tariff struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	Name             string    `json:"name"`
+	Provider         string    `json:"provider"`
+	LinkKind         string    `json:"link_kind"` // vsat_ka / l_band / starlink / 4g_lte / port_wifi
+	ShipID           string    `json:"ship_id"`   // Rỗng = mọi tàu
+	Company          string    `json:"company"`   // Rỗng = mọi công ty
+	MonthlyFee       float64   `json:"monthly_fee"`
+	BundleGB         float64   `json:"bundle_gb"` // Dung lượng đã gồm trong phí tháng
+	OverageRatePerGB float64   `json:"overage_rate_per_gb"`
+	Currency         string    `json:"currency"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// 21. Luật phân loại ứng dụng cho NetFlow/IPFIX (theo cổng, dải IP hoặc tên miền)
+type AppCategoryRule struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Category  string    `json:"category"` // VoIP / Video / ERP / Email / Social / IoT
+	Protocol  uint8     `json:"protocol"` // 6 = TCP, 17 = UDP, 0 = mọi giao thức
+	PortFrom  uint16    `json:"port_from"`
+	PortTo    uint16    `json:"port_to"` // 0 = chỉ đúng PortFrom
+	CIDR      string    `json:"cidr"`
+	Domain    string    `json:"domain"` // Khớp theo DNS cache của router trên tàu (gồm tên miền con)
+	Priority  int       `json:"priority"` // Nhỏ hơn được xét trước
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 22. Lưu lượng theo tàu / người dùng / nhóm ứng dụng (gộp theo giờ)
+type TrafficAggregate struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	ShipID      string    `json:"ship_id" gorm:"uniqueIndex:idx_traffic_period"`
+	Username    string    `json:"username" gorm:"uniqueIndex:idx_traffic_period"` // Rỗng = lưu lượng vận hành tàu
+	Category    string    `json:"category" gorm:"uniqueIndex:idx_traffic_period"`
+	PeriodStart time.Time `json:"period_start" gorm:"uniqueIndex:idx_traffic_period;index"`
+	Bytes       int64     `json:"bytes"`
+	Packets     int64     `json:"packets"`
+	Flows       int64     `json:"flows"`
+}
+
+// 23. Phiên hotspot (mỗi lần đăng nhập của thuyền viên / voucher)
+type UsageSession struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	ShipID     string     `json:"ship_id" gorm:"index:idx_usage_session_open"`
+	CrewID     *uint      `json:"crew_id" gorm:"index"` // nil = voucher / tài khoản ngoài danh sách crew
+	Username   string     `json:"username" gorm:"index"`
+	SessionKey string     `json:"-" gorm:"index:idx_usage_session_open"` // .id + user + MAC trên router
+	Address    string     `json:"address"`
+	MAC        string     `json:"mac"`
+	Source     string     `json:"source"` // router / simulator
+	StartedAt  time.Time  `json:"started_at" gorm:"index"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	EndedAt    *time.Time `json:"ended_at" gorm:"index:idx_usage_session_open"` // nil = đang online
+	BytesIn    int64      `json:"bytes_in"`                                      // Thuyền viên gửi lên
+	BytesOut   int64      `json:"bytes_out"`                                     // Thuyền viên tải về
+}
+
+// 24. Lưu lượng theo ngày của từng tài khoản hotspot
+type UsageDaily struct {
+	ID       uint      `json:"id" gorm:"primaryKey"`
+	ShipID   string    `json:"ship_id" gorm:"uniqueIndex:idx_usage_daily"`
+	Username string    `json:"username" gorm:"uniqueIndex:idx_usage_daily"`
+	Day      time.Time `json:"day" gorm:"uniqueIndex:idx_usage_daily;type:date"`
+	CrewID   *uint     `json:"crew_id" gorm:"index"`
+	BytesIn  int64     `json:"bytes_in"`
+	BytesOut int64     `json:"bytes_out"`
+}
+
+// Bộ đếm /ip/hotspot/user + phiên đang mở lần đọc trước (phát hiện reset khi logout / khởi động lại)
+type HotspotUserCounter struct {
+	ShipID    string    `json:"ship_id" gorm:"primaryKey"`
+	Username  string    `json:"username" gorm:"primaryKey"`
+	BytesIn   int64     `json:"bytes_in"`
+	BytesOut  int64     `json:"bytes_out"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 25. Trạng thái dung lượng của thuyền viên trong chu kỳ hiện tại
+type QuotaState struct {
+	CrewID         uint      `json:"crew_id" gorm:"primaryKey"`
+	ShipID         string    `json:"ship_id" gorm:"index"`
+	Username       string    `json:"username"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end" gorm:"index"`
+	AllowanceBytes int64     `json:"allowance_bytes"` // 0 = không giới hạn
+	TopupBytes     int64     `json:"topup_bytes"`     // Nạp thêm bằng voucher trong chu kỳ
+	WelfareBytes   int64     `json:"welfare_bytes"`   // Phụ cấp công ty cấp miễn phí trong chu kỳ (dùng trước phần trả tiền)
+	UsedBytes      int64     `json:"used_bytes"`
+	State          string    `json:"state"`  // normal / warned / exceeded
+	Action         string    `json:"action"` // Hành động đã áp dụng khi exceeded
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// 26. Dòng thời gian sử dụng của thuyền viên (cảnh báo, giới hạn, nạp thêm, reset chu kỳ)
+type CrewUsageEvent struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	CrewID         uint      `json:"crew_id" gorm:"index"`
+	ShipID         string    `json:"ship_id"`
+	Username       string    `json:"username"`
+	Type           string    `json:"type"` // warning / throttled / disconnected / topup_required / topup / allowance / restored / reset
+	Message        string    `json:"message"`
+	UsedBytes      int64     `json:"used_bytes"`
+	AllowanceBytes int64     `json:"allowance_bytes"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+}
+
+// 27. Trạng thái triển khai profile gói cước xuống router từng tàu
+type PlanDeployment struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	PlanID    uint      `json:"plan_id" gorm:"uniqueIndex:idx_plan_deployment"`
+	ShipID    string    `json:"ship_id" gorm:"uniqueIndex:idx_plan_deployment"`
+	Action    string    `json:"action"` // create / update / delete
+	Status    string    `json:"status"` // pending / ok / failed / skipped
+	Error     string    `json:"error"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 28. Chính sách QoS: dành băng thông tối thiểu cho lưu lượng vận hành, chia đều phần còn lại cho crew (PCQ)
+type QosPolicy struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name"`
+	ShipIDs      string     `json:"ship_ids"`      // Rỗng = mọi tàu; danh sách phân tách dấu phẩy
+	Company      string     `json:"company"`       // Rỗng = mọi công ty
+	WanInterface string     `json:"wan_interface"` // Rỗng = interface list "WAN" của RouterOS
+	UplinkKbps   int        `json:"uplink_kbps"`   // Dung lượng đường truyền (max-limit của queue gốc)
+	DownlinkKbps int        `json:"downlink_kbps"`
+	Classes      []QosClass `json:"classes" gorm:"serializer:json"` // Theo thứ tự ưu tiên khớp
+	Enabled      bool       `json:"enabled"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Lớp lưu lượng trong chính sách QoS (không có điều kiện khớp = lớp mặc định, nhận phần còn lại)
+type QosClass struct {
+	Name             string `json:"name"`     // Chữ, số, "_" (dùng làm tên mark / queue trên router)
+	Kind             string `json:"kind"`     // operational / crew / default
+	Priority         int    `json:"priority"` // 1 (cao nhất) .. 8
+	GuaranteedUpKbps int    `json:"guaranteed_up_kbps"`
+	GuaranteedDnKbps int    `json:"guaranteed_down_kbps"`
+	MaxUpKbps        int    `json:"max_up_kbps"` // 0 = bằng dung lượng đường truyền
+	MaxDnKbps        int    `json:"max_down_kbps"`
+	Fair             bool   `json:"fair"` // PCQ: chia đều theo từng người dùng (crew luôn bật)
+
+	// Điều kiện khớp
+	Protocol     string `json:"protocol,omitempty"`      // tcp / udp
+	DstPorts     string `json:"dst_ports,omitempty"`     // VD: 443,5060-5061
+	DstAddresses string `json:"dst_addresses,omitempty"` // IP / CIDR phân tách dấu phẩy (VD: server ERP, văn phòng)
+	SrcAddresses string `json:"src_addresses,omitempty"` // VD: dải IP hotspot crew
+	DSCP         int    `json:"dscp,omitempty"`          // 0 = không xét
+}
+
+// Kết quả áp dụng QoS gần nhất trên từng tàu
+type ShipQosState struct {
+	ShipID    string     `json:"ship_id" gorm:"primaryKey"`
+	PolicyID  *uint      `json:"policy_id"` // nil = không có chính sách, đã gỡ cấu hình
+	Status    string     `json:"status"`    // ok / failed
+	Error     string     `json:"error"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// 29. Lô voucher in sẵn (N voucher cùng gói cho 1 tàu)
+type VoucherBatch struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	PlanID    uint      `json:"plan_id"`
+	DataPlan  string    `json:"data_plan"`
+	ShipID    string    `json:"ship_id" gorm:"index"`
+	Count     int       `json:"count"`
+	ValidDays int       `json:"valid_days"`
+	Note      string    `json:"note"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 30. Sổ cái ví trả trước của thuyền viên: chỉ ghi thêm, sửa sai bằng giao dịch đảo
+type WalletTransaction struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CrewID       uint      `json:"crew_id" gorm:"index"`
+	ShipID       string    `json:"ship_id" gorm:"index"`
+	Source       string    `json:"source"`        // Có: voucher / purchase / allowance / settlement; Nợ: plan_purchase / overage; adjustment / reversal: cả hai
+	AmountCents  int64     `json:"amount_cents"`  // Đơn vị cent; dương = ghi có, âm = ghi nợ
+	BalanceCents int64     `json:"balance_cents"` // Số dư sau giao dịch (cent)
+	Currency     string    `json:"currency"`
+	Reference    string    `json:"reference"` // Mã voucher / gói / kỳ lương...
+	Note         string    `json:"note"`
+	ReversalOf   *uint     `json:"reversal_of" gorm:"uniqueIndex"` // Giao dịch bị đảo (mỗi giao dịch chỉ đảo 1 lần)
+	CreatedBy    string    `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+}
+
+var ErrWalletImmutable = errors.New("giao dịch ví không được sửa hoặc xóa")
+
+func (WalletTransaction) BeforeUpdate(*gorm.DB) error { return ErrWalletImmutable }
+func (WalletTransaction) BeforeDelete(*gorm.DB) error { return ErrWalletImmutable }
+
+// 31. Chính sách phụ cấp Internet công ty trả theo chức danh (VD: sĩ quan 10GB, thủy thủ 5GB / chu kỳ)
+type AllowancePolicy struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name"`
+	Company     string    `json:"company"`  // Rỗng = mọi công ty
+	ShipIDs     string    `json:"ship_ids"` // Rỗng = mọi tàu; danh sách phân tách dấu phẩy
+	Ranks       string    `json:"ranks"`    // Chức danh áp dụng (không phân biệt hoa thường), rỗng = mọi chức danh
+	AllowanceMB int64     `json:"allowance_mb"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Phụ cấp đã cấp cho thuyền viên theo từng chu kỳ (mỗi chu kỳ 1 lần)
+type AllowanceGrant struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CrewID       uint      `json:"crew_id" gorm:"uniqueIndex:idx_allowance_grant"`
+	PeriodStart  time.Time `json:"period_start" gorm:"uniqueIndex:idx_allowance_grant"`
+	PeriodEnd    time.Time `json:"period_end"`
+	ShipID       string    `json:"ship_id" gorm:"index"`
+	Rank         string    `json:"rank"`
+	PolicyID     uint      `json:"policy_id"`
+	FullBytes    int64     `json:"full_bytes"`    // Mức phụ cấp cả chu kỳ theo chính sách
+	GrantedBytes int64     `json:"granted_bytes"` // Sau khi tính tỉ lệ ngày lên tàu giữa chu kỳ
+	ProRata      float64   `json:"pro_rata"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// 32. Bảng giá bán cho chủ tàu / thuyền viên (khác Tariff là giá mua airtime của nhà mạng)
+type ServiceRate struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`    // crew_gb: USD/GB thuyền viên dùng vượt phụ cấp; fixed_fee: phí cố định / tàu / tháng
+	ShipID    string    `json:"ship_id"` // Rỗng = mọi tàu
+	Company   string    `json:"company"` // Rỗng = mọi công ty
+	Price     float64   `json:"price"`
+	Currency  string    `json:"currency"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 33. Hóa đơn tháng theo công ty (draft -> issued -> paid; số hóa đơn cấp khi phát hành)
+type Invoice struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	Number      string        `json:"number" gorm:"uniqueIndex"`      // INV-YYYY-NNNN, nháp: DRAFT-<id>
+	NumberYear  int           `json:"-" gorm:"index:idx_invoice_seq"` // Năm + số thứ tự dạng số của Number (0 khi còn nháp)
+	NumberSeq   int           `json:"-" gorm:"index:idx_invoice_seq"`
+	Company     string        `json:"company" gorm:"uniqueIndex:idx_invoice_period"`
+	PeriodStart time.Time     `json:"period_start" gorm:"uniqueIndex:idx_invoice_period"`
+	PeriodEnd   time.Time     `json:"period_end"`
+	Status      string        `json:"status"` // draft / issued / paid
+	Currency    string        `json:"currency"`
+	Total       float64       `json:"total"`
+	Lines       []InvoiceLine `json:"lines,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	IssuedAt    *time.Time    `json:"issued_at"`
+	PaidAt      *time.Time    `json:"paid_at"`
+	CreatedBy   string        `json:"created_by"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+type InvoiceLine struct {
+	ID          uint    `json:"id" gorm:"primaryKey"`
+	InvoiceID   uint    `json:"invoice_id" gorm:"index"`
+	Category    string  `json:"category"` // airtime / crew_usage / voucher / fixed_fee
+	ShipID      string  `json:"ship_id"`
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	Unit        string  `json:"unit"` // GB / month / voucher
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+}
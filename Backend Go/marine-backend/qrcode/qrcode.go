@@ -0,0 +1,441 @@
+// Package qrcode sinh mã QR (chế độ byte, mức sửa lỗi M, phiên bản 1-10) để in lên thẻ voucher.
+//
+// Đủ cho URL đăng nhập hotspot kèm mã (tối đa 213 byte); không cần thư viện ngoài.
+package qrcode
+
+import "errors"
+
+// Thông số khối sửa lỗi mức M theo phiên bản: số codeword EC mỗi khối, các nhóm (số khối, số codeword dữ liệu mỗi khối)
+type versionInfo struct {
+	ecPerBlock int
+	groups     [][2]int
+	align      []int // Tâm các alignment pattern
+}
+
+var versions = [...]versionInfo{
+	1:  {10, [][2]int{{1, 16}}, nil},
+	2:  {16, [][2]int{{1, 28}}, []int{6, 18}},
+	3:  {26, [][2]int{{1, 44}}, []int{6, 22}},
+	4:  {18, [][2]int{{2, 32}}, []int{6, 26}},
+	5:  {24, [][2]int{{2, 43}}, []int{6, 30}},
+	6:  {16, [][2]int{{4, 27}}, []int{6, 34}},
+	7:  {18, [][2]int{{4, 31}}, []int{6, 22, 38}},
+	8:  {22, [][2]int{{2, 38}, {2, 39}}, []int{6, 24, 42}},
+	9:  {22, [][2]int{{3, 36}, {2, 37}}, []int{6, 26, 46}},
+	10: {26, [][2]int{{4, 43}, {1, 44}}, []int{6, 28, 50}},
+}
+
+const eclFormatBits = 0 // Mức M
+
+var ErrTooLong = errors.New("dữ liệu quá dài cho mã QR")
+
+// Code là ma trận QR đã đặt mask; Size = 17 + 4*Version
+type Code struct {
+	Version int
+	Size    int
+	Mask    int
+	modules [][]bool
+	isFunc  [][]bool
+}
+
+// Dark cho biết ô (x = cột, y = hàng) có tô đen không
+func (q *Code) Dark(x, y int) bool {
+	return q.modules[y][x]
+}
+
+func (v versionInfo) dataCodewords() int {
+	n := 0
+	for _, g := range v.groups {
+		n += g[0] * g[1]
+	}
+	return n
+}
+
+// Encode mã hóa chuỗi, tự chọn phiên bản nhỏ nhất và mask có điểm phạt thấp nhất
+func Encode(text string) (*Code, error) {
+	return EncodeWithMask(text, -1)
+}
+
+// EncodeWithMask như Encode nhưng dùng mask cố định (0-7); mask < 0 = tự chọn
+func EncodeWithMask(text string, mask int) (*Code, error) {
+	data := []byte(text)
+	ver := 0
+	for v := 1; v < len(versions); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= versions[v].dataCodewords()*8 {
+			ver = v
+			break
+		}
+	}
+	if ver == 0 {
+		return nil, ErrTooLong
+	}
+
+	q := &Code{Version: ver, Size: 17 + 4*ver}
+	q.modules = make([][]bool, q.Size)
+	q.isFunc = make([][]bool, q.Size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, q.Size)
+		q.isFunc[i] = make([]bool, q.Size)
+	}
+	q.drawFunctionPatterns()
+	q.drawCodewords(addErrorCorrection(encodeData(data, ver), versions[ver]))
+
+	if mask < 0 {
+		best := -1
+		for m := 0; m < 8; m++ {
+			q.applyMask(m)
+			q.drawFormatBits(m)
+			if p := q.penalty(); best < 0 || p < best {
+				best, mask = p, m
+			}
+			q.applyMask(m) // XOR lần nữa để trả lại như cũ
+		}
+	}
+	q.Mask = mask
+	q.applyMask(mask)
+	q.drawFormatBits(mask)
+	return q, nil
+}
+
+// --- Dữ liệu ---
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(val, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (val>>i)&1 == 1)
+	}
+}
+
+func encodeData(data []byte, ver int) []byte {
+	capacity := versions[ver].dataCodewords()
+	var bits bitBuffer
+	bits.append(0x4, 4) // Chế độ byte
+	countBits := 8
+	if ver >= 10 {
+		countBits = 16
+	}
+	bits.append(len(data), countBits)
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	// Terminator + đệm đủ byte
+	for i := 0; i < 4 && len(bits) < capacity*8; i++ {
+		bits.append(0, 1)
+	}
+	for len(bits)%8 != 0 {
+		bits.append(0, 1)
+	}
+	out := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		out = append(out, b)
+	}
+	for pad := byte(0xEC); len(out) < capacity; pad ^= 0xEC ^ 0x11 {
+		out = append(out, pad)
+	}
+	return out
+}
+
+// Chia khối, tính Reed-Solomon, xen kẽ codeword dữ liệu rồi codeword EC
+func addErrorCorrection(data []byte, v versionInfo) []byte {
+	divisor := rsDivisor(v.ecPerBlock)
+	var blocks, ecs [][]byte
+	pos := 0
+	for _, g := range v.groups {
+		for i := 0; i < g[0]; i++ {
+			block := data[pos : pos+g[1]]
+			pos += g[1]
+			blocks = append(blocks, block)
+			ecs = append(ecs, rsRemainder(block, divisor))
+		}
+	}
+	var out []byte
+	for i := 0; ; i++ {
+		added := false
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	for i := 0; i < v.ecPerBlock; i++ {
+		for _, e := range ecs {
+			out = append(out, e[i])
+		}
+	}
+	return out
+}
+
+// Nhân trong GF(2^8) với đa thức 0x11D
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 0x02)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMul(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// --- Ma trận ---
+
+func (q *Code) setFunc(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.isFunc[y][x] = true
+}
+
+func (q *Code) drawFunctionPatterns() {
+	for i := 0; i < q.Size; i++ {
+		q.setFunc(6, i, i%2 == 0)
+		q.setFunc(i, 6, i%2 == 0)
+	}
+	q.drawFinder(3, 3)
+	q.drawFinder(q.Size-4, 3)
+	q.drawFinder(3, q.Size-4)
+
+	align := versions[q.Version].align
+	last := len(align) - 1
+	for i, ax := range align {
+		for j, ay := range align {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.setFunc(ax+dx, ay+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Giữ chỗ cho format bits (ghi thật sau khi chọn mask) + thông tin phiên bản
+	q.drawFormatBits(0)
+	if q.Version >= 7 {
+		rem := q.Version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := q.Version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 == 1
+			a, b := q.Size-11+i%3, i/3
+			q.setFunc(a, b, dark)
+			q.setFunc(b, a, dark)
+		}
+	}
+}
+
+// Finder pattern 7x7 + viền trắng
+func (q *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= q.Size || y < 0 || y >= q.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			q.setFunc(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (q *Code) drawFormatBits(mask int) {
+	data := eclFormatBits<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		q.setFunc(8, i, bit(i))
+	}
+	q.setFunc(8, 7, bit(6))
+	q.setFunc(8, 8, bit(7))
+	q.setFunc(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunc(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.setFunc(q.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunc(8, q.Size-15+i, bit(i))
+	}
+	q.setFunc(8, q.Size-8, true) // Ô tối cố định
+}
+
+// Đặt bit dữ liệu theo đường zig-zag 2 cột từ góc dưới phải
+func (q *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.Size - 1 - vert
+				}
+				if !q.isFunc[y][x] && i < len(data)*8 {
+					q.modules[y][x] = (data[i>>3]>>(7-i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *Code) applyMask(mask int) {
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.isFunc[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// Điểm phạt theo chuẩn: chuỗi cùng màu, khối 2x2, mẫu giống finder, tỉ lệ ô tối
+func (q *Code) penalty() int {
+	n := q.Size
+	score := 0
+	get := func(row bool, i, j int) bool {
+		if row {
+			return q.modules[i][j]
+		}
+		return q.modules[j][i]
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+	for _, row := range []bool{true, false} {
+		for i := 0; i < n; i++ {
+			run := 1
+			for j := 1; j < n; j++ {
+				if get(row, i, j) == get(row, i, j-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+			if run >= 5 {
+				score += 3 + run - 5
+			}
+			// 1:1:3:1:1 có 4 ô sáng ở một bên
+			for j := 0; j+7 <= n; j++ {
+				match := true
+				for k, want := range finder {
+					if get(row, i, j+k) != want {
+						match = false
+						break
+					}
+				}
+				if !match {
+					continue
+				}
+				lightBefore, lightAfter := true, true
+				for k := 1; k <= 4; k++ {
+					if j-k >= 0 && get(row, i, j-k) {
+						lightBefore = false
+					}
+					if j+6+k < n && get(row, i, j+6+k) {
+						lightAfter = false
+					}
+				}
+				if lightBefore || lightAfter {
+					score += 40
+				}
+			}
+		}
+	}
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+	total := n * n
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return score + k*10
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,143 @@
+package qrcode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func bitmap(q *Code) []byte {
+	var b []byte
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.Dark(x, y) {
+				b = append(b, '1')
+			} else {
+				b = append(b, '0')
+			}
+		}
+	}
+	return b
+}
+
+// Ma trận tham chiếu sinh bằng rsc.io/qr/coding (chế độ byte, mức M, phiên bản + mask cố định)
+func TestEncodeKnownVectors(t *testing.T) {
+	tests := []struct {
+		text    string
+		version int
+		mask    int
+		sha256  string
+	}{
+		{"VOU-ABC123", 1, 2, "0c1c56c346310647bd97253557a9c9547765bc99372d47141bcefd46ffa62c21"},
+		{"http://10.5.50.1/login?username=K7QW9XF2&password=K7QW9XF2", 4, 5, "97641763ff29680f7cba33bacf595e9f1584c6daffc892178fbb98a52eeb091e"},
+		{"http://hotspot.ship.local/login?username=crew-voucher-7QW9XF2MP4D&password=7QW9XF2MP4D&dst=http%3A%2F%2Fportal.local%2F",
+			7, 0, "159147e9880c2056dce66542ee8be4a31fbeb058cb2020389213ff4be0b0d168"},
+		{"http://hotspot.marine-portal.example/login?username=VOUCHER-K7QW9XF2MP4DZ8&password=K7QW9XF2MP4DZ8&dst=https%3A%2F%2Fportal.marine-portal.example%2Fwelcome%3Fship%3DIMO9876543%26lang%3Dvi&popup=true",
+			10, 6, "1f8a67e6f1b79f8a659a9d208936fd996d3ff02c0623152ddf017fdc99313521"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text[:10], func(t *testing.T) {
+			q, err := EncodeWithMask(tt.text, tt.mask)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Version != tt.version || q.Size != 17+4*tt.version {
+				t.Fatalf("phiên bản = %d (size %d), want %d", q.Version, q.Size, tt.version)
+			}
+			sum := sha256.Sum256(bitmap(q))
+			if got := hex.EncodeToString(sum[:]); got != tt.sha256 {
+				t.Errorf("ma trận sha256 = %s, want %s", got, tt.sha256)
+			}
+		})
+	}
+}
+
+func TestEncodeVersion1Matrix(t *testing.T) {
+	want := strings.Join([]string{
+		"#######..#.#..#######",
+		"#.....#..#.#..#.....#",
+		"#.###.#.#.#...#.###.#",
+		"#.###.#.##.##.#.###.#",
+		"#.###.#.#####.#.###.#",
+		"#.....#.#...#.#.....#",
+		"#######.#.#.#.#######",
+		"........##.##........",
+		"#.#####..##.#.#####..",
+		"##..#..#..#.#...##...",
+		".#.##.#...##.#.#.#.#.",
+		"#..###..#.......###.#",
+		".#.#..##..##.###.###.",
+		"........#####..#.###.",
+		"#######..##.#.#..###.",
+		"#.....#.#.###..##.#.#",
+		"#.###.#.#.#.####....#",
+		"#.###.#.#.#.#..#.#...",
+		"#.###.#.#..#.##..##..",
+		"#.....#..........##..",
+		"#######.##.#...#..##.",
+	}, "")
+	q, err := EncodeWithMask("VOU-ABC123", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.NewReplacer("1", "#", "0", ".").Replace(string(bitmap(q)))
+	if got != want {
+		for y := 0; y < q.Size; y++ {
+			t.Errorf("%s   %s", got[y*q.Size:(y+1)*q.Size], want[y*q.Size:(y+1)*q.Size])
+		}
+	}
+}
+
+// Ví dụ "HELLO WORLD" 1-M: 16 codeword dữ liệu -> 10 codeword sửa lỗi
+func TestReedSolomon(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder() = %v, want %v", got, want)
+	}
+}
+
+func TestEncodeVersionSelection(t *testing.T) {
+	tests := []struct {
+		length  int
+		version int
+		err     error
+	}{
+		{1, 1, nil},
+		{14, 1, nil},
+		{15, 2, nil},
+		{62, 4, nil},
+		{63, 5, nil},
+		{122, 7, nil},
+		{213, 10, nil},
+		{214, 0, ErrTooLong},
+	}
+	for _, tt := range tests {
+		q, err := Encode(strings.Repeat("a", tt.length))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Encode(%d byte) error = %v, want %v", tt.length, err, tt.err)
+			continue
+		}
+		if err == nil && q.Version != tt.version {
+			t.Errorf("Encode(%d byte) phiên bản = %d, want %d", tt.length, q.Version, tt.version)
+		}
+	}
+}
+
+func TestEncodeAutoMask(t *testing.T) {
+	text := "http://10.5.50.1/login?username=K7QW9XF2&password=K7QW9XF2"
+	q, err := Encode(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Mask < 0 || q.Mask > 7 {
+		t.Fatalf("mask = %d", q.Mask)
+	}
+	fixed, _ := EncodeWithMask(text, q.Mask)
+	if !bytes.Equal(bitmap(q), bitmap(fixed)) {
+		t.Errorf("Encode() khác EncodeWithMask() với cùng mask %d", q.Mask)
+	}
+}
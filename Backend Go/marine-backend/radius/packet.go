@@ -0,0 +1,301 @@
+// Package radius mã hóa / giải mã gói RADIUS (RFC 2865 xác thực, RFC 2866 accounting)
+// dùng chung cho server trong backend và client thử nghiệm cmd/radius-client.
+package radius
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// Mã gói
+const (
+	AccessRequest      = 1
+	AccessAccept       = 2
+	AccessReject       = 3
+	AccountingRequest  = 4
+	AccountingResponse = 5
+)
+
+// Thuộc tính dùng tới
+const (
+	AttrUserName            = 1
+	AttrUserPassword        = 2
+	AttrCHAPPassword        = 3
+	AttrNASIPAddress        = 4
+	AttrFramedIPAddress     = 8
+	AttrReplyMessage        = 18
+	AttrVendorSpecific      = 26
+	AttrSessionTimeout      = 27
+	AttrCallingStationID    = 31
+	AttrNASIdentifier       = 32
+	AttrAcctStatusType      = 40
+	AttrAcctInputOctets     = 42
+	AttrAcctOutputOctets    = 43
+	AttrAcctSessionID       = 44
+	AttrAcctSessionTime     = 46
+	AttrAcctTerminateCause  = 49
+	AttrAcctInputGigawords  = 52
+	AttrAcctOutputGigawords = 53
+	AttrCHAPChallenge       = 60
+	AttrMessageAuth         = 80
+)
+
+// Acct-Status-Type
+const (
+	AcctStart   = 1
+	AcctStop    = 2
+	AcctInterim = 3
+	AcctOn      = 7
+	AcctOff     = 8
+)
+
+// Vendor MikroTik (14988)
+const (
+	VendorMikrotik       = 14988
+	MikrotikGroup        = 3
+	MikrotikRateLimit    = 8
+	MikrotikTotalLimit   = 17
+	MikrotikTotalLimitGB = 18
+)
+
+type Attribute struct {
+	Type  byte
+	Value []byte
+}
+
+type Packet struct {
+	Code          byte
+	Identifier    byte
+	Authenticator [16]byte
+	Attributes    []Attribute
+}
+
+// Giải mã gói (chưa kiểm tra authenticator)
+func Parse(b []byte) (*Packet, error) {
+	if len(b) < 20 {
+		return nil, fmt.Errorf("gói RADIUS quá ngắn")
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if length < 20 || length > len(b) || length > 4096 {
+		return nil, fmt.Errorf("độ dài gói RADIUS không hợp lệ")
+	}
+	p := &Packet{Code: b[0], Identifier: b[1]}
+	copy(p.Authenticator[:], b[4:20])
+	attrs := b[20:length]
+	for len(attrs) > 0 {
+		if len(attrs) < 2 || attrs[1] < 2 || int(attrs[1]) > len(attrs) {
+			return nil, fmt.Errorf("thuộc tính RADIUS không hợp lệ")
+		}
+		p.Attributes = append(p.Attributes, Attribute{Type: attrs[0], Value: append([]byte(nil), attrs[2:attrs[1]]...)})
+		attrs = attrs[attrs[1]:]
+	}
+	return p, nil
+}
+
+// Mã hóa gói như hiện có (authenticator giữ nguyên)
+func (p *Packet) Encode() []byte {
+	buf := make([]byte, 20, 128)
+	buf[0], buf[1] = p.Code, p.Identifier
+	copy(buf[4:], p.Authenticator[:])
+	for _, a := range p.Attributes {
+		buf = append(buf, a.Type, byte(len(a.Value)+2))
+		buf = append(buf, a.Value...)
+	}
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(buf)))
+	return buf
+}
+
+func (p *Packet) Get(t byte) []byte {
+	for _, a := range p.Attributes {
+		if a.Type == t {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+func (p *Packet) String(t byte) string { return string(p.Get(t)) }
+
+func (p *Packet) Uint32(t byte) uint32 {
+	if v := p.Get(t); len(v) == 4 {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (p *Packet) IP(t byte) net.IP {
+	if v := p.Get(t); len(v) == 4 {
+		return net.IP(v)
+	}
+	return nil
+}
+
+func (p *Packet) Add(t byte, value []byte) { p.Attributes = append(p.Attributes, Attribute{t, value}) }
+
+func (p *Packet) AddString(t byte, s string) { p.Add(t, []byte(s)) }
+
+func (p *Packet) AddUint32(t byte, v uint32) { p.Add(t, binary.BigEndian.AppendUint32(nil, v)) }
+
+// Thuộc tính Vendor-Specific (1 sub-attribute)
+func (p *Packet) AddVendor(vendor uint32, t byte, value []byte) {
+	v := binary.BigEndian.AppendUint32(nil, vendor)
+	v = append(v, t, byte(len(value)+2))
+	p.Add(AttrVendorSpecific, append(v, value...))
+}
+
+// Đọc sub-attribute của vendor
+func (p *Packet) Vendor(vendor uint32, t byte) []byte {
+	for _, a := range p.Attributes {
+		if a.Type != AttrVendorSpecific || len(a.Value) < 6 || binary.BigEndian.Uint32(a.Value) != vendor {
+			continue
+		}
+		sub := a.Value[4:]
+		for len(sub) >= 2 && int(sub[1]) <= len(sub) && sub[1] >= 2 {
+			if sub[0] == t {
+				return sub[2:sub[1]]
+			}
+			sub = sub[sub[1]:]
+		}
+	}
+	return nil
+}
+
+// Tạo gói trả lời cho request: cùng Identifier, tạm giữ request authenticator (EncodeResponse sẽ thay)
+func (p *Packet) Reply(code byte) *Packet {
+	return &Packet{Code: code, Identifier: p.Identifier, Authenticator: p.Authenticator}
+}
+
+// Mã hóa gói trả lời (Response Authenticator + Message-Authenticator nếu request có)
+func (p *Packet) EncodeResponse(secret []byte, withMessageAuth bool) []byte {
+	if withMessageAuth {
+		p.Add(AttrMessageAuth, make([]byte, 16))
+		b := p.Encode() // Authenticator lúc này = request authenticator
+		mac := hmac.New(md5.New, secret)
+		mac.Write(b)
+		copy(p.Attributes[len(p.Attributes)-1].Value, mac.Sum(nil))
+	}
+	b := p.Encode()
+	sum := md5.Sum(append(b, secret...))
+	copy(b[4:20], sum[:])
+	return b
+}
+
+// Mã hóa Accounting-Request (authenticator = MD5 với ô authenticator toàn 0)
+func (p *Packet) EncodeAccounting(secret []byte) []byte {
+	p.Authenticator = [16]byte{}
+	b := p.Encode()
+	sum := md5.Sum(append(b, secret...))
+	copy(b[4:20], sum[:])
+	copy(p.Authenticator[:], sum[:])
+	return b
+}
+
+// Mã hóa Access-Request: authenticator ngẫu nhiên + Message-Authenticator
+func (p *Packet) EncodeRequest(secret []byte) []byte {
+	if p.Authenticator == [16]byte{} {
+		rand.Read(p.Authenticator[:])
+	}
+	p.Add(AttrMessageAuth, make([]byte, 16))
+	mac := hmac.New(md5.New, secret)
+	mac.Write(p.Encode())
+	copy(p.Attributes[len(p.Attributes)-1].Value, mac.Sum(nil))
+	return p.Encode()
+}
+
+// Kiểm tra authenticator của Accounting-Request (raw = gói nhận được)
+func VerifyAccounting(raw, secret []byte) bool {
+	if len(raw) < 20 {
+		return false
+	}
+	b := append([]byte(nil), raw[:binary.BigEndian.Uint16(raw[2:])]...)
+	copy(b[4:20], make([]byte, 16))
+	sum := md5.Sum(append(b, secret...))
+	return hmac.Equal(sum[:], raw[4:20])
+}
+
+// Kiểm tra Message-Authenticator (nếu gói có); false = có nhưng sai
+func VerifyMessageAuth(raw, secret []byte) bool {
+	p, err := Parse(raw)
+	if err != nil {
+		return false
+	}
+	got := p.Get(AttrMessageAuth)
+	if got == nil {
+		return true
+	}
+	b := append([]byte(nil), raw[:binary.BigEndian.Uint16(raw[2:])]...)
+	// Đặt lại ô Message-Authenticator về 0 rồi tính HMAC-MD5
+	for i := 20; i+2 <= len(b); i += int(b[i+1]) {
+		if b[i+1] < 2 {
+			return false
+		}
+		if b[i] == AttrMessageAuth {
+			copy(b[i+2:i+int(b[i+1])], make([]byte, 16))
+		}
+	}
+	mac := hmac.New(md5.New, secret)
+	mac.Write(b)
+	return hmac.Equal(mac.Sum(nil), got)
+}
+
+// User-Password (PAP): XOR từng khối 16 byte với MD5(secret + khối trước)
+func EncryptPassword(password, secret []byte, auth [16]byte) []byte {
+	padded := make([]byte, (len(password)+15)/16*16)
+	if len(padded) == 0 {
+		padded = make([]byte, 16)
+	}
+	copy(padded, password)
+	out := make([]byte, len(padded))
+	prev := auth[:]
+	for i := 0; i < len(padded); i += 16 {
+		b := md5.Sum(append(append([]byte(nil), secret...), prev...))
+		for j := 0; j < 16; j++ {
+			out[i+j] = padded[i+j] ^ b[j]
+		}
+		prev = out[i : i+16]
+	}
+	return out
+}
+
+func DecryptPassword(cipher, secret []byte, auth [16]byte) ([]byte, error) {
+	if len(cipher) == 0 || len(cipher)%16 != 0 || len(cipher) > 128 {
+		return nil, fmt.Errorf("User-Password không hợp lệ")
+	}
+	out := make([]byte, len(cipher))
+	prev := auth[:]
+	for i := 0; i < len(cipher); i += 16 {
+		b := md5.Sum(append(append([]byte(nil), secret...), prev...))
+		for j := 0; j < 16; j++ {
+			out[i+j] = cipher[i+j] ^ b[j]
+		}
+		prev = cipher[i : i+16]
+	}
+	return bytes.TrimRight(out, "\x00"), nil
+}
+
+// CHAP: CHAP-Password = ident + MD5(ident + password + challenge)
+func CHAPResponse(ident byte, password, challenge []byte) []byte {
+	sum := md5.Sum(append(append([]byte{ident}, password...), challenge...))
+	return append([]byte{ident}, sum[:]...)
+}
+
+// Kiểm tra mật khẩu theo PAP hoặc CHAP có trong request
+func (p *Packet) CheckPassword(password string, secret []byte) bool {
+	if v := p.Get(AttrUserPassword); v != nil {
+		plain, err := DecryptPassword(v, secret, p.Authenticator)
+		return err == nil && hmac.Equal(plain, []byte(password))
+	}
+	if v := p.Get(AttrCHAPPassword); len(v) == 17 {
+		challenge := p.Get(AttrCHAPChallenge)
+		if challenge == nil {
+			challenge = p.Authenticator[:]
+		}
+		return hmac.Equal(CHAPResponse(v[0], []byte(password), challenge), v)
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package radius
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Access-Request / Access-Accept mẫu trong RFC 2865 mục 7.1 (secret "xyzzy5461", mật khẩu "arctangent")
+const (
+	rfcSecret  = "xyzzy5461"
+	rfcRequest = "01000038" + "0f403f9473978057bd83d5cb98f4227a" +
+		"01066e656d6f" + "02120dbe708d93d413ce3196e43f782a0aee" + "0406c0a80110" + "050600000003"
+	rfcAccept = "02000026" + "86fe220e7624ba2a1005f6bf9b55e0b2" +
+		"0606000000010f06000000000e06c0a80103"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParse(t *testing.T) {
+	valid := mustHex(t, rfcRequest)
+	tests := []struct {
+		name    string
+		raw     []byte
+		wantErr bool
+		attrs   int
+	}{
+		{"gói RFC 2865", valid, false, 4},
+		{"thừa byte sau độ dài khai báo", append(append([]byte(nil), valid...), 0, 0, 0), false, 4},
+		{"quá ngắn", valid[:19], true, 0},
+		{"độ dài lớn hơn dữ liệu", valid[:40], true, 0},
+		{"độ dài nhỏ hơn 20", append([]byte{1, 0, 0, 19}, valid[4:]...), true, 0},
+		{"thuộc tính độ dài 0", append([]byte{1, 0, 0, 22}, append(append([]byte(nil), valid[4:20]...), 1, 0)...), true, 0},
+		{"thuộc tính vượt quá gói", append([]byte{1, 0, 0, 23}, append(append([]byte(nil), valid[4:20]...), 1, 9, 'a')...), true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(p.Attributes) != tt.attrs {
+				t.Errorf("Parse() %d thuộc tính, want %d", len(p.Attributes), tt.attrs)
+			}
+		})
+	}
+
+	p, _ := Parse(valid)
+	if p.Code != AccessRequest || p.String(AttrUserName) != "nemo" || p.IP(AttrNASIPAddress).String() != "192.168.1.16" || p.Uint32(5) != 3 {
+		t.Errorf("Parse() đọc sai thuộc tính: %+v", p)
+	}
+	if !bytes.Equal(p.Encode(), valid) {
+		t.Errorf("Encode() không khớp gói gốc")
+	}
+}
+
+func TestPAP(t *testing.T) {
+	p, _ := Parse(mustHex(t, rfcRequest))
+	plain, err := DecryptPassword(p.Get(AttrUserPassword), []byte(rfcSecret), p.Authenticator)
+	if err != nil || string(plain) != "arctangent" {
+		t.Fatalf("DecryptPassword() = %q, %v", plain, err)
+	}
+	if got := EncryptPassword([]byte("arctangent"), []byte(rfcSecret), p.Authenticator); !bytes.Equal(got, p.Get(AttrUserPassword)) {
+		t.Errorf("EncryptPassword() = %x", got)
+	}
+	tests := []struct {
+		password, secret string
+		want             bool
+	}{
+		{"arctangent", rfcSecret, true},
+		{"arctangenT", rfcSecret, false},
+		{"arctangent", "wrong", false},
+	}
+	for _, tt := range tests {
+		if got := p.CheckPassword(tt.password, []byte(tt.secret)); got != tt.want {
+			t.Errorf("CheckPassword(%q, %q) = %v, want %v", tt.password, tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestCHAP(t *testing.T) {
+	challenge := mustHex(t, "00112233445566778899aabbccddeeff")
+	withChallenge := &Packet{Code: AccessRequest}
+	withChallenge.AddString(AttrUserName, "crew01")
+	withChallenge.Add(AttrCHAPPassword, CHAPResponse(7, []byte("s3cret"), challenge))
+	withChallenge.Add(AttrCHAPChallenge, challenge)
+
+	// Không có CHAP-Challenge: challenge = request authenticator
+	fromAuth := &Packet{Code: AccessRequest}
+	copy(fromAuth.Authenticator[:], challenge)
+	fromAuth.Add(AttrCHAPPassword, CHAPResponse(7, []byte("s3cret"), challenge))
+
+	tests := []struct {
+		name     string
+		p        *Packet
+		password string
+		want     bool
+	}{
+		{"đúng mật khẩu, có CHAP-Challenge", withChallenge, "s3cret", true},
+		{"sai mật khẩu", withChallenge, "s3cret2", false},
+		{"challenge lấy từ authenticator", fromAuth, "s3cret", true},
+		{"không có mật khẩu", &Packet{Code: AccessRequest}, "s3cret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.CheckPassword(tt.password, []byte("ignored")); got != tt.want {
+				t.Errorf("CheckPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := CHAPResponse(7, []byte("s3cret"), challenge); len(got) != 17 || got[0] != 7 {
+		t.Errorf("CHAPResponse() = %x", got)
+	}
+}
+
+func TestEncodeResponse(t *testing.T) {
+	req, _ := Parse(mustHex(t, rfcRequest))
+	reply := req.Reply(AccessAccept)
+	reply.AddUint32(6, 1)                 // Service-Type = Login
+	reply.AddUint32(15, 0)                // Login-Service = Telnet
+	reply.Add(14, []byte{192, 168, 1, 3}) // Login-IP-Host
+	if got := reply.EncodeResponse([]byte(rfcSecret), false); !bytes.Equal(got, mustHex(t, rfcAccept)) {
+		t.Errorf("EncodeResponse() = %x\nwant %s", got, rfcAccept)
+	}
+}
+
+func TestVerifyAccounting(t *testing.T) {
+	secret := []byte("ship-secret")
+	p := &Packet{Code: AccountingRequest, Identifier: 9}
+	p.AddUint32(AttrAcctStatusType, AcctInterim)
+	p.AddString(AttrAcctSessionID, "81000001")
+	p.AddUint32(AttrAcctInputOctets, 123456)
+	raw := p.EncodeAccounting(secret)
+
+	tampered := append([]byte(nil), raw...)
+	tampered[len(tampered)-1]++
+	tests := []struct {
+		name   string
+		raw    []byte
+		secret []byte
+		want   bool
+	}{
+		{"hợp lệ", raw, secret, true},
+		{"sai secret", raw, []byte("other"), false},
+		{"bị sửa nội dung", tampered, secret, false},
+		{"quá ngắn", raw[:10], secret, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyAccounting(tt.raw, tt.secret); got != tt.want {
+				t.Errorf("VerifyAccounting() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageAuthenticator(t *testing.T) {
+	secret := []byte("ship-secret")
+	p := &Packet{Code: AccessRequest, Identifier: 1}
+	p.AddString(AttrUserName, "crew01")
+	raw := p.EncodeRequest(secret)
+	if !VerifyMessageAuth(raw, secret) {
+		t.Errorf("VerifyMessageAuth() = false với gói hợp lệ")
+	}
+	if VerifyMessageAuth(raw, []byte("other")) {
+		t.Errorf("VerifyMessageAuth() = true với sai secret")
+	}
+
+	req, _ := Parse(raw)
+	resp := req.Reply(AccessReject).EncodeResponse(secret, true)
+	if parsed, err := Parse(resp); err != nil || parsed.Get(AttrMessageAuth) == nil {
+		t.Fatalf("EncodeResponse() thiếu Message-Authenticator: %v", err)
+	}
+}
+
+func TestVendor(t *testing.T) {
+	p := &Packet{}
+	p.AddVendor(VendorMikrotik, MikrotikRateLimit, []byte("2M/4M"))
+	p.AddVendor(VendorMikrotik, MikrotikGroup, []byte("crew"))
+	tests := []struct {
+		vendor uint32
+		t      byte
+		want   string
+	}{
+		{VendorMikrotik, MikrotikRateLimit, "2M/4M"},
+		{VendorMikrotik, MikrotikGroup, "crew"},
+		{VendorMikrotik, MikrotikTotalLimit, ""},
+		{9, MikrotikRateLimit, ""},
+	}
+	for _, tt := range tests {
+		if got := string(p.Vendor(tt.vendor, tt.t)); got != tt.want {
+			t.Errorf("Vendor(%d, %d) = %q, want %q", tt.vendor, tt.t, got, tt.want)
+		}
+	}
+}
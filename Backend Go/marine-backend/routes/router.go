@@ -2,6 +2,7 @@ package routes
 
 import (
 	"marine-backend/controllers"
+	"marine-backend/middlewares"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -9,7 +10,8 @@ import (
 )
 
 func SetupRouter() *gin.Engine {
-	r := gin.Default()
+	r := gin.New()
+	r.Use(middlewares.RequestLogger(), gin.Recovery()) // Như gin.Default() nhưng không ghi token ra log
 
 	// Cấu hình CORS (Cho phép Frontend truy cập)
 	r.Use(cors.New(cors.Config{
@@ -28,20 +30,61 @@ func SetupRouter() *gin.Engine {
 		api.POST("/reset-password", controllers.ResetPassword)
 		api.GET("/ships", controllers.GetShips)
 		api.POST("/ships", controllers.CreateShip)
+		api.POST("/ships/:ship_id/heartbeat", controllers.ShipHeartbeat)        // Agent trên tàu check-in
+		api.POST("/ships/:ship_id/agent-token", middlewares.AuthRequired(), middlewares.AdminRequired(), controllers.RotateAgentToken) // Cấp token cho agent
+		api.GET("/ships/:ship_id/status-history", controllers.GetShipStatusHistory)
+		api.GET("/simulator", controllers.GetSimulatorStatus)
+		api.POST("/ships/:ship_id/positions", controllers.IngestPositions) // JSON hoặc NMEA ($GPRMC/$GPGGA)
+		api.GET("/ships/:ship_id/track", controllers.GetShipTrack)         // GeoJSON LineString
+		api.GET("/ais/status", controllers.GetAISStatus)
+		api.POST("/ais/replay", middlewares.AuthRequired(), middlewares.AdminRequired(), controllers.ReplayNMEAUpload) // Phát lại file NMEA ghi sẵn
 		api.GET("/ships/:ship_id/crew", controllers.GetCrewByShip) // Lấy crew theo tàu
     	api.POST("/crew", controllers.AddCrew)                     // Thêm crew
     	api.DELETE("/crew/:id", controllers.DeleteCrew)            // Xóa crew
 		// PDF Report (Bạn có thể copy logic PDF vào controller riêng sau)
 		api.GET("/report/:id", controllers.DownloadReport) 
 		api.PUT("/crew/:id", controllers.UpdateCrew)
+		api.GET("/crew/:id/quota", controllers.GetCrewQuota)
+		api.POST("/crew/:id/topup", middlewares.AuthRequired(), controllers.TopupCrewQuota) // {voucher_code}
+		api.GET("/crew/:id/timeline", controllers.GetCrewTimeline)
+
+		// Ví trả trước của thuyền viên (sổ cái chỉ ghi thêm)
+		api.GET("/crew/:id/wallet", controllers.GetCrewWallet)
+		api.GET("/crew/:id/wallet/statement", controllers.GetWalletStatement) // ?month=YYYY-MM
+		// Ghi sổ ví và xuất trừ lương: chỉ Admin, người thao tác lấy từ JWT
+		wallet := api.Group("", middlewares.AuthRequired(), middlewares.AdminRequired())
+		wallet.POST("/crew/:id/wallet/credit", controllers.CreditCrewWallet)
+		wallet.POST("/crew/:id/wallet/debit", controllers.DebitCrewWallet)
+		wallet.POST("/crew/:id/wallet/settle", controllers.SettleCrewWallet) // Quyết toán khi rời tàu
+		wallet.POST("/wallet-transactions/:id/reverse", controllers.ReverseWalletTransaction)
+		wallet.GET("/wallet/payroll", controllers.ExportPayrollDeductions) // CSV trừ lương
+
+		// Phụ cấp Internet công ty trả theo chức danh
+		api.GET("/allowance-policies", controllers.GetAllowancePolicies)
+		api.POST("/allowance-policies", controllers.CreateAllowancePolicy)
+		api.PUT("/allowance-policies/:id", controllers.UpdateAllowancePolicy)
+		api.DELETE("/allowance-policies/:id", controllers.DeleteAllowancePolicy)
+		api.GET("/allowance-report", controllers.GetAllowanceReport) // ?month=YYYY-MM
 		api.GET("/usage-report", controllers.GetMonthlyUsage)
+		api.GET("/usage-sessions", controllers.GetUsageSessions)
+		api.GET("/radius/status", controllers.GetRadiusStatus)
 		api.GET("/online-users", controllers.GetOnlineUsers)
     	api.POST("/online-users/:username/kick", controllers.KickUser)
 		api.GET("/vouchers", controllers.GetVouchers)
 		api.POST("/vouchers", controllers.CreateVoucher)
-		api.PUT("/vouchers/:id/assign", controllers.AssignVoucher) // API Gán
+		api.PUT("/vouchers/:id/assign", middlewares.AuthRequired(), controllers.AssignVoucher) // API Gán
+		api.POST("/vouchers/:id/revoke", controllers.RevokeVoucher)
+		api.POST("/vouchers/:id/extend", controllers.ExtendVoucher) // {days}
+		api.DELETE("/vouchers/:id", controllers.DeleteVoucher)
+		api.GET("/vouchers/:id/usage", controllers.GetVoucherUsage)
+		api.GET("/voucher-batches", controllers.GetVoucherBatches)
+		api.POST("/voucher-batches", controllers.CreateVoucherBatch)
+		api.GET("/voucher-batches/:id/pdf", controllers.DownloadVoucherBatchPDF) // Thẻ in cắt rời kèm QR
 		api.GET("/bandwidth-plans", controllers.GetBandwidthPlans)
+		api.GET("/bandwidth-plans/:id", controllers.GetBandwidthPlan)
 		api.POST("/bandwidth-plans", controllers.CreateBandwidthPlan)
+		api.POST("/bandwidth-plans/:id/deploy", controllers.DeployBandwidthPlan)
+		api.PUT("/bandwidth-plans/:id", controllers.UpdateBandwidthPlan)
 		api.DELETE("/bandwidth-plans/:id", controllers.DeleteBandwidthPlan)
 		api.GET("/ships/:ship_id/router/stats", controllers.GetRouterHealth)
 		api.POST("/ships/:ship_id/router/sync", controllers.SyncCrewToRouter)
@@ -53,11 +96,81 @@ func SetupRouter() *gin.Engine {
 		api.GET("/analytics/overview", controllers.GetAnalyticsOverview)
 		api.GET("/analytics/traffic", controllers.GetAnalyticsTraffic)
 		api.GET("/analytics/top-consumers", controllers.GetAnalyticsTopConsumers)
-		api.GET("/analytics/app-usage", controllers.GetAnalyticsAppUsage)
+		api.GET("/analytics/app-usage", controllers.GetAnalyticsAppUsage) // ?range=&ship_id=&username=
+		api.GET("/analytics/beams", controllers.GetBeamStats) // Beam / vệ tinh tệ nhất trước
+		api.GET("/handovers", controllers.GetBeamHandovers)
+		api.GET("/ships/:ship_id/link-history", controllers.GetShipLinkHistory)
+		api.GET("/ships/:ship_id/terminal", controllers.GetShipTerminal)    // Thiết bị vệ tinh (Starlink / iDirect / SNMP)
+		api.PUT("/ships/:ship_id/terminal", controllers.UpdateShipTerminal)
+		api.POST("/ships/:ship_id/terminal/poll", controllers.PollShipTerminal)
 		// Thêm vào nhóm API:
 		api.POST("/ships/:ship_id/router/command", controllers.RunTerminalCommand) // Web Terminal
 		api.POST("/ships/:ship_id/router/upload", controllers.UploadConfigFile)    // Upload File
 		api.POST("/settings/firewall", controllers.ApplyFirewallRules)
+		// Thông báo (Email / Webhook)
+		api.GET("/notification-rules", controllers.GetNotificationRules)
+		api.POST("/notification-rules", controllers.CreateNotificationRule)
+		api.PUT("/notification-rules/:id", controllers.UpdateNotificationRule)
+		api.DELETE("/notification-rules/:id", controllers.DeleteNotificationRule)
+		api.GET("/notification-logs", controllers.GetNotificationLogs)
+		api.POST("/notifications/test", controllers.SendTestNotification)
+		// SD-WAN / nhiều đường truyền
+		api.GET("/ships/:ship_id/links", controllers.GetShipLinks)
+		api.POST("/ships/:ship_id/links", controllers.CreateShipLink)
+		api.PUT("/ships/:ship_id/links/:id", controllers.UpdateShipLink)
+		api.DELETE("/ships/:ship_id/links/:id", controllers.DeleteShipLink)
+		api.GET("/ships/:ship_id/sdwan", controllers.GetShipSdwan)
+		api.PUT("/ships/:ship_id/sdwan", controllers.UpdateShipSdwan)
+		api.POST("/ships/:ship_id/sdwan/apply", controllers.ApplyShipSdwan)
+
+		// QoS: ưu tiên lưu lượng vận hành, chia đều cho crew (queue tree / PCQ)
+		api.GET("/qos-policies", controllers.GetQosPolicies)
+		api.POST("/qos-policies", controllers.CreateQosPolicy)
+		api.PUT("/qos-policies/:id", controllers.UpdateQosPolicy)
+		api.DELETE("/qos-policies/:id", controllers.DeleteQosPolicy)
+		api.GET("/qos-policies/:id/preview", controllers.PreviewQosPolicy)
+		api.GET("/ships/:ship_id/qos", controllers.GetShipQos)
+		api.POST("/ships/:ship_id/qos/apply", controllers.ApplyShipQos)
+		api.GET("/link-switches", controllers.GetLinkSwitches)
+		api.GET("/ships/:ship_id/link-usage", controllers.GetShipLinkUsage)
+		// Bảng giá đường truyền & chi phí
+		api.GET("/tariffs", controllers.GetTariffs)
+		api.POST("/tariffs", controllers.CreateTariff)
+		api.PUT("/tariffs/:id", controllers.UpdateTariff)
+		api.DELETE("/tariffs/:id", controllers.DeleteTariff)
+		// Giá bán và lập / phát hành hóa đơn: chỉ Admin
+		billing := api.Group("", middlewares.AuthRequired(), middlewares.AdminRequired())
+		billing.GET("/service-rates", controllers.GetServiceRates) // Giá bán: crew_gb, fixed_fee
+		billing.POST("/service-rates", controllers.CreateServiceRate)
+		billing.PUT("/service-rates/:id", controllers.UpdateServiceRate)
+		billing.DELETE("/service-rates/:id", controllers.DeleteServiceRate)
+		billing.POST("/invoices/generate", controllers.GenerateInvoices)
+		billing.POST("/invoices/:id/status", controllers.UpdateInvoiceStatus)
+		billing.DELETE("/invoices/:id", controllers.DeleteInvoice)
+
+		// Hóa đơn tháng theo công ty
+		api.GET("/invoices", controllers.GetInvoices)
+		api.GET("/invoices/:id", controllers.GetInvoice)
+		api.GET("/invoices/:id/pdf", controllers.DownloadInvoicePDF)
+		api.GET("/invoices/:id/csv", controllers.DownloadInvoiceCSV)
+		api.GET("/analytics/costs", controllers.GetCostReport) // ?month=YYYY-MM
+
+		// Phân loại lưu lượng (NetFlow v9 / IPFIX)
+		api.GET("/netflow/status", controllers.GetNetflowStatus)
+		api.POST("/netflow/replay", middlewares.AuthRequired(), middlewares.AdminRequired(), controllers.ReplayNetflowUpload) // multipart: file (pcap), exporter, ship_id
+		api.GET("/app-rules", controllers.GetAppCategoryRules)
+		api.POST("/app-rules", controllers.CreateAppCategoryRule)
+		api.PUT("/app-rules/:id", controllers.UpdateAppCategoryRule)
+		api.DELETE("/app-rules/:id", controllers.DeleteAppCategoryRule)
+		// Geofence (vùng cảng, neo đậu, rủi ro cao, mất phủ sóng)
+		api.GET("/geofences", controllers.GetGeofences)
+		api.POST("/geofences", controllers.CreateGeofence)
+		api.PUT("/geofences/:id", controllers.UpdateGeofence)
+		api.DELETE("/geofences/:id", controllers.DeleteGeofence)
+		api.GET("/geofence-events", controllers.GetGeofenceEvents)
+		api.GET("/ships/:ship_id/geofences", controllers.GetShipGeofences) // Vùng tàu đang ở trong
+		// Realtime Dashboard (Server-Sent Events)
+		api.GET("/stream", middlewares.AuthRequired(), controllers.StreamEvents)
 	}
 
 	return r
@@ -0,0 +1,87 @@
+package terminals
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Modem VSAT kiểu iDirect / Hughes có API HTTP trả JSON trạng thái:
+// GET /api/v1/status -> {"rx_snr": 9.4, "rx_lock": true, "tx_state": "up", "latency_ms": 610, "satellite": "...", "beam": "..."}
+const idirectPath = "/api/v1/status"
+
+type idirectAdapter struct {
+	cfg Config
+}
+
+type idirectStatus struct {
+	RxSNR     *float64 `json:"rx_snr"`
+	RxLock    *bool    `json:"rx_lock"`
+	TxState   string   `json:"tx_state"` // up / down / muted
+	LatencyMs *float64 `json:"latency_ms"`
+	Satellite string   `json:"satellite"`
+	Beam      string   `json:"beam"`
+}
+
+func (a *idirectAdapter) Name() string { return "idirect" }
+
+func (a *idirectAdapter) Status(ctx context.Context) (Status, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL(a.cfg.Addr)+idirectPath, nil)
+	if err != nil {
+		return Status{}, err
+	}
+	if a.cfg.Secret != "" {
+		req.Header.Set("Authorization", "Bearer "+a.cfg.Secret)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Status{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Status{}, fmt.Errorf("modem trả về HTTP %d", resp.StatusCode)
+	}
+
+	var data idirectStatus
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&data); err != nil {
+		return Status{}, fmt.Errorf("JSON không hợp lệ: %v", err)
+	}
+	return Status{
+		SNR: data.RxSNR, ModemLock: data.RxLock, LatencyMs: data.LatencyMs,
+		UplinkState: data.TxState, Satellite: data.Satellite, Beam: data.Beam,
+	}, nil
+}
+
+// --- STUB SERVER ---
+
+// Giả lập modem VSAT: SNR dao động, thỉnh thoảng mất khóa (mưa / chuyển beam)
+func IDirectStubHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(idirectPath, func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		t := float64(time.Now().Unix())
+		snr := math.Round((9+3*math.Sin(t/180))*10) / 10
+		locked := math.Sin(t/50) < 0.95
+		tx := "up"
+		if !locked {
+			tx, snr = "muted", 0
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(idirectStatus{
+			RxSNR: &snr, RxLock: &locked, TxState: tx,
+			LatencyMs: floatPtr(math.Round(600 + 40*math.Sin(t/30))),
+			Satellite: "Intelsat 39", Beam: "IS39-Ku-07",
+		})
+	})
+	return mux
+}
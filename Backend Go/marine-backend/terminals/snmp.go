@@ -0,0 +1,363 @@
+package terminals
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Modem đọc qua SNMP v2c (GET). OID khác nhau theo MIB từng hãng nên cấu hình qua biến môi trường;
+// mặc định trỏ tới nhánh 1.3.6.1.4.1.99999.1 mà stub phục vụ.
+type snmpOIDs struct {
+	SNR     string // INTEGER: SNR x10 (dB)
+	Lock    string // INTEGER: 1 = đã khóa tín hiệu
+	Tx      string // INTEGER: 1 = up, 2 = down, 3 = muted
+	Latency string // INTEGER: ms
+}
+
+func currentSNMPOIDs() snmpOIDs {
+	get := func(key, def string) string {
+		if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+			return strings.TrimPrefix(v, ".")
+		}
+		return def
+	}
+	return snmpOIDs{
+		SNR:     get("SNMP_OID_SNR", "1.3.6.1.4.1.99999.1.1.0"),
+		Lock:    get("SNMP_OID_LOCK", "1.3.6.1.4.1.99999.1.2.0"),
+		Tx:      get("SNMP_OID_TX", "1.3.6.1.4.1.99999.1.3.0"),
+		Latency: get("SNMP_OID_LATENCY", "1.3.6.1.4.1.99999.1.4.0"),
+	}
+}
+
+var snmpTxStates = map[int64]string{1: "up", 2: "down", 3: "muted"}
+
+type snmpAdapter struct {
+	cfg Config
+}
+
+func (a *snmpAdapter) Name() string { return "snmp" }
+
+func (a *snmpAdapter) Status(ctx context.Context) (Status, error) {
+	addr := a.cfg.Addr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "161")
+	}
+	oids := currentSNMPOIDs()
+	values, err := snmpGet(ctx, addr, a.cfg.Secret, a.cfg.Timeout, []string{oids.SNR, oids.Lock, oids.Tx, oids.Latency})
+	if err != nil {
+		return Status{}, err
+	}
+
+	var st Status
+	if v, ok := values[oids.SNR]; ok {
+		st.SNR = floatPtr(float64(v) / 10)
+	}
+	if v, ok := values[oids.Lock]; ok {
+		st.ModemLock = boolPtr(v == 1)
+	}
+	if v, ok := values[oids.Tx]; ok {
+		st.UplinkState = snmpTxStates[v]
+	}
+	if v, ok := values[oids.Latency]; ok {
+		st.LatencyMs = floatPtr(float64(v))
+	}
+	return st, nil
+}
+
+// SNMP v2c GET: trả về giá trị số của các OID có mặt trong phản hồi
+func snmpGet(ctx context.Context, addr, community string, timeout time.Duration, oids []string) (map[string]int64, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var idBuf [4]byte
+	rand.Read(idBuf[:])
+	requestID := int64(binary.BigEndian.Uint32(idBuf[:]) & 0x7fffffff)
+
+	packet, err := encodeSNMP(community, berGetRequest, requestID, oids, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(packet); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("modem không phản hồi SNMP: %v", err)
+	}
+	msg, err := decodeSNMP(buf[:n])
+	if err != nil {
+		return nil, err
+	}
+	if msg.requestID != requestID {
+		return nil, fmt.Errorf("request-id không khớp")
+	}
+	if msg.errorStatus != 0 {
+		return nil, fmt.Errorf("SNMP error-status %d", msg.errorStatus)
+	}
+	return msg.values, nil
+}
+
+// --- BER (chỉ phần cần cho GET / RESPONSE) ---
+
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+	berCounter32   = 0x41
+	berGauge32     = 0x42
+	berTimeTicks   = 0x43
+	berCounter64   = 0x46
+	berGetRequest  = 0xa0
+	berGetResponse = 0xa2
+)
+
+func berTLV(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	switch l := len(value); {
+	case l < 0x80:
+		out = append(out, byte(l))
+	case l <= 0xff:
+		out = append(out, 0x81, byte(l))
+	default:
+		out = append(out, 0x82, byte(l>>8), byte(l))
+	}
+	return append(out, value...)
+}
+
+func berInt(v int64) []byte {
+	b := []byte{byte(v)}
+	for v > 127 || v < -128 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return b
+}
+
+func berEncodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("OID không hợp lệ: %s", oid)
+	}
+	nums := make([]uint64, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("OID không hợp lệ: %s", oid)
+		}
+		nums[i] = n
+	}
+	out := []byte{byte(nums[0]*40 + nums[1])}
+	for _, n := range nums[2:] {
+		chunk := []byte{byte(n & 0x7f)}
+		for n >>= 7; n > 0; n >>= 7 {
+			chunk = append([]byte{byte(n&0x7f) | 0x80}, chunk...)
+		}
+		out = append(out, chunk...)
+	}
+	return out, nil
+}
+
+func berDecodeOID(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	parts := []string{strconv.Itoa(int(b[0]) / 40), strconv.Itoa(int(b[0]) % 40)}
+	var n uint64
+	for _, c := range b[1:] {
+		n = n<<7 | uint64(c&0x7f)
+		if c&0x80 == 0 {
+			parts = append(parts, strconv.FormatUint(n, 10))
+			n = 0
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// Đọc 1 TLV, trả về tag, giá trị và phần còn lại
+func berRead(b []byte) (byte, []byte, []byte, error) {
+	if len(b) < 2 {
+		return 0, nil, nil, fmt.Errorf("gói SNMP bị cắt")
+	}
+	tag, l := b[0], int(b[1])
+	b = b[2:]
+	if l&0x80 != 0 {
+		size := l & 0x7f
+		if size == 0 || size > 2 || len(b) < size {
+			return 0, nil, nil, fmt.Errorf("độ dài BER không hỗ trợ")
+		}
+		l = 0
+		for _, c := range b[:size] {
+			l = l<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if len(b) < l {
+		return 0, nil, nil, fmt.Errorf("gói SNMP bị cắt")
+	}
+	return tag, b[:l], b[l:], nil
+}
+
+func berParseInt(b []byte, signed bool) int64 {
+	var v int64
+	for i, c := range b {
+		if i == 0 && signed && c&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+type snmpMessage struct {
+	community   string
+	pduType     byte
+	requestID   int64
+	errorStatus int64
+	oids        []string
+	values      map[string]int64
+}
+
+// values == nil -> giá trị NULL (dùng cho GET)
+func encodeSNMP(community string, pduType byte, requestID int64, oids []string, values map[string]int64) ([]byte, error) {
+	var binds []byte
+	for _, oid := range oids {
+		enc, err := berEncodeOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		value := berTLV(berNull, nil)
+		if v, ok := values[oid]; ok {
+			value = berTLV(berInteger, berInt(v))
+		} else if values != nil {
+			value = berTLV(0x80, nil) // noSuchObject
+		}
+		binds = append(binds, berTLV(berSequence, append(berTLV(berOID, enc), value...))...)
+	}
+	pdu := append(berTLV(berInteger, berInt(requestID)), berTLV(berInteger, []byte{0})...)
+	pdu = append(pdu, berTLV(berInteger, []byte{0})...)
+	pdu = append(pdu, berTLV(berSequence, binds)...)
+
+	msg := append(berTLV(berInteger, []byte{1}), berTLV(berOctetString, []byte(community))...) // version 1 = v2c
+	msg = append(msg, berTLV(pduType, pdu)...)
+	return berTLV(berSequence, msg), nil
+}
+
+func decodeSNMP(packet []byte) (snmpMessage, error) {
+	msg := snmpMessage{values: make(map[string]int64)}
+	tag, body, _, err := berRead(packet)
+	if err != nil || tag != berSequence {
+		return msg, fmt.Errorf("gói SNMP không hợp lệ")
+	}
+	if _, _, body, err = berRead(body); err != nil { // version
+		return msg, err
+	}
+	var community []byte
+	if _, community, body, err = berRead(body); err != nil {
+		return msg, err
+	}
+	msg.community = string(community)
+
+	var pdu []byte
+	if msg.pduType, pdu, _, err = berRead(body); err != nil {
+		return msg, err
+	}
+	var field []byte
+	if _, field, pdu, err = berRead(pdu); err != nil {
+		return msg, err
+	}
+	msg.requestID = berParseInt(field, true)
+	if _, field, pdu, err = berRead(pdu); err != nil {
+		return msg, err
+	}
+	msg.errorStatus = berParseInt(field, true)
+	if _, _, pdu, err = berRead(pdu); err != nil { // error-index
+		return msg, err
+	}
+	var binds []byte
+	if _, binds, _, err = berRead(pdu); err != nil {
+		return msg, err
+	}
+
+	for len(binds) > 0 {
+		var bind, oid, value []byte
+		var vtag byte
+		if _, bind, binds, err = berRead(binds); err != nil {
+			return msg, err
+		}
+		if _, oid, bind, err = berRead(bind); err != nil {
+			return msg, err
+		}
+		if vtag, value, _, err = berRead(bind); err != nil {
+			return msg, err
+		}
+		name := berDecodeOID(oid)
+		msg.oids = append(msg.oids, name)
+		switch vtag {
+		case berInteger:
+			msg.values[name] = berParseInt(value, true)
+		case berCounter32, berGauge32, berTimeTicks, berCounter64:
+			msg.values[name] = berParseInt(value, false)
+		case berOctetString:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(string(value)), 64); err == nil {
+				msg.values[name] = int64(math.Round(f))
+			}
+		}
+	}
+	return msg, nil
+}
+
+// --- STUB SERVER ---
+
+// Giả lập modem SNMP v2c trên UDP (chỉ trả lời GET với đúng community)
+func ServeSNMPStub(addr, community string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	oids := currentSNMPOIDs()
+	buf := make([]byte, 65535)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		req, err := decodeSNMP(buf[:n])
+		if err != nil || req.pduType != berGetRequest || req.community != community {
+			continue // SNMP v2c: sai community thì im lặng
+		}
+
+		t := float64(time.Now().Unix())
+		snr := int64(math.Round((8 + 3*math.Sin(t/200)) * 10))
+		lock, tx := int64(1), int64(1)
+		if math.Sin(t/70) > 0.95 {
+			lock, tx, snr = 0, 3, 0
+		}
+		values := map[string]int64{
+			oids.SNR: snr, oids.Lock: lock, oids.Tx: tx,
+			oids.Latency: int64(math.Round(620 + 50*math.Sin(t/40))),
+		}
+		resp, err := encodeSNMP(community, berGetResponse, req.requestID, req.oids, values)
+		if err == nil {
+			conn.WriteTo(resp, peer)
+		}
+	}
+}
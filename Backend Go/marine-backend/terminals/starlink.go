@@ -0,0 +1,304 @@
+package terminals
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Starlink dish: gọi SpaceX.API.Device.Device/Handle{get_status} qua gRPC-Web (cổng 9201),
+// giải mã protobuf trực tiếp theo số hiệu trường để không phụ thuộc file .proto.
+const starlinkPath = "/SpaceX.API.Device.Device/Handle"
+
+// Số hiệu trường trong device.proto
+const (
+	slRequestGetStatus      = 1004 // Request.get_status
+	slResponseDishGetStatus = 2004 // Response.dish_get_status
+
+	slDishSNR              = 1001 // float (cũ, nhiều firmware trả 0)
+	slDishPopPingDropRate  = 1003 // float 0..1
+	slDishObstructionStats = 1004 // DishObstructionStats
+	slDishDownlinkBps      = 1007 // float
+	slDishUplinkBps        = 1008 // float
+	slDishPopPingLatencyMs = 1009 // float
+	slDishSNRAboveNoise    = 1018 // bool
+	slObstructionFraction  = 1    // DishObstructionStats.fraction_obstructed
+	slObstructionCurrently = 5    // DishObstructionStats.currently_obstructed
+)
+
+type starlinkAdapter struct {
+	cfg Config
+}
+
+func (a *starlinkAdapter) Name() string { return "starlink" }
+
+func (a *starlinkAdapter) Status(ctx context.Context) (Status, error) {
+	// Request{get_status: GetStatusRequest{}}
+	msg := protowire.AppendTag(nil, slRequestGetStatus, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, nil)
+
+	ctx, cancel := context.WithTimeout(ctx, a.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL(a.cfg.Addr)+starlinkPath, bytes.NewReader(grpcWebFrame(0, msg)))
+	if err != nil {
+		return Status{}, err
+	}
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("X-Grpc-Web", "1")
+	if a.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.cfg.APIKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Status{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Status{}, fmt.Errorf("dish trả về HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Status{}, err
+	}
+
+	payload, err := readGRPCWeb(body, resp.Header.Get("grpc-status"))
+	if err != nil {
+		return Status{}, err
+	}
+	dish, ok := protoBytesField(payload, slResponseDishGetStatus)
+	if !ok {
+		return Status{}, fmt.Errorf("phản hồi không có dish_get_status")
+	}
+	return parseDishStatus(dish)
+}
+
+func parseDishStatus(b []byte) (Status, error) {
+	st := Status{Satellite: "Starlink"}
+	var dropRate float64
+	var obstructed bool
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return st, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case typ == protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(b)
+			if n < 0 {
+				return st, protowire.ParseError(n)
+			}
+			b = b[n:]
+			f := float64(math.Float32frombits(v))
+			switch num {
+			case slDishSNR:
+				if f > 0 {
+					st.SNR = floatPtr(math.Round(f*10) / 10)
+				}
+			case slDishPopPingDropRate:
+				dropRate = f
+			case slDishPopPingLatencyMs:
+				st.LatencyMs = floatPtr(math.Round(f*10) / 10)
+			}
+		case typ == protowire.VarintType && num == slDishSNRAboveNoise:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return st, protowire.ParseError(n)
+			}
+			b = b[n:]
+			st.ModemLock = boolPtr(v != 0)
+		case typ == protowire.BytesType && num == slDishObstructionStats:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return st, protowire.ParseError(n)
+			}
+			b = b[n:]
+			fraction, currently := parseObstruction(v)
+			st.ObstructionPct = floatPtr(math.Round(fraction*1000) / 10)
+			obstructed = currently
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return st, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+
+	switch {
+	case obstructed:
+		st.UplinkState = "obstructed"
+	case dropRate >= 1:
+		st.UplinkState = "down"
+	default:
+		st.UplinkState = "up"
+	}
+	return st, nil
+}
+
+func parseObstruction(b []byte) (float64, bool) {
+	var fraction float64
+	var currently bool
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			break
+		}
+		b = b[n:]
+		switch {
+		case num == slObstructionFraction && typ == protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(b)
+			if n < 0 {
+				return fraction, currently
+			}
+			fraction = float64(math.Float32frombits(v))
+			b = b[n:]
+		case num == slObstructionCurrently && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return fraction, currently
+			}
+			currently = v != 0
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return fraction, currently
+			}
+			b = b[n:]
+		}
+	}
+	return fraction, currently
+}
+
+// Tìm trường bytes đầu tiên có số hiệu num
+func protoBytesField(b []byte, want protowire.Number) ([]byte, bool) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, false
+		}
+		b = b[n:]
+		if num == want && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			return v, n >= 0
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, false
+		}
+		b = b[n:]
+	}
+	return nil, false
+}
+
+// Khung gRPC-Web: 1 byte cờ (0x00 dữ liệu, 0x80 trailer) + 4 byte độ dài big-endian
+func grpcWebFrame(flag byte, data []byte) []byte {
+	out := make([]byte, 5, 5+len(data))
+	out[0] = flag
+	binary.BigEndian.PutUint32(out[1:], uint32(len(data)))
+	return append(out, data...)
+}
+
+// Lấy message dữ liệu đầu tiên, kiểm tra grpc-status trong header hoặc trailer
+func readGRPCWeb(body []byte, headerStatus string) ([]byte, error) {
+	if headerStatus != "" && headerStatus != "0" {
+		return nil, fmt.Errorf("grpc-status %s", headerStatus)
+	}
+	var payload []byte
+	for len(body) >= 5 {
+		flag := body[0]
+		size := int(binary.BigEndian.Uint32(body[1:5]))
+		if len(body) < 5+size {
+			return nil, fmt.Errorf("khung gRPC-Web bị cắt")
+		}
+		data := body[5 : 5+size]
+		body = body[5+size:]
+		if flag&0x80 != 0 {
+			for _, line := range strings.Split(string(data), "\r\n") {
+				k, v, _ := strings.Cut(line, ":")
+				if strings.EqualFold(strings.TrimSpace(k), "grpc-status") && strings.TrimSpace(v) != "0" {
+					return nil, fmt.Errorf("grpc-status %s", strings.TrimSpace(v))
+				}
+			}
+			continue
+		}
+		if payload == nil {
+			payload = data
+		}
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("không có dữ liệu trong phản hồi")
+	}
+	return payload, nil
+}
+
+// --- STUB SERVER ---
+
+// Giả lập dish Starlink (gRPC-Web): độ trễ, vật cản và tốc độ dao động theo thời gian
+func StarlinkStubHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(starlinkPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req, err := readGRPCWeb(body, "")
+		if _, ok := protoBytesField(req, slRequestGetStatus); err != nil || !ok {
+			writeGRPCWeb(w, nil, "12", "chỉ hỗ trợ get_status") // UNIMPLEMENTED
+			return
+		}
+
+		t := float64(time.Now().Unix())
+		fraction := 0.02 + 0.02*math.Sin(t/300)
+		obstructed := math.Sin(t/45) > 0.97 // Thỉnh thoảng bị che khuất vài giây
+
+		var obs []byte
+		obs = protowire.AppendTag(obs, slObstructionFraction, protowire.Fixed32Type)
+		obs = protowire.AppendFixed32(obs, math.Float32bits(float32(fraction)))
+		obs = protowire.AppendTag(obs, slObstructionCurrently, protowire.VarintType)
+		obs = protowire.AppendVarint(obs, protowire.EncodeBool(obstructed))
+
+		dropRate := 0.0
+		if obstructed {
+			dropRate = 0.6
+		}
+		var dish []byte
+		appendFloat := func(num protowire.Number, v float64) {
+			dish = protowire.AppendTag(dish, num, protowire.Fixed32Type)
+			dish = protowire.AppendFixed32(dish, math.Float32bits(float32(v)))
+		}
+		appendFloat(slDishPopPingDropRate, dropRate)
+		appendFloat(slDishPopPingLatencyMs, 35+10*math.Sin(t/60))
+		appendFloat(slDishDownlinkBps, 80e6+30e6*math.Sin(t/120))
+		appendFloat(slDishUplinkBps, 12e6+4e6*math.Sin(t/90))
+		dish = protowire.AppendTag(dish, slDishObstructionStats, protowire.BytesType)
+		dish = protowire.AppendBytes(dish, obs)
+		dish = protowire.AppendTag(dish, slDishSNRAboveNoise, protowire.VarintType)
+		dish = protowire.AppendVarint(dish, protowire.EncodeBool(!obstructed))
+
+		resp := protowire.AppendTag(nil, slResponseDishGetStatus, protowire.BytesType)
+		resp = protowire.AppendBytes(resp, dish)
+		writeGRPCWeb(w, resp, "0", "")
+	})
+	return mux
+}
+
+func writeGRPCWeb(w http.ResponseWriter, msg []byte, status, message string) {
+	w.Header().Set("Content-Type", "application/grpc-web+proto")
+	w.WriteHeader(http.StatusOK)
+	if msg != nil {
+		w.Write(grpcWebFrame(0, msg))
+	}
+	w.Write(grpcWebFrame(0x80, []byte("grpc-status:"+status+"\r\ngrpc-message:"+message+"\r\n")))
+}
@@ -0,0 +1,78 @@
+// Package terminals đọc trạng thái thiết bị vệ tinh trên tàu (Starlink, modem VSAT iDirect/Hughes)
+// qua các adapter dùng chung 1 interface, kèm stub server để thử nghiệm không cần thiết bị thật.
+package terminals
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Trạng thái đọc được từ thiết bị (nil = thiết bị không cung cấp chỉ số đó)
+type Status struct {
+	SNR            *float64 `json:"snr"`
+	ModemLock      *bool    `json:"modem_lock"`
+	LatencyMs      *float64 `json:"latency_ms"`
+	ObstructionPct *float64 `json:"obstruction_pct"`
+	UplinkState    string   `json:"uplink_state"` // up / down / obstructed / muted
+	Satellite      string   `json:"satellite"`
+	Beam           string   `json:"beam"`
+}
+
+// Adapter cho 1 loại thiết bị
+type Adapter interface {
+	Name() string
+	Status(ctx context.Context) (Status, error)
+}
+
+// Cấu hình kết nối tới thiết bị của 1 tàu
+type Config struct {
+	Type    string // starlink / idirect / snmp
+	Addr    string // host:port hoặc URL
+	Secret  string // Token HTTP hoặc SNMP community
+	APIKey  string // Starlink API key (SystemConfig.StarlinkApiKey)
+	Timeout time.Duration
+}
+
+// Các loại adapter hỗ trợ
+var Types = []string{"starlink", "idirect", "snmp"}
+
+// Tạo adapter theo loại thiết bị
+func New(cfg Config) (Adapter, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	switch strings.ToLower(cfg.Type) {
+	case "starlink":
+		if cfg.Addr == "" {
+			cfg.Addr = "192.168.100.1:9201" // Cổng gRPC-Web mặc định của dish
+		}
+		return &starlinkAdapter{cfg: cfg}, nil
+	case "idirect":
+		if cfg.Addr == "" {
+			return nil, fmt.Errorf("thiếu địa chỉ modem")
+		}
+		return &idirectAdapter{cfg: cfg}, nil
+	case "snmp":
+		if cfg.Addr == "" {
+			return nil, fmt.Errorf("thiếu địa chỉ modem")
+		}
+		if cfg.Secret == "" {
+			cfg.Secret = "public"
+		}
+		return &snmpAdapter{cfg: cfg}, nil
+	}
+	return nil, fmt.Errorf("loại thiết bị không hỗ trợ: %s", cfg.Type)
+}
+
+func floatPtr(v float64) *float64 { return &v }
+func boolPtr(v bool) *bool        { return &v }
+
+// Thêm http:// nếu cấu hình chỉ có host:port
+func baseURL(addr string) string {
+	if strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
+		return strings.TrimRight(addr, "/")
+	}
+	return "http://" + addr
+}
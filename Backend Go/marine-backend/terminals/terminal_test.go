@@ -0,0 +1,131 @@
+package terminals
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Chạy stub SNMP trên 1 cổng UDP trống của máy, trả về host:port
+func startSNMPStub(t *testing.T, community string) string {
+	t.Helper()
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.LocalAddr().String()
+	probe.Close()
+	go ServeSNMPStub(addr, community)
+	time.Sleep(50 * time.Millisecond)
+	return addr
+}
+
+func between(name string, v *float64, lo, hi float64) error {
+	if v == nil {
+		return fmt.Errorf("%s = nil", name)
+	}
+	if *v < lo || *v > hi {
+		return fmt.Errorf("%s = %v, ngoài khoảng [%v, %v]", name, *v, lo, hi)
+	}
+	return nil
+}
+
+func TestAdaptersAgainstStub(t *testing.T) {
+	starlink := httptest.NewServer(StarlinkStubHandler())
+	defer starlink.Close()
+	idirect := httptest.NewServer(IDirectStubHandler("modem-token"))
+	defer idirect.Close()
+	unimplemented := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeGRPCWeb(w, nil, "12", "unimplemented")
+	}))
+	defer unimplemented.Close()
+	snmp := startSNMPStub(t, "public")
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+		check   func(Status) error
+	}{
+		{"Starlink gRPC-Web", Config{Type: "starlink", Addr: starlink.URL, APIKey: "key"}, false, func(st Status) error {
+			if st.Satellite != "Starlink" || st.ModemLock == nil {
+				return fmt.Errorf("satellite %q, modem_lock %v", st.Satellite, st.ModemLock)
+			}
+			if st.UplinkState != "up" && st.UplinkState != "obstructed" {
+				return fmt.Errorf("uplink_state = %q", st.UplinkState)
+			}
+			if err := between("latency_ms", st.LatencyMs, 25, 45); err != nil {
+				return err
+			}
+			return between("obstruction_pct", st.ObstructionPct, 0, 4)
+		}},
+		{"Starlink trả grpc-status lỗi", Config{Type: "starlink", Addr: unimplemented.URL}, true, nil},
+		{"iDirect đúng token", Config{Type: "idirect", Addr: idirect.URL, Secret: "modem-token"}, false, func(st Status) error {
+			if st.Satellite != "Intelsat 39" || st.Beam != "IS39-Ku-07" || st.ModemLock == nil {
+				return fmt.Errorf("satellite %q, beam %q, modem_lock %v", st.Satellite, st.Beam, st.ModemLock)
+			}
+			if *st.ModemLock {
+				return between("snr", st.SNR, 6, 12)
+			}
+			return nil
+		}},
+		{"iDirect sai token", Config{Type: "idirect", Addr: idirect.URL, Secret: "sai"}, true, nil},
+		{"SNMP đúng community", Config{Type: "snmp", Addr: snmp, Secret: "public", Timeout: time.Second}, false, func(st Status) error {
+			if st.ModemLock == nil || (st.UplinkState != "up" && st.UplinkState != "muted") {
+				return fmt.Errorf("modem_lock %v, uplink_state %q", st.ModemLock, st.UplinkState)
+			}
+			if err := between("latency_ms", st.LatencyMs, 570, 670); err != nil {
+				return err
+			}
+			if *st.ModemLock {
+				return between("snr", st.SNR, 5, 11)
+			}
+			return nil
+		}},
+		{"SNMP sai community (stub im lặng)", Config{Type: "snmp", Addr: snmp, Secret: "private", Timeout: 300 * time.Millisecond}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter, err := New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if adapter.Name() != tt.cfg.Type {
+				t.Errorf("Name() = %s, want %s", adapter.Name(), tt.cfg.Type)
+			}
+			st, err := adapter.Status(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Status() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				if err := tt.check(st); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewAdapter(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"Starlink dùng địa chỉ mặc định", Config{Type: "Starlink"}, false},
+		{"iDirect thiếu địa chỉ", Config{Type: "idirect"}, true},
+		{"SNMP thiếu địa chỉ", Config{Type: "snmp"}, true},
+		{"loại không hỗ trợ", Config{Type: "hughes", Addr: "10.0.0.1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -24,9 +24,26 @@ export const useBandwidthStore = defineStore('bandwidth', {
                 return false;
             }
         },
+        async updatePlan(id, data) {
+            try {
+                await axios.put(`http://localhost:8080/api/bandwidth-plans/${id}`, data);
+                this.fetchPlans();
+                return true;
+            } catch (e) {
+                alert(e.response?.data?.error || e.message);
+                return false;
+            }
+        },
+        async redeployPlan(id) {
+            await axios.post(`http://localhost:8080/api/bandwidth-plans/${id}/deploy`);
+        },
         async deletePlan(id) {
             if(!confirm("Xóa gói này?")) return;
-            await axios.delete(`http://localhost:8080/api/bandwidth-plans/${id}`);
+            try {
+                await axios.delete(`http://localhost:8080/api/bandwidth-plans/${id}`);
+            } catch (e) {
+                alert(e.response?.data?.error || e.message);
+            }
             this.fetchPlans();
         }
     }
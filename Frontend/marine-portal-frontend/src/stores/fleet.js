@@ -5,6 +5,7 @@ export const useFleetStore = defineStore('fleet', {
     state: () => ({
         ships: [],
         loading: false,
+        stream: null,
         filterText: ''
     }),
     
@@ -13,7 +14,7 @@ export const useFleetStore = defineStore('fleet', {
             const total = state.ships.length;
             const online = state.ships.filter(s => s.status === 'Online').length;
             const offline = state.ships.filter(s => s.status === 'Offline').length;
-            const warning = state.ships.filter(s => s.status === 'Warning' || s.status === 'Blockage').length;
+            const warning = state.ships.filter(s => s.status === 'Warning' || s.status === 'Degraded' || s.status === 'Blockage').length;
             const health = total > 0 ? ((online + (warning * 0.5)) / total * 100).toFixed(1) : 0;
 
             return [
@@ -49,6 +50,27 @@ export const useFleetStore = defineStore('fleet', {
             }
         },
 
+        // Nhận cập nhật realtime (SSE) thay vì polling
+        connectStream() {
+            const token = localStorage.getItem('token');
+            if (this.stream || !token) return;
+            this.stream = new EventSource(`http://localhost:8080/api/stream?token=${encodeURIComponent(token)}`);
+            this.stream.addEventListener('snapshot', (e) => {
+                this.ships = JSON.parse(e.data).ships || [];
+            });
+            this.stream.addEventListener('ship', (e) => {
+                const ship = JSON.parse(e.data).data;
+                const idx = this.ships.findIndex(s => s.id === ship.id);
+                if (idx >= 0) this.ships.splice(idx, 1, { ...this.ships[idx], ...ship });
+                else this.ships.unshift(ship);
+            });
+        },
+
+        disconnectStream() {
+            if (this.stream) this.stream.close();
+            this.stream = null;
+        },
+
         async addShip(newShipData) {
             try {
                 const response = await axios.post('http://localhost:8080/api/ships', newShipData);